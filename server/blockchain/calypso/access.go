@@ -0,0 +1,226 @@
+package calypso
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/store/prefixed"
+	"golang.org/x/xerrors"
+)
+
+// Revocation describes why and when the access of a reader was revoked.
+type Revocation struct {
+	// Reason is the reason given by the owner of the secret.
+	Reason string `json:"reason"`
+
+	// Height is the index of the block of the revocation.
+	Height uint64 `json:"height"`
+
+	// Identity is the identity that revoked the access.
+	Identity string `json:"identity"`
+}
+
+// revokeAccess implements commands. It performs the REVOKE_ACCESS command. Only
+// the owner of the secret is allowed to revoke the access of a reader to the
+// secret. The reader can't reveal it anymore, even after the secret is updated
+// or migrated, and the SMC refuses to re-encrypt it.
+func (c calypsoCommand) revokeAccess(snap store.Snapshot, step execution.Step) error {
+	smcKey := step.Current.GetArg(SmcPublicKeyArg)
+	if len(smcKey) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SmcPublicKeyArg)
+	}
+
+	name := step.Current.GetArg(SecretNameArg)
+	if len(name) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SecretNameArg)
+	}
+
+	pubKey := step.Current.GetArg(PubKeyArg)
+	if len(pubKey) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, PubKeyArg)
+	}
+
+	reason := step.Current.GetArg(ReasonArg)
+	if len(reason) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, ReasonArg)
+	}
+
+	err := checkSmcSecret(snap, smcKey, name)
+	if err != nil {
+		return err
+	}
+
+	err = checkSecretOwner(snap, name, step.Current.GetIdentity())
+	if err != nil {
+		return err
+	}
+
+	secret, err := getSecret(snap, name)
+	if err != nil {
+		return xerrors.Errorf("failed to get secret '%s': %v", name, err)
+	}
+
+	revocations, err := getRevocations(snap, name)
+	if err != nil {
+		return err
+	}
+
+	_, found := revocations[string(pubKey)]
+	if found {
+		return xerrors.Errorf("access of '%s' to '%s' is already revoked", pubKey, name)
+	}
+
+	accessToken := computeAccessToken(smcKey, secret, pubKey)
+
+	record, err := getSecretAccess(snap, accessToken)
+	if err != nil {
+		return err
+	}
+
+	entry, err := c.newAuditEntry(snap, step, AuditRevoke, accessToken, pubKey)
+	if err != nil {
+		return xerrors.Errorf("failed to create audit entry: %v", err)
+	}
+
+	entry.Reason = string(reason)
+
+	revocation := Revocation{
+		Reason:   entry.Reason,
+		Height:   entry.Height,
+		Identity: entry.Identity,
+	}
+
+	revocations[string(pubKey)] = revocation
+
+	err = setRevocations(snap, name, revocations)
+	if err != nil {
+		return xerrors.Errorf("failed to persist revocation: %v", err)
+	}
+
+	// the access record of the current value is revoked as well, so that the
+	// token is refused by the SMC
+	if record != nil {
+		record.Revoked = &revocation
+
+		err = setSecretAccess(snap, accessToken, *record)
+		if err != nil {
+			return xerrors.Errorf("failed to persist revocation: %v", err)
+		}
+	}
+
+	err = insertAuditLog(snap, name, entry)
+	if err != nil {
+		return xerrors.Errorf("failed to persist secret audit log: %v", err)
+	}
+
+	dela.Logger.Info().
+		Str("contract", ContractName).
+		Msgf("revoked access of %s to secret %x", pubKey, name)
+
+	return nil
+}
+
+// GetAccess returns the access record of the access token, or nil if it is
+// unknown.
+func GetAccess(snap store.Readable, accessToken []byte) (*SecretAccess, error) {
+	return getSecretAccess(snap, accessToken)
+}
+
+// GetRevocation returns the revocation of the access of the reader to the
+// secret, or nil if it is not revoked.
+func GetRevocation(snap store.Readable, name, pubKey []byte) (*Revocation, error) {
+	revocations, err := getRevocations(snap, name)
+	if err != nil {
+		return nil, err
+	}
+
+	revocation, found := revocations[string(pubKey)]
+	if !found {
+		return nil, nil
+	}
+
+	return &revocation, nil
+}
+
+//
+// Utility functions
+//
+
+// checkRevocation returns nil if the access of the reader to the secret is not
+// revoked.
+func checkRevocation(snap store.Readable, name, pubKey []byte) error {
+	revocation, err := GetRevocation(snap, name, pubKey)
+	if err != nil {
+		return xerrors.Errorf("failed to check revocation: %v", err)
+	}
+
+	if revocation != nil {
+		return xerrors.Errorf("access revoked for '%s': %s",
+			pubKey, revocation.Reason)
+	}
+
+	return nil
+}
+
+// checkRevealNonce returns nil if the nonce is empty or if it is the number of
+// reveals recorded for the access token.
+func checkRevealNonce(snap store.Readable, accessToken []byte, nonce []byte) error {
+	if len(nonce) == 0 {
+		return nil
+	}
+
+	value, err := strconv.ParseUint(string(nonce), 10, 64)
+	if err != nil {
+		return xerrors.Errorf("invalid '%s': %v", RevealNonceArg, err)
+	}
+
+	record, err := getSecretAccess(snap, accessToken)
+	if err != nil {
+		return xerrors.Errorf("failed to get access: %v", err)
+	}
+
+	expected := uint64(0)
+	if record != nil {
+		expected = record.Reveals
+	}
+
+	if value != expected {
+		return xerrors.Errorf("invalid reveal nonce %d, expected %d", value, expected)
+	}
+
+	return nil
+}
+
+func getRevocations(snap store.Readable, name []byte) (map[string]Revocation, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixRevocationKeys), name)
+	buf, err := snap.Get(k)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get revocations of '%s': %v", name, err)
+	}
+
+	revocations := map[string]Revocation{}
+
+	if len(buf) == 0 {
+		return revocations, nil
+	}
+
+	err = json.Unmarshal(buf, &revocations)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode revocations: %v", err)
+	}
+
+	return revocations, nil
+}
+
+func setRevocations(snap store.Snapshot, name []byte, revocations map[string]Revocation) error {
+	buf, err := json.Marshal(revocations)
+	if err != nil {
+		return xerrors.Errorf("failed to encode revocations: %v", err)
+	}
+
+	k := prefixed.NewPrefixedKey([]byte(PrefixRevocationKeys), name)
+	return snap.Set(k, buf)
+}
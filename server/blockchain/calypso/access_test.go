@@ -0,0 +1,167 @@
+package calypso
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestCommand_RevokeAccess(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	buf := &bytes.Buffer{}
+	contract.printer = buf
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	const (
+		smcKey = testSmcKey
+		name   = "my_secret"
+		reader = "my_pubkey"
+	)
+
+	err := cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		RosterArg, makeRoster(t, "node:12345"),
+		SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name,
+		SecretArg, makeSecret(t, smcKey, name, "my_value")))
+	require.NoError(t, err)
+
+	revoke := func(args ...string) error {
+		return cmd.revokeAccess(snap, makeStep(t, args...))
+	}
+
+	err = revoke(SecretNameArg, name, PubKeyArg, reader, ReasonArg, "left")
+	require.EqualError(t, err, "'calypso:smc_key' not found in tx arg")
+
+	err = revoke(SmcPublicKeyArg, smcKey, PubKeyArg, reader, ReasonArg, "left")
+	require.EqualError(t, err, "'calypso:secret_name' not found in tx arg")
+
+	err = revoke(SmcPublicKeyArg, smcKey, SecretNameArg, name, ReasonArg, "left")
+	require.EqualError(t, err, "'calypso:pub_key' not found in tx arg")
+
+	err = revoke(SmcPublicKeyArg, smcKey, SecretNameArg, name, PubKeyArg, reader)
+	require.EqualError(t, err, "'calypso:reason' not found in tx arg")
+
+	reveal := makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name,
+		PubKeyArg, reader)
+
+	err = cmd.revealSecret(snap, reveal)
+	require.NoError(t, err)
+
+	// only the owner can revoke
+	err = cmd.revokeAccess(snap, makeStepWithIdentity(t, bls.NewSigner().GetPublicKey(),
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name,
+		PubKeyArg, reader,
+		ReasonArg, "left"))
+	require.ErrorContains(t, err, "is not the owner of 'my_secret'")
+
+	setHeight(t, snap, 7)
+
+	err = revoke(SmcPublicKeyArg, smcKey, SecretNameArg, name, PubKeyArg, reader,
+		ReasonArg, "left the organisation")
+	require.NoError(t, err)
+
+	record, err := GetSecretAccess(snap, []byte(smcKey), []byte(name), []byte(reader))
+	require.NoError(t, err)
+	require.Equal(t, &Revocation{
+		Reason:   "left the organisation",
+		Height:   7,
+		Identity: "PK",
+	}, record.Revoked)
+
+	token := computeAccessToken([]byte(smcKey),
+		[]byte(makeSecret(t, smcKey, name, "my_value")), []byte(reader))
+
+	access, err := GetAccess(snap, token)
+	require.NoError(t, err)
+	require.Equal(t, record, access)
+
+	logs, err := getAuditLogs(snap, []byte(name))
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	require.Equal(t, AuditReveal, logs[0].Event)
+	require.Equal(t, AuditRevoke, logs[1].Event)
+	require.Equal(t, "left the organisation", logs[1].Reason)
+	require.Equal(t, token, logs[1].AccessToken)
+
+	// the revocation is not an access of the reader
+	accesses, total, err := ListReaderAccess(snap, []byte(reader), 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), total)
+	require.Equal(t, AuditReveal, accesses[0].Event)
+
+	err = cmd.listAuditLogs(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name))
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `"event":"revoke"`)
+	require.Contains(t, buf.String(), `"reason":"left the organisation"`)
+
+	err = cmd.revealSecret(snap, reveal)
+	require.EqualError(t, err,
+		"access revoked for 'my_pubkey': "+
+			"left the organisation")
+
+	err = revoke(SmcPublicKeyArg, smcKey, SecretNameArg, name, PubKeyArg, reader,
+		ReasonArg, "again")
+	require.EqualError(t, err, "access of 'my_pubkey' to 'my_secret' is already revoked")
+
+	// the revocation survives an update of the secret
+	err = cmd.updateSecret(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name,
+		SecretArg, makeSecret(t, smcKey, name, "my_value2")))
+	require.NoError(t, err)
+
+	err = cmd.revealSecret(snap, reveal)
+	require.EqualError(t, err,
+		"access revoked for 'my_pubkey': "+
+			"left the organisation")
+
+	// a reader can be revoked before it reveals the secret
+	err = revoke(SmcPublicKeyArg, smcKey, SecretNameArg, name, PubKeyArg, "other",
+		ReasonArg, "not trusted")
+	require.NoError(t, err)
+
+	revocation, err := GetRevocation(snap, []byte(name), []byte("other"))
+	require.NoError(t, err)
+	require.Equal(t, "not trusted", revocation.Reason)
+
+	err = cmd.revealSecret(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name,
+		PubKeyArg, "other"))
+	require.EqualError(t, err,
+		"access revoked for 'other': "+
+			"not trusted")
+
+	// the revocations are removed with the secret
+	err = deleteSecret(snap, []byte(name))
+	require.NoError(t, err)
+
+	revocation, err = GetRevocation(snap, []byte(name), []byte(reader))
+	require.NoError(t, err)
+	require.Nil(t, revocation)
+
+	err = cmd.revokeAccess(fake.NewBadSnapshot(), execution.Step{Current: makeTx(t,
+		SmcPublicKeyArg, smcKey, SecretNameArg, name, PubKeyArg, reader,
+		ReasonArg, "left")})
+	require.EqualError(t, err, fake.Err("failed to get SMC '"+smcKey+"'"))
+}
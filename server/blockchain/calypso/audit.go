@@ -0,0 +1,800 @@
+package calypso
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/store/prefixed"
+	"go.dedis.ch/dela/crypto"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"golang.org/x/xerrors"
+)
+
+// AuditEntryVersion is the version of the audit entries written by this
+// contract. It must be increased whenever the format of AuditEntry changes.
+const AuditEntryVersion = 1
+
+// Kinds of audit events.
+const (
+	// AuditReveal is the event of a secret revealed to a reader.
+	AuditReveal = "reveal"
+
+	// AuditRevoke is the event of the access of a reader being revoked.
+	AuditRevoke = "revoke"
+)
+
+// AuditEntry is the record of an event on the access to a secret.
+type AuditEntry struct {
+	// Version is the version of the format of the entry. It is zero for the
+	// reveals logged before the audit entries existed, which only have an
+	// access token and a reader.
+	Version uint32 `json:"version"`
+
+	// Event is the kind of event.
+	Event string `json:"event,omitempty"`
+
+	// AccessToken is H(SMC public key, secret, reader's public key).
+	AccessToken []byte `json:"access_token"`
+
+	// Reader is the public key the secret is revealed to.
+	Reader []byte `json:"reader"`
+
+	// Identity is the identity that signed the transaction.
+	Identity string `json:"identity"`
+
+	// TxID is the identifier of the transaction.
+	TxID []byte `json:"tx_id"`
+
+	// Height is the index of the block of the transaction.
+	Height uint64 `json:"height"`
+
+	// Purpose is the optional reason given by the reader.
+	Purpose string `json:"purpose,omitempty"`
+
+	// Reveal is the number of times the access token has been revealed,
+	// including this one. It is zero for the revocations.
+	Reveal uint64 `json:"reveal,omitempty"`
+
+	// Reason is the reason of a revocation.
+	Reason string `json:"reason,omitempty"`
+}
+
+// SecretAccess is the record of the reveals of a secret to a reader.
+type SecretAccess struct {
+	// Reader is the public key the secret is revealed to.
+	Reader []byte `json:"reader"`
+
+	// FirstSeen is the block index of the first reveal.
+	FirstSeen uint64 `json:"first_seen"`
+
+	// LastSeen is the block index of the latest reveal.
+	LastSeen uint64 `json:"last_seen"`
+
+	// Reveals is the number of reveals.
+	Reveals uint64 `json:"reveals"`
+
+	// Revoked is set once the access is revoked.
+	Revoked *Revocation `json:"revoked,omitempty"`
+}
+
+// ReaderAccess is the audit entry of a secret revealed to a reader.
+type ReaderAccess struct {
+	// Secret is the name of the revealed secret.
+	Secret []byte `json:"secret"`
+
+	AuditEntry
+}
+
+// auditRef references the audit entry of a secret. It is the value of the
+// index of the reveals of a reader.
+type auditRef struct {
+	Secret []byte `json:"secret"`
+	Index  uint64 `json:"index"`
+}
+
+// auditLogDomain separates the requests of an audit log from any other message
+// signed by the owner of a secret.
+const auditLogDomain = "calypso:audit_log"
+
+// AuditLogRequest is the request of the owner of a secret to read its audit
+// log. It is signed by the owner to prove that it holds the key of the
+// identity that created the secret, and carries a timestamp so that a
+// signature can't be used for long.
+type AuditLogRequest struct {
+	// Name is the name of the secret.
+	Name []byte
+
+	// Timestamp is the creation time of the request, in seconds since epoch.
+	Timestamp int64
+}
+
+// Message returns the message signed by the owner.
+func (r AuditLogRequest) Message() []byte {
+	h := sha256.New()
+	h.Write([]byte(auditLogDomain))
+
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(r.Name)))
+	h.Write(size)
+	h.Write(r.Name)
+
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(r.Timestamp))
+	h.Write(ts)
+
+	return h.Sum(nil)
+}
+
+// Sign returns the signature of the request by the owner.
+func (r AuditLogRequest) Sign(signer crypto.Signer) ([]byte, error) {
+	sig, err := signer.Sign(r.Message())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign: %v", err)
+	}
+
+	buf, err := sig.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal signature: %v", err)
+	}
+
+	return buf, nil
+}
+
+// Verify verifies the signature of the request by the owner of the secret, as
+// returned in its descriptor. Only the BLS identities are supported.
+func (r AuditLogRequest) Verify(owner string, sig []byte) error {
+	if !strings.HasPrefix(owner, "bls:") {
+		return xerrors.Errorf("unsupported owner identity '%s'", owner)
+	}
+
+	buf, err := hex.DecodeString(strings.TrimPrefix(owner, "bls:"))
+	if err != nil {
+		return xerrors.Errorf("invalid owner identity: %v", err)
+	}
+
+	pk, err := bls.NewPublicKey(buf)
+	if err != nil {
+		return xerrors.Errorf("invalid owner identity: %v", err)
+	}
+
+	err = pk.Verify(r.Message(), bls.NewSignature(sig))
+	if err != nil {
+		return xerrors.Errorf("invalid signature: %v", err)
+	}
+
+	return nil
+}
+
+// readerAccessDomain separates the requests of the accesses of a reader from
+// any other message signed by the reader.
+const readerAccessDomain = "calypso:reader_access"
+
+// ReaderAccessRequest is the request of a reader to list the secrets revealed
+// to it. It is signed with the private key of the reader, and carries a
+// timestamp so that a signature can't be used for long.
+type ReaderAccessRequest struct {
+	// Reader is the hex-encoded public key of the reader, as given when the
+	// secrets are revealed.
+	Reader []byte
+
+	// Timestamp is the creation time of the request, in seconds since epoch.
+	Timestamp int64
+}
+
+// Message returns the message signed by the reader.
+func (r ReaderAccessRequest) Message() []byte {
+	h := sha256.New()
+	h.Write([]byte(readerAccessDomain))
+
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(r.Reader)))
+	h.Write(size)
+	h.Write(r.Reader)
+
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(r.Timestamp))
+	h.Write(ts)
+
+	return h.Sum(nil)
+}
+
+// Sign returns the Schnorr signature of the request by the private key of the
+// reader.
+func (r ReaderAccessRequest) Sign(privK kyber.Scalar) ([]byte, error) {
+	sig, err := schnorr.Sign(suite, privK, r.Message())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign: %v", err)
+	}
+
+	return sig, nil
+}
+
+// Verify verifies the signature of the request by the reader.
+func (r ReaderAccessRequest) Verify(sig []byte) error {
+	buf, err := hex.DecodeString(string(r.Reader))
+	if err != nil {
+		return xerrors.Errorf("failed to decode reader key: %v", err)
+	}
+
+	pubKey := suite.Point()
+
+	err = pubKey.UnmarshalBinary(buf)
+	if err != nil {
+		return xerrors.Errorf("invalid reader key: %v", err)
+	}
+
+	err = schnorr.Verify(suite, pubKey, r.Message(), sig)
+	if err != nil {
+		return xerrors.Errorf("invalid signature: %v", err)
+	}
+
+	return nil
+}
+
+// revealDomain separates the requests of the reveals from any other message
+// signed by the reader.
+const revealDomain = "calypso:reveal"
+
+// RevealRequest is the request of a reader to reveal a secret to it. It is
+// signed with the private key of the reader over the access token of the reveal
+// and the number of reveals already recorded for it, so that a request can't
+// be replayed once it is committed.
+type RevealRequest struct {
+	// Token is the access token of the reveal, see AccessToken.
+	Token []byte
+
+	// Nonce is the number of reveals recorded for the access token, see
+	// SecretAccess.
+	Nonce uint64
+}
+
+// Message returns the message signed by the reader.
+func (r RevealRequest) Message() []byte {
+	h := sha256.New()
+	h.Write([]byte(revealDomain))
+
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(r.Token)))
+	h.Write(size)
+	h.Write(r.Token)
+
+	nonce := make([]byte, 8)
+	binary.BigEndian.PutUint64(nonce, r.Nonce)
+	h.Write(nonce)
+
+	return h.Sum(nil)
+}
+
+// Sign returns the Schnorr signature of the request by the private key of the
+// reader.
+func (r RevealRequest) Sign(privK kyber.Scalar) ([]byte, error) {
+	sig, err := schnorr.Sign(suite, privK, r.Message())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign: %v", err)
+	}
+
+	return sig, nil
+}
+
+// Verify verifies the signature of the request by the reader with the given
+// hex-encoded public key.
+func (r RevealRequest) Verify(reader []byte, sig []byte) error {
+	buf, err := hex.DecodeString(string(reader))
+	if err != nil {
+		return xerrors.Errorf("failed to decode reader key: %v", err)
+	}
+
+	pubKey := suite.Point()
+
+	err = pubKey.UnmarshalBinary(buf)
+	if err != nil {
+		return xerrors.Errorf("invalid reader key: %v", err)
+	}
+
+	err = schnorr.Verify(suite, pubKey, r.Message(), sig)
+	if err != nil {
+		return xerrors.Errorf("invalid signature: %v", err)
+	}
+
+	return nil
+}
+
+// defaultPageLimit is the number of records listed when no limit is given.
+const defaultPageLimit = 100
+
+// BlockInfo provides the index of the block being built when a transaction is
+// executed. The index must be the same on every node, otherwise the nodes would
+// end up with different states.
+type BlockInfo interface {
+	// GetBlockIndex returns the index of the block being built.
+	GetBlockIndex() (uint64, error)
+}
+
+// noBlockInfo is the block information used when the contract has no access to
+// the blocks of the chain.
+//
+// - implements BlockInfo
+type noBlockInfo struct{}
+
+// GetBlockIndex implements BlockInfo. It always returns zero.
+func (noBlockInfo) GetBlockIndex() (uint64, error) {
+	return 0, nil
+}
+
+// GetHeight returns the height of the contract, which is the index of the block
+// of the last transaction it has executed.
+func GetHeight(snap store.Readable) (uint64, error) {
+	return getCount(snap, PrefixHeightKey, nil)
+}
+
+// recordHeight sets the height of the contract to the index of the block being
+// built, so that it is part of the state of the transaction.
+func recordHeight(snap store.Snapshot, blocks BlockInfo) error {
+	index, err := blocks.GetBlockIndex()
+	if err != nil {
+		return xerrors.Errorf("failed to get block index: %v", err)
+	}
+
+	return setCount(snap, PrefixHeightKey, nil, index)
+}
+
+// newAuditEntry creates the audit entry of the transaction of the step.
+func (c calypsoCommand) newAuditEntry(snap store.Readable, step execution.Step,
+	event string, accessToken []byte, pubKey []byte) (AuditEntry, error) {
+
+	ident, err := step.Current.GetIdentity().MarshalText()
+	if err != nil {
+		return AuditEntry{}, xerrors.Errorf("failed to marshal identity: %v", err)
+	}
+
+	height, err := GetHeight(snap)
+	if err != nil {
+		return AuditEntry{}, xerrors.Errorf("failed to get height: %v", err)
+	}
+
+	return AuditEntry{
+		Version:     AuditEntryVersion,
+		Event:       event,
+		AccessToken: accessToken,
+		Reader:      pubKey,
+		Identity:    string(ident),
+		TxID:        step.Current.GetID(),
+		Height:      height,
+		Purpose:     string(step.Current.GetArg(PurposeArg)),
+	}, nil
+}
+
+// listAuditLogs implements commands. It performs the LIST_AUDIT_LOG command
+// and prints the audit entries of the secret, oldest first.
+func (c calypsoCommand) listAuditLogs(snap store.Snapshot, step execution.Step) error {
+	smcKey := step.Current.GetArg(SmcPublicKeyArg)
+	if len(smcKey) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SmcPublicKeyArg)
+	}
+
+	name := step.Current.GetArg(SecretNameArg)
+	if len(name) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SecretNameArg)
+	}
+
+	logs, err := ListAuditLogs(snap, smcKey, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.printer, "Audit logs for secret '%s':\n", name)
+
+	for _, log := range logs {
+		buf, err := json.Marshal(log)
+		if err != nil {
+			return xerrors.Errorf("failed to encode audit entry: %v", err)
+		}
+
+		fmt.Fprintf(c.printer, "%s\n", buf)
+	}
+
+	return nil
+}
+
+// listReaderAccess implements commands. It performs the LIST_READER_ACCESS
+// command and prints a page of the secrets revealed to the reader, oldest
+// first.
+func (c calypsoCommand) listReaderAccess(snap store.Snapshot, step execution.Step) error {
+	reader := step.Current.GetArg(PubKeyArg)
+	if len(reader) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, PubKeyArg)
+	}
+
+	offset, limit, err := parsePage(step)
+	if err != nil {
+		return xerrors.Errorf("failed to parse page: %v", err)
+	}
+
+	accesses, total, err := ListReaderAccess(snap, reader, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.printer, "Secrets revealed to '%s' (%d-%d of %d):\n", reader,
+		offset, offset+uint64(len(accesses)), total)
+
+	for _, access := range accesses {
+		buf, err := json.Marshal(access)
+		if err != nil {
+			return xerrors.Errorf("failed to encode audit entry: %v", err)
+		}
+
+		fmt.Fprintf(c.printer, "%s\n", buf)
+	}
+
+	return nil
+}
+
+// ListReaderAccess returns at most limit audit entries of the secrets revealed
+// to the reader, starting at offset, and the total number of entries. The
+// entries are in the order of the reveals.
+func ListReaderAccess(snap store.Readable, reader []byte, offset,
+	limit uint64) ([]ReaderAccess, uint64, error) {
+
+	total, err := getCount(snap, PrefixReaderListKeys, reader)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("failed to read accesses of '%s': %v", reader, err)
+	}
+
+	res := []ReaderAccess{}
+
+	for i := offset; i < total && uint64(len(res)) < limit; i++ {
+		buf, err := snap.Get(indexedKey(PrefixReaderKeys, reader, i))
+		if err != nil {
+			return nil, 0, xerrors.Errorf("failed to read access %d of '%s': %v",
+				i, reader, err)
+		}
+
+		var ref auditRef
+		err = json.Unmarshal(buf, &ref)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("failed to decode audit reference: %v", err)
+		}
+
+		entry, err := getAuditEntry(snap, ref.Secret, ref.Index)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("failed to get audit entry: %v", err)
+		}
+
+		res = append(res, ReaderAccess{Secret: ref.Secret, AuditEntry: entry})
+	}
+
+	return res, total, nil
+}
+
+// GetSecretAccess returns the access record of the reader for the current
+// value of the secret, or nil if the secret has never been revealed to the
+// reader. It does not modify the store and can be used to check whether the
+// access has already been granted.
+func GetSecretAccess(snap store.Readable, smcKey, name, pubKey []byte) (*SecretAccess, error) {
+	secret, err := getSecret(snap, name)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get secret '%s': %v", name, err)
+	}
+
+	record, err := getSecretAccess(snap, computeAccessToken(smcKey, secret, pubKey))
+	if err != nil || record == nil {
+		return record, err
+	}
+
+	// the access may have been revoked before the current value was revealed
+	if record.Revoked == nil {
+		record.Revoked, err = GetRevocation(snap, name, pubKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
+
+//
+// Utility functions
+//
+
+// getSecretAccess returns the access record of the token, or nil if there is
+// none. The reveals logged before the access records existed only stored the
+// public key of the reader.
+func getSecretAccess(snap store.Readable, accessToken []byte) (*SecretAccess, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixAccessKeys), accessToken)
+	buf, err := snap.Get(k)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get access token '%x': %v", accessToken, err)
+	}
+
+	if len(buf) == 0 {
+		return nil, nil
+	}
+
+	if buf[0] != '{' {
+		return &SecretAccess{Reader: buf, Reveals: 1}, nil
+	}
+
+	var record SecretAccess
+	err = json.Unmarshal(buf, &record)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode access record: %v", err)
+	}
+
+	return &record, nil
+}
+
+// recordSecretAccess updates the access record of the token with a reveal
+// happening in the given block and returns the new record.
+func recordSecretAccess(snap store.Snapshot, accessToken []byte, pubKey []byte,
+	index uint64) (SecretAccess, error) {
+
+	prev, err := getSecretAccess(snap, accessToken)
+	if err != nil {
+		return SecretAccess{}, err
+	}
+
+	record := SecretAccess{
+		Reader:    pubKey,
+		FirstSeen: index,
+	}
+
+	if prev != nil {
+		if prev.Revoked != nil {
+			return SecretAccess{}, xerrors.Errorf("access of '%s' has been revoked: %s",
+				pubKey, prev.Revoked.Reason)
+		}
+
+		record = *prev
+	}
+
+	record.LastSeen = index
+	record.Reveals++
+
+	err = setSecretAccess(snap, accessToken, record)
+	if err != nil {
+		return SecretAccess{}, err
+	}
+
+	return record, nil
+}
+
+func setSecretAccess(snap store.Snapshot, accessToken []byte, record SecretAccess) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return xerrors.Errorf("failed to encode access record: %v", err)
+	}
+
+	k := prefixed.NewPrefixedKey([]byte(PrefixAccessKeys), accessToken)
+	err = snap.Set(k, buf)
+	if err != nil {
+		return xerrors.Errorf("failed to set secret access '%x' of '%s': %v",
+			accessToken, record.Reader, err)
+	}
+
+	dela.Logger.Info().
+		Str("contract", ContractName).
+		Msgf("setting secret access %x=%s", accessToken, buf)
+
+	return nil
+}
+
+// parsePage reads the optional paging arguments of the transaction.
+func parsePage(step execution.Step) (uint64, uint64, error) {
+	offset := uint64(0)
+	limit := uint64(defaultPageLimit)
+
+	arg := step.Current.GetArg(OffsetArg)
+	if len(arg) > 0 {
+		v, err := strconv.ParseUint(string(arg), 10, 64)
+		if err != nil {
+			return 0, 0, xerrors.Errorf("invalid offset '%s': %v", arg, err)
+		}
+
+		offset = v
+	}
+
+	arg = step.Current.GetArg(LimitArg)
+	if len(arg) > 0 {
+		v, err := strconv.ParseUint(string(arg), 10, 64)
+		if err != nil {
+			return 0, 0, xerrors.Errorf("invalid limit '%s': %v", arg, err)
+		}
+
+		limit = v
+	}
+
+	return offset, limit, nil
+}
+
+// indexedKey returns the store key of the i-th element of the list of key.
+// The index has a fixed size so that the key can always be told apart.
+func indexedKey(prefix string, key []byte, i uint64) []byte {
+	buf := make([]byte, len(key)+8)
+	copy(buf, key)
+	binary.BigEndian.PutUint64(buf[len(key):], i)
+
+	return prefixed.NewPrefixedKey([]byte(prefix), buf)
+}
+
+// getCount returns the number of elements of the list of key.
+func getCount(snap store.Readable, prefix string, key []byte) (uint64, error) {
+	buf, err := snap.Get(prefixed.NewPrefixedKey([]byte(prefix), key))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	if len(buf) != 8 {
+		return 0, xerrors.Errorf("invalid count length: %d", len(buf))
+	}
+
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func setCount(snap store.Snapshot, prefix string, key []byte, count uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, count)
+
+	return snap.Set(prefixed.NewPrefixedKey([]byte(prefix), key), buf)
+}
+
+// appendIndexed appends the value to the list of key and returns its index.
+func appendIndexed(snap store.Snapshot, countPrefix string, prefix string,
+	key []byte, value []byte) (uint64, error) {
+
+	count, err := getCount(snap, countPrefix, key)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to read count: %v", err)
+	}
+
+	err = snap.Set(indexedKey(prefix, key, count), value)
+	if err != nil {
+		return 0, err
+	}
+
+	err = setCount(snap, countPrefix, key, count+1)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// insertAuditLog appends the entry to the audit log of the secret and, if it
+// is a reveal, to the accesses of the reader.
+func insertAuditLog(snap store.Snapshot, name []byte, entry AuditEntry) error {
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return xerrors.Errorf("failed to encode audit entry: %v", err)
+	}
+
+	i, err := appendIndexed(snap, PrefixAuditCountKeys, PrefixAuditKeys, name, buf)
+	if err != nil {
+		return xerrors.Errorf(
+			"failed to insert audit log for secret '%s': %v", name, err)
+	}
+
+	// the accesses of a reader are the secrets revealed to it
+	if entry.Event == AuditReveal {
+		ref, err := json.Marshal(auditRef{Secret: name, Index: i})
+		if err != nil {
+			return xerrors.Errorf("failed to encode audit reference: %v", err)
+		}
+
+		_, err = appendIndexed(snap, PrefixReaderListKeys, PrefixReaderKeys,
+			entry.Reader, ref)
+		if err != nil {
+			return xerrors.Errorf(
+				"failed to insert access of reader '%s': %v", entry.Reader, err)
+		}
+	}
+
+	dela.Logger.Info().
+		Str("contract", ContractName).
+		Msgf("appending audit log %x=%s", name, buf)
+
+	return nil
+}
+
+// getAuditLogs returns the audit entries of the secret, starting with the
+// reveals logged before the audit entries existed.
+func getAuditLogs(snap store.Readable, name []byte) ([]AuditEntry, error) {
+	logs, err := getLegacyAuditLogs(snap, name)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := getCount(snap, PrefixAuditCountKeys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := uint64(0); i < count; i++ {
+		entry, err := getAuditEntry(snap, name, i)
+		if err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, entry)
+	}
+
+	return logs, nil
+}
+
+// accessTokenNbBytes is the size of an access token, see computeAccessToken.
+const accessTokenNbBytes = sha256.Size
+
+// getLegacyAuditLogs returns the reveals of the secret logged as a list of
+// access tokens.
+func getLegacyAuditLogs(snap store.Readable, name []byte) ([]AuditEntry, error) {
+	buf, err := snap.Get(prefixed.NewPrefixedKey([]byte(PrefixListKeys), name))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf)%accessTokenNbBytes != 0 {
+		return nil, xerrors.Errorf("invalid audit log length: %d", len(buf))
+	}
+
+	logs := []AuditEntry{}
+
+	for i := 0; i < len(buf); i += accessTokenNbBytes {
+		token := buf[i : i+accessTokenNbBytes]
+
+		entry := AuditEntry{
+			Event:       AuditReveal,
+			AccessToken: token,
+		}
+
+		record, err := getSecretAccess(snap, token)
+		if err != nil {
+			return nil, err
+		}
+
+		if record != nil {
+			entry.Reader = record.Reader
+		}
+
+		logs = append(logs, entry)
+	}
+
+	return logs, nil
+}
+
+func getAuditEntry(snap store.Readable, name []byte, i uint64) (AuditEntry, error) {
+	buf, err := snap.Get(indexedKey(PrefixAuditKeys, name, i))
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	if len(buf) == 0 {
+		return AuditEntry{}, xerrors.Errorf("audit entry %d of '%s' not found", i, name)
+	}
+
+	var entry AuditEntry
+	err = json.Unmarshal(buf, &entry)
+	if err != nil {
+		return AuditEntry{}, xerrors.Errorf("failed to decode audit entry: %v", err)
+	}
+
+	if entry.Version > AuditEntryVersion {
+		return AuditEntry{}, xerrors.Errorf("unsupported audit entry version: %d",
+			entry.Version)
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,467 @@
+package calypso
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/store/hashtree"
+	"go.dedis.ch/dela/core/store/hashtree/binprefix"
+	"go.dedis.ch/dela/core/store/kv"
+	"go.dedis.ch/dela/core/store/prefixed"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func Test_getAuditLogs(t *testing.T) {
+	snap := fake.NewSnapshot()
+	name := []byte("my_secret")
+
+	logs, err := getAuditLogs(snap, name)
+	require.NoError(t, err)
+	require.Empty(t, logs)
+
+	for i := 0; i < 3; i++ {
+		err = insertAuditLog(snap, name, AuditEntry{
+			Version: AuditEntryVersion,
+			Height:  uint64(i),
+		})
+		require.NoError(t, err)
+	}
+
+	// entries of a secret whose name is a prefix must not be mixed up
+	err = insertAuditLog(snap, []byte("my_secre"), AuditEntry{Height: 42})
+	require.NoError(t, err)
+
+	logs, err = getAuditLogs(snap, name)
+	require.NoError(t, err)
+	require.Len(t, logs, 3)
+	for i, log := range logs {
+		require.Equal(t, uint64(i), log.Height)
+	}
+
+	err = snap.Set(indexedKey(PrefixAuditKeys, name, 1), []byte(`{"version":2}`))
+	require.NoError(t, err)
+
+	_, err = getAuditLogs(snap, name)
+	require.EqualError(t, err, "unsupported audit entry version: 2")
+
+	err = snap.Set(prefixed.NewPrefixedKey([]byte(PrefixAuditCountKeys), name), []byte("bad"))
+	require.NoError(t, err)
+
+	_, err = getAuditLogs(snap, name)
+	require.EqualError(t, err, "invalid count length: 3")
+
+	err = snap.Set(prefixed.NewPrefixedKey([]byte(PrefixListKeys), name), []byte("bad"))
+	require.NoError(t, err)
+
+	_, err = getAuditLogs(snap, name)
+	require.EqualError(t, err, "invalid audit log length: 3")
+
+	bad := fake.NewBadSnapshot()
+	err = insertAuditLog(bad, name, AuditEntry{})
+	require.EqualError(t, err,
+		fake.Err("failed to insert audit log for secret 'my_secret': failed to read count"))
+}
+
+func Test_getAuditLogs_Legacy(t *testing.T) {
+	snap := fake.NewSnapshot()
+	name := []byte("my_secret")
+
+	// the reveals used to be logged as a list of access tokens, and the access
+	// records as the public key of the reader
+	first := computeAccessToken([]byte("smc"), []byte("value"), []byte("pk1"))
+	second := computeAccessToken([]byte("smc"), []byte("value"), []byte("pk2"))
+
+	err := snap.Set(prefixed.NewPrefixedKey([]byte(PrefixListKeys), name),
+		append(append([]byte{}, first...), second...))
+	require.NoError(t, err)
+
+	err = snap.Set(prefixed.NewPrefixedKey([]byte(PrefixAccessKeys), first), []byte("pk1"))
+	require.NoError(t, err)
+
+	err = insertAuditLog(snap, name, AuditEntry{
+		Version: AuditEntryVersion,
+		Event:   AuditReveal,
+		Height:  5,
+	})
+	require.NoError(t, err)
+
+	logs, err := getAuditLogs(snap, name)
+	require.NoError(t, err)
+	require.Equal(t, []AuditEntry{
+		{Event: AuditReveal, AccessToken: first, Reader: []byte("pk1")},
+		{Event: AuditReveal, AccessToken: second},
+		{Version: AuditEntryVersion, Event: AuditReveal, Height: 5},
+	}, logs)
+
+	record, err := getSecretAccess(snap, first)
+	require.NoError(t, err)
+	require.Equal(t, &SecretAccess{Reader: []byte("pk1"), Reveals: 1}, record)
+}
+
+func TestCommand_ListReaderAccess(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	buf := &bytes.Buffer{}
+	contract.printer = buf
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	const (
+		smcKey = testSmcKey
+		reader = "my_pubkey"
+	)
+
+	err := cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		RosterArg, makeRoster(t, "node:12345"),
+		SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	for _, name := range []string{"secret_a", "secret_b", "secret_c"} {
+		err = cmd.createSecret(snap, makeStep(t,
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, name,
+			SecretArg, makeSecret(t, smcKey, name, "value")))
+		require.NoError(t, err)
+
+		err = cmd.revealSecret(snap, makeStep(t,
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, name,
+			PubKeyArg, reader,
+			PurposeArg, "check "+name))
+		require.NoError(t, err)
+	}
+
+	// another reader must not show up
+	err = cmd.revealSecret(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, "secret_a",
+		PubKeyArg, "another_pubkey"))
+	require.NoError(t, err)
+
+	accesses, total, err := ListReaderAccess(snap, []byte(reader), 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), total)
+	require.Len(t, accesses, 3)
+
+	for i, name := range []string{"secret_a", "secret_b", "secret_c"} {
+		require.Equal(t, []byte(name), accesses[i].Secret)
+		require.Equal(t, []byte(reader), accesses[i].Reader)
+		require.Equal(t, "check "+name, accesses[i].Purpose)
+	}
+
+	accesses, total, err = ListReaderAccess(snap, []byte(reader), 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), total)
+	require.Len(t, accesses, 1)
+	require.Equal(t, []byte("secret_b"), accesses[0].Secret)
+
+	accesses, _, err = ListReaderAccess(snap, []byte(reader), 5, 1)
+	require.NoError(t, err)
+	require.Empty(t, accesses)
+
+	accesses, total, err = ListReaderAccess(snap, []byte("unknown"), 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), total)
+	require.Empty(t, accesses)
+
+	err = cmd.listReaderAccess(snap, makeStep(t,
+		PubKeyArg, reader,
+		OffsetArg, "2",
+		LimitArg, "5"))
+	require.NoError(t, err)
+	require.Contains(t, buf.String(),
+		fmt.Sprintf("Secrets revealed to '%s' (2-3 of 3):\n", reader))
+	require.Contains(t, buf.String(), `"secret":"c2VjcmV0X2M="`)
+	require.NotContains(t, buf.String(), `"secret":"c2VjcmV0X2E="`)
+
+	err = cmd.listReaderAccess(snap, makeStep(t))
+	require.EqualError(t, err, "'calypso:pub_key' not found in tx arg")
+
+	err = cmd.listReaderAccess(snap, makeStep(t, PubKeyArg, reader, OffsetArg, "a"))
+	require.EqualError(t, err, "failed to parse page: invalid offset 'a': "+
+		"strconv.ParseUint: parsing \"a\": invalid syntax")
+
+	err = cmd.listReaderAccess(snap, makeStep(t, PubKeyArg, reader, LimitArg, "-1"))
+	require.EqualError(t, err, "failed to parse page: invalid limit '-1': "+
+		"strconv.ParseUint: parsing \"-1\": invalid syntax")
+
+	bad := fake.NewBadSnapshot()
+	err = cmd.listReaderAccess(bad, makeStep(t, PubKeyArg, reader))
+	require.EqualError(t, err, fake.Err("failed to read accesses of 'my_pubkey'"))
+}
+
+func TestCommand_RevealSecret_Repeated(t *testing.T) {
+	db, err := kv.New(filepath.Join(t.TempDir(), "calypso.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	blocks := &fakeBlockInfo{}
+	contract := NewContract(fakeAccess{}, WithBlockInfo(blocks))
+
+	const (
+		smcKey = testSmcKey
+		name   = "my_secret"
+		reader = "my_pubkey"
+		other  = "another_pubkey"
+	)
+
+	reveal := func(pubKey string) execution.Step {
+		return makeStep(t, CmdArg, string(CmdRevealSecret),
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, name,
+			PubKeyArg, pubKey)
+	}
+
+	var tree hashtree.Tree = binprefix.NewMerkleTree(db, binprefix.Nonce{})
+
+	// stage executes the steps in a new block and commits it
+	stage := func(steps ...execution.Step) {
+		next, err := tree.Stage(func(snap store.Snapshot) error {
+			for _, step := range steps {
+				err := contract.Execute(snap, step)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, next.Commit())
+
+		tree = next
+		blocks.index++
+	}
+
+	stage(
+		makeStep(t, CmdArg, string(CmdAdvertiseSmc),
+			SmcPublicKeyArg, smcKey,
+			RosterArg, makeRoster(t, "node:12345"),
+			SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345"))),
+		makeStep(t, CmdArg, string(CmdCreateSecret),
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, name,
+			SecretArg, makeSecret(t, smcKey, name, "my_value")))
+
+	record, err := GetSecretAccess(tree, []byte(smcKey), []byte(name), []byte(reader))
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	// first reveal
+	stage(reveal(reader))
+
+	record, err = GetSecretAccess(tree, []byte(smcKey), []byte(name), []byte(reader))
+	require.NoError(t, err)
+	require.Equal(t, &SecretAccess{
+		Reader:    []byte(reader),
+		FirstSeen: 1,
+		LastSeen:  1,
+		Reveals:   1,
+	}, record)
+
+	// the query does not grant anything
+	logs, err := getAuditLogs(tree, []byte(name))
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	// repeated reveal
+	stage(reveal(reader))
+
+	record, err = GetSecretAccess(tree, []byte(smcKey), []byte(name), []byte(reader))
+	require.NoError(t, err)
+	require.Equal(t, &SecretAccess{
+		Reader:    []byte(reader),
+		FirstSeen: 1,
+		LastSeen:  2,
+		Reveals:   2,
+	}, record)
+
+	// concurrent reveals in the same block
+	stage(reveal(reader), reveal(other), reveal(reader))
+
+	record, err = GetSecretAccess(tree, []byte(smcKey), []byte(name), []byte(reader))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), record.FirstSeen)
+	require.Equal(t, uint64(3), record.LastSeen)
+	require.Equal(t, uint64(4), record.Reveals)
+
+	record, err = GetSecretAccess(tree, []byte(smcKey), []byte(name), []byte(other))
+	require.NoError(t, err)
+	require.Equal(t, &SecretAccess{
+		Reader:    []byte(other),
+		FirstSeen: 3,
+		LastSeen:  3,
+		Reveals:   1,
+	}, record)
+
+	logs, err = getAuditLogs(tree, []byte(name))
+	require.NoError(t, err)
+	require.Len(t, logs, 5)
+
+	reveals := []uint64{1, 2, 3, 1, 4}
+	// the reveals of the same block have the same height
+	heights := []uint64{1, 2, 3, 3, 3}
+
+	for i, log := range logs {
+		require.Equal(t, reveals[i], log.Reveal)
+		require.Equal(t, heights[i], log.Height)
+	}
+
+	// concurrent blocks staged on the same state do not see each other
+	wg := sync.WaitGroup{}
+	results := make([]*SecretAccess, 4)
+
+	for i := range results {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := tree.Stage(func(snap store.Snapshot) error {
+				err := contract.Execute(snap, reveal(reader))
+				if err != nil {
+					return err
+				}
+
+				results[i], err = GetSecretAccess(snap, []byte(smcKey), []byte(name),
+					[]byte(reader))
+				return err
+			})
+			require.NoError(t, err)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, res := range results {
+		require.Equal(t, uint64(5), res.Reveals)
+	}
+
+	record, err = GetSecretAccess(tree, []byte(smcKey), []byte(name), []byte(reader))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), record.Reveals)
+}
+
+func TestGetSecretAccess_Failures(t *testing.T) {
+	_, err := GetSecretAccess(fake.NewSnapshot(), []byte("smc"), []byte("name"),
+		[]byte("pk"))
+	require.EqualError(t, err, "failed to get secret 'name': couldn't find key")
+
+	snap := fake.NewSnapshot()
+	err = setSecret(snap, []byte("name"), []byte("value"))
+	require.NoError(t, err)
+
+	token := computeAccessToken([]byte("smc"), []byte("value"), []byte("pk"))
+	err = snap.Set(prefixed.NewPrefixedKey([]byte(PrefixAccessKeys), token), []byte("{pk"))
+	require.NoError(t, err)
+
+	_, err = GetSecretAccess(snap, []byte("smc"), []byte("name"), []byte("pk"))
+	require.ErrorContains(t, err, "failed to decode access record: ")
+}
+
+func TestAuditLogRequest(t *testing.T) {
+	signer := bls.NewSigner()
+
+	owner, err := signer.GetPublicKey().MarshalText()
+	require.NoError(t, err)
+
+	req := AuditLogRequest{Name: []byte("a"), Timestamp: 1700000000}
+
+	sig, err := req.Sign(signer)
+	require.NoError(t, err)
+
+	err = req.Verify(string(owner), sig)
+	require.NoError(t, err)
+
+	other := AuditLogRequest{Name: []byte("b"), Timestamp: req.Timestamp}
+	require.Error(t, other.Verify(string(owner), sig))
+
+	other = AuditLogRequest{Name: req.Name, Timestamp: req.Timestamp + 1}
+	require.Error(t, other.Verify(string(owner), sig))
+
+	stranger, err := bls.NewSigner().GetPublicKey().MarshalText()
+	require.NoError(t, err)
+
+	err = req.Verify(string(stranger), sig)
+	require.ErrorContains(t, err, "invalid signature")
+
+	err = req.Verify("PK", sig)
+	require.EqualError(t, err, "unsupported owner identity 'PK'")
+
+	err = req.Verify("bls:zz", sig)
+	require.ErrorContains(t, err, "invalid owner identity")
+}
+
+func TestReaderAccessRequest(t *testing.T) {
+	privK := suite.Scalar().Pick(suite.RandomStream())
+
+	buf, err := suite.Point().Mul(privK, nil).MarshalBinary()
+	require.NoError(t, err)
+
+	reader := []byte(hex.EncodeToString(buf))
+
+	req := ReaderAccessRequest{Reader: reader, Timestamp: 1700000000}
+
+	sig, err := req.Sign(privK)
+	require.NoError(t, err)
+
+	err = req.Verify(sig)
+	require.NoError(t, err)
+
+	other := ReaderAccessRequest{Reader: reader, Timestamp: req.Timestamp + 1}
+	require.ErrorContains(t, other.Verify(sig), "invalid signature")
+
+	// the signature of another reader is refused
+	sig, err = req.Sign(suite.Scalar().Pick(suite.RandomStream()))
+	require.NoError(t, err)
+	require.ErrorContains(t, req.Verify(sig), "invalid signature")
+
+	other = ReaderAccessRequest{Reader: []byte("zz")}
+	require.ErrorContains(t, other.Verify(sig), "failed to decode reader key")
+
+	other = ReaderAccessRequest{Reader: []byte("abcd")}
+	require.ErrorContains(t, other.Verify(sig), "invalid reader key")
+}
+
+func TestRevealRequest(t *testing.T) {
+	privK := suite.Scalar().Pick(suite.RandomStream())
+
+	buf, err := suite.Point().Mul(privK, nil).MarshalBinary()
+	require.NoError(t, err)
+
+	reader := []byte(hex.EncodeToString(buf))
+
+	req := RevealRequest{Token: []byte("token"), Nonce: 2}
+
+	sig, err := req.Sign(privK)
+	require.NoError(t, err)
+
+	err = req.Verify(reader, sig)
+	require.NoError(t, err)
+
+	other := RevealRequest{Token: req.Token, Nonce: req.Nonce + 1}
+	require.ErrorContains(t, other.Verify(reader, sig), "invalid signature")
+
+	other = RevealRequest{Token: []byte("other"), Nonce: req.Nonce}
+	require.ErrorContains(t, other.Verify(reader, sig), "invalid signature")
+
+	// the signature of another reader is refused
+	sig, err = req.Sign(suite.Scalar().Pick(suite.RandomStream()))
+	require.NoError(t, err)
+	require.ErrorContains(t, req.Verify(reader, sig), "invalid signature")
+
+	require.ErrorContains(t, req.Verify([]byte("zz"), sig), "failed to decode reader key")
+	require.ErrorContains(t, req.Verify([]byte("abcd"), sig), "invalid reader key")
+}
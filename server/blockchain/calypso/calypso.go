@@ -2,16 +2,33 @@
 // Management Committees, deal with secrets and audit their access.
 //
 // Its information will be represented in the KV store as follows :
-// CALYR {SMC pub key} -> {pub key, smc_roster (list of comma-separated host:port addresses)}
+// CALYR {SMC pub key} -> roster of the SMC (address, public key and DKG share index of each member)
 // CALYS {secret name} -> secret value (encrypted with the SMC public key)
-// CALYL {secret name} -> H(SMC public key, secret, client's public key)
-// CALYA {H(SMC public key, secret, client's public key)} -> client's public key
+// CALYU {secret name} -> number of audit entries of the secret
+// CALYE {secret name, index} -> audit entry of a reveal of the secret
+// CALYL {secret name} -> legacy list of the access keys of the secret, only read
+// CALYW {client's public key} -> number of reveals to the client
+// CALYX {client's public key, index} -> reference to an audit entry
+// CALYA {H(SMC public key, secret, client's public key)} -> access record of the client
+// CALYI {SMC pub key} -> list of the secret names bound to the SMC
+// CALYK -> list of the advertised SMC pub keys
+// CALYP {secret name} -> policy defining who can reveal the secret
+// CALYO {secret name} -> identity of the secret's owner
+// CALYV {secret name} -> list of the previous values of the secret
+// CALYT {secret name} -> window during which the secret can be revealed
+// CALYN {SMC pub key} -> pub key of the SMC it succeeds
+// CALYM {SMC pub key} -> pub key of the SMC succeeding it
+// CALYC {secret name} -> index of the block in which the secret was created
+// CALYH -> index of the block of the last transaction executed by the contract
+// CALYG {SMC pub key} -> number of rosters set for the SMC, kept after its deletion
+// CALYQ {secret name} -> revocations of the readers of the secret
 package calypso
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"sort"
 	"strings"
 
@@ -35,8 +52,15 @@ type commands interface {
 	createSecret(snap store.Snapshot, step execution.Step) error
 	listSecrets(snap store.Snapshot, step execution.Step) error
 	revealSecret(snap store.Snapshot, step execution.Step) error
+	updatePolicy(snap store.Snapshot, step execution.Step) error
+	deleteSecret(snap store.Snapshot, step execution.Step) error
+	updateSecret(snap store.Snapshot, step execution.Step) error
 
 	listAuditLogs(snap store.Snapshot, step execution.Step) error
+	listReaderAccess(snap store.Snapshot, step execution.Step) error
+	revokeAccess(snap store.Snapshot, step execution.Step) error
+
+	migrateSecrets(snap store.Snapshot, step execution.Step) error
 }
 
 const (
@@ -52,21 +76,87 @@ const (
 	SmcPublicKeyArg = "calypso:smc_key"
 
 	// RosterArg is the argument's name in the transaction that contains the
-	// roster to associate with a given public key.
+	// roster to associate with a given public key, as a JSON list of members.
+	// See Roster.
 	RosterArg = "calypso:smc_roster"
 
+	// RosterSignatureArg is the argument's name in the transaction that
+	// contains the collective signature of the current members of the SMC
+	// authorizing a new roster. See RosterSignature.
+	RosterSignatureArg = "calypso:smc_roster_signature"
+
+	// SmcProofArg is the argument's name in the transaction that contains the
+	// hex-encoded Schnorr proof of possession of the DKG private key of a new
+	// SMC. See SmcProofMessage.
+	SmcProofArg = "calypso:smc_proof"
+
+	// PredecessorArg is the argument's name in the transaction that contains
+	// the public key of the SMC succeeded by a new SMC.
+	PredecessorArg = "calypso:smc_predecessor"
+
+	// MigratedSecretsArg is the optional argument's name in the transaction
+	// that contains the secrets of the predecessor encrypted for the successor
+	// SMC, as a JSON object mapping the names of the secrets to their new
+	// values. It comes with the signature of the predecessor's members over
+	// SmcMigrationMessage.
+	MigratedSecretsArg = "calypso:migrated_secrets"
+
 	// SecretNameArg is the argument's name in the transaction that contains
 	// the name of the secret to be published on the blockchain.
 	SecretNameArg = "calypso:secret_name"
 
 	// SecretArg is the argument's name in the transaction that contains the
-	// secret to be published on the blockchain.
+	// secret to be published on the blockchain, as a serialized Ciphertext
+	// encrypted for the SMC key. See EncryptSecret.
 	SecretArg = "calypso:secret_value"
 
 	// PubKeyArg is the argument's name in the transaction that contains the
 	// public key to be used to re-encrypt the secret (and thus reveal it).
 	PubKeyArg = "calypso:pub_key"
 
+	// RevealNonceArg is the optional argument's name in the transaction that
+	// contains the number of reveals recorded for the access token of a
+	// reveal. The reveal is refused if it differs, so that the request of the
+	// reader can't be replayed. See RevealRequest.
+	RevealNonceArg = "calypso:reveal_nonce"
+
+	// PolicyReadersArg is the argument's name in the transaction that contains
+	// the comma-separated list of public keys allowed to reveal the secret.
+	PolicyReadersArg = "calypso:policy_readers"
+
+	// PolicyDarcArg is the argument's name in the transaction that contains
+	// the hex-encoded identifier of the DARC allowed to reveal the secret.
+	PolicyDarcArg = "calypso:policy_darc"
+
+	// PurposeArg is the argument's name in the transaction that contains the
+	// optional reason for revealing the secret, kept in the audit log.
+	PurposeArg = "calypso:purpose"
+
+	// OffsetArg is the argument's name in the transaction that contains the
+	// number of records to skip when listing.
+	OffsetArg = "calypso:offset"
+
+	// LimitArg is the argument's name in the transaction that contains the
+	// maximum number of records to list.
+	LimitArg = "calypso:limit"
+
+	// ReasonArg is the argument's name in the transaction that contains the
+	// reason of a revocation.
+	ReasonArg = "calypso:reason"
+
+	// NotBeforeArg is the argument's name in the transaction that contains
+	// the first block index or time at which the secret can be revealed.
+	NotBeforeArg = "calypso:not_before"
+
+	// NotAfterArg is the argument's name in the transaction that contains the
+	// last block index or time at which the secret can be revealed.
+	NotAfterArg = "calypso:not_after"
+
+	// WindowUnitArg is the argument's name in the transaction that contains
+	// the unit of the reveal window. Only "height", in block indices, is
+	// supported, the "timestamp" unit is refused until the blocks have a time.
+	WindowUnitArg = "calypso:window_unit"
+
 	// CmdArg is the argument's name to indicate the kind of command we want to
 	// run on the contract. Should be one of the Command type.
 	CmdArg = "calypso:command"
@@ -82,19 +172,100 @@ const (
 	PrefixSecretKeys = ContractUID + "S"
 
 	// PrefixListKeys prefixed store keys contain the list of audit keys
-	// that had access to the secret.
+	// that had access to the secret. It is only read, for the reveals logged
+	// before the audit entries existed.
 	// e.g. [SMCL|Secret] => [SMCA1, SMCA2, SMCA3, ...]
 	PrefixListKeys = ContractUID + "L"
 
-	// PrefixAccessKeys prefixed store keys contain the public key of the secret reader
-	// e.g. [SMCA|Hash(...)] => PubKey
+	// PrefixAuditCountKeys prefixed store keys contain the number of audit
+	// entries of the secret.
+	// e.g. [CALYU|Secret] => count
+	PrefixAuditCountKeys = ContractUID + "U"
+
+	// PrefixAuditKeys prefixed store keys contain the audit entries of the
+	// secret, indexed from zero.
+	// e.g. [CALYE|Secret|index] => AuditEntry
+	PrefixAuditKeys = ContractUID + "E"
+
+	// PrefixReaderListKeys prefixed store keys contain the number of secrets
+	// revealed to a reader.
+	// e.g. [CALYW|Reader] => count
+	PrefixReaderListKeys = ContractUID + "W"
+
+	// PrefixReaderKeys prefixed store keys contain the references to the audit
+	// entries of a reader, indexed from zero.
+	// e.g. [CALYX|Reader|index] => (secret name, audit entry index)
+	PrefixReaderKeys = ContractUID + "X"
+
+	// PrefixAccessKeys prefixed store keys contain the access record of the
+	// secret reader
+	// e.g. [SMCA|Hash(...)] => SecretAccess
 	PrefixAccessKeys = ContractUID + "A"
 
+	// PrefixSmcIndexKeys prefixed store keys contain the names of the secrets
+	// bound to a SMC.
+	// e.g. [CALYI|SMC pub key] => [name1, name2, ...]
+	PrefixSmcIndexKeys = ContractUID + "I"
+
+	// PrefixSmcListKeys prefixed store key contains the public keys of all the
+	// advertised SMCs.
+	// e.g. [CALYK] => [SMC pub key1, SMC pub key2, ...]
+	PrefixSmcListKeys = ContractUID + "K"
+
+	// PrefixPolicyKeys prefixed store keys contain the policy of the secret.
+	// e.g. [CALYP|Secret] => Policy
+	PrefixPolicyKeys = ContractUID + "P"
+
+	// PrefixOwnerKeys prefixed store keys contain the identity that created
+	// the secret.
+	// e.g. [CALYO|Secret] => Identity
+	PrefixOwnerKeys = ContractUID + "O"
+
+	// PrefixVersionKeys prefixed store keys contain the previous values of
+	// the secret, oldest first.
+	// e.g. [CALYV|Secret] => [value1, value2, ...]
+	PrefixVersionKeys = ContractUID + "V"
+
+	// PrefixWindowKeys prefixed store keys contain the window during which
+	// the secret can be revealed.
+	// e.g. [CALYT|Secret] => Window
+	PrefixWindowKeys = ContractUID + "T"
+
+	// PrefixPredecessorKeys prefixed store keys contain the public key of the
+	// SMC succeeded by a SMC.
+	// e.g. [CALYN|SMC pub key] => predecessor pub key
+	PrefixPredecessorKeys = ContractUID + "N"
+
+	// PrefixSuccessorKeys prefixed store keys contain the public key of the
+	// SMC succeeding a SMC.
+	// e.g. [CALYM|SMC pub key] => successor pub key
+	PrefixSuccessorKeys = ContractUID + "M"
+
+	// PrefixCreationKeys prefixed store keys contain the height at which the
+	// secret was created.
+	// e.g. [CALYC|Secret] => Creation
+	PrefixCreationKeys = ContractUID + "C"
+
+	// PrefixSmcNonceKeys prefixed store keys contain the number of rosters
+	// set for the SMC. It is signed in the proofs of possession and the roster
+	// updates so that they can't be replayed, and is kept when the SMC is
+	// deleted.
+	// e.g. [CALYG|SMC pub key] => nonce
+	PrefixSmcNonceKeys = ContractUID + "G"
+
+	// PrefixHeightKey prefixed store key contains the index of the block of
+	// the last transaction executed by the contract.
+	// e.g. [CALYH] => height
+	PrefixHeightKey = ContractUID + "H"
+
+	// PrefixRevocationKeys prefixed store keys contain the revocations of the
+	// readers of the secret, by public key. They do not depend on the value
+	// of the secret, so that they survive its updates and migrations.
+	// e.g. [CALYQ|Secret] => {reader1: Revocation, reader2: Revocation, ...}
+	PrefixRevocationKeys = ContractUID + "Q"
+
 	// errorKeyNotFoundInSmcs is used in error messages of this module
 	errorKeyNotFoundInSmcs = "'%s' was not found among the SMCs"
-
-	// the length of the access token (depending on the sha used)
-	accessTokenNbBytes = 32
 )
 
 // Command defines a type of command for the value contract
@@ -110,6 +281,10 @@ const (
 	// CmdListSmc defines a command to list all SMCs (not deleted) so far.
 	CmdListSmc Command = "LIST_SMC"
 
+	// CmdMigrateSecrets defines a command to bind the secrets of a SMC to its
+	// successor.
+	CmdMigrateSecrets Command = "MIGRATE_SECRETS"
+
 	// CmdCreateSecret defines a command to create a new secret.
 	CmdCreateSecret Command = "CREATE_SECRET"
 
@@ -121,26 +296,72 @@ const (
 
 	// CmdListAuditLog defines a command to list audit logs.
 	CmdListAuditLog Command = "LIST_AUDIT_LOG"
+
+	// CmdListReaderAccess defines a command to list the secrets revealed to a
+	// reader.
+	CmdListReaderAccess Command = "LIST_READER_ACCESS"
+
+	// CmdRevokeAccess defines a command to revoke the access of a reader to a
+	// secret.
+	CmdRevokeAccess Command = "REVOKE_ACCESS"
+
+	// CmdUpdatePolicy defines a command to update the policy of a secret.
+	CmdUpdatePolicy Command = "UPDATE_POLICY"
+
+	// CmdDeleteSecret defines a command to delete a secret.
+	CmdDeleteSecret Command = "DELETE_SECRET"
+
+	// CmdUpdateSecret defines a command to replace the value of a secret.
+	CmdUpdateSecret Command = "UPDATE_SECRET"
 )
 
-// Common error messages
+// Role defines a group of commands that can be granted at once to an identity.
+type Role string
+
 const (
-	notFoundInTxArg = "'%s' not found in tx arg"
+	// RoleAdmin is allowed to administrate the SMCs.
+	RoleAdmin Role = "admin"
+
+	// RolePublisher is allowed to publish secrets.
+	RolePublisher Role = "publisher"
+
+	// RoleReader is allowed to read secrets and their audit logs.
+	RoleReader Role = "reader"
 )
 
-// smcPubKey contains the SMC public key.
-type smcPubKey string
+// roleCommands defines the commands granted by each role.
+var roleCommands = map[Role][]Command{
+	RoleAdmin: {
+		CmdAdvertiseSmc, CmdDeleteSmc, CmdListSmc, CmdMigrateSecrets,
+	},
+	RolePublisher: {
+		CmdCreateSecret, CmdUpdateSecret, CmdDeleteSecret, CmdUpdatePolicy,
+		CmdRevokeAccess, CmdListSmc, CmdListSecrets,
+	},
+	RoleReader: {
+		CmdRevealSecret, CmdListSecrets, CmdListAuditLog, CmdListReaderAccess,
+	},
+}
 
-type secretSet map[string]struct{}
+// GetRoleCommands returns the commands granted by the given role.
+func GetRoleCommands(role Role) ([]Command, error) {
+	cmds, found := roleCommands[role]
+	if !found {
+		return nil, xerrors.Errorf("unknown role: %s", role)
+	}
 
-func (s secretSet) addSecret(name string) {
-	s[name] = struct{}{}
+	return append([]Command{}, cmds...), nil
 }
 
-// NewCreds creates new credentials for a value contract execution. We might
-// want to use in the future a separate credential for each command.
-func NewCreds() access.Credential {
-	return access.NewContractCreds([]byte(ContractUID), ContractName, credentialAllCommand)
+// Common error messages
+const (
+	notFoundInTxArg = "'%s' not found in tx arg"
+)
+
+// NewCreds creates new credentials for the execution of the given command of
+// the calypso contract.
+func NewCreds(cmd Command) access.Credential {
+	return access.NewContractCreds([]byte(ContractUID), ContractName, string(cmd))
 }
 
 // RegisterContract registers the value contract to the given execution service.
@@ -153,10 +374,6 @@ func RegisterContract(exec *native.Service, c Contract) {
 //
 // - implements native.Contract
 type Contract struct {
-	// secrets contains a mapping between the SMC and their associated secrets
-	// k=SMC pub key, v=set of secret names
-	secrets map[smcPubKey]secretSet
-
 	// access is the access control service managing this smart contract
 	access access.Service
 
@@ -165,14 +382,32 @@ type Contract struct {
 
 	// printer is the output used by the READ and LIST commands
 	printer io.Writer
+
+	// blocks provides the index of the block being built
+	blocks BlockInfo
+}
+
+// ContractOption is the type of option to set some fields of a contract.
+type ContractOption func(*Contract)
+
+// WithBlockInfo sets the source of the index of the block being built. By
+// default, the height of the contract is left to zero.
+func WithBlockInfo(info BlockInfo) ContractOption {
+	return func(c *Contract) {
+		c.blocks = info
+	}
 }
 
 // NewContract creates a new Calypso contract
-func NewContract(srvc access.Service) Contract {
+func NewContract(srvc access.Service, opts ...ContractOption) Contract {
 	contract := Contract{
-		secrets: map[smcPubKey]secretSet{},
 		access:  srvc,
 		printer: infoLog{},
+		blocks:  noBlockInfo{},
+	}
+
+	for _, opt := range opts {
+		opt(&contract)
 	}
 
 	contract.cmd = calypsoCommand{Contract: &contract}
@@ -180,24 +415,46 @@ func NewContract(srvc access.Service) Contract {
 	return contract
 }
 
-// Execute implements native.Contract. It checks that command is formed correctly before running it.
+// Execute implements native.Contract. It checks that command is formed
+// correctly and that the identity is allowed to run it before running it. Every
+// transaction sets the height of the contract to the index of its block.
 func (c Contract) Execute(snap store.Snapshot, step execution.Step) error {
-	creds := NewCreds()
+	cmd := step.Current.GetArg(CmdArg)
+	if len(cmd) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, CmdArg)
+	}
 
-	err := c.access.Match(snap, creds, step.Current.GetIdentity())
+	err := c.checkAccess(snap, Command(cmd), step.Current.GetIdentity())
 	if err != nil {
 		return xerrors.Errorf("identity not authorized: %v (%v)",
 			step.Current.GetIdentity(), err)
 	}
 
-	cmd := step.Current.GetArg(CmdArg)
-	if len(cmd) == 0 {
-		return xerrors.Errorf(notFoundInTxArg, CmdArg)
+	err = recordHeight(snap, c.blocks)
+	if err != nil {
+		return xerrors.Errorf("failed to record height: %v", err)
 	}
 
 	return c.ExecuteCommand(snap, step, cmd)
 }
 
+// checkAccess verifies that the identity holds the credential of the command.
+// The credential for all the commands is still accepted, so that existing
+// grants keep working.
+func (c Contract) checkAccess(snap store.Snapshot, cmd Command, ident access.Identity) error {
+	err := c.access.Match(snap, NewCreds(cmd), ident)
+	if err == nil {
+		return nil
+	}
+
+	e := c.access.Match(snap, NewCreds(credentialAllCommand), ident)
+	if e == nil {
+		return nil
+	}
+
+	return err
+}
+
 // ExecuteCommand executes the appropriate command.
 func (c Contract) ExecuteCommand(snap store.Snapshot, step execution.Step, cmd []byte) error {
 	switch Command(cmd) {
@@ -216,6 +473,11 @@ func (c Contract) ExecuteCommand(snap store.Snapshot, step execution.Step, cmd [
 		if err != nil {
 			return xerrors.Errorf("failed to LIST_SMC: %v", err)
 		}
+	case CmdMigrateSecrets:
+		err := c.cmd.migrateSecrets(snap, step)
+		if err != nil {
+			return xerrors.Errorf("failed to MIGRATE_SECRETS: %v", err)
+		}
 	case CmdCreateSecret:
 		err := c.cmd.createSecret(snap, step)
 		if err != nil {
@@ -236,6 +498,31 @@ func (c Contract) ExecuteCommand(snap store.Snapshot, step execution.Step, cmd [
 		if err != nil {
 			return xerrors.Errorf("failed to LIST_AUDIT_LOG: %v", err)
 		}
+	case CmdListReaderAccess:
+		err := c.cmd.listReaderAccess(snap, step)
+		if err != nil {
+			return xerrors.Errorf("failed to LIST_READER_ACCESS: %v", err)
+		}
+	case CmdRevokeAccess:
+		err := c.cmd.revokeAccess(snap, step)
+		if err != nil {
+			return xerrors.Errorf("failed to REVOKE_ACCESS: %v", err)
+		}
+	case CmdUpdatePolicy:
+		err := c.cmd.updatePolicy(snap, step)
+		if err != nil {
+			return xerrors.Errorf("failed to UPDATE_POLICY: %v", err)
+		}
+	case CmdDeleteSecret:
+		err := c.cmd.deleteSecret(snap, step)
+		if err != nil {
+			return xerrors.Errorf("failed to DELETE_SECRET: %v", err)
+		}
+	case CmdUpdateSecret:
+		err := c.cmd.updateSecret(snap, step)
+		if err != nil {
+			return xerrors.Errorf("failed to UPDATE_SECRET: %v", err)
+		}
 	default:
 		return xerrors.Errorf("unknown command: %s", cmd)
 	}
@@ -270,12 +557,16 @@ func (c calypsoCommand) advertiseSmc(snap store.Snapshot, step execution.Step) e
 		return xerrors.Errorf(notFoundInTxArg, RosterArg)
 	}
 
-	nodeList := strings.Split(string(roster), ",")
-	for _, r := range nodeList {
-		_, _, err := net.SplitHostPort(r)
-		if err != nil {
-			return xerrors.Errorf("invalid node '%s' in roster: %v", r, err)
-		}
+	newRoster, err := DecodeRoster(roster)
+	if err != nil {
+		return xerrors.Errorf("invalid roster: %v", err)
+	}
+
+	// the nonce is signed with the new roster, so that a previous
+	// advertisement can't be replayed
+	nonce, err := GetSmcNonce(snap, key)
+	if err != nil {
+		return xerrors.Errorf("failed to get nonce of '%s': %v", key, err)
 	}
 
 	currentRoster, err := getSmcRoster(snap, key)
@@ -284,68 +575,89 @@ func (c calypsoCommand) advertiseSmc(snap store.Snapshot, step execution.Step) e
 		// the new roster and the old one. There must be at least a threshold
 		// of nodes in the intersection
 
-		e := validateRosterUpdate(currentRoster, roster)
+		oldRoster, e := DecodeRoster(currentRoster)
 		if e != nil {
-			return xerrors.Errorf("roster validation failed: %v", e)
+			return xerrors.Errorf("failed to decode current roster: %v", e)
 		}
-	}
 
-	err = setSmcRoster(snap, key, roster) // DKG public key => roster
-	if err != nil {
-		return xerrors.Errorf("failed to set roster: %v", err)
-	}
-
-	c.secrets[smcPubKey(key)] = secretSet{}
+		if len(step.Current.GetArg(PredecessorArg)) > 0 {
+			return xerrors.Errorf("the predecessor of an existing SMC can't be changed")
+		}
 
-	return nil
-}
+		// after a resharing of the DKG, the new committee can replace the
+		// old one entirely as long as it proves that it holds the key
+		proof := step.Current.GetArg(SmcProofArg)
+		if len(proof) > 0 {
+			e = verifySmcProof(key, nonce, newRoster, proof)
+			if e != nil {
+				return xerrors.Errorf("proof of possession verification failed: %v", e)
+			}
+		} else {
+			e = validateRosterUpdate(oldRoster, newRoster)
+			if e != nil {
+				return xerrors.Errorf("roster validation failed: %v", e)
+			}
+		}
 
-// validateRosterUpdate verifies that the new roster has sufficient overlap
-// with the old roster. It returns an error if the new roster is not valid.
-func validateRosterUpdate(oldRoster []byte, newRoster []byte) error {
-	oldRosterList := strings.Split(string(oldRoster), ",")
-	newRosterList := strings.Split(string(newRoster), ",")
+		// the update must be authorized by the current members of the SMC
+		sig := step.Current.GetArg(RosterSignatureArg)
+		if len(sig) == 0 {
+			return xerrors.Errorf(notFoundInTxArg, RosterSignatureArg)
+		}
 
-	sort.Strings(oldRosterList)
-	sort.Strings(newRosterList)
+		msg, e := RosterUpdateMessage(key, nonce, newRoster)
+		if e != nil {
+			return xerrors.Errorf("failed to create roster update message: %v", e)
+		}
 
-	// verify there's overlap between old roster and new roster
-	overlap := intersectSortedRosters(oldRosterList, newRosterList)
-	thr := len(oldRosterList) - (len(oldRosterList)-1)/3
-	if overlap < thr {
-		return xerrors.Errorf(
-			"new roster does not overlap enough with current roster (%d < %d)",
-			overlap, thr)
-	}
+		e = verifyRosterSignature(oldRoster, msg, sig)
+		if e != nil {
+			return xerrors.Errorf("roster signature verification failed: %v", e)
+		}
+	} else {
+		// a new SMC must prove that it controls the private key of the DKG
+		proof := step.Current.GetArg(SmcProofArg)
+		if len(proof) == 0 {
+			return xerrors.Errorf(notFoundInTxArg, SmcProofArg)
+		}
 
-	return nil
-}
+		e := verifySmcProof(key, nonce, newRoster, proof)
+		if e != nil {
+			return xerrors.Errorf("proof of possession verification failed: %v", e)
+		}
 
-// intersectSortedRosters returns the # of elements in common between 2 rosters
-// Its behaviour is undefined if the rosters are not sorted.
-func intersectSortedRosters(oldRoster []string, newRoster []string) int {
-	overlap := 0
+		// a SMC succeeding another one must be approved by its predecessor
+		predecessor := step.Current.GetArg(PredecessorArg)
+		if len(predecessor) > 0 {
+			e = linkSuccessor(snap, predecessor, key, newRoster,
+				step.Current.GetArg(RosterSignatureArg))
+			if e != nil {
+				return xerrors.Errorf("failed to link to predecessor: %v", e)
+			}
+		}
+	}
 
-	oldIdx := 0
-	newIdx := 0
-	for oldIdx < len(oldRoster) && newIdx < len(newRoster) {
-		o, n := oldRoster[oldIdx], newRoster[newIdx]
+	roster, err = newRoster.Encode()
+	if err != nil {
+		return xerrors.Errorf("failed to encode roster: %v", err)
+	}
 
-		switch {
-		case o < n:
-			oldIdx++
+	err = setSmcRoster(snap, key, roster) // DKG public key => roster
+	if err != nil {
+		return xerrors.Errorf("failed to set roster: %v", err)
+	}
 
-		case o > n:
-			newIdx++
+	err = insertSmc(snap, key)
+	if err != nil {
+		return xerrors.Errorf("failed to index SMC: %v", err)
+	}
 
-		case o == n:
-			oldIdx++
-			newIdx++
-			overlap++
-		}
+	err = setCount(snap, PrefixSmcNonceKeys, key, nonce+1)
+	if err != nil {
+		return xerrors.Errorf("failed to set nonce: %v", err)
 	}
 
-	return overlap
+	return nil
 }
 
 // deleteSmc implements commands. It performs the DELETE_SMC command
@@ -362,14 +674,19 @@ func (c calypsoCommand) deleteSmc(snap store.Snapshot, step execution.Step) erro
 		return xerrors.Errorf("failed to delete SMC with public key '%x': %v", key, err)
 	}
 
+	secrets, err := getSmcSecrets(snap, key)
+	if err != nil {
+		return xerrors.Errorf("failed to get secrets of SMC '%s': %v", key, err)
+	}
+
 	// DKG => roster
 	// DKG => [secret1_key, secret2, secret3, ...]
 	// secret1_key => secret1_encrypted_value
-	for secret := range c.secrets[smcPubKey(key)] {
+	for _, secret := range secrets {
 		dela.Logger.Info().
 			Msgf("Deleting secret '%s' that depended on deleted SMC '%s'", secret, key)
 
-		err = deleteSecret(snap, []byte(secret))
+		err = deleteSecret(snap, secret)
 		if err != nil {
 			dela.Logger.Warn().
 				Msgf("Could not delete secret '%s', "+
@@ -377,7 +694,20 @@ func (c calypsoCommand) deleteSmc(snap store.Snapshot, step execution.Step) erro
 		}
 	}
 
-	delete(c.secrets, smcPubKey(key))
+	err = deleteSmcSecrets(snap, key)
+	if err != nil {
+		return xerrors.Errorf("failed to delete secrets index of SMC '%s': %v", key, err)
+	}
+
+	err = removeSmc(snap, key)
+	if err != nil {
+		return xerrors.Errorf("failed to remove SMC '%s' from index: %v", key, err)
+	}
+
+	err = deleteSmcLinks(snap, key)
+	if err != nil {
+		return xerrors.Errorf("failed to delete links of SMC '%s': %v", key, err)
+	}
 
 	return nil
 }
@@ -386,13 +716,18 @@ func (c calypsoCommand) deleteSmc(snap store.Snapshot, step execution.Step) erro
 func (c calypsoCommand) listSmc(snap store.Snapshot) error {
 	res := []string{}
 
-	for k := range c.secrets {
-		v, err := getSmcRoster(snap, []byte(k))
+	smcs, err := ListSmc(snap)
+	if err != nil {
+		return err
+	}
+
+	for _, smc := range smcs {
+		roster, err := smc.Roster.Encode()
 		if err != nil {
-			return xerrors.Errorf("failed to get key '%s': %v", k, err)
+			return err
 		}
 
-		res = append(res, fmt.Sprintf("%x=%s", k, v))
+		res = append(res, fmt.Sprintf("%x=%s", smc.Key, roster))
 	}
 
 	sort.Strings(res)
@@ -418,58 +753,119 @@ func (c calypsoCommand) createSecret(snap store.Snapshot, step execution.Step) e
 		return xerrors.Errorf(notFoundInTxArg, SecretArg)
 	}
 
-	_, ok := c.secrets[smcPubKey(smcKey)]
-	if !ok {
+	policy, err := parsePolicy(step)
+	if err != nil {
+		return xerrors.Errorf("failed to parse policy: %v", err)
+	}
+
+	window, err := parseWindow(step)
+	if err != nil {
+		return xerrors.Errorf("failed to parse window: %v", err)
+	}
+
+	found, err := hasSmc(snap, smcKey)
+	if err != nil {
+		return xerrors.Errorf("failed to get SMC '%s': %v", smcKey, err)
+	}
+
+	if !found {
 		return xerrors.Errorf(errorKeyNotFoundInSmcs, smcKey)
 	}
 
+	err = verifySecretValue(smcKey, name, secret)
+	if err != nil {
+		return xerrors.Errorf("invalid secret value: %v", err)
+	}
+
 	v, _ := getSecret(snap, name)
 	if v != nil {
 		return xerrors.Errorf("a secret named '%s' already exists", name)
 	}
 
-	err := setSecret(snap, name, secret)
+	err = setSecret(snap, name, secret)
 	if err != nil {
 		return xerrors.Errorf("failed to set secret: %v", err)
 	}
 
-	c.secrets[smcPubKey(smcKey)].addSecret(string(name))
+	err = setSecretOwner(snap, name, step.Current.GetIdentity())
+	if err != nil {
+		return xerrors.Errorf("failed to set owner: %v", err)
+	}
+
+	height, err := GetHeight(snap)
+	if err != nil {
+		return xerrors.Errorf("failed to get height: %v", err)
+	}
+
+	err = setSecretCreation(snap, name, Creation{Height: height})
+	if err != nil {
+		return xerrors.Errorf("failed to set creation: %v", err)
+	}
+
+	if policy != nil {
+		err = setSecretPolicy(snap, name, *policy)
+		if err != nil {
+			return xerrors.Errorf("failed to set policy: %v", err)
+		}
+	}
+
+	if window != nil {
+		err = setSecretWindow(snap, name, *window)
+		if err != nil {
+			return xerrors.Errorf("failed to set window: %v", err)
+		}
+	}
+
+	err = insertSmcSecret(snap, smcKey, name)
+	if err != nil {
+		return xerrors.Errorf("failed to index secret: %v", err)
+	}
 
 	return nil
 }
 
-// listSecrets implements commands. It performs the LIST_SECRETS command
-func (c calypsoCommand) listSecrets(snap store.Snapshot, step execution.Step) error {
-	res := []string{}
-
-	key := step.Current.GetArg(SmcPublicKeyArg)
-	if len(key) == 0 {
+// deleteSecret implements commands. It performs the DELETE_SECRET command.
+// Only the owner of the secret is allowed to delete it. The audit logs of the
+// secret are kept.
+func (c calypsoCommand) deleteSecret(snap store.Snapshot, step execution.Step) error {
+	smcKey := step.Current.GetArg(SmcPublicKeyArg)
+	if len(smcKey) == 0 {
 		return xerrors.Errorf(notFoundInTxArg, SmcPublicKeyArg)
 	}
 
-	_, found := c.secrets[smcPubKey(key)]
-	if !found {
-		return xerrors.Errorf("SMC not found: %s", key)
+	name := step.Current.GetArg(SecretNameArg)
+	if len(name) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SecretNameArg)
 	}
 
-	for k := range c.secrets[smcPubKey(key)] {
-		v, err := getSecret(snap, []byte(k))
-		if err != nil {
-			return xerrors.Errorf("failed to get key '%s': %v", k, err)
-		}
+	err := checkSmcSecret(snap, smcKey, name)
+	if err != nil {
+		return err
+	}
 
-		res = append(res, fmt.Sprintf("%s=%s", k, v))
+	err = checkSecretOwner(snap, name, step.Current.GetIdentity())
+	if err != nil {
+		return err
 	}
 
-	sort.Strings(res)
-	fmt.Fprint(c.printer, strings.Join(res, ","))
+	err = deleteSecret(snap, name)
+	if err != nil {
+		return xerrors.Errorf("failed to delete secret '%s': %v", name, err)
+	}
+
+	err = removeSmcSecret(snap, smcKey, name)
+	if err != nil {
+		return xerrors.Errorf("failed to remove secret '%s' from index: %v", name, err)
+	}
 
 	return nil
 }
 
-// revealSecret implements commands. It performs the REVEAL_SECRET command
-func (c calypsoCommand) revealSecret(snap store.Snapshot, step execution.Step) error {
-
+// updateSecret implements commands. It performs the UPDATE_SECRET command.
+// Only the owner of the secret is allowed to update it. The previous value is
+// kept as a version so that the access tokens computed on it can still be
+// interpreted.
+func (c calypsoCommand) updateSecret(snap store.Snapshot, step execution.Step) error {
 	smcKey := step.Current.GetArg(SmcPublicKeyArg)
 	if len(smcKey) == 0 {
 		return xerrors.Errorf(notFoundInTxArg, SmcPublicKeyArg)
@@ -480,54 +876,81 @@ func (c calypsoCommand) revealSecret(snap store.Snapshot, step execution.Step) e
 		return xerrors.Errorf(notFoundInTxArg, SecretNameArg)
 	}
 
-	clientPubKey := step.Current.GetArg(PubKeyArg)
-	if len(clientPubKey) == 0 {
-		return xerrors.Errorf(notFoundInTxArg, PubKeyArg)
+	secret := step.Current.GetArg(SecretArg)
+	if len(secret) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SecretArg)
 	}
 
-	smcSecrets, ok := c.secrets[smcPubKey(smcKey)]
-	if !ok {
-		return xerrors.Errorf(errorKeyNotFoundInSmcs, smcKey)
+	err := checkSmcSecret(snap, smcKey, name)
+	if err != nil {
+		return err
 	}
 
-	_, found := smcSecrets[string(name)]
+	err = checkSecretOwner(snap, name, step.Current.GetIdentity())
+	if err != nil {
+		return err
+	}
 
-	if !found {
-		return xerrors.Errorf(
-			"'%s' was not found among the secrets of the smc (%v)",
-			name, string(smcKey))
+	err = verifySecretValue(smcKey, name, secret)
+	if err != nil {
+		return xerrors.Errorf("invalid secret value: %v", err)
 	}
 
-	secret, err := getSecret(snap, name)
+	previous, err := getSecret(snap, name)
 	if err != nil {
 		return xerrors.Errorf("failed to get secret '%s': %v", name, err)
 	}
 
-	accessToken := computeAccessToken(smcKey, secret, clientPubKey)
+	err = appendSecretVersion(snap, name, previous)
+	if err != nil {
+		return xerrors.Errorf("failed to keep previous version: %v", err)
+	}
 
-	if hasSecretAccess(snap, accessToken) {
-		return nil
+	err = setSecret(snap, name, secret)
+	if err != nil {
+		return xerrors.Errorf("failed to set secret: %v", err)
 	}
 
-	err = setSecretAccess(snap, accessToken, clientPubKey)
+	return nil
+}
+
+// listSecrets implements commands. It performs the LIST_SECRETS command
+func (c calypsoCommand) listSecrets(snap store.Snapshot, step execution.Step) error {
+	res := []string{}
+
+	key := step.Current.GetArg(SmcPublicKeyArg)
+	if len(key) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SmcPublicKeyArg)
+	}
+
+	secrets, err := ListSecrets(snap, key)
 	if err != nil {
-		return xerrors.Errorf("failed to persist secret reveal: %v", err)
+		return err
 	}
 
-	err = insertAuditLog(snap, name, accessToken)
+	height, err := GetHeight(snap)
 	if err != nil {
-		return xerrors.Errorf("failed to persist secret audit log: %v", err)
+		return xerrors.Errorf("failed to get height: %v", err)
 	}
 
-	dela.Logger.Info().
-		Str("contract", ContractName).
-		Msgf("revealed secret %x to %s", name, step.Current.GetIdentity())
+	for _, secret := range secrets {
+		if secret.IsExpired(height) {
+			res = append(res, fmt.Sprintf("%s=%s (expired)", secret.Name, secret.Value))
+			continue
+		}
+
+		res = append(res, fmt.Sprintf("%s=%s", secret.Name, secret.Value))
+	}
+
+	sort.Strings(res)
+	fmt.Fprint(c.printer, strings.Join(res, ","))
 
 	return nil
 }
 
-// listAuditLogs implements commands. It performs the LIST_AUDIT_LOGS command
-func (c calypsoCommand) listAuditLogs(snap store.Snapshot, step execution.Step) error {
+// revealSecret implements commands. It performs the REVEAL_SECRET command
+func (c calypsoCommand) revealSecret(snap store.Snapshot, step execution.Step) error {
+
 	smcKey := step.Current.GetArg(SmcPublicKeyArg)
 	if len(smcKey) == 0 {
 		return xerrors.Errorf(notFoundInTxArg, SmcPublicKeyArg)
@@ -538,34 +961,70 @@ func (c calypsoCommand) listAuditLogs(snap store.Snapshot, step execution.Step)
 		return xerrors.Errorf(notFoundInTxArg, SecretNameArg)
 	}
 
-	smcSecrets, ok := c.secrets[smcPubKey(smcKey)]
-	if !ok {
-		return xerrors.Errorf(errorKeyNotFoundInSmcs, smcKey)
+	clientPubKey := step.Current.GetArg(PubKeyArg)
+	if len(clientPubKey) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, PubKeyArg)
 	}
 
-	_, found := smcSecrets[string(name)]
+	err := checkSmcSecret(snap, smcKey, name)
+	if err != nil {
+		return err
+	}
 
-	if !found {
-		return xerrors.Errorf(
-			"'%s' was not found among the secrets of the smc (%v)",
-			name, smcKey)
+	err = checkSecretPolicy(c.access, snap, name, clientPubKey, step.Current.GetIdentity())
+	if err != nil {
+		return err
+	}
+
+	height, err := GetHeight(snap)
+	if err != nil {
+		return xerrors.Errorf("failed to get height: %v", err)
 	}
 
-	logs, err := getAuditLogs(snap, name)
+	err = checkSecretWindow(snap, name, height)
 	if err != nil {
-		return xerrors.Errorf("failed to get audit logs for '%s': %v", name, err)
+		return err
 	}
 
-	fmt.Fprintf(c.printer, "Audit logs for secret '%s':\n", name)
+	err = checkRevocation(snap, name, clientPubKey)
+	if err != nil {
+		return err
+	}
 
-	for _, log := range logs {
-		pubKey, err := getSecretAccess(snap, log)
-		if err != nil {
-			return xerrors.Errorf("failed to get public key for access token '%s': %v", log, err)
-		}
-		fmt.Fprintf(c.printer, "%x\n", pubKey)
+	secret, err := getSecret(snap, name)
+	if err != nil {
+		return xerrors.Errorf("failed to get secret '%s': %v", name, err)
+	}
+
+	accessToken := computeAccessToken(smcKey, secret, clientPubKey)
+
+	err = checkRevealNonce(snap, accessToken, step.Current.GetArg(RevealNonceArg))
+	if err != nil {
+		return err
+	}
+
+	// every reveal is logged, a repeated one only updates the access record
+	record, err := recordSecretAccess(snap, accessToken, clientPubKey, height)
+	if err != nil {
+		return xerrors.Errorf("failed to persist secret reveal: %v", err)
+	}
+
+	entry, err := c.newAuditEntry(snap, step, AuditReveal, accessToken, clientPubKey)
+	if err != nil {
+		return xerrors.Errorf("failed to create audit entry: %v", err)
+	}
+
+	entry.Reveal = record.Reveals
+
+	err = insertAuditLog(snap, name, entry)
+	if err != nil {
+		return xerrors.Errorf("failed to persist secret audit log: %v", err)
 	}
 
+	dela.Logger.Info().
+		Str("contract", ContractName).
+		Msgf("revealed secret %x to %s", name, step.Current.GetIdentity())
+
 	return nil
 }
 
@@ -584,7 +1043,33 @@ func (h infoLog) Write(p []byte) (int, error) {
 // Utility functions
 //
 
-func getSmcRoster(snap store.Snapshot, key []byte) ([]byte, error) {
+// checkSmcSecret returns an error if the SMC does not exist or if the secret
+// is not bound to it.
+func checkSmcSecret(snap store.Readable, smcKey []byte, name []byte) error {
+	found, err := hasSmc(snap, smcKey)
+	if err != nil {
+		return xerrors.Errorf("failed to get SMC '%s': %v", smcKey, err)
+	}
+
+	if !found {
+		return xerrors.Errorf(errorKeyNotFoundInSmcs, smcKey)
+	}
+
+	secrets, err := getSmcSecrets(snap, smcKey)
+	if err != nil {
+		return xerrors.Errorf("failed to get secrets of SMC '%s': %v", smcKey, err)
+	}
+
+	if !containsKey(secrets, name) {
+		return xerrors.Errorf(
+			"'%s' was not found among the secrets of the smc (%v)",
+			name, string(smcKey))
+	}
+
+	return nil
+}
+
+func getSmcRoster(snap store.Readable, key []byte) ([]byte, error) {
 	k := prefixed.NewPrefixedKey([]byte(PrefixSmcRosterKeys), key)
 	roster, err := snap.Get(k)
 	if err != nil {
@@ -607,7 +1092,7 @@ func setSmcRoster(snap store.Snapshot, key []byte, roster []byte) error {
 	return nil
 }
 
-func getSecret(snap store.Snapshot, key []byte) ([]byte, error) {
+func getSecret(snap store.Readable, key []byte) ([]byte, error) {
 	k := prefixed.NewPrefixedKey([]byte(PrefixSecretKeys), key)
 	secret, err := snap.Get(k)
 	if secret == nil {
@@ -638,10 +1123,15 @@ func setSecret(snap store.Snapshot, key []byte, secret []byte) error {
 }
 
 func deleteSecret(snap store.Snapshot, key []byte) error {
-	k := prefixed.NewPrefixedKey([]byte(PrefixSecretKeys), key)
-	err := snap.Delete(k)
-	if err != nil {
-		return xerrors.Errorf("failed to delete from snapshot: %v", err)
+	prefixes := []string{PrefixSecretKeys, PrefixPolicyKeys, PrefixOwnerKeys,
+		PrefixVersionKeys, PrefixWindowKeys, PrefixCreationKeys, PrefixRevocationKeys}
+
+	for _, prefix := range prefixes {
+		k := prefixed.NewPrefixedKey([]byte(prefix), key)
+		err := snap.Delete(k)
+		if err != nil {
+			return xerrors.Errorf("failed to delete from snapshot: %v", err)
+		}
 	}
 
 	dela.Logger.Info().
@@ -651,6 +1141,74 @@ func deleteSecret(snap store.Snapshot, key []byte) error {
 	return nil
 }
 
+// getSecretVersions returns the previous values of the secret, oldest first.
+func getSecretVersions(snap store.Readable, name []byte) ([][]byte, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixVersionKeys), name)
+	buf, err := snap.Get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) == 0 {
+		return [][]byte{}, nil
+	}
+
+	var versions [][]byte
+	err = json.Unmarshal(buf, &versions)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode versions: %v", err)
+	}
+
+	return versions, nil
+}
+
+func appendSecretVersion(snap store.Snapshot, name []byte, value []byte) error {
+	versions, err := getSecretVersions(snap, name)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(append(versions, value))
+	if err != nil {
+		return xerrors.Errorf("failed to encode versions: %v", err)
+	}
+
+	k := prefixed.NewPrefixedKey([]byte(PrefixVersionKeys), name)
+	return snap.Set(k, buf)
+}
+
+// getSecretCreation returns the creation of the secret, or nil if it was
+// created before the creations were recorded.
+func getSecretCreation(snap store.Readable, name []byte) (*Creation, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixCreationKeys), name)
+	buf, err := snap.Get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) == 0 {
+		return nil, nil
+	}
+
+	var creation Creation
+	err = json.Unmarshal(buf, &creation)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode creation: %v", err)
+	}
+
+	return &creation, nil
+}
+
+func setSecretCreation(snap store.Snapshot, name []byte, creation Creation) error {
+	buf, err := json.Marshal(creation)
+	if err != nil {
+		return xerrors.Errorf("failed to encode creation: %v", err)
+	}
+
+	k := prefixed.NewPrefixedKey([]byte(PrefixCreationKeys), name)
+	return snap.Set(k, buf)
+}
+
 func computeAccessToken(smcKey []byte, secret []byte, clientPubKey []byte) []byte {
 	h := crypto.NewHashFactory(crypto.Sha256).New()
 	h.Write(smcKey)
@@ -659,82 +1217,125 @@ func computeAccessToken(smcKey []byte, secret []byte, clientPubKey []byte) []byt
 	return h.Sum(nil)
 }
 
-func hasSecretAccess(snap store.Snapshot, accessToken []byte) bool {
-	_, err := getSecretAccess(snap, accessToken)
-	return err != nil
-}
-
-func getSecretAccess(snap store.Snapshot, accessToken []byte) ([]byte, error) {
-	k := prefixed.NewPrefixedKey([]byte(PrefixAccessKeys), accessToken)
-	pubKey, err := snap.Get(k)
+func hasSmc(snap store.Readable, key []byte) (bool, error) {
+	smcs, err := getSmcList(snap)
 	if err != nil {
-		return nil, xerrors.Errorf(
-			"failed to get access token '%v': %v", accessToken, err)
+		return false, err
 	}
 
-	return pubKey, nil
+	return containsKey(smcs, key), nil
 }
 
-func setSecretAccess(snap store.Snapshot, accessToken []byte, pubKey []byte) error {
-	k := prefixed.NewPrefixedKey([]byte(PrefixAccessKeys), accessToken)
-	err := snap.Set(k, pubKey)
-	if err != nil {
-		return xerrors.Errorf(
-			"failed to give secret '%v' access to '%v': %v", accessToken, pubKey, err)
-	}
+func getSmcList(snap store.Readable) ([][]byte, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixSmcListKeys), nil)
+	return getKeyList(snap, k)
+}
 
-	dela.Logger.Info().
-		Str("contract", ContractName).
-		Msgf("setting secret access %x=%s", accessToken, pubKey)
+func insertSmc(snap store.Snapshot, key []byte) error {
+	k := prefixed.NewPrefixedKey([]byte(PrefixSmcListKeys), nil)
+	return insertKeyList(snap, k, key)
+}
 
-	return nil
+func removeSmc(snap store.Snapshot, key []byte) error {
+	k := prefixed.NewPrefixedKey([]byte(PrefixSmcListKeys), nil)
+	return removeKeyList(snap, k, key)
+}
+
+func getSmcSecrets(snap store.Readable, smcKey []byte) ([][]byte, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixSmcIndexKeys), smcKey)
+	return getKeyList(snap, k)
+}
+
+func insertSmcSecret(snap store.Snapshot, smcKey []byte, name []byte) error {
+	k := prefixed.NewPrefixedKey([]byte(PrefixSmcIndexKeys), smcKey)
+	return insertKeyList(snap, k, name)
+}
+
+func removeSmcSecret(snap store.Snapshot, smcKey []byte, name []byte) error {
+	k := prefixed.NewPrefixedKey([]byte(PrefixSmcIndexKeys), smcKey)
+	return removeKeyList(snap, k, name)
+}
+
+func deleteSmcSecrets(snap store.Snapshot, smcKey []byte) error {
+	k := prefixed.NewPrefixedKey([]byte(PrefixSmcIndexKeys), smcKey)
+	return snap.Delete(k)
 }
 
-func insertAuditLog(snap store.Snapshot, name []byte, accessToken []byte) error {
-	k := prefixed.NewPrefixedKey([]byte(PrefixListKeys), name)
-	log, err := snap.Get(k)
+// getKeyList reads the sorted list of keys stored at k. A missing entry is an
+// empty list.
+func getKeyList(snap store.Readable, k []byte) ([][]byte, error) {
+	buf, err := snap.Get(k)
 	if err != nil {
-		log = make([]byte, 0, accessTokenNbBytes)
+		return nil, err
 	}
 
-	// log contains: [<accessToken1>, <accessToken2>, ...] , [][]byte
-	log = append(log, accessToken...)
+	if len(buf) == 0 {
+		return [][]byte{}, nil
+	}
 
-	err = snap.Set(k, log)
+	var list [][]byte
+	err = json.Unmarshal(buf, &list)
 	if err != nil {
-		return xerrors.Errorf(
-			"failed to insert audit log for secret '%v': %v", name, err)
+		return nil, xerrors.Errorf("failed to decode list: %v", err)
 	}
 
-	dela.Logger.Info().
-		Str("contract", ContractName).
-		Msgf("appending audit log %x=[%s]", name, accessToken)
+	return list, nil
+}
 
-	return nil
+func setKeyList(snap store.Snapshot, k []byte, list [][]byte) error {
+	buf, err := json.Marshal(list)
+	if err != nil {
+		return xerrors.Errorf("failed to encode list: %v", err)
+	}
+
+	return snap.Set(k, buf)
 }
 
-func getAuditLogs(snap store.Snapshot, name []byte) ([][]byte, error) {
-	k := prefixed.NewPrefixedKey([]byte(PrefixListKeys), name)
-	log, err := snap.Get(k)
+// insertKeyList adds the key to the list stored at k. The list is kept sorted
+// so that every node ends up with the same value.
+func insertKeyList(snap store.Snapshot, k []byte, key []byte) error {
+	list, err := getKeyList(snap, k)
 	if err != nil {
-		return [][]byte{}, err
+		return err
+	}
+
+	i := sort.Search(len(list), func(i int) bool {
+		return bytes.Compare(list[i], key) >= 0
+	})
+
+	if i < len(list) && bytes.Equal(list[i], key) {
+		return nil
 	}
 
-	return decodeAuditLog(log)
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = append([]byte{}, key...)
+
+	return setKeyList(snap, k, list)
 }
 
-func decodeAuditLog(log []byte) ([][]byte, error) {
-	// log contains: [<accessToken1>, <accessToken2>, ...] , [][]byte
-	// we need to split it in chunks of accessTokenNbBytes bytes (sha256)
-	// see computeAccessToken() above
-	if len(log)%accessTokenNbBytes != 0 {
-		return nil, xerrors.Errorf("invalid audit log length: %v", len(log))
+func removeKeyList(snap store.Snapshot, k []byte, key []byte) error {
+	list, err := getKeyList(snap, k)
+	if err != nil {
+		return err
+	}
+
+	res := make([][]byte, 0, len(list))
+	for _, e := range list {
+		if !bytes.Equal(e, key) {
+			res = append(res, e)
+		}
 	}
 
-	res := make([][]byte, 0, len(log)/accessTokenNbBytes)
-	for i := 0; i < len(log); i += accessTokenNbBytes {
-		res = append(res, log[i:i+accessTokenNbBytes])
+	return setKeyList(snap, k, res)
+}
+
+func containsKey(list [][]byte, key []byte) bool {
+	for _, e := range list {
+		if bytes.Equal(e, key) {
+			return true
+		}
 	}
 
-	return res, nil
+	return false
 }
@@ -2,7 +2,9 @@ package calypso
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -14,23 +16,40 @@ import (
 	"go.dedis.ch/dela/core/store/prefixed"
 	"go.dedis.ch/dela/core/txn"
 	"go.dedis.ch/dela/core/txn/signed"
+	"go.dedis.ch/dela/crypto"
+	"go.dedis.ch/dela/crypto/bls"
 	"go.dedis.ch/dela/testing/fake"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
 )
 
-func Test_secretSet_addSecret(t *testing.T) {
-	s := secretSet{}
-	secret := "some secret"
-
-	s.addSecret(secret)
+func Test_NewCreds(t *testing.T) {
+	creds := NewCreds(CmdRevealSecret)
 
-	require.Equal(t, 1, len(s))
-	require.Equal(t, struct{}{}, s[secret])
+	require.NotNilf(t, creds, "creds should not be nil")
+	require.Equal(t, []byte(ContractUID), creds.GetID())
+	require.Equal(t, ContractName+":"+string(CmdRevealSecret), creds.GetRule())
 }
 
-func Test_NewCreds(t *testing.T) {
-	creds := NewCreds()
+func Test_GetRoleCommands(t *testing.T) {
+	cmds, err := GetRoleCommands(RoleAdmin)
+	require.NoError(t, err)
+	require.Contains(t, cmds, CmdAdvertiseSmc)
+	require.Contains(t, cmds, CmdDeleteSmc)
+	require.Contains(t, cmds, CmdMigrateSecrets)
+	require.NotContains(t, cmds, CmdRevealSecret)
 
-	require.NotNilf(t, creds, "creds should not be nil")
+	cmds, err = GetRoleCommands(RolePublisher)
+	require.NoError(t, err)
+	require.Contains(t, cmds, CmdCreateSecret)
+	require.NotContains(t, cmds, CmdDeleteSmc)
+
+	cmds, err = GetRoleCommands(RoleReader)
+	require.NoError(t, err)
+	require.Contains(t, cmds, CmdRevealSecret)
+	require.NotContains(t, cmds, CmdAdvertiseSmc)
+
+	_, err = GetRoleCommands("fake")
+	require.EqualError(t, err, "unknown role: fake")
 }
 
 func Test_RegisterContract(_ *testing.T) {
@@ -41,7 +60,6 @@ func Test_NewContract(t *testing.T) {
 	contract := NewContract(fakeAccess{})
 
 	require.NotNilf(t, contract, "contract should not be nil")
-	require.NotNilf(t, contract.secrets, "secrets should not be nil")
 	require.NotNilf(t, contract.printer, "printer should not be nil")
 	require.NotNilf(t, contract.cmd, "cmd should not be nil")
 	require.NotNilf(t, contract.access, "access should not be nil")
@@ -57,7 +75,7 @@ func TestContract_UID(t *testing.T) {
 func TestExecuteFailing(t *testing.T) {
 	contract := NewContract(fakeAccess{err: fake.GetError()})
 
-	err := contract.Execute(fakeStore{}, makeStep(t))
+	err := contract.Execute(fakeStore{}, makeStep(t, CmdArg, "LIST_SMC"))
 	require.EqualError(t, err,
 		"identity not authorized: fake.PublicKey ("+fake.GetError().Error()+")")
 
@@ -65,6 +83,14 @@ func TestExecuteFailing(t *testing.T) {
 	err = contract.Execute(fakeStore{}, makeStep(t))
 	require.EqualError(t, err, "'calypso:command' not found in tx arg")
 
+	contract.blocks = &fakeBlockInfo{err: fake.GetError()}
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "LIST_SMC"))
+	require.EqualError(t, err,
+		fake.Err("failed to record height: failed to get block index"))
+
+	contract.blocks = noBlockInfo{}
+
 	contract.cmd = fakeCmd{err: fake.GetError()}
 
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "ADVERTISE_SMC"))
@@ -76,6 +102,9 @@ func TestExecuteFailing(t *testing.T) {
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "LIST_SMC"))
 	require.EqualError(t, err, fake.Err("failed to LIST_SMC"))
 
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "MIGRATE_SECRETS"))
+	require.EqualError(t, err, fake.Err("failed to MIGRATE_SECRETS"))
+
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "CREATE_SECRET"))
 	require.EqualError(t, err, fake.Err("failed to CREATE_SECRET"))
 
@@ -88,6 +117,21 @@ func TestExecuteFailing(t *testing.T) {
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "LIST_AUDIT_LOG"))
 	require.EqualError(t, err, fake.Err("failed to LIST_AUDIT_LOG"))
 
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "LIST_READER_ACCESS"))
+	require.EqualError(t, err, fake.Err("failed to LIST_READER_ACCESS"))
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "REVOKE_ACCESS"))
+	require.EqualError(t, err, fake.Err("failed to REVOKE_ACCESS"))
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "UPDATE_POLICY"))
+	require.EqualError(t, err, fake.Err("failed to UPDATE_POLICY"))
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "DELETE_SECRET"))
+	require.EqualError(t, err, fake.Err("failed to DELETE_SECRET"))
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "UPDATE_SECRET"))
+	require.EqualError(t, err, fake.Err("failed to UPDATE_SECRET"))
+
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "fake"))
 	require.EqualError(t, err, "unknown command: fake")
 }
@@ -105,6 +149,9 @@ func TestExecutePassing(t *testing.T) {
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "LIST_SMC"))
 	require.NoError(t, err)
 
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "MIGRATE_SECRETS"))
+	require.NoError(t, err)
+
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "CREATE_SECRET"))
 	require.NoError(t, err)
 
@@ -117,10 +164,51 @@ func TestExecutePassing(t *testing.T) {
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "LIST_AUDIT_LOG"))
 	require.NoError(t, err)
 
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "LIST_READER_ACCESS"))
+	require.NoError(t, err)
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "REVOKE_ACCESS"))
+	require.NoError(t, err)
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "UPDATE_POLICY"))
+	require.NoError(t, err)
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "DELETE_SECRET"))
+	require.NoError(t, err)
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "UPDATE_SECRET"))
+	require.NoError(t, err)
+
 	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, "fake"))
 	require.EqualError(t, err, "unknown command: fake")
 }
 
+func TestExecute_PerCommandAccess(t *testing.T) {
+	access := fakeAccess{
+		rules: map[string]struct{}{
+			ContractName + ":" + string(CmdListSecrets): {},
+		},
+	}
+
+	contract := NewContract(access)
+	contract.cmd = fakeCmd{}
+
+	err := contract.Execute(fakeStore{}, makeStep(t, CmdArg, string(CmdListSecrets)))
+	require.NoError(t, err)
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, string(CmdDeleteSmc)))
+	require.ErrorContains(t, err, "identity not authorized")
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, string(CmdAdvertiseSmc)))
+	require.ErrorContains(t, err, "identity not authorized")
+
+	// the credential for all the commands is still honoured
+	access.rules[ContractName+":"+credentialAllCommand] = struct{}{}
+
+	err = contract.Execute(fakeStore{}, makeStep(t, CmdArg, string(CmdDeleteSmc)))
+	require.NoError(t, err)
+}
+
 func TestCommand_AdvertiseSmc(t *testing.T) {
 	contract := NewContract(fakeAccess{})
 
@@ -128,8 +216,7 @@ func TestCommand_AdvertiseSmc(t *testing.T) {
 		Contract: &contract,
 	}
 
-	keyString := "dummy"
-	keySmc := smcPubKey(keyString)
+	keyString := testSmcKey
 	keyBytes := []byte(keyString)
 
 	err := cmd.advertiseSmc(fake.NewSnapshot(), makeStep(t))
@@ -139,33 +226,35 @@ func TestCommand_AdvertiseSmc(t *testing.T) {
 	require.EqualError(t, err, "'calypso:smc_roster' not found in tx arg")
 
 	err = cmd.advertiseSmc(fake.NewBadSnapshot(),
-		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, "node:12345"))
-	require.EqualError(t, err, fake.Err("failed to set roster"))
+		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, keyString, makeRoster(t, "node:12345"))))
+	require.EqualError(t, err, fake.Err("failed to get nonce of '"+keyString+"'"))
 
 	err = cmd.advertiseSmc(fake.NewBadSnapshot(),
-		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, ","))
-	require.ErrorContains(t, err, "invalid node '' in roster")
+		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, "node:12345"))
+	require.ErrorContains(t, err, "invalid roster: failed to decode roster: ")
 
 	err = cmd.advertiseSmc(fake.NewBadSnapshot(),
-		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, "abcd"))
+		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, makeRoster(t, "abcd"), SmcProofArg, makeSmcProof(t, keyString, makeRoster(t, "abcd"))))
 	require.ErrorContains(t, err, "invalid node 'abcd' in roster")
 
 	snapshot := fake.NewSnapshot()
 
-	_, found := contract.secrets[keySmc]
+	found, err := hasSmc(snapshot, keyBytes)
+	require.NoError(t, err)
 	require.False(t, found)
 
 	err = cmd.advertiseSmc(snapshot,
-		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, "node:12345"))
+		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, keyString, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
-	_, found = contract.secrets[keySmc]
+	found, err = hasSmc(snapshot, keyBytes)
+	require.NoError(t, err)
 	require.True(t, found)
 
 	k := prefixed.NewPrefixedKey([]byte(PrefixSmcRosterKeys), keyBytes)
 	res, err := snapshot.Get(k)
 	require.NoError(t, err)
-	require.Equal(t, "node:12345", string(res))
+	require.Equal(t, makeRoster(t, "node:12345"), string(res))
 }
 
 func TestCommand_DeleteSmc(t *testing.T) {
@@ -175,8 +264,7 @@ func TestCommand_DeleteSmc(t *testing.T) {
 		Contract: &contract,
 	}
 
-	keyString := "dummy"
-	keySmc := smcPubKey("dummy")
+	keyString := testSmcKey
 	keyBytes := []byte(keyString)
 	keyHex := hex.EncodeToString(keyBytes)
 
@@ -187,9 +275,13 @@ func TestCommand_DeleteSmc(t *testing.T) {
 	require.EqualError(t, err, fake.Err("failed to delete SMC with public key '"+keyHex+"'"))
 
 	snap := fake.NewSnapshot()
-	err = snap.Set(keyBytes, []byte("localhost:12345"))
+	err = cmd.advertiseSmc(snap,
+		makeStep(t, SmcPublicKeyArg, keyString, RosterArg, makeRoster(t, "localhost:12345"), SmcProofArg, makeSmcProof(t, keyString, makeRoster(t, "localhost:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap,
+		makeStep(t, SmcPublicKeyArg, keyString, SecretNameArg, "name", SecretArg, makeSecret(t, keyString, "name", "value")))
 	require.NoError(t, err)
-	contract.secrets[keySmc] = secretSet{}
 
 	err = cmd.deleteSmc(snap, makeStep(t, SmcPublicKeyArg, keyString))
 	require.NoError(t, err)
@@ -199,25 +291,29 @@ func TestCommand_DeleteSmc(t *testing.T) {
 	require.Nil(t, err) // == key not found
 	require.Nil(t, res)
 
-	_, found := contract.secrets[keySmc]
+	found, err := hasSmc(snap, keyBytes)
+	require.NoError(t, err)
 	require.False(t, found)
+
+	secrets, err := getSmcSecrets(snap, keyBytes)
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+
+	secret, err := getSecret(snap, []byte("name"))
+	require.Error(t, err)
+	require.Nil(t, secret)
 }
 
 func TestCommand_ListSmc(t *testing.T) {
 	contract := NewContract(fakeAccess{})
 
 	key1String := "key1"
-	key1Smc := smcPubKey(key1String)
 	key1Bytes := []byte(key1String)
-	roster1 := "localhost:12345"
+	roster1 := makeRoster(t, "localhost:12345")
 
 	key2String := "key2"
-	key2Smc := smcPubKey(key2String)
 	key2Bytes := []byte(key2String)
-	roster2 := "localhost:12345,remote:54321"
-
-	contract.secrets[key1Smc] = secretSet{}
-	contract.secrets[key2Smc] = secretSet{}
+	roster2 := makeRoster(t, "localhost:12345", "remote:54321")
 
 	buf := &bytes.Buffer{}
 	contract.printer = buf
@@ -236,6 +332,12 @@ func TestCommand_ListSmc(t *testing.T) {
 	err = snap.Set(k, []byte(roster2))
 	require.NoError(t, err)
 
+	err = insertSmc(snap, key2Bytes)
+	require.NoError(t, err)
+
+	err = insertSmc(snap, key1Bytes)
+	require.NoError(t, err)
+
 	err = cmd.listSmc(snap)
 	require.NoError(t, err)
 
@@ -243,8 +345,7 @@ func TestCommand_ListSmc(t *testing.T) {
 		buf.String())
 
 	err = cmd.listSmc(fake.NewBadSnapshot())
-	// we can't assume an order from the map
-	require.Regexp(t, "^failed to get key", err.Error())
+	require.EqualError(t, err, fake.Err("failed to get SMC list"))
 }
 
 func TestCommand_CreateSecret_BadSnapshot(t *testing.T) {
@@ -259,14 +360,14 @@ func TestCommand_CreateSecret_BadSnapshot(t *testing.T) {
 	badSnap.ErrRead = nil  // temporarily disable errors
 	badSnap.ErrWrite = nil // temporarily disable errors
 
-	err := cmd.advertiseSmc(badSnap, makeStep(t, SmcPublicKeyArg, "dummy", RosterArg, "node:12345"))
+	err := cmd.advertiseSmc(badSnap, makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
 	badSnap.ErrWrite = fake.GetError() // re-enable errors
 
 	// Act
 	err = cmd.createSecret(badSnap,
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "name", SecretArg, "value"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "value")))
 
 	// Assert
 	require.EqualError(t, err, fake.Err("failed to set secret"))
@@ -282,16 +383,16 @@ func TestCommand_CreateSecret_AlreadyExists(t *testing.T) {
 
 	badSnap := fake.NewSnapshot()
 
-	err := cmd.advertiseSmc(badSnap, makeStep(t, SmcPublicKeyArg, "dummy", RosterArg, "node:12345"))
+	err := cmd.advertiseSmc(badSnap, makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
 	err = cmd.createSecret(badSnap,
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "name", SecretArg, "value"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "value")))
 	require.NoError(t, err)
 
 	// Act
 	err = cmd.createSecret(badSnap,
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "name", SecretArg, "other_value"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "other_value")))
 
 	// Assert
 	require.EqualError(t, err, "a secret named 'name' already exists")
@@ -306,29 +407,29 @@ func TestCommand_CreateSecret_Succeeds(t *testing.T) {
 	}
 
 	snap := fake.NewSnapshot()
-	err := cmd.advertiseSmc(snap, makeStep(t, SmcPublicKeyArg, "dummy", RosterArg, "node:12345"))
+	err := cmd.advertiseSmc(snap, makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
 	// Verify pre-conditions
-	dummy, found := contract.secrets["dummy"]
-	require.True(t, found)
+	dummy, err := getSmcSecrets(snap, []byte(testSmcKey))
+	require.NoError(t, err)
 	require.Equal(t, 0, len(dummy))
 
 	// Act
 	err = cmd.createSecret(snap,
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "my_secret", SecretArg, "my_value"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "my_secret", SecretArg, makeSecret(t, testSmcKey, "my_secret", "my_value")))
 
 	// Assert
 	require.NoError(t, err)
 
-	dummy = contract.secrets[smcPubKey("dummy")]
-	require.Equal(t, 1, len(dummy))
-	require.Equal(t, dummy["my_value"], struct{}{})
+	dummy, err = getSmcSecrets(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("my_secret")}, dummy)
 
 	k := prefixed.NewPrefixedKey([]byte(PrefixSecretKeys), []byte("my_secret"))
 	res, err := snap.Get(k)
 	require.NoError(t, err)
-	require.Equal(t, "my_value", string(res))
+	require.Equal(t, makeSecret(t, testSmcKey, "my_secret", "my_value"), string(res))
 }
 
 func TestCommand_CreateSecret_InvalidInputs(t *testing.T) {
@@ -346,19 +447,19 @@ func TestCommand_CreateSecret_InvalidInputs(t *testing.T) {
 	require.EqualError(t, err, "'calypso:smc_key' not found in tx arg")
 
 	err = cmd.createSecret(fake.NewSnapshot(),
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "name"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name"))
 	require.EqualError(t, err, "'calypso:secret_value' not found in tx arg")
 
 	err = cmd.createSecret(fake.NewSnapshot(),
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretArg, "value"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretArg, "value"))
 	require.EqualError(t, err, "'calypso:secret_name' not found in tx arg")
 
 	err = cmd.createSecret(fake.NewSnapshot(),
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "name", SecretArg, ""))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, ""))
 	require.ErrorContains(t, err, "'calypso:secret_value' not found in tx arg")
 
 	err = cmd.createSecret(fake.NewSnapshot(),
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "", SecretArg, "value"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "", SecretArg, makeSecret(t, testSmcKey, "", "value")))
 	require.ErrorContains(t, err, "'calypso:secret_name' not found in tx arg")
 
 	err = cmd.createSecret(fake.NewSnapshot(),
@@ -366,9 +467,103 @@ func TestCommand_CreateSecret_InvalidInputs(t *testing.T) {
 	require.ErrorContains(t, err, "'invalid' was not found among the SMCs")
 }
 
+func TestCommand_DeleteSecret(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	err := cmd.advertiseSmc(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "value")))
+	require.NoError(t, err)
+
+	err = cmd.deleteSecret(snap, makeStep(t, SecretNameArg, "name"))
+	require.EqualError(t, err, "'calypso:smc_key' not found in tx arg")
+
+	err = cmd.deleteSecret(snap, makeStep(t, SmcPublicKeyArg, testSmcKey))
+	require.EqualError(t, err, "'calypso:secret_name' not found in tx arg")
+
+	err = cmd.deleteSecret(snap, makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "other"))
+	require.EqualError(t, err, "'other' was not found among the secrets of the smc ("+testSmcKey+")")
+
+	other := bls.NewSigner().GetPublicKey()
+	err = cmd.deleteSecret(snap,
+		makeStepWithIdentity(t, other, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name"))
+	require.ErrorContains(t, err, "is not the owner of 'name'")
+
+	err = cmd.deleteSecret(snap, makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name"))
+	require.NoError(t, err)
+
+	secrets, err := getSmcSecrets(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+
+	_, err = getSecret(snap, []byte("name"))
+	require.Error(t, err)
+
+	owner, err := getSecretOwner(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Nil(t, owner)
+}
+
+func TestCommand_UpdateSecret(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	err := cmd.advertiseSmc(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "value1")))
+	require.NoError(t, err)
+
+	err = cmd.updateSecret(snap, makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name"))
+	require.EqualError(t, err, "'calypso:secret_value' not found in tx arg")
+
+	other := bls.NewSigner().GetPublicKey()
+	err = cmd.updateSecret(snap, makeStepWithIdentity(t, other,
+		SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, "value2"))
+	require.ErrorContains(t, err, "is not the owner of 'name'")
+
+	err = cmd.updateSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "value2")))
+	require.NoError(t, err)
+
+	err = cmd.updateSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "value3")))
+	require.NoError(t, err)
+
+	value, err := getSecret(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Equal(t, makeSecret(t, testSmcKey, "name", "value3"), string(value))
+
+	versions, err := getSecretVersions(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{
+		[]byte(makeSecret(t, testSmcKey, "name", "value1")),
+		[]byte(makeSecret(t, testSmcKey, "name", "value2")),
+	}, versions)
+
+	badSnap := fake.NewBadSnapshot()
+	err = cmd.updateSecret(badSnap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "value2")))
+	require.EqualError(t, err, fake.Err("failed to get SMC '"+testSmcKey+"'"))
+}
+
 func TestCommand_ListSecrets(t *testing.T) {
 
-	// Arrange (2 SMCs, "dummy" has 2 secrets, "other" has 1)
+	// Arrange (2 SMCs, the first has 2 secrets, the other has 1)
 
 	contract := NewContract(fakeAccess{})
 
@@ -382,43 +577,42 @@ func TestCommand_ListSecrets(t *testing.T) {
 	snap := fake.NewSnapshot()
 
 	err := cmd.advertiseSmc(snap,
-		makeStep(t, SmcPublicKeyArg, "dummy", RosterArg, "node:12345"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
 	err = cmd.advertiseSmc(snap,
-		makeStep(t, SmcPublicKeyArg, "other", RosterArg, "node:32145"))
+		makeStep(t, SmcPublicKeyArg, otherSmcKey, RosterArg, makeRoster(t, "node:32145"), SmcProofArg, makeSmcProof(t, otherSmcKey, makeRoster(t, "node:32145"))))
 	require.NoError(t, err)
 
 	err = cmd.createSecret(snap,
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "name1", SecretArg, "secret1"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name1", SecretArg, makeSecret(t, testSmcKey, "name1", "secret1")))
 	require.NoError(t, err)
 
 	err = cmd.createSecret(snap,
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "name2", SecretArg, "secret2"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name2", SecretArg, makeSecret(t, testSmcKey, "name2", "secret2")))
 	require.NoError(t, err)
 
 	err = cmd.createSecret(snap,
-		makeStep(t, SmcPublicKeyArg, "other", SecretNameArg, "name3", SecretArg, "secret3"))
+		makeStep(t, SmcPublicKeyArg, otherSmcKey, SecretNameArg, "name3", SecretArg, makeSecret(t, otherSmcKey, "name3", "secret3")))
 	require.NoError(t, err)
 
 	// Verify pre-conditions
-	_, found := contract.secrets["dummy"]
-	require.True(t, found)
-
-	require.Equal(t, 2, len(contract.secrets["dummy"]))
-
-	_, found = contract.secrets["other"]
-	require.True(t, found)
+	dummy, err := getSmcSecrets(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(dummy))
 
-	require.Equal(t, 1, len(contract.secrets["other"]))
+	other, err := getSmcSecrets(snap, []byte(otherSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(other))
 
 	// Act
 	err = cmd.listSecrets(snap,
-		makeStep(t, SmcPublicKeyArg, "dummy"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey))
 
 	// Assert
 	require.NoError(t, err)
-	require.Equal(t, "name1=secret1,name2=secret2", buf.String())
+	require.Equal(t, "name1="+makeSecret(t, testSmcKey, "name1", "secret1")+
+		",name2="+makeSecret(t, testSmcKey, "name2", "secret2"), buf.String())
 }
 
 func TestCommand_ListSecrets_EmptySmcKey(t *testing.T) {
@@ -472,21 +666,21 @@ func TestCommand_ListSecrets_InvalidSnapshot(t *testing.T) {
 	snap.ErrWrite = nil
 	snap.ErrRead = nil
 
-	err := cmd.advertiseSmc(snap, makeStep(t, SmcPublicKeyArg, "dummy", RosterArg, "node:12345"))
+	err := cmd.advertiseSmc(snap, makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
 	err = cmd.createSecret(snap,
-		makeStep(t, SmcPublicKeyArg, "dummy", SecretNameArg, "name1", SecretArg, "secret1"))
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name1", SecretArg, makeSecret(t, testSmcKey, "name1", "secret1")))
 	require.NoError(t, err)
 
 	snap.ErrWrite = fake.GetError()
 	snap.ErrRead = fake.GetError()
 
 	// Act
-	err = cmd.listSecrets(snap, makeStep(t, SmcPublicKeyArg, "dummy"))
+	err = cmd.listSecrets(snap, makeStep(t, SmcPublicKeyArg, testSmcKey))
 
 	// Assert
-	require.ErrorContains(t, err, "failed to get key")
+	require.EqualError(t, err, fake.Err("failed to get SMC '"+testSmcKey+"'"))
 }
 
 func TestCommand_RevealSecret_Succeeds(t *testing.T) {
@@ -500,7 +694,7 @@ func TestCommand_RevealSecret_Succeeds(t *testing.T) {
 
 	snap := fake.NewSnapshot()
 	const (
-		smcKey      = "my_smc_key"
+		smcKey      = testSmcKey
 		secretName  = "my_secret"
 		secretValue = "my_value"
 	)
@@ -508,40 +702,53 @@ func TestCommand_RevealSecret_Succeeds(t *testing.T) {
 	err := cmd.advertiseSmc(snap,
 		makeStep(t,
 			SmcPublicKeyArg, smcKey,
-			RosterArg, "node:12345"))
+			RosterArg, makeRoster(t, "node:12345"),
+			SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
 	err = cmd.createSecret(snap,
 		makeStep(t,
 			SmcPublicKeyArg, smcKey,
 			SecretNameArg, secretName,
-			SecretArg, secretValue))
+			SecretArg, makeSecret(t, smcKey, secretName, secretValue)))
 	require.NoError(t, err)
 
 	// Verify pre-conditions
-	smcSecrets, found := contract.secrets[smcKey]
-	require.True(t, found)
-	require.Equal(t, 1, len(smcSecrets))
+	smcSecrets, err := getSmcSecrets(snap, []byte(smcKey))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(secretName)}, smcSecrets)
 
-	_, found = smcSecrets[secretName]
-	require.True(t, found)
+	setHeight(t, snap, 12)
 
 	// Act
-	err = cmd.revealSecret(snap,
-		makeStep(t,
-			SmcPublicKeyArg, smcKey,
-			SecretNameArg, secretName,
-			PubKeyArg, "my_pubkey"))
+	tx := makeTx(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, secretName,
+		PubKeyArg, "my_pubkey",
+		PurposeArg, "border control")
+
+	err = cmd.revealSecret(snap, execution.Step{Current: tx})
 
 	// Assert
 	require.NoError(t, err)
 
-	token := computeAccessToken([]byte(smcKey), []byte(secretValue), []byte("my_pubkey"))
+	token := computeAccessToken([]byte(smcKey),
+		[]byte(makeSecret(t, smcKey, secretName, secretValue)), []byte("my_pubkey"))
 
 	logs, err := getAuditLogs(snap, []byte(secretName))
 	require.NoError(t, err)
 	require.Len(t, logs, 1)
-	require.Equal(t, logs[0], token)
+	require.Equal(t, AuditEntry{
+		Version:     AuditEntryVersion,
+		Event:       AuditReveal,
+		AccessToken: token,
+		Reader:      []byte("my_pubkey"),
+		Identity:    "PK",
+		TxID:        tx.GetID(),
+		Height:      12,
+		Purpose:     "border control",
+		Reveal:      1,
+	}, logs[0])
 }
 
 func TestCommand_RevealSecretFails(t *testing.T) {
@@ -553,7 +760,7 @@ func TestCommand_RevealSecretFails(t *testing.T) {
 	snap := fake.NewSnapshot()
 
 	const (
-		smcKey      = "my_smc_key"
+		smcKey      = testSmcKey
 		secretName  = "my_secret"
 		secretValue = "my_value"
 		pubKey      = "my_pubkey"
@@ -562,23 +769,21 @@ func TestCommand_RevealSecretFails(t *testing.T) {
 	err := cmd.advertiseSmc(snap,
 		makeStep(t,
 			SmcPublicKeyArg, smcKey,
-			RosterArg, "node:12345"))
+			RosterArg, makeRoster(t, "node:12345"),
+			SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
 	err = cmd.createSecret(snap,
 		makeStep(t,
 			SmcPublicKeyArg, smcKey,
 			SecretNameArg, secretName,
-			SecretArg, secretValue))
+			SecretArg, makeSecret(t, smcKey, secretName, secretValue)))
 	require.NoError(t, err)
 
 	// Verify pre-conditions
-	smcSecrets, found := contract.secrets[smcKey]
-	require.True(t, found)
-	require.Equal(t, 1, len(smcSecrets))
-
-	_, found = smcSecrets[secretName]
-	require.True(t, found)
+	smcSecrets, err := getSmcSecrets(snap, []byte(smcKey))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(secretName)}, smcSecrets)
 
 	err = cmd.revealSecret(snap, makeStep(t,
 		SmcPublicKeyArg, "",
@@ -609,7 +814,32 @@ func TestCommand_RevealSecretFails(t *testing.T) {
 		SecretNameArg, "another_name",
 		PubKeyArg, pubKey))
 	require.EqualError(t, err,
-		"'another_name' was not found among the secrets of the smc (my_smc_key)")
+		"'another_name' was not found among the secrets of the smc ("+smcKey+")")
+
+	// the nonce is the number of reveals of the access token
+	reveal := func(nonce string) error {
+		return cmd.revealSecret(snap, makeStep(t,
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, secretName,
+			PubKeyArg, pubKey,
+			RevealNonceArg, nonce))
+	}
+
+	err = reveal("x")
+	require.ErrorContains(t, err, "invalid 'calypso:reveal_nonce': ")
+
+	err = reveal("1")
+	require.EqualError(t, err, "invalid reveal nonce 1, expected 0")
+
+	err = reveal("0")
+	require.NoError(t, err)
+
+	// the request of the reader can't be replayed
+	err = reveal("0")
+	require.EqualError(t, err, "invalid reveal nonce 0, expected 1")
+
+	err = reveal("1")
+	require.NoError(t, err)
 }
 
 func TestCommand_ListAuditLogs_Succeeds(t *testing.T) {
@@ -627,7 +857,7 @@ func TestCommand_ListAuditLogs_Succeeds(t *testing.T) {
 	snap := fake.NewSnapshot()
 
 	const (
-		smcKey      = "my_smc_key"
+		smcKey      = testSmcKey
 		secretName  = "my_secret"
 		secretValue = "my_value"
 	)
@@ -635,29 +865,28 @@ func TestCommand_ListAuditLogs_Succeeds(t *testing.T) {
 	err := cmd.advertiseSmc(snap,
 		makeStep(t,
 			SmcPublicKeyArg, smcKey,
-			RosterArg, "node:12345"))
+			RosterArg, makeRoster(t, "node:12345"),
+			SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345"))))
 	require.NoError(t, err)
 
 	err = cmd.createSecret(snap,
 		makeStep(t,
 			SmcPublicKeyArg, smcKey,
 			SecretNameArg, secretName,
-			SecretArg, secretValue))
+			SecretArg, makeSecret(t, smcKey, secretName, secretValue)))
 	require.NoError(t, err)
 
 	// Verify pre-conditions
-	_, found := contract.secrets[smcKey]
-	require.True(t, found)
+	smcSecrets, err := getSmcSecrets(snap, []byte(smcKey))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(secretName)}, smcSecrets)
 
-	smcSecrets := contract.secrets[smcKey]
-	require.Equal(t, 1, len(smcSecrets))
-	require.Equal(t, smcSecrets[secretName], struct{}{})
+	tx := makeTx(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, secretName,
+		PubKeyArg, "my_pubkey")
 
-	err = cmd.revealSecret(snap,
-		makeStep(t,
-			SmcPublicKeyArg, smcKey,
-			SecretNameArg, secretName,
-			PubKeyArg, "my_pubkey"))
+	err = cmd.revealSecret(snap, execution.Step{Current: tx})
 	require.NoError(t, err)
 
 	// Act
@@ -669,10 +898,115 @@ func TestCommand_ListAuditLogs_Succeeds(t *testing.T) {
 	// Assert
 	require.NoError(t, err)
 
+	token := computeAccessToken([]byte(smcKey),
+		[]byte(makeSecret(t, smcKey, secretName, secretValue)), []byte("my_pubkey"))
 	require.Equal(t,
 		fmt.Sprintf("Audit logs for secret '%v':\n", secretName)+
-			fmt.Sprintf("%x\n", "my_pubkey"),
+			fmt.Sprintf(`{"version":1,"event":"reveal","access_token":"%s","reader":"%s",`+
+				`"identity":"PK","tx_id":"%s","height":0,"reveal":1}`+"\n",
+				base64.StdEncoding.EncodeToString(token),
+				base64.StdEncoding.EncodeToString([]byte("my_pubkey")),
+				base64.StdEncoding.EncodeToString(tx.GetID())),
+		buf.String())
+}
+
+func TestCommand_RestoreFromSnapshot(t *testing.T) {
+	// Arrange
+	snap := fake.NewSnapshot()
+
+	const (
+		smcKey      = testSmcKey
+		secretName  = "my_secret"
+		secretValue = "my_value"
+	)
+
+	contract := NewContract(fakeAccess{})
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	err := cmd.advertiseSmc(snap,
+		makeStep(t, SmcPublicKeyArg, smcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap,
+		makeStep(t,
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, secretName,
+			SecretArg, makeSecret(t, smcKey, secretName, secretValue)))
+	require.NoError(t, err)
+
+	// Act: a new contract, e.g. after a restart, works on the same snapshot
+	restored := NewContract(fakeAccess{})
+
+	buf := &bytes.Buffer{}
+	restored.printer = buf
+
+	cmd = calypsoCommand{
+		Contract: &restored,
+	}
+
+	// Assert
+	err = cmd.listSmc(snap)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%x=%s", smcKey, makeRoster(t, "node:12345")),
 		buf.String())
+
+	buf.Reset()
+
+	err = cmd.listSecrets(snap, makeStep(t, SmcPublicKeyArg, smcKey))
+	require.NoError(t, err)
+	require.Equal(t, secretName+"="+makeSecret(t, smcKey, secretName, secretValue), buf.String())
+
+	err = cmd.createSecret(snap,
+		makeStep(t,
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, "other_secret",
+			SecretArg, makeSecret(t, smcKey, "other_secret", "other_value")))
+	require.NoError(t, err)
+
+	err = cmd.revealSecret(snap,
+		makeStep(t,
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, secretName,
+			PubKeyArg, "my_pubkey"))
+	require.NoError(t, err)
+
+	err = cmd.listAuditLogs(snap,
+		makeStep(t,
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, secretName))
+	require.NoError(t, err)
+}
+
+func Test_insertKeyList(t *testing.T) {
+	snap := fake.NewSnapshot()
+	k := []byte("list")
+
+	list, err := getKeyList(snap, k)
+	require.NoError(t, err)
+	require.Empty(t, list)
+
+	require.NoError(t, insertKeyList(snap, k, []byte("b")))
+	require.NoError(t, insertKeyList(snap, k, []byte("a")))
+	require.NoError(t, insertKeyList(snap, k, []byte("c")))
+	require.NoError(t, insertKeyList(snap, k, []byte("a")))
+
+	list, err = getKeyList(snap, k)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, list)
+
+	require.NoError(t, removeKeyList(snap, k, []byte("b")))
+
+	list, err = getKeyList(snap, k)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("c")}, list)
+
+	err = snap.Set(k, []byte("not a list"))
+	require.NoError(t, err)
+
+	_, err = getKeyList(snap, k)
+	require.ErrorContains(t, err, "failed to decode list")
 }
 
 func TestInfoLog(t *testing.T) {
@@ -688,9 +1022,13 @@ func TestRegisterContract(_ *testing.T) {
 }
 
 func Test_validateRosterUpdate(t *testing.T) {
+	member := func(addr string, key string) RosterMember {
+		return RosterMember{Address: addr, PublicKey: []byte(key)}
+	}
+
 	type args struct {
-		oldRoster []byte
-		newRoster []byte
+		oldRoster Roster
+		newRoster Roster
 	}
 	tests := []struct {
 		name    string
@@ -698,42 +1036,58 @@ func Test_validateRosterUpdate(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name: "validateNew",
+			name: "validateEmpty",
 			args: args{
-				oldRoster: []byte(""),
-				newRoster: []byte("node:12345"),
+				oldRoster: Roster{member("node:12345", "A")},
+				newRoster: Roster{},
 			},
 			wantErr: true,
 		},
 		{
 			name: "validateAdd",
 			args: args{
-				oldRoster: []byte("node:12345"),
-				newRoster: []byte("node:12345,other:54321"),
+				oldRoster: Roster{member("node:12345", "A")},
+				newRoster: Roster{member("node:12345", "A"), member("other:54321", "B")},
 			},
 			wantErr: false,
 		},
 		{
 			name: "validateNoChange",
 			args: args{
-				oldRoster: []byte("node:12345"),
-				newRoster: []byte("node:12345"),
+				oldRoster: Roster{member("node:12345", "A")},
+				newRoster: Roster{member("node:12345", "A")},
 			},
 			wantErr: false,
 		},
 		{
 			name: "validateRemove",
 			args: args{
-				oldRoster: []byte("node:12345,other:54321"),
-				newRoster: []byte("node:12345"),
+				oldRoster: Roster{member("node:12345", "A"), member("other:54321", "B")},
+				newRoster: Roster{member("node:12345", "A")},
 			},
 			wantErr: true,
 		},
 		{
 			name: "validateNoOverlap",
 			args: args{
-				oldRoster: []byte("node:12345"),
-				newRoster: []byte("other:54321"),
+				oldRoster: Roster{member("node:12345", "A")},
+				newRoster: Roster{member("other:54321", "B")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "validateAddressChange",
+			args: args{
+				oldRoster: Roster{member("node:12345", "A")},
+				newRoster: Roster{member("other:54321", "A")},
+			},
+			wantErr: false,
+		},
+		{
+			name: "validateReusedAddress",
+			args: args{
+				oldRoster: Roster{member("node:12345", "A")},
+				newRoster: Roster{member("node:12345", "B")},
 			},
 			wantErr: true,
 		},
@@ -752,17 +1106,99 @@ func Test_validateRosterUpdate(t *testing.T) {
 // -----------------------------------------------------------------------------
 // Utility functions
 
+// testSmcKey and otherSmcKey are the hex-encoded public keys of the SMCs used
+// in the tests. Their private keys are derived from smcSeeds.
+const (
+	testSmcKey  = "ab3fdacf63fdbe3b15e86338980ae89d01e8b5ce52417e9149dc56c018f51d5a"
+	otherSmcKey = "c7264abbaea7cfcdb780448aa214729a1d8905b381fbac9408d36195ef661783"
+)
+
+var smcSeeds = []string{"smc", "other"}
+
+// makeSmcProof returns the proof of possession of the private key of a test
+// SMC for the given roster, in the first advertisement of the SMC.
+func makeSmcProof(t *testing.T, key string, roster string) string {
+	return makeSmcProofAt(t, key, 0, roster)
+}
+
+// makeSmcProofAt returns the proof of possession of the private key of a test
+// SMC for the given roster, with the given nonce of the SMC.
+func makeSmcProofAt(t *testing.T, key string, nonce uint64, roster string) string {
+	var r Roster
+
+	err := json.Unmarshal([]byte(roster), &r)
+	require.NoError(t, err)
+
+	msg, err := SmcProofMessage([]byte(key), nonce, r)
+	require.NoError(t, err)
+
+	for _, seed := range smcSeeds {
+		secret := suite.Scalar().Pick(suite.XOF([]byte(seed)))
+
+		buf, err := suite.Point().Mul(secret, nil).MarshalBinary()
+		require.NoError(t, err)
+
+		if hex.EncodeToString(buf) == key {
+			sig, err := schnorr.Sign(suite, secret, msg)
+			require.NoError(t, err)
+
+			return hex.EncodeToString(sig)
+		}
+	}
+
+	t.Fatalf("unknown SMC key: %s", key)
+
+	return ""
+}
+
+// makeSecret returns the ciphertext of the message for the SMC and the secret
+// name. The ciphertext only depends on the arguments.
+func makeSecret(t *testing.T, smcKey string, name string, msg string) string {
+	rand := suite.XOF([]byte(smcKey + name + msg))
+
+	buf, err := encryptSecret([]byte(smcKey), []byte(name), []byte(msg), rand)
+	require.NoError(t, err)
+
+	return string(buf)
+}
+
+// makeRoster returns a serialized roster with a member for each address. The
+// public key of a member is derived from its address.
+func makeRoster(t *testing.T, addrs ...string) string {
+	roster := make(Roster, len(addrs))
+	for i, addr := range addrs {
+		roster[i] = RosterMember{
+			Address:    addr,
+			PublicKey:  []byte("pk:" + addr),
+			ShareIndex: uint32(i),
+		}
+	}
+
+	buf, err := roster.Encode()
+	require.NoError(t, err)
+
+	return string(buf)
+}
+
 func makeStep(t *testing.T, args ...string) execution.Step {
 	return execution.Step{Current: makeTx(t, args...)}
 }
 
 func makeTx(t *testing.T, args ...string) txn.Transaction {
+	return makeTxWithIdentity(t, fake.PublicKey{}, args...)
+}
+
+func makeStepWithIdentity(t *testing.T, pk crypto.PublicKey, args ...string) execution.Step {
+	return execution.Step{Current: makeTxWithIdentity(t, pk, args...)}
+}
+
+func makeTxWithIdentity(t *testing.T, pk crypto.PublicKey, args ...string) txn.Transaction {
 	options := []signed.TransactionOption{}
 	for i := 0; i < len(args)-1; i += 2 {
 		options = append(options, signed.WithArg(args[i], []byte(args[i+1])))
 	}
 
-	tx, err := signed.NewTransaction(0, fake.PublicKey{}, options...)
+	tx, err := signed.NewTransaction(0, pk, options...)
 	require.NoError(t, err)
 
 	return tx
@@ -772,9 +1208,19 @@ type fakeAccess struct {
 	access.Service
 
 	err error
+
+	// rules restricts the accepted credentials when it is set
+	rules map[string]struct{}
 }
 
-func (srvc fakeAccess) Match(store.Readable, access.Credential, ...access.Identity) error {
+func (srvc fakeAccess) Match(_ store.Readable, creds access.Credential, _ ...access.Identity) error {
+	if srvc.rules != nil {
+		_, found := srvc.rules[creds.GetRule()]
+		if !found {
+			return fake.GetError()
+		}
+	}
+
 	return srvc.err
 }
 
@@ -794,6 +1240,24 @@ func (s fakeStore) Set(_, _ []byte) error {
 	return nil
 }
 
+// fakeBlockInfo is a source of the index of the block being built, set by the
+// tests.
+//
+// - implements BlockInfo
+type fakeBlockInfo struct {
+	index uint64
+	err   error
+}
+
+func (b *fakeBlockInfo) GetBlockIndex() (uint64, error) {
+	return b.index, b.err
+}
+
+func setHeight(t *testing.T, snap store.Snapshot, height uint64) {
+	err := setCount(snap, PrefixHeightKey, nil, height)
+	require.NoError(t, err)
+}
+
 type fakeCmd struct {
 	err error
 }
@@ -825,3 +1289,27 @@ func (c fakeCmd) revealSecret(_ store.Snapshot, _ execution.Step) error {
 func (c fakeCmd) listAuditLogs(_ store.Snapshot, _ execution.Step) error {
 	return c.err
 }
+
+func (c fakeCmd) listReaderAccess(_ store.Snapshot, _ execution.Step) error {
+	return c.err
+}
+
+func (c fakeCmd) revokeAccess(_ store.Snapshot, _ execution.Step) error {
+	return c.err
+}
+
+func (c fakeCmd) migrateSecrets(_ store.Snapshot, _ execution.Step) error {
+	return c.err
+}
+
+func (c fakeCmd) updatePolicy(_ store.Snapshot, _ execution.Step) error {
+	return c.err
+}
+
+func (c fakeCmd) deleteSecret(_ store.Snapshot, _ execution.Step) error {
+	return c.err
+}
+
+func (c fakeCmd) updateSecret(_ store.Snapshot, _ execution.Step) error {
+	return c.err
+}
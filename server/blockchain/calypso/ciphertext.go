@@ -0,0 +1,327 @@
+package calypso
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+
+	"go.dedis.ch/kyber/v3"
+	"golang.org/x/xerrors"
+)
+
+// ciphertextDomain separates the challenges of the ciphertext proofs from any
+// other hash computed by the contract.
+const ciphertextDomain = "calypso:ciphertext"
+
+// keyDomain separates the symmetric keys derived from the encapsulated points
+// from any other hash.
+const keyDomain = "calypso:key"
+
+// CiphertextVersion is the version of the format of the ciphertexts. The
+// ciphertexts of other versions are refused.
+const CiphertextVersion = 1
+
+// Ciphertext is the hybrid encryption of a secret for the key X of a SMC. It
+// is the value of a secret in the store.
+//
+// A random point P is encapsulated with ElGamal to the key of the SMC, and the
+// secret is sealed with AES-GCM under a key derived from P. Only P goes through
+// the reencryption, so that secrets of any size can be stored.
+type Ciphertext struct {
+	// Version is the version of the format, see CiphertextVersion.
+	Version int `json:"version"`
+
+	// K is the ephemeral key rG.
+	K []byte `json:"k"`
+
+	// C is the encapsulated point P + rX.
+	C []byte `json:"c"`
+
+	// Payload is the secret sealed under the key derived from P. The key is
+	// used for a single message, so that the nonce is zero.
+	Payload []byte `json:"payload"`
+
+	// Proof proves the knowledge of r.
+	Proof CiphertextProof `json:"proof"`
+}
+
+// CiphertextProof is a non-interactive Schnorr proof of knowledge of the
+// randomness r of a ciphertext, bound to the SMC key and the secret name so
+// that a ciphertext can't be copied under another name.
+type CiphertextProof struct {
+	// E is the challenge.
+	E []byte `json:"e"`
+
+	// F is the response s + E*r, where sG is the commitment.
+	F []byte `json:"f"`
+}
+
+// EncryptSecret returns the serialized ciphertext of the message for the
+// hex-encoded SMC key, with the proof for the secret name.
+func EncryptSecret(smcKey []byte, name []byte, msg []byte) ([]byte, error) {
+	return encryptSecret(smcKey, name, msg, suite.RandomStream())
+}
+
+func encryptSecret(smcKey []byte, name []byte, msg []byte, rand cipher.Stream) ([]byte, error) {
+	if len(msg) == 0 {
+		return nil, xerrors.New("empty message")
+	}
+
+	pubKey, err := decodeSmcKey(smcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r := suite.Scalar().Pick(rand)
+	P := suite.Point().Pick(rand)
+
+	K := suite.Point().Mul(r, nil)
+	C := suite.Point().Add(P, suite.Point().Mul(r, pubKey))
+
+	ctext := Ciphertext{Version: CiphertextVersion}
+
+	ctext.K, err = K.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal K: %v", err)
+	}
+
+	ctext.C, err = C.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal C: %v", err)
+	}
+
+	aead, err := newAEAD(P)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	ctext.Payload = aead.Seal(nil, nonce, msg, ctext.header())
+
+	s := suite.Scalar().Pick(rand)
+	W := suite.Point().Mul(s, nil)
+
+	E, err := ctext.challenge(smcKey, name, W)
+	if err != nil {
+		return nil, err
+	}
+
+	F := suite.Scalar().Add(s, suite.Scalar().Mul(E, r))
+
+	ctext.Proof.E, err = E.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal challenge: %v", err)
+	}
+
+	ctext.Proof.F, err = F.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal response: %v", err)
+	}
+
+	buf, err := json.Marshal(ctext)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode ciphertext: %v", err)
+	}
+
+	return buf, nil
+}
+
+// DecodeCiphertext decodes a serialized ciphertext and checks its format.
+func DecodeCiphertext(data []byte) (Ciphertext, error) {
+	var ctext Ciphertext
+
+	err := json.Unmarshal(data, &ctext)
+	if err != nil {
+		return ctext, xerrors.Errorf("failed to decode ciphertext: %v", err)
+	}
+
+	_, _, err = ctext.points()
+	if err != nil {
+		return ctext, err
+	}
+
+	return ctext, nil
+}
+
+// Key returns the ephemeral key K of the ciphertext, which is reencrypted by
+// the SMC.
+func (c Ciphertext) Key() (kyber.Point, error) {
+	K, _, err := c.points()
+	return K, err
+}
+
+// Reveal decrypts the ciphertext with the key XhatEnc reencrypted by the SMC
+// of public key X for the reader of private key privK.
+func (c Ciphertext) Reveal(XhatEnc kyber.Point, X kyber.Point,
+	privK kyber.Scalar) ([]byte, error) {
+
+	// XhatEnc = rX + privK*X
+	Xhat := suite.Point().Sub(XhatEnc, suite.Point().Mul(privK, X))
+
+	return c.Decrypt(Xhat)
+}
+
+// Decrypt decrypts the ciphertext with the shared point rX.
+func (c Ciphertext) Decrypt(Xhat kyber.Point) ([]byte, error) {
+	_, C, err := c.points()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(suite.Point().Sub(C, Xhat))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	msg, err := aead.Open(nil, nonce, c.Payload, c.header())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open payload: %v", err)
+	}
+
+	return msg, nil
+}
+
+// points returns the points of the ciphertext.
+func (c Ciphertext) points() (kyber.Point, kyber.Point, error) {
+	if c.Version != CiphertextVersion {
+		return nil, nil, xerrors.Errorf("unsupported ciphertext version %d", c.Version)
+	}
+
+	if len(c.Payload) == 0 {
+		return nil, nil, xerrors.New("empty ciphertext")
+	}
+
+	K := suite.Point()
+
+	err := K.UnmarshalBinary(c.K)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("invalid K: %v", err)
+	}
+
+	C := suite.Point()
+
+	err = C.UnmarshalBinary(c.C)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("invalid C: %v", err)
+	}
+
+	return K, C, nil
+}
+
+// header returns the data authenticated with the payload.
+func (c Ciphertext) header() []byte {
+	header := make([]byte, 8, 8+len(c.K)+len(c.C))
+	binary.BigEndian.PutUint64(header, uint64(c.Version))
+
+	header = append(header, c.K...)
+	header = append(header, c.C...)
+
+	return header
+}
+
+// challenge returns the challenge of the proof of the ciphertext.
+func (c Ciphertext) challenge(smcKey []byte, name []byte, W kyber.Point) (kyber.Scalar, error) {
+	h := sha256.New()
+	h.Write([]byte(ciphertextDomain))
+
+	for _, buf := range [][]byte{smcKey, name, c.header(), c.Payload} {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(buf)))
+		h.Write(size)
+		h.Write(buf)
+	}
+
+	_, err := W.MarshalTo(h)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to hash point: %v", err)
+	}
+
+	return suite.Scalar().Pick(suite.XOF(h.Sum(nil))), nil
+}
+
+// verifySecretValue verifies that the value of the secret is a well-formed
+// ciphertext for the SMC key, and that its proof is valid for the name.
+func verifySecretValue(smcKey []byte, name []byte, value []byte) error {
+	ctext, err := DecodeCiphertext(value)
+	if err != nil {
+		return err
+	}
+
+	K, err := ctext.Key()
+	if err != nil {
+		return err
+	}
+
+	E := suite.Scalar()
+
+	err = E.UnmarshalBinary(ctext.Proof.E)
+	if err != nil {
+		return xerrors.Errorf("invalid challenge: %v", err)
+	}
+
+	F := suite.Scalar()
+
+	err = F.UnmarshalBinary(ctext.Proof.F)
+	if err != nil {
+		return xerrors.Errorf("invalid response: %v", err)
+	}
+
+	// W = FG - EK is the commitment if the proof is valid
+	W := suite.Point().Sub(suite.Point().Mul(F, nil), suite.Point().Mul(E, K))
+
+	challenge, err := ctext.challenge(smcKey, name, W)
+	if err != nil {
+		return err
+	}
+
+	if !challenge.Equal(E) {
+		return xerrors.New("invalid proof")
+	}
+
+	return nil
+}
+
+// newAEAD returns the AES-GCM cipher keyed by the hash of the point.
+func newAEAD(P kyber.Point) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write([]byte(keyDomain))
+
+	_, err := P.MarshalTo(h)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to hash point: %v", err)
+	}
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create cipher: %v", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create AEAD: %v", err)
+	}
+
+	return aead, nil
+}
+
+// decodeSmcKey decodes the hex-encoded public key of a SMC.
+func decodeSmcKey(smcKey []byte) (kyber.Point, error) {
+	buf, err := hex.DecodeString(string(smcKey))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode SMC key: %v", err)
+	}
+
+	pubKey := suite.Point()
+
+	err = pubKey.UnmarshalBinary(buf)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid SMC key: %v", err)
+	}
+
+	return pubKey, nil
+}
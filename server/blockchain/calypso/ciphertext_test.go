@@ -0,0 +1,175 @@
+package calypso
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	msg := strings.Repeat("a long secret message ", 100)
+
+	value, err := EncryptSecret([]byte(testSmcKey), []byte("name"), []byte(msg))
+	require.NoError(t, err)
+
+	err = verifySecretValue([]byte(testSmcKey), []byte("name"), value)
+	require.NoError(t, err)
+
+	ctext, err := DecodeCiphertext(value)
+	require.NoError(t, err)
+	require.Equal(t, CiphertextVersion, ctext.Version)
+
+	K, err := ctext.Key()
+	require.NoError(t, err)
+
+	// the private key of the test SMC
+	x := suite.Scalar().Pick(suite.XOF([]byte("smc")))
+
+	res, err := ctext.Decrypt(suite.Point().Mul(x, K))
+	require.NoError(t, err)
+	require.Equal(t, msg, string(res))
+
+	// the reader gets xK + privK*X from the SMC
+	privK := suite.Scalar().Pick(suite.RandomStream())
+	X := suite.Point().Mul(x, nil)
+	XhatEnc := suite.Point().Add(suite.Point().Mul(x, K), suite.Point().Mul(privK, X))
+
+	res, err = ctext.Reveal(XhatEnc, X, privK)
+	require.NoError(t, err)
+	require.Equal(t, msg, string(res))
+
+	_, err = ctext.Reveal(XhatEnc, X, suite.Scalar().One())
+	require.ErrorContains(t, err, "failed to open payload: ")
+
+	// equal messages don't give equal payloads
+	other, err := EncryptSecret([]byte(testSmcKey), []byte("name"), []byte(msg))
+	require.NoError(t, err)
+
+	otherCtext, err := DecodeCiphertext(other)
+	require.NoError(t, err)
+	require.NotEqual(t, ctext.Payload, otherCtext.Payload)
+}
+
+func TestEncryptSecret_Failures(t *testing.T) {
+	_, err := EncryptSecret([]byte(testSmcKey), []byte("name"), nil)
+	require.EqualError(t, err, "empty message")
+
+	_, err = EncryptSecret([]byte("xyz"), []byte("name"), []byte("msg"))
+	require.ErrorContains(t, err, "failed to decode SMC key: ")
+
+	_, err = EncryptSecret([]byte("abcd"), []byte("name"), []byte("msg"))
+	require.ErrorContains(t, err, "invalid SMC key: ")
+}
+
+func TestDecodeCiphertext_Failures(t *testing.T) {
+	_, err := DecodeCiphertext([]byte("{"))
+	require.ErrorContains(t, err, "failed to decode ciphertext: ")
+
+	_, err = DecodeCiphertext([]byte(`{"k":"","cs":[""]}`))
+	require.EqualError(t, err, "unsupported ciphertext version 0")
+
+	_, err = DecodeCiphertext([]byte(`{"version":1,"k":""}`))
+	require.EqualError(t, err, "empty ciphertext")
+
+	_, err = DecodeCiphertext([]byte(`{"version":1,"k":"","payload":"AA=="}`))
+	require.ErrorContains(t, err, "invalid K: ")
+
+	value := makeSecret(t, testSmcKey, "name", "value")
+
+	ctext, err := DecodeCiphertext([]byte(value))
+	require.NoError(t, err)
+
+	ctext.C = []byte("abcd")
+
+	_, err = DecodeCiphertext(encodeCiphertext(t, ctext))
+	require.ErrorContains(t, err, "invalid C: ")
+}
+
+func TestVerifySecretValue(t *testing.T) {
+	value := makeSecret(t, testSmcKey, "name", "value")
+
+	err := verifySecretValue([]byte(testSmcKey), []byte("name"), []byte(value))
+	require.NoError(t, err)
+
+	// the ciphertext is bound to the name and the SMC
+	err = verifySecretValue([]byte(testSmcKey), []byte("other"), []byte(value))
+	require.EqualError(t, err, "invalid proof")
+
+	err = verifySecretValue([]byte(otherSmcKey), []byte("name"), []byte(value))
+	require.EqualError(t, err, "invalid proof")
+
+	err = verifySecretValue([]byte(testSmcKey), []byte("name"), []byte("value"))
+	require.ErrorContains(t, err, "failed to decode ciphertext: ")
+
+	err = verifySecretValue([]byte(testSmcKey), []byte("name"), []byte(`{"version":1}`))
+	require.EqualError(t, err, "empty ciphertext")
+
+	var ctext Ciphertext
+	require.NoError(t, json.Unmarshal([]byte(value), &ctext))
+
+	tampered := ctext
+	tampered.C = ctext.K
+	err = verifySecretValue([]byte(testSmcKey), []byte("name"), encodeCiphertext(t, tampered))
+	require.EqualError(t, err, "invalid proof")
+
+	tampered = ctext
+	tampered.Payload = append([]byte{0}, ctext.Payload...)
+	err = verifySecretValue([]byte(testSmcKey), []byte("name"), encodeCiphertext(t, tampered))
+	require.EqualError(t, err, "invalid proof")
+
+	tampered = ctext
+	tampered.Proof.E = []byte("abcd")
+	err = verifySecretValue([]byte(testSmcKey), []byte("name"), encodeCiphertext(t, tampered))
+	require.ErrorContains(t, err, "invalid challenge: ")
+
+	tampered = ctext
+	tampered.Proof.F = []byte("abcd")
+	err = verifySecretValue([]byte(testSmcKey), []byte("name"), encodeCiphertext(t, tampered))
+	require.ErrorContains(t, err, "invalid response: ")
+}
+
+func TestCommand_CreateSecret_InvalidValue(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	err := cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		RosterArg, makeRoster(t, "node:12345"),
+		SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	// a ciphertext copied from another secret
+	err = cmd.createSecret(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		SecretNameArg, "name",
+		SecretArg, makeSecret(t, testSmcKey, "other", "value")))
+	require.EqualError(t, err, "invalid secret value: invalid proof")
+
+	err = cmd.createSecret(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		SecretNameArg, "name",
+		SecretArg, makeSecret(t, testSmcKey, "name", "value")))
+	require.NoError(t, err)
+
+	err = cmd.updateSecret(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		SecretNameArg, "name",
+		SecretArg, "value"))
+	require.ErrorContains(t, err, "invalid secret value: failed to decode ciphertext: ")
+}
+
+// encodeCiphertext returns the JSON encoding of the ciphertext.
+func encodeCiphertext(t *testing.T, ctext Ciphertext) []byte {
+	buf, err := json.Marshal(ctext)
+	require.NoError(t, err)
+
+	return buf
+}
@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/cli/node"
+	accessContract "go.dedis.ch/dela/contracts/access"
+	"go.dedis.ch/dela/core/access"
+	"go.dedis.ch/dela/core/execution/native"
+	"go.dedis.ch/dela/core/ordering"
+	"go.dedis.ch/dela/core/txn"
+	"go.dedis.ch/dela/core/txn/pool"
+	"go.dedis.ch/dela/core/txn/signed"
+	"go.dedis.ch/dela/core/validation"
+	"go.dedis.ch/dela/crypto"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/crypto/loader"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// signerFlag is the flag name containing the path to the private keyfile.
+	signerFlag = "key"
+
+	// roleFlag is the flag name containing the roles to grant.
+	roleFlag = "role"
+
+	// commandFlag is the flag name containing the commands to grant.
+	commandFlag = "command"
+
+	// identityFlag is the flag name containing the identities to grant.
+	identityFlag = "identity"
+
+	// nameFlag is the flag name containing the name of a secret.
+	nameFlag = "name"
+)
+
+// getManager is the function called when we need a transaction manager. It
+// allows us to use a different manager for the tests.
+var getManager = func(signer crypto.Signer, c signed.Client) txn.Manager {
+	return signed.NewManager(signer, c)
+}
+
+// grantAction is an action to grant the commands of the calypso contract to
+// one or more identities. It submits a GRANT transaction to the access
+// contract for each command.
+//
+// - implements node.ActionTemplate
+type grantAction struct{}
+
+// Execute implements node.ActionTemplate.
+func (a grantAction) Execute(ctx node.Context) error {
+	cmds, err := getCommands(ctx.Flags.StringSlice(roleFlag),
+		ctx.Flags.StringSlice(commandFlag))
+	if err != nil {
+		return xerrors.Errorf("failed to get commands: %v", err)
+	}
+
+	identities := ctx.Flags.StringSlice(identityFlag)
+	if len(identities) == 0 {
+		return xerrors.Errorf("no identity to grant")
+	}
+
+	var p pool.Pool
+	err = ctx.Injector.Resolve(&p)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve pool: %v", err)
+	}
+
+	var srvc ordering.Service
+	err = ctx.Injector.Resolve(&srvc)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve ordering service: %v", err)
+	}
+
+	var vs validation.Service
+	err = ctx.Injector.Resolve(&vs)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve validation service: %v", err)
+	}
+
+	signer, err := getSigner(ctx.Flags.Path(signerFlag))
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	manager := getManager(signer, client{srvc: srvc, mgr: vs})
+
+	err = manager.Sync()
+	if err != nil {
+		return xerrors.Errorf("failed to sync manager: %v", err)
+	}
+
+	for _, cmd := range cmds {
+		tx, err := manager.Make(makeGrantArgs(cmd, identities)...)
+		if err != nil {
+			return xerrors.Errorf("failed to create transaction: %v", err)
+		}
+
+		err = p.Add(tx)
+		if err != nil {
+			return xerrors.Errorf("failed to include tx: %v", err)
+		}
+
+		dela.Logger.Info().Msgf("granting %s to %v", cmd, identities)
+	}
+
+	return nil
+}
+
+// auditSigAction is an action to sign the request of the owner of a secret to
+// read its audit log from the proxy. It prints the form values of the request.
+//
+// - implements node.ActionTemplate
+type auditSigAction struct{}
+
+// Execute implements node.ActionTemplate.
+func (a auditSigAction) Execute(ctx node.Context) error {
+	name := ctx.Flags.String(nameFlag)
+	if name == "" {
+		return xerrors.Errorf("no secret name")
+	}
+
+	signer, err := getSigner(ctx.Flags.Path(signerFlag))
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	req := calypso.AuditLogRequest{
+		Name:      []byte(name),
+		Timestamp: time.Now().Unix(),
+	}
+
+	sig, err := req.Sign(signer)
+	if err != nil {
+		return xerrors.Errorf("failed to sign request: %v", err)
+	}
+
+	fmt.Fprintf(ctx.Out, "timestamp=%d&signature=%x\n", req.Timestamp, sig)
+
+	return nil
+}
+
+// getCommands returns the deduplicated list of commands covered by the roles
+// and the commands.
+func getCommands(roles []string, commands []string) ([]calypso.Command, error) {
+	if len(roles) == 0 && len(commands) == 0 {
+		return nil, xerrors.Errorf("no role or command to grant")
+	}
+
+	res := []calypso.Command{}
+	seen := map[calypso.Command]struct{}{}
+
+	add := func(cmd calypso.Command) {
+		_, found := seen[cmd]
+		if !found {
+			seen[cmd] = struct{}{}
+			res = append(res, cmd)
+		}
+	}
+
+	for _, role := range roles {
+		cmds, err := calypso.GetRoleCommands(calypso.Role(role))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cmd := range cmds {
+			add(cmd)
+		}
+	}
+
+	for _, cmd := range commands {
+		add(calypso.Command(cmd))
+	}
+
+	return res, nil
+}
+
+// makeGrantArgs returns the arguments of a GRANT transaction of the access
+// contract for the given calypso command.
+func makeGrantArgs(cmd calypso.Command, identities []string) []txn.Arg {
+	return []txn.Arg{
+		{Key: native.ContractArg, Value: []byte(accessContract.ContractName)},
+		{Key: accessContract.GrantIDArg, Value: []byte(hex.EncodeToString([]byte(calypso.ContractUID)))},
+		{Key: accessContract.GrantContractArg, Value: []byte(calypso.ContractName)},
+		{Key: accessContract.GrantCommandArg, Value: []byte(cmd)},
+		{Key: accessContract.IdentityArg, Value: []byte(strings.Join(identities, ","))},
+		{Key: accessContract.CmdArg, Value: []byte(accessContract.CmdSet)},
+	}
+}
+
+// getSigner loads a BLS signer from the given file.
+func getSigner(path string) (crypto.Signer, error) {
+	l := loader.NewFileLoader(path)
+
+	signerdata, err := l.Load()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load signer: %v", err)
+	}
+
+	signer, err := bls.NewSignerFromBytes(signerdata)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal signer: %v", err)
+	}
+
+	return signer, nil
+}
+
+// client reads the nonce of an identity from the store of the ordering
+// service.
+//
+// - implements signed.Client
+type client struct {
+	srvc ordering.Service
+	mgr  validation.Service
+}
+
+// GetNonce implements signed.Client.
+func (c client) GetNonce(ident access.Identity) (uint64, error) {
+	nonce, err := c.mgr.GetNonce(c.srvc.GetStore(), ident)
+	if err != nil {
+		return 0, err
+	}
+
+	return nonce, nil
+}
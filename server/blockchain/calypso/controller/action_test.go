@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/cli/node"
+	accessContract "go.dedis.ch/dela/contracts/access"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+)
+
+func TestGrantAction_Execute(t *testing.T) {
+	action := grantAction{}
+
+	ctx := node.Context{
+		Injector: node.NewInjector(),
+		Flags:    makeFlags(),
+	}
+
+	err := action.Execute(ctx)
+	require.EqualError(t, err,
+		"failed to get commands: no role or command to grant")
+
+	ctx.Flags = makeFlags(roleFlag, "fake")
+	err = action.Execute(ctx)
+	require.EqualError(t, err, "failed to get commands: unknown role: fake")
+
+	ctx.Flags = makeFlags(roleFlag, string(calypso.RoleReader))
+	err = action.Execute(ctx)
+	require.EqualError(t, err, "no identity to grant")
+
+	ctx.Flags = makeFlags(roleFlag, string(calypso.RoleReader), identityFlag, "id")
+	err = action.Execute(ctx)
+	require.EqualError(t, err,
+		"failed to resolve pool: couldn't find dependency for 'pool.Pool'")
+}
+
+func TestGetCommands(t *testing.T) {
+	admin, err := calypso.GetRoleCommands(calypso.RoleAdmin)
+	require.NoError(t, err)
+
+	cmds, err := getCommands([]string{string(calypso.RoleAdmin), string(calypso.RoleAdmin)},
+		[]string{string(calypso.CmdListSmc), string(calypso.CmdRevealSecret)})
+	require.NoError(t, err)
+	require.Equal(t, append(admin, calypso.CmdRevealSecret), cmds)
+}
+
+func TestMakeGrantArgs(t *testing.T) {
+	args := makeGrantArgs(calypso.CmdRevealSecret, []string{"id1", "id2"})
+
+	values := map[string]string{}
+	for _, arg := range args {
+		values[arg.Key] = string(arg.Value)
+	}
+
+	require.Equal(t, "43414c59", values[accessContract.GrantIDArg])
+	require.Equal(t, calypso.ContractName, values[accessContract.GrantContractArg])
+	require.Equal(t, string(calypso.CmdRevealSecret), values[accessContract.GrantCommandArg])
+	require.Equal(t, "id1,id2", values[accessContract.IdentityArg])
+	require.Equal(t, string(accessContract.CmdSet), values[accessContract.CmdArg])
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+func makeFlags(args ...string) node.FlagSet {
+	fset := node.FlagSet{}
+
+	for i := 0; i < len(args)-1; i += 2 {
+		values, _ := fset[args[i]].([]interface{})
+		fset[args[i]] = append(values, args[i+1])
+	}
+
+	return fset
+}
+
+func TestAuditSigAction_Execute(t *testing.T) {
+	action := auditSigAction{}
+
+	out := new(bytes.Buffer)
+	ctx := node.Context{
+		Injector: node.NewInjector(),
+		Flags:    node.FlagSet{},
+		Out:      out,
+	}
+
+	err := action.Execute(ctx)
+	require.EqualError(t, err, "no secret name")
+
+	ctx.Flags = node.FlagSet{nameFlag: "a", signerFlag: filepath.Join(t.TempDir(), "none")}
+	err = action.Execute(ctx)
+	require.ErrorContains(t, err, "failed to get signer: failed to load signer")
+
+	signer := bls.NewSigner()
+
+	data, err := signer.MarshalBinary()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "owner.key")
+	err = os.WriteFile(path, data, 0600)
+	require.NoError(t, err)
+
+	ctx.Flags = node.FlagSet{nameFlag: "a", signerFlag: path}
+	err = action.Execute(ctx)
+	require.NoError(t, err)
+
+	values, err := url.ParseQuery(strings.TrimSpace(out.String()))
+	require.NoError(t, err)
+
+	timestamp, err := strconv.ParseInt(values.Get("timestamp"), 10, 64)
+	require.NoError(t, err)
+
+	sig, err := hex.DecodeString(values.Get("signature"))
+	require.NoError(t, err)
+
+	owner, err := signer.GetPublicKey().MarshalText()
+	require.NoError(t, err)
+
+	req := calypso.AuditLogRequest{Name: []byte("a"), Timestamp: timestamp}
+	require.NoError(t, req.Verify(string(owner), sig))
+}
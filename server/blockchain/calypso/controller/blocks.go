@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"go.dedis.ch/dela/core/store/kv"
+)
+
+// blocksBucket is the bucket in which the block store of the cosipbft ordering
+// service writes the blocks, indexed by their index in big endian.
+var blocksBucket = []byte("blocks")
+
+// chainBlocks reads the number of blocks committed in the database of the
+// node. A block is only validated once the previous one is committed, and the
+// ordering service refuses a block whose index is not the number of blocks
+// stored, so the count is the index of the block being built on every node,
+// also after a restart.
+//
+// - implements calypso.BlockInfo
+type chainBlocks struct {
+	db kv.DB
+
+	// hint is the last count found, from which the next search starts.
+	hint atomic.Uint64
+}
+
+// newChainBlocks creates a new reader of the blocks of the database.
+func newChainBlocks(db kv.DB) *chainBlocks {
+	return &chainBlocks{db: db}
+}
+
+// GetBlockIndex implements calypso.BlockInfo. It returns the number of blocks
+// committed, which is the index of the next one.
+func (c *chainBlocks) GetBlockIndex() (uint64, error) {
+	var count uint64
+
+	err := c.db.View(func(tx kv.ReadableTx) error {
+		bucket := tx.GetBucket(blocksBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		has := func(index uint64) bool {
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, index)
+
+			return bucket.Get(key) != nil
+		}
+
+		count = countBlocks(has, c.hint.Load())
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.hint.Store(count)
+
+	return count, nil
+}
+
+// countBlocks returns the number of blocks stored, given that the blocks are
+// stored from the index zero without gaps. The search starts from the hint,
+// and is logarithmic in the distance to it.
+func countBlocks(has func(uint64) bool, hint uint64) uint64 {
+	lo, hi := uint64(0), hint
+
+	if has(hint) {
+		// the count is after the hint, look for a missing block with steps
+		// growing exponentially
+		lo = hint + 1
+		hi = lo
+
+		for step := uint64(1); has(hi); step *= 2 {
+			lo = hi + 1
+			hi = lo + step
+		}
+	}
+
+	// the count is in [lo, hi], the block lo-1 exists, if any, and the block
+	// hi doesn't
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		if has(mid) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/core/ordering/cosipbft/blockstore"
+	_ "go.dedis.ch/dela/core/ordering/cosipbft/json"
+	"go.dedis.ch/dela/core/ordering/cosipbft/types"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/store/hashtree/binprefix"
+	"go.dedis.ch/dela/core/store/kv"
+	"go.dedis.ch/dela/core/validation/simple"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestChainBlocks_GetBlockIndex(t *testing.T) {
+	db, err := kv.New(filepath.Join(t.TempDir(), "chain.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	blocks := newChainBlocks(db)
+
+	index, err := blocks.GetBlockIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), index)
+
+	// the blocks are written by the block store of the ordering service
+	bs := blockstore.NewDiskStore(db, nil)
+	last := types.Digest{}
+
+	storeBlocks := func(n int) {
+		for i := 0; i < n; i++ {
+			last = storeBlock(t, bs, last)
+		}
+	}
+
+	storeBlocks(5)
+
+	index, err = blocks.GetBlockIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), index)
+
+	storeBlocks(40)
+
+	index, err = blocks.GetBlockIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(45), index)
+
+	// the index is known after a restart
+	index, err = newChainBlocks(db).GetBlockIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(45), index)
+
+	// the contract reads it while the block is validated in the staging tree
+	tree := binprefix.NewMerkleTree(db, binprefix.Nonce{})
+
+	_, err = tree.Stage(func(store.Snapshot) error {
+		index, err = blocks.GetBlockIndex()
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(45), index)
+
+	db.Close()
+
+	_, err = blocks.GetBlockIndex()
+	require.Error(t, err)
+}
+
+func TestCountBlocks(t *testing.T) {
+	for n := uint64(0); n < 70; n++ {
+		has := func(index uint64) bool {
+			return index < n
+		}
+
+		for hint := uint64(0); hint < 70; hint++ {
+			require.Equal(t, n, countBlocks(has, hint), "n=%d hint=%d", n, hint)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+func storeBlock(t *testing.T, bs *blockstore.InDisk, from types.Digest) types.Digest {
+	block, err := types.NewBlock(simple.NewResult(nil), types.WithIndex(bs.Len()))
+	require.NoError(t, err)
+
+	link, err := types.NewBlockLink(from, block,
+		types.WithSignatures(fake.Signature{}, fake.Signature{}))
+	require.NoError(t, err)
+
+	err = bs.Store(link)
+	require.NoError(t, err)
+
+	return link.GetTo()
+}
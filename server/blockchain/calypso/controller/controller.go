@@ -7,6 +7,7 @@ import (
 	"go.dedis.ch/dela/cli/node"
 	"go.dedis.ch/dela/core/access"
 	"go.dedis.ch/dela/core/execution/native"
+	"go.dedis.ch/dela/core/store/kv"
 	"golang.org/x/xerrors"
 )
 
@@ -18,16 +19,62 @@ type miniController struct {
 
 // NewController creates a new minimal controller for the value contract.
 func NewController() node.Initializer {
-	return miniController{}
+	return &miniController{}
 }
 
-// SetCommands implements node.Initializer.
-func (miniController) SetCommands(_ node.Builder) {
-	// For now, no need to do anything here.
+// SetCommands implements node.Initializer. It sets the commands to manage the
+// access to the calypso contract.
+func (m *miniController) SetCommands(builder node.Builder) {
+	cmd := builder.SetCommand("calypso")
+	cmd.SetDescription("Handles the calypso contract")
+
+	sub := cmd.SetSubCommand("grant")
+	sub.SetDescription("grant calypso commands to identities, by role or by command")
+	sub.SetFlags(
+		cli.StringSliceFlag{
+			Name: roleFlag,
+			Usage: "role to grant: " + string(calypso.RoleAdmin) + " (SMC administration), " +
+				string(calypso.RolePublisher) + " (secret publishing) or " +
+				string(calypso.RoleReader) + " (secret reading)",
+			Required: false,
+		},
+		cli.StringSliceFlag{
+			Name:     commandFlag,
+			Usage:    "command to grant, e.g. " + string(calypso.CmdRevealSecret),
+			Required: false,
+		},
+		cli.StringSliceFlag{
+			Name:     identityFlag,
+			Usage:    "identity to grant, in the form of base64 bls public keys",
+			Required: true,
+		},
+		cli.StringFlag{
+			Name:     signerFlag,
+			Usage:    "path to the private keyfile of an identity allowed to use the access contract",
+			Required: true,
+		},
+	)
+	sub.SetAction(builder.MakeAction(grantAction{}))
+
+	sub = cmd.SetSubCommand("auditsig")
+	sub.SetDescription("sign the request of the owner of a secret to read its audit log")
+	sub.SetFlags(
+		cli.StringFlag{
+			Name:     nameFlag,
+			Usage:    "name of the secret",
+			Required: true,
+		},
+		cli.StringFlag{
+			Name:     signerFlag,
+			Usage:    "path to the private keyfile of the owner of the secret",
+			Required: true,
+		},
+	)
+	sub.SetAction(builder.MakeAction(auditSigAction{}))
 }
 
 // OnStart implements node.Initializer. It registers the value contract.
-func (m miniController) OnStart(_ cli.Flags, inj node.Injector) error {
+func (m *miniController) OnStart(_ cli.Flags, inj node.Injector) error {
 	var access access.Service
 	err := inj.Resolve(&access)
 	if err != nil {
@@ -40,7 +87,14 @@ func (m miniController) OnStart(_ cli.Flags, inj node.Injector) error {
 		return xerrors.Errorf("failed to resolve native service: %v", err)
 	}
 
-	contract := calypso.NewContract(access)
+	var db kv.DB
+	err = inj.Resolve(&db)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve database: %v", err)
+	}
+
+	contract := calypso.NewContract(access,
+		calypso.WithBlockInfo(newChainBlocks(db)))
 
 	calypso.RegisterContract(exec, contract)
 
@@ -50,6 +104,6 @@ func (m miniController) OnStart(_ cli.Flags, inj node.Injector) error {
 }
 
 // OnStop implements node.Initializer.
-func (miniController) OnStop(_ node.Injector) error {
+func (m *miniController) OnStop(_ node.Injector) error {
 	return nil
 }
@@ -4,15 +4,21 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/cli"
 	"go.dedis.ch/dela/cli/node"
 	"go.dedis.ch/dela/core/access"
 	"go.dedis.ch/dela/core/execution/native"
 	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/testing/fake"
 )
 
-func TestSetCommands(_ *testing.T) {
+func TestSetCommands(t *testing.T) {
 	ctrl := NewController()
-	ctrl.SetCommands(nil)
+
+	call := &fake.Call{}
+	ctrl.SetCommands(fakeBuilder{call: call})
+
+	require.Equal(t, 12, call.Len())
 }
 
 func TestOnStart(t *testing.T) {
@@ -33,8 +39,17 @@ func TestOnStart(t *testing.T) {
 	native := native.NewExecution()
 	injector.Inject(native)
 
+	err = ctrl.OnStart(node.FlagSet{}, injector)
+	require.EqualError(t, err,
+		"failed to resolve database: couldn't find dependency for 'kv.DB'")
+
+	injector.Inject(fake.NewInMemoryDB())
+
 	err = ctrl.OnStart(node.FlagSet{}, injector)
 	require.NoError(t, err)
+
+	err = ctrl.OnStop(injector)
+	require.NoError(t, err)
 }
 
 func TestOnStop(t *testing.T) {
@@ -56,3 +71,42 @@ type fakeAccess struct {
 func (a fakeAccess) Grant(store.Snapshot, access.Credential, ...access.Identity) error {
 	return a.err
 }
+
+type fakeCommandBuilder struct {
+	call *fake.Call
+}
+
+func (b fakeCommandBuilder) SetSubCommand(name string) cli.CommandBuilder {
+	b.call.Add(name)
+	return b
+}
+
+func (b fakeCommandBuilder) SetDescription(value string) {
+	b.call.Add(value)
+}
+
+func (b fakeCommandBuilder) SetFlags(flags ...cli.Flag) {
+	b.call.Add(flags)
+}
+
+func (b fakeCommandBuilder) SetAction(a cli.Action) {
+	b.call.Add(a)
+}
+
+type fakeBuilder struct {
+	call *fake.Call
+}
+
+func (b fakeBuilder) SetCommand(name string) cli.CommandBuilder {
+	b.call.Add(name)
+	return fakeCommandBuilder(b)
+}
+
+func (b fakeBuilder) SetStartFlags(flags ...cli.Flag) {
+	b.call.Add(flags)
+}
+
+func (b fakeBuilder) MakeAction(tmpl node.ActionTemplate) cli.Action {
+	b.call.Add(tmpl)
+	return nil
+}
@@ -0,0 +1,338 @@
+package calypso
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/store/prefixed"
+	"golang.org/x/xerrors"
+)
+
+// smcSuccessorDomain separates the successor messages from any other message
+// signed by the members of a SMC.
+const smcSuccessorDomain = "calypso:smc_successor"
+
+// smcMigrationDomain separates the migration messages from any other message
+// signed by the members of a SMC.
+const smcMigrationDomain = "calypso:smc_migration"
+
+// SmcSuccessorMessage returns the message the members of the predecessor SMC
+// must sign to hand over to the successor SMC with the given roster.
+func SmcSuccessorMessage(predecessor []byte, smcKey []byte, roster Roster) ([]byte, error) {
+	buf, err := roster.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(smcSuccessorDomain))
+
+	for _, key := range [][]byte{predecessor, smcKey} {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(key)))
+		h.Write(size)
+		h.Write(key)
+	}
+
+	h.Write(buf)
+
+	return h.Sum(nil), nil
+}
+
+// SmcMigrationMessage returns the message the members of the predecessor SMC
+// must sign to attest that the values encrypted for the successor hold the same
+// secrets as the current ones. Both are keyed by the name of the secret.
+func SmcMigrationMessage(predecessor []byte, smcKey []byte, current,
+	values map[string]string) []byte {
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	h := sha256.New()
+	h.Write([]byte(smcMigrationDomain))
+
+	fields := [][]byte{predecessor, smcKey}
+	for _, name := range names {
+		fields = append(fields, []byte(name), []byte(current[name]), []byte(values[name]))
+	}
+
+	for _, field := range fields {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(field)))
+		h.Write(size)
+		h.Write(field)
+	}
+
+	return h.Sum(nil)
+}
+
+// migrateSecrets implements commands. It performs the MIGRATE_SECRETS command.
+// It binds the secrets of the predecessor to the successor SMC so that the
+// predecessor can be deleted without losing them. The ciphertexts are moved as
+// they are, since a committee resharing the DKG key keeps it. A successor with
+// a new DKG key can instead receive values encrypted for it, as long as a
+// threshold of the members of the predecessor signed that they hold the same
+// secrets. The previous values are then kept as versions. The access records
+// of the readers follow the secrets.
+func (c calypsoCommand) migrateSecrets(snap store.Snapshot, step execution.Step) error {
+	key := step.Current.GetArg(SmcPublicKeyArg)
+	if len(key) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SmcPublicKeyArg)
+	}
+
+	predecessor, err := getSmcPredecessor(snap, key)
+	if err != nil {
+		return xerrors.Errorf("failed to get predecessor of '%s': %v", key, err)
+	}
+
+	if len(predecessor) == 0 {
+		return xerrors.Errorf("SMC '%s' has no predecessor", key)
+	}
+
+	secrets, err := getSmcSecrets(snap, predecessor)
+	if err != nil {
+		return xerrors.Errorf("failed to get secrets of SMC '%s': %v", predecessor, err)
+	}
+
+	current := make(map[string]string, len(secrets))
+
+	for _, name := range secrets {
+		value, err := getSecret(snap, name)
+		if err != nil {
+			return xerrors.Errorf("failed to get secret '%s': %v", name, err)
+		}
+
+		current[string(name)] = string(value)
+	}
+
+	values := current
+
+	arg := step.Current.GetArg(MigratedSecretsArg)
+	if len(arg) > 0 {
+		values, err = parseMigratedSecrets(snap, predecessor, key, current, arg,
+			step.Current.GetArg(RosterSignatureArg))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range secrets {
+		err = migrateSecret(snap, predecessor, key, name, []byte(values[string(name)]))
+		if err != nil {
+			return xerrors.Errorf("failed to migrate secret '%s': %v", name, err)
+		}
+
+		err = insertSmcSecret(snap, key, name)
+		if err != nil {
+			return xerrors.Errorf("failed to bind secret '%s': %v", name, err)
+		}
+	}
+
+	err = deleteSmcSecrets(snap, predecessor)
+	if err != nil {
+		return xerrors.Errorf("failed to delete secrets index of SMC '%s': %v",
+			predecessor, err)
+	}
+
+	dela.Logger.Info().Str("contract", ContractName).
+		Msgf("migrated %d secrets from '%s' to '%s'", len(secrets), predecessor, key)
+
+	return nil
+}
+
+// parseMigratedSecrets decodes the values encrypted for the successor and
+// verifies them, including the signature of the members of the predecessor
+// over SmcMigrationMessage.
+func parseMigratedSecrets(snap store.Readable, predecessor, key []byte,
+	current map[string]string, arg, sig []byte) (map[string]string, error) {
+
+	var values map[string]string
+
+	err := json.Unmarshal(arg, &values)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode migrated secrets: %v", err)
+	}
+
+	if len(values) != len(current) {
+		return nil, xerrors.Errorf("expected %d migrated secrets, got %d",
+			len(current), len(values))
+	}
+
+	for name := range current {
+		value, found := values[name]
+		if !found {
+			return nil, xerrors.Errorf("secret '%s' is not migrated", name)
+		}
+
+		err = verifySecretValue(key, []byte(name), []byte(value))
+		if err != nil {
+			return nil, xerrors.Errorf("invalid value of secret '%s': %v", name, err)
+		}
+	}
+
+	if len(sig) == 0 {
+		return nil, xerrors.Errorf(notFoundInTxArg, RosterSignatureArg)
+	}
+
+	buf, err := getSmcRoster(snap, predecessor)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get roster of '%s': %v", predecessor, err)
+	}
+
+	roster, err := DecodeRoster(buf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode roster of '%s': %v", predecessor, err)
+	}
+
+	err = verifyRosterSignature(roster, SmcMigrationMessage(predecessor, key, current, values), sig)
+	if err != nil {
+		return nil, xerrors.Errorf("signature verification failed: %v", err)
+	}
+
+	return values, nil
+}
+
+// migrateSecret binds the access records of the readers found in the audit log
+// to the successor, the revocations being keyed on the name of the secret. The
+// value of the secret is replaced if the successor has a new one.
+func migrateSecret(snap store.Snapshot, predecessor, key, name, value []byte) error {
+	previous, err := getSecret(snap, name)
+	if err != nil {
+		return xerrors.Errorf("failed to get secret: %v", err)
+	}
+
+	logs, err := getAuditLogs(snap, name)
+	if err != nil {
+		return xerrors.Errorf("failed to get audit logs: %v", err)
+	}
+
+	readers := make(map[string]struct{})
+
+	for _, entry := range logs {
+		_, found := readers[string(entry.Reader)]
+		if found || len(entry.Reader) == 0 {
+			continue
+		}
+
+		readers[string(entry.Reader)] = struct{}{}
+
+		token := computeAccessToken(predecessor, previous, entry.Reader)
+
+		record, err := getSecretAccess(snap, token)
+		if err != nil {
+			return err
+		}
+
+		if record == nil {
+			continue
+		}
+
+		token = computeAccessToken(key, value, entry.Reader)
+
+		err = setSecretAccess(snap, token, *record)
+		if err != nil {
+			return err
+		}
+	}
+
+	if bytes.Equal(previous, value) {
+		return nil
+	}
+
+	err = appendSecretVersion(snap, name, previous)
+	if err != nil {
+		return xerrors.Errorf("failed to keep previous version: %v", err)
+	}
+
+	err = setSecret(snap, name, value)
+	if err != nil {
+		return xerrors.Errorf("failed to set secret: %v", err)
+	}
+
+	return nil
+}
+
+// linkSuccessor records the SMC as the successor of the predecessor after
+// verifying that a threshold of the members of the predecessor signed the
+// hand over.
+func linkSuccessor(snap store.Snapshot, predecessor []byte, key []byte, roster Roster,
+	sig []byte) error {
+
+	current, err := getSmcRoster(snap, predecessor)
+	if err != nil {
+		return xerrors.Errorf("failed to get roster of '%s': %v", predecessor, err)
+	}
+
+	if len(current) == 0 {
+		return xerrors.Errorf(errorKeyNotFoundInSmcs, predecessor)
+	}
+
+	successor, err := getSmcSuccessor(snap, predecessor)
+	if err != nil {
+		return xerrors.Errorf("failed to get successor of '%s': %v", predecessor, err)
+	}
+
+	if len(successor) > 0 {
+		return xerrors.Errorf("'%s' already has a successor: '%s'", predecessor, successor)
+	}
+
+	if len(sig) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, RosterSignatureArg)
+	}
+
+	predecessorRoster, err := DecodeRoster(current)
+	if err != nil {
+		return xerrors.Errorf("failed to decode roster of '%s': %v", predecessor, err)
+	}
+
+	msg, err := SmcSuccessorMessage(predecessor, key, roster)
+	if err != nil {
+		return xerrors.Errorf("failed to create successor message: %v", err)
+	}
+
+	err = verifyRosterSignature(predecessorRoster, msg, sig)
+	if err != nil {
+		return xerrors.Errorf("signature verification failed: %v", err)
+	}
+
+	err = snap.Set(prefixed.NewPrefixedKey([]byte(PrefixSuccessorKeys), predecessor), key)
+	if err != nil {
+		return xerrors.Errorf("failed to set successor: %v", err)
+	}
+
+	err = snap.Set(prefixed.NewPrefixedKey([]byte(PrefixPredecessorKeys), key), predecessor)
+	if err != nil {
+		return xerrors.Errorf("failed to set predecessor: %v", err)
+	}
+
+	return nil
+}
+
+// deleteSmcLinks removes the links of a deleted SMC. The links of its
+// predecessor and successor are kept as a trace of the hand over.
+func deleteSmcLinks(snap store.Snapshot, key []byte) error {
+	err := snap.Delete(prefixed.NewPrefixedKey([]byte(PrefixSuccessorKeys), key))
+	if err != nil {
+		return err
+	}
+
+	return snap.Delete(prefixed.NewPrefixedKey([]byte(PrefixPredecessorKeys), key))
+}
+
+func getSmcPredecessor(snap store.Readable, key []byte) ([]byte, error) {
+	return snap.Get(prefixed.NewPrefixedKey([]byte(PrefixPredecessorKeys), key))
+}
+
+func getSmcSuccessor(snap store.Readable, key []byte) ([]byte, error) {
+	return snap.Get(prefixed.NewPrefixedKey([]byte(PrefixSuccessorKeys), key))
+}
@@ -0,0 +1,283 @@
+package calypso
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/core/store/prefixed"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestCommand_MigrateSecrets(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	signers := []bls.Signer{bls.NewSigner(), bls.NewSigner(), bls.NewSigner()}
+
+	oldRoster := makeSignerRoster(t, signers)
+	oldBuf, err := oldRoster.Encode()
+	require.NoError(t, err)
+
+	newBuf := makeRoster(t, "node:22345", "node:22346")
+	newRoster, err := DecodeRoster([]byte(newBuf))
+	require.NoError(t, err)
+
+	snap := fake.NewSnapshot()
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, string(oldBuf),
+		SmcProofArg, makeSmcProof(t, testSmcKey, string(oldBuf))))
+	require.NoError(t, err)
+
+	valueA := makeSecret(t, testSmcKey, "a", "value")
+	valueB := makeSecret(t, testSmcKey, "b", "value")
+
+	for name, value := range map[string]string{"a": valueA, "b": valueB} {
+		err = cmd.createSecret(snap, makeStep(t,
+			SmcPublicKeyArg, testSmcKey, SecretNameArg, name, SecretArg, value))
+		require.NoError(t, err)
+	}
+
+	err = cmd.migrateSecrets(snap, makeStep(t))
+	require.EqualError(t, err, "'calypso:smc_key' not found in tx arg")
+
+	err = cmd.migrateSecrets(snap, makeStep(t, SmcPublicKeyArg, testSmcKey))
+	require.EqualError(t, err, "SMC '"+testSmcKey+"' has no predecessor")
+
+	advertise := func(predecessor string, sig string) error {
+		return cmd.advertiseSmc(snap, makeStep(t,
+			SmcPublicKeyArg, otherSmcKey, RosterArg, newBuf,
+			SmcProofArg, makeSmcProof(t, otherSmcKey, newBuf),
+			PredecessorArg, predecessor, RosterSignatureArg, sig))
+	}
+
+	msg, err := SmcSuccessorMessage([]byte(testSmcKey), []byte(otherSmcKey), newRoster)
+	require.NoError(t, err)
+
+	err = advertise("unknown", signRosterMessage(t, msg, oldRoster, signers, 0, 1, 2))
+	require.EqualError(t, err,
+		"failed to link to predecessor: 'unknown' was not found among the SMCs")
+
+	err = advertise(testSmcKey, "")
+	require.EqualError(t, err,
+		"failed to link to predecessor: 'calypso:smc_roster_signature' not found in tx arg")
+
+	err = advertise(testSmcKey, signRosterMessage(t, msg, oldRoster, signers, 0, 1))
+	require.EqualError(t, err, "failed to link to predecessor: "+
+		"signature verification failed: not enough signers (2 < 3)")
+
+	other, err := RosterUpdateMessage([]byte(otherSmcKey), 0, newRoster)
+	require.NoError(t, err)
+
+	err = advertise(testSmcKey, signRosterMessage(t, other, oldRoster, signers, 0, 1, 2))
+	require.ErrorContains(t, err, "failed to link to predecessor: "+
+		"signature verification failed: invalid signature of node ")
+
+	err = advertise(testSmcKey, signRosterMessage(t, msg, oldRoster, signers, 0, 1, 2))
+	require.NoError(t, err)
+
+	// the predecessor of an existing SMC is final
+	err = advertise(testSmcKey, signRosterMessage(t, msg, oldRoster, signers, 0, 1, 2))
+	require.EqualError(t, err, "the predecessor of an existing SMC can't be changed")
+
+	smc, err := GetSmc(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, []byte(otherSmcKey), smc.Successor)
+	require.Nil(t, smc.Predecessor)
+
+	smc, err = GetSmc(snap, []byte(otherSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, []byte(testSmcKey), smc.Predecessor)
+	require.Nil(t, smc.Successor)
+
+	// a reader revealed "a" and another one was revoked from "b"
+	setHeight(t, snap, 7)
+	err = cmd.revealSecret(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, SecretNameArg, "a", PubKeyArg, "reader"))
+	require.NoError(t, err)
+
+	err = cmd.revokeAccess(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, SecretNameArg, "b", PubKeyArg, "revoked",
+		ReasonArg, "left"))
+	require.NoError(t, err)
+
+	err = cmd.migrateSecrets(snap, makeStep(t, SmcPublicKeyArg, otherSmcKey))
+	require.NoError(t, err)
+
+	secrets, err := getSmcSecrets(snap, []byte(otherSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b")}, secrets)
+
+	// the ciphertexts are moved as they are
+	secret, err := GetSecret(snap, []byte(otherSmcKey), []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte(valueA), secret.Value)
+	require.Equal(t, 0, secret.Versions)
+
+	// the access records and the revocations follow the secrets
+	access, err := GetSecretAccess(snap, []byte(otherSmcKey), []byte("a"), []byte("reader"))
+	require.NoError(t, err)
+	require.Equal(t, &SecretAccess{Reader: []byte("reader"), FirstSeen: 7, LastSeen: 7,
+		Reveals: 1}, access)
+
+	revocation, err := GetRevocation(snap, []byte("b"), []byte("revoked"))
+	require.NoError(t, err)
+	require.Equal(t, "left", revocation.Reason)
+
+	secrets, err = getSmcSecrets(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+
+	// the reveals through the successor use the moved ciphertext
+	err = cmd.revealSecret(snap, makeStep(t,
+		SmcPublicKeyArg, otherSmcKey, SecretNameArg, "a", PubKeyArg, "reader"))
+	require.NoError(t, err)
+
+	access, err = GetSecretAccess(snap, []byte(otherSmcKey), []byte("a"), []byte("reader"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), access.Reveals)
+
+	// the secrets survive the deletion of the predecessor
+	err = cmd.deleteSmc(snap, makeStep(t, SmcPublicKeyArg, testSmcKey))
+	require.NoError(t, err)
+
+	_, err = GetSecret(snap, []byte(otherSmcKey), []byte("a"))
+	require.NoError(t, err)
+}
+
+func TestCommand_MigrateSecrets_Reencrypted(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	signers := []bls.Signer{bls.NewSigner(), bls.NewSigner()}
+
+	oldRoster := makeSignerRoster(t, signers)
+	oldBuf, err := oldRoster.Encode()
+	require.NoError(t, err)
+
+	newBuf := makeRoster(t, "node:22345")
+	newRoster, err := DecodeRoster([]byte(newBuf))
+	require.NoError(t, err)
+
+	snap := fake.NewSnapshot()
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, string(oldBuf),
+		SmcProofArg, makeSmcProof(t, testSmcKey, string(oldBuf))))
+	require.NoError(t, err)
+
+	current := map[string]string{
+		"a": makeSecret(t, testSmcKey, "a", "value"),
+		"b": makeSecret(t, testSmcKey, "b", "value"),
+	}
+
+	for name, value := range current {
+		err = cmd.createSecret(snap, makeStep(t,
+			SmcPublicKeyArg, testSmcKey, SecretNameArg, name, SecretArg, value))
+		require.NoError(t, err)
+	}
+
+	msg, err := SmcSuccessorMessage([]byte(testSmcKey), []byte(otherSmcKey), newRoster)
+	require.NoError(t, err)
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, otherSmcKey, RosterArg, newBuf,
+		SmcProofArg, makeSmcProof(t, otherSmcKey, newBuf),
+		PredecessorArg, testSmcKey,
+		RosterSignatureArg, signRosterMessage(t, msg, oldRoster, signers, 0, 1)))
+	require.NoError(t, err)
+
+	migrate := func(values map[string]string, sig string) error {
+		buf, err := json.Marshal(values)
+		require.NoError(t, err)
+
+		return cmd.migrateSecrets(snap, makeStep(t,
+			SmcPublicKeyArg, otherSmcKey, MigratedSecretsArg, string(buf),
+			RosterSignatureArg, sig))
+	}
+
+	sign := func(values map[string]string, indices ...int) string {
+		msg := SmcMigrationMessage([]byte(testSmcKey), []byte(otherSmcKey), current, values)
+		return signRosterMessage(t, msg, oldRoster, signers, indices...)
+	}
+
+	err = cmd.migrateSecrets(snap, makeStep(t,
+		SmcPublicKeyArg, otherSmcKey, MigratedSecretsArg, "["))
+	require.ErrorContains(t, err, "failed to decode migrated secrets: ")
+
+	valueA := makeSecret(t, otherSmcKey, "a", "value")
+	valueB := makeSecret(t, otherSmcKey, "b", "value")
+	values := map[string]string{"a": valueA, "b": valueB}
+
+	err = migrate(map[string]string{"a": valueA}, "")
+	require.EqualError(t, err, "expected 2 migrated secrets, got 1")
+
+	err = migrate(map[string]string{"a": valueA, "c": valueB}, "")
+	require.EqualError(t, err, "secret 'b' is not migrated")
+
+	// the values of the predecessor can't be reencrypted by the successor
+	err = migrate(map[string]string{"a": valueA, "b": current["b"]}, "")
+	require.EqualError(t, err, "invalid value of secret 'b': invalid proof")
+
+	// the new values must be attested by the members of the predecessor
+	err = migrate(values, "")
+	require.EqualError(t, err, "'calypso:smc_roster_signature' not found in tx arg")
+
+	err = migrate(values, sign(values, 0))
+	require.EqualError(t, err,
+		"signature verification failed: not enough signers (1 < 2)")
+
+	err = migrate(values, sign(map[string]string{"a": valueA, "b": current["b"]}, 0, 1))
+	require.ErrorContains(t, err, "signature verification failed: invalid signature of node ")
+
+	err = migrate(values, sign(values, 0, 1))
+	require.NoError(t, err)
+
+	secret, err := GetSecret(snap, []byte(otherSmcKey), []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte(valueA), secret.Value)
+	require.Equal(t, 1, secret.Versions)
+}
+
+func TestCommand_MigrateSecrets_Successor(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	signers := []bls.Signer{bls.NewSigner()}
+
+	roster := makeSignerRoster(t, signers)
+	buf, err := roster.Encode()
+	require.NoError(t, err)
+
+	snap := fake.NewSnapshot()
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, string(buf),
+		SmcProofArg, makeSmcProof(t, testSmcKey, string(buf))))
+	require.NoError(t, err)
+
+	// a SMC can only be succeeded once
+	k := prefixed.NewPrefixedKey([]byte(PrefixSuccessorKeys), []byte(testSmcKey))
+	err = snap.Set(k, []byte("successor"))
+	require.NoError(t, err)
+
+	newBuf := makeRoster(t, "node:22345")
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, otherSmcKey, RosterArg, newBuf,
+		SmcProofArg, makeSmcProof(t, otherSmcKey, newBuf),
+		PredecessorArg, testSmcKey, RosterSignatureArg, "{}"))
+	require.EqualError(t, err, "failed to link to predecessor: '"+testSmcKey+
+		"' already has a successor: 'successor'")
+}
@@ -0,0 +1,221 @@
+package calypso
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/core/access"
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/store/prefixed"
+	"golang.org/x/xerrors"
+)
+
+// Policy defines who is allowed to reveal a secret. A reader is covered by the
+// policy if its public key is among the readers, or if the identity that
+// signed the REVEAL_SECRET transaction is granted by the DARC.
+type Policy struct {
+	// Readers contains the public keys allowed to reveal the secret.
+	Readers [][]byte `json:"readers,omitempty"`
+
+	// Darc is the identifier of a DARC that grants the REVEAL_SECRET command
+	// of this contract.
+	Darc []byte `json:"darc,omitempty"`
+}
+
+// isEmpty returns true if the policy does not restrict anything.
+func (p Policy) isEmpty() bool {
+	return len(p.Readers) == 0 && len(p.Darc) == 0
+}
+
+// allows returns nil if the reader's public key or the identity is covered by
+// the policy.
+func (p Policy) allows(srvc access.Service, snap store.Readable,
+	pubKey []byte, ident access.Identity) error {
+
+	if containsKey(p.Readers, pubKey) {
+		return nil
+	}
+
+	if len(p.Darc) > 0 {
+		creds := access.NewContractCreds(p.Darc, ContractName, string(CmdRevealSecret))
+
+		err := srvc.Match(snap, creds, ident)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return xerrors.Errorf("reader '%s' is not allowed by the policy", pubKey)
+}
+
+// parsePolicy reads the optional policy arguments of the transaction. It
+// returns nil if the transaction has none.
+func parsePolicy(step execution.Step) (*Policy, error) {
+	readers := step.Current.GetArg(PolicyReadersArg)
+	darc := step.Current.GetArg(PolicyDarcArg)
+
+	if len(readers) == 0 && len(darc) == 0 {
+		return nil, nil
+	}
+
+	policy := &Policy{}
+
+	if len(readers) > 0 {
+		for _, r := range strings.Split(string(readers), ",") {
+			if len(r) == 0 {
+				return nil, xerrors.Errorf("invalid empty reader in '%s'", PolicyReadersArg)
+			}
+
+			policy.Readers = append(policy.Readers, []byte(r))
+		}
+	}
+
+	if len(darc) > 0 {
+		id, err := hex.DecodeString(string(darc))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to decode DARC id: %v", err)
+		}
+
+		policy.Darc = id
+	}
+
+	return policy, nil
+}
+
+// updatePolicy implements commands. It performs the UPDATE_POLICY command. Only
+// the owner of the secret is allowed to update its policy. A transaction
+// without readers nor DARC clears the policy.
+func (c calypsoCommand) updatePolicy(snap store.Snapshot, step execution.Step) error {
+	name := step.Current.GetArg(SecretNameArg)
+	if len(name) == 0 {
+		return xerrors.Errorf(notFoundInTxArg, SecretNameArg)
+	}
+
+	policy, err := parsePolicy(step)
+	if err != nil {
+		return xerrors.Errorf("failed to parse policy: %v", err)
+	}
+
+	if policy == nil {
+		policy = &Policy{}
+	}
+
+	err = checkSecretOwner(snap, name, step.Current.GetIdentity())
+	if err != nil {
+		return err
+	}
+
+	err = setSecretPolicy(snap, name, *policy)
+	if err != nil {
+		return xerrors.Errorf("failed to set policy: %v", err)
+	}
+
+	return nil
+}
+
+//
+// Utility functions
+//
+
+func getSecretPolicy(snap store.Readable, name []byte) (*Policy, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixPolicyKeys), name)
+	buf, err := snap.Get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) == 0 {
+		return nil, nil
+	}
+
+	var policy Policy
+	err = json.Unmarshal(buf, &policy)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode policy: %v", err)
+	}
+
+	return &policy, nil
+}
+
+func setSecretPolicy(snap store.Snapshot, name []byte, policy Policy) error {
+	k := prefixed.NewPrefixedKey([]byte(PrefixPolicyKeys), name)
+
+	if policy.isEmpty() {
+		return snap.Delete(k)
+	}
+
+	buf, err := json.Marshal(policy)
+	if err != nil {
+		return xerrors.Errorf("failed to encode policy: %v", err)
+	}
+
+	err = snap.Set(k, buf)
+	if err != nil {
+		return err
+	}
+
+	dela.Logger.Info().
+		Str("contract", ContractName).
+		Msgf("setting policy %x=%s", name, buf)
+
+	return nil
+}
+
+// checkSecretPolicy returns nil if the secret has no policy or if the reader
+// is covered by it.
+func checkSecretPolicy(srvc access.Service, snap store.Snapshot, name []byte,
+	pubKey []byte, ident access.Identity) error {
+
+	policy, err := getSecretPolicy(snap, name)
+	if err != nil {
+		return xerrors.Errorf("failed to get policy of '%s': %v", name, err)
+	}
+
+	if policy == nil {
+		return nil
+	}
+
+	return policy.allows(srvc, snap, pubKey, ident)
+}
+
+func getSecretOwner(snap store.Readable, name []byte) ([]byte, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixOwnerKeys), name)
+	return snap.Get(k)
+}
+
+func setSecretOwner(snap store.Snapshot, name []byte, ident access.Identity) error {
+	owner, err := ident.MarshalText()
+	if err != nil {
+		return xerrors.Errorf("failed to marshal identity: %v", err)
+	}
+
+	k := prefixed.NewPrefixedKey([]byte(PrefixOwnerKeys), name)
+	return snap.Set(k, owner)
+}
+
+// checkSecretOwner returns nil if the identity is the owner of the secret.
+func checkSecretOwner(snap store.Snapshot, name []byte, ident access.Identity) error {
+	owner, err := getSecretOwner(snap, name)
+	if err != nil {
+		return xerrors.Errorf("failed to get owner of '%s': %v", name, err)
+	}
+
+	if len(owner) == 0 {
+		return xerrors.Errorf("secret '%s' has no owner", name)
+	}
+
+	id, err := ident.MarshalText()
+	if err != nil {
+		return xerrors.Errorf("failed to marshal identity: %v", err)
+	}
+
+	if !bytes.Equal(owner, id) {
+		return xerrors.Errorf("identity '%s' is not the owner of '%s'", id, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package calypso
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestCommand_CreateSecret_WithReaders(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	err := cmd.advertiseSmc(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap,
+		makeStep(t,
+			SmcPublicKeyArg, testSmcKey,
+			SecretNameArg, "name",
+			SecretArg, makeSecret(t, testSmcKey, "name", "value"),
+			PolicyReadersArg, "reader1,reader2"))
+	require.NoError(t, err)
+
+	policy, err := getSecretPolicy(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("reader1"), []byte("reader2")}, policy.Readers)
+
+	owner, err := getSecretOwner(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("PK"), owner)
+
+	err = cmd.revealSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", PubKeyArg, "reader2"))
+	require.NoError(t, err)
+
+	err = cmd.revealSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", PubKeyArg, "intruder"))
+	require.EqualError(t, err, "reader 'intruder' is not allowed by the policy")
+}
+
+func TestCommand_CreateSecret_WithDarc(t *testing.T) {
+	access := fakeAccess{rules: map[string]struct{}{}}
+
+	contract := NewContract(access)
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	err := cmd.advertiseSmc(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap,
+		makeStep(t,
+			SmcPublicKeyArg, testSmcKey,
+			SecretNameArg, "name",
+			SecretArg, makeSecret(t, testSmcKey, "name", "value"),
+			PolicyDarcArg, "abcd"))
+	require.NoError(t, err)
+
+	err = cmd.revealSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", PubKeyArg, "reader"))
+	require.EqualError(t, err, "reader 'reader' is not allowed by the policy")
+
+	access.rules[ContractName+":"+string(CmdRevealSecret)] = struct{}{}
+
+	err = cmd.revealSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", PubKeyArg, "reader"))
+	require.NoError(t, err)
+}
+
+func TestCommand_CreateSecret_InvalidPolicy(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	err := cmd.createSecret(fake.NewSnapshot(),
+		makeStep(t,
+			SmcPublicKeyArg, testSmcKey,
+			SecretNameArg, "name",
+			SecretArg, makeSecret(t, testSmcKey, "name", "value"),
+			PolicyDarcArg, "not hex"))
+	require.ErrorContains(t, err, "failed to parse policy: failed to decode DARC id")
+
+	err = cmd.createSecret(fake.NewSnapshot(),
+		makeStep(t,
+			SmcPublicKeyArg, testSmcKey,
+			SecretNameArg, "name",
+			SecretArg, makeSecret(t, testSmcKey, "name", "value"),
+			PolicyReadersArg, "a,,b"))
+	require.EqualError(t, err,
+		"failed to parse policy: invalid empty reader in 'calypso:policy_readers'")
+}
+
+func TestCommand_UpdatePolicy(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	err := cmd.advertiseSmc(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, SecretNameArg, "name", SecretArg, makeSecret(t, testSmcKey, "name", "value")))
+	require.NoError(t, err)
+
+	err = cmd.updatePolicy(snap, makeStep(t))
+	require.EqualError(t, err, "'calypso:secret_name' not found in tx arg")
+
+	err = cmd.updatePolicy(snap,
+		makeStep(t, SecretNameArg, "unknown", PolicyReadersArg, "reader"))
+	require.EqualError(t, err, "secret 'unknown' has no owner")
+
+	other := bls.NewSigner().GetPublicKey()
+	err = cmd.updatePolicy(snap,
+		makeStepWithIdentity(t, other, SecretNameArg, "name", PolicyReadersArg, "reader"))
+	require.ErrorContains(t, err, "is not the owner of 'name'")
+
+	err = cmd.updatePolicy(snap,
+		makeStep(t, SecretNameArg, "name", PolicyReadersArg, "reader"))
+	require.NoError(t, err)
+
+	policy, err := getSecretPolicy(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("reader")}, policy.Readers)
+
+	err = cmd.updatePolicy(snap, makeStep(t, SecretNameArg, "name"))
+	require.NoError(t, err)
+
+	policy, err = getSecretPolicy(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Nil(t, policy)
+
+	err = cmd.updatePolicy(fake.NewBadSnapshot(),
+		makeStep(t, SecretNameArg, "name", PolicyReadersArg, "reader"))
+	require.EqualError(t, err, fake.Err("failed to get owner of 'name'"))
+}
+
+func TestCommand_DeleteSmc_DeletesPolicy(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	err := cmd.advertiseSmc(snap,
+		makeStep(t, SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap,
+		makeStep(t,
+			SmcPublicKeyArg, testSmcKey,
+			SecretNameArg, "name",
+			SecretArg, makeSecret(t, testSmcKey, "name", "value"),
+			PolicyReadersArg, "reader"))
+	require.NoError(t, err)
+
+	err = cmd.deleteSmc(snap, makeStep(t, SmcPublicKeyArg, testSmcKey))
+	require.NoError(t, err)
+
+	policy, err := getSecretPolicy(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Nil(t, policy)
+
+	owner, err := getSecretOwner(snap, []byte("name"))
+	require.NoError(t, err)
+	require.Nil(t, owner)
+}
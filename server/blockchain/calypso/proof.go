@@ -0,0 +1,70 @@
+package calypso
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/suites"
+	"golang.org/x/xerrors"
+)
+
+// suite is the Kyber suite of the DKG of the SMCs.
+var suite = suites.MustFind("Ed25519")
+
+// smcProofDomain separates the proofs of possession from any other message
+// signed with the DKG private key of a SMC.
+const smcProofDomain = "calypso:smc_proof"
+
+// SmcProofMessage returns the message the SMC must sign with its DKG private
+// key to advertise its public key with the given roster. The signature is a
+// Schnorr proof that the committee controls the key. The nonce is the one of
+// the SMC in the contract, see GetSmcNonce.
+func SmcProofMessage(smcKey []byte, nonce uint64, roster Roster) ([]byte, error) {
+	buf, err := roster.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(smcProofDomain))
+
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(smcKey)))
+	h.Write(size)
+	h.Write(smcKey)
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, nonce)
+	h.Write(counter)
+	h.Write(buf)
+
+	return h.Sum(nil), nil
+}
+
+// verifySmcProof verifies the hex-encoded Schnorr proof of possession of the
+// DKG private key associated with the hex-encoded SMC public key.
+func verifySmcProof(smcKey []byte, nonce uint64, roster Roster, proof []byte) error {
+	pubKey, err := decodeSmcKey(smcKey)
+	if err != nil {
+		return err
+	}
+
+	sig, err := hex.DecodeString(string(proof))
+	if err != nil {
+		return xerrors.Errorf("failed to decode proof: %v", err)
+	}
+
+	msg, err := SmcProofMessage(smcKey, nonce, roster)
+	if err != nil {
+		return xerrors.Errorf("failed to create message: %v", err)
+	}
+
+	err = schnorr.Verify(suite, pubKey, msg, sig)
+	if err != nil {
+		return xerrors.Errorf("invalid proof: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package calypso
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestCommand_AdvertiseSmc_Proof(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	roster := makeRoster(t, "node:12345")
+
+	err := cmd.advertiseSmc(fake.NewSnapshot(), makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, roster))
+	require.EqualError(t, err, "'calypso:smc_proof' not found in tx arg")
+
+	err = cmd.advertiseSmc(fake.NewSnapshot(), makeStep(t,
+		SmcPublicKeyArg, "dummy", RosterArg, roster, SmcProofArg, "abcd"))
+	require.ErrorContains(t, err,
+		"proof of possession verification failed: failed to decode SMC key: ")
+
+	err = cmd.advertiseSmc(fake.NewSnapshot(), makeStep(t,
+		SmcPublicKeyArg, "abcd", RosterArg, roster, SmcProofArg, "abcd"))
+	require.ErrorContains(t, err,
+		"proof of possession verification failed: invalid SMC key: ")
+
+	err = cmd.advertiseSmc(fake.NewSnapshot(), makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, roster, SmcProofArg, "xyz"))
+	require.ErrorContains(t, err,
+		"proof of possession verification failed: failed to decode proof: ")
+
+	// a proof for another roster
+	proof := makeSmcProof(t, testSmcKey, makeRoster(t, "node:12346"))
+	err = cmd.advertiseSmc(fake.NewSnapshot(), makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, roster, SmcProofArg, proof))
+	require.ErrorContains(t, err, "proof of possession verification failed: invalid proof: ")
+
+	// a proof of another SMC
+	proof = makeSmcProof(t, otherSmcKey, roster)
+	err = cmd.advertiseSmc(fake.NewSnapshot(), makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, roster, SmcProofArg, proof))
+	require.ErrorContains(t, err, "proof of possession verification failed: invalid proof: ")
+
+	snap := fake.NewSnapshot()
+
+	proof = makeSmcProof(t, testSmcKey, roster)
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, roster, SmcProofArg, proof))
+	require.NoError(t, err)
+
+	found, err := hasSmc(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// the advertisement can't be replayed once the SMC is deleted
+	err = cmd.deleteSmc(snap, makeStep(t, SmcPublicKeyArg, testSmcKey))
+	require.NoError(t, err)
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, roster, SmcProofArg, proof))
+	require.ErrorContains(t, err, "proof of possession verification failed: invalid proof: ")
+
+	nonce, err := GetSmcNonce(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), nonce)
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, roster,
+		SmcProofArg, makeSmcProofAt(t, testSmcKey, nonce, roster)))
+	require.NoError(t, err)
+
+	smc, err := GetSmc(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), smc.Nonce)
+}
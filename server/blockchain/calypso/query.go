@@ -0,0 +1,354 @@
+package calypso
+
+import (
+	"bytes"
+	"sort"
+
+	"go.dedis.ch/dela/core/store"
+	"golang.org/x/xerrors"
+)
+
+// This file contains the query API of the contract. The functions read the
+// state from a store.Readable and never modify it, so that they can be used by
+// the web handlers and the CLI commands.
+
+// SmcRecord describes an advertised SMC.
+type SmcRecord struct {
+	// Key is the public key of the SMC.
+	Key []byte `json:"key"`
+
+	// Roster contains the members of the SMC.
+	Roster Roster `json:"roster"`
+
+	// Predecessor is the public key of the SMC it succeeds, if any.
+	Predecessor []byte `json:"predecessor,omitempty"`
+
+	// Successor is the public key of the SMC succeeding it, if any.
+	Successor []byte `json:"successor,omitempty"`
+
+	// Nonce is the nonce to sign in the next update of the roster.
+	Nonce uint64 `json:"nonce"`
+}
+
+// Creation describes when a secret was created.
+type Creation struct {
+	// Height is the index of the block in which the secret was created.
+	Height uint64 `json:"height"`
+}
+
+// SecretDescriptor describes a secret and its metadata.
+type SecretDescriptor struct {
+	// Name is the name of the secret.
+	Name []byte `json:"name"`
+
+	// Smc is the public key of the SMC the secret is bound to.
+	Smc []byte `json:"smc"`
+
+	// Value is the current value of the secret, encrypted for the SMC.
+	Value []byte `json:"value"`
+
+	// Owner is the identity that created the secret.
+	Owner string `json:"owner,omitempty"`
+
+	// Policy defines who can reveal the secret, if any.
+	Policy *Policy `json:"policy,omitempty"`
+
+	// Window defines when the secret can be revealed, if any.
+	Window *Window `json:"window,omitempty"`
+
+	// Versions is the number of previous values of the secret.
+	Versions int `json:"versions"`
+
+	// Created is when the secret was created, if it is known.
+	Created *Creation `json:"created,omitempty"`
+}
+
+// IsExpired returns true if the reveal window of the secret is closed for good
+// at the given block index.
+func (d SecretDescriptor) IsExpired(index uint64) bool {
+	return d.Window != nil && d.Window.isExpired(index)
+}
+
+// ListSmc returns the advertised SMCs, sorted by public key.
+func ListSmc(snap store.Readable) ([]SmcRecord, error) {
+	keys, err := getSmcList(snap)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get SMC list: %v", err)
+	}
+
+	res := make([]SmcRecord, 0, len(keys))
+
+	for _, key := range keys {
+		smc, err := GetSmc(snap, key)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, *smc)
+	}
+
+	return res, nil
+}
+
+// ListSmcPage returns at most limit SMCs, sorted by public key, starting at
+// offset, and the total number of SMCs.
+func ListSmcPage(snap store.Readable, offset, limit uint64) ([]SmcRecord, uint64, error) {
+	keys, err := getSmcList(snap)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("failed to get SMC list: %v", err)
+	}
+
+	res := []SmcRecord{}
+
+	for _, key := range page(keys, offset, limit) {
+		smc, err := GetSmc(snap, key)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		res = append(res, *smc)
+	}
+
+	return res, uint64(len(keys)), nil
+}
+
+// GetSmc returns the SMC with the given public key.
+func GetSmc(snap store.Readable, key []byte) (*SmcRecord, error) {
+	found, err := hasSmc(snap, key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get SMC '%s': %v", key, err)
+	}
+
+	if !found {
+		return nil, xerrors.Errorf(errorKeyNotFoundInSmcs, key)
+	}
+
+	roster, err := getSmcRoster(snap, key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get roster of '%s': %v", key, err)
+	}
+
+	members, err := DecodeRoster(roster)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode roster of '%s': %v", key, err)
+	}
+
+	predecessor, err := getSmcPredecessor(snap, key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get predecessor of '%s': %v", key, err)
+	}
+
+	successor, err := getSmcSuccessor(snap, key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get successor of '%s': %v", key, err)
+	}
+
+	nonce, err := GetSmcNonce(snap, key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get nonce of '%s': %v", key, err)
+	}
+
+	return &SmcRecord{
+		Key:         key,
+		Roster:      members,
+		Predecessor: predecessor,
+		Successor:   successor,
+		Nonce:       nonce,
+	}, nil
+}
+
+// GetSmcNonce returns the nonce to sign in the next advertisement of the SMC,
+// which is the number of rosters set for it. It is known for a deleted SMC.
+func GetSmcNonce(snap store.Readable, key []byte) (uint64, error) {
+	return getCount(snap, PrefixSmcNonceKeys, key)
+}
+
+// ListSecrets returns the secrets bound to the SMC, sorted by name.
+func ListSecrets(snap store.Readable, smcKey []byte) ([]SecretDescriptor, error) {
+	found, err := hasSmc(snap, smcKey)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get SMC '%s': %v", smcKey, err)
+	}
+
+	if !found {
+		return nil, xerrors.Errorf("SMC not found: %s", smcKey)
+	}
+
+	names, err := getSmcSecrets(snap, smcKey)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get secrets of SMC '%s': %v", smcKey, err)
+	}
+
+	res := make([]SecretDescriptor, 0, len(names))
+
+	for _, name := range names {
+		desc, err := getSecretDescriptor(snap, smcKey, name)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, desc)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return bytes.Compare(res[i].Name, res[j].Name) < 0
+	})
+
+	return res, nil
+}
+
+// ListSecretsPage returns at most limit secrets, starting at offset, and the
+// total number of secrets. The secrets are the ones bound to the SMC, sorted by
+// name, or the ones of all the SMCs, sorted by SMC and by name, if the key is
+// empty.
+func ListSecretsPage(snap store.Readable, smcKey []byte, offset,
+	limit uint64) ([]SecretDescriptor, uint64, error) {
+
+	smcs := [][]byte{smcKey}
+
+	if len(smcKey) == 0 {
+		var err error
+
+		smcs, err = getSmcList(snap)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("failed to get SMC list: %v", err)
+		}
+	} else {
+		found, err := hasSmc(snap, smcKey)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("failed to get SMC '%s': %v", smcKey, err)
+		}
+
+		if !found {
+			return nil, 0, xerrors.Errorf("SMC not found: %s", smcKey)
+		}
+	}
+
+	// the descriptors are only read for the secrets of the page
+	type secretRef struct {
+		smc  []byte
+		name []byte
+	}
+
+	refs := []secretRef{}
+
+	for _, smc := range smcs {
+		names, err := getSmcSecrets(snap, smc)
+		if err != nil {
+			return nil, 0, xerrors.Errorf("failed to get secrets of SMC '%s': %v", smc, err)
+		}
+
+		sort.Slice(names, func(i, j int) bool {
+			return bytes.Compare(names[i], names[j]) < 0
+		})
+
+		for _, name := range names {
+			refs = append(refs, secretRef{smc: smc, name: name})
+		}
+	}
+
+	res := []SecretDescriptor{}
+
+	for i := offset; i < uint64(len(refs)) && uint64(len(res)) < limit; i++ {
+		desc, err := getSecretDescriptor(snap, refs[i].smc, refs[i].name)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		res = append(res, desc)
+	}
+
+	return res, uint64(len(refs)), nil
+}
+
+// GetSecret returns the secret bound to the SMC with the given name.
+func GetSecret(snap store.Readable, smcKey, name []byte) (*SecretDescriptor, error) {
+	err := checkSmcSecret(snap, smcKey, name)
+	if err != nil {
+		return nil, err
+	}
+
+	desc, err := getSecretDescriptor(snap, smcKey, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc, nil
+}
+
+// ListAuditLogs returns the audit entries of the secret bound to the SMC,
+// oldest first.
+func ListAuditLogs(snap store.Readable, smcKey, name []byte) ([]AuditEntry, error) {
+	err := checkSmcSecret(snap, smcKey, name)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := getAuditLogs(snap, name)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get audit logs for '%s': %v", name, err)
+	}
+
+	return logs, nil
+}
+
+//
+// Utility functions
+//
+
+func getSecretDescriptor(snap store.Readable, smcKey, name []byte) (SecretDescriptor, error) {
+	value, err := getSecret(snap, name)
+	if err != nil {
+		return SecretDescriptor{}, xerrors.Errorf("failed to get key '%s': %v", name, err)
+	}
+
+	owner, err := getSecretOwner(snap, name)
+	if err != nil {
+		return SecretDescriptor{}, xerrors.Errorf("failed to get owner of '%s': %v", name, err)
+	}
+
+	policy, err := getSecretPolicy(snap, name)
+	if err != nil {
+		return SecretDescriptor{}, xerrors.Errorf("failed to get policy of '%s': %v", name, err)
+	}
+
+	window, err := getSecretWindow(snap, name)
+	if err != nil {
+		return SecretDescriptor{}, xerrors.Errorf("failed to get window of '%s': %v", name, err)
+	}
+
+	versions, err := getSecretVersions(snap, name)
+	if err != nil {
+		return SecretDescriptor{}, xerrors.Errorf("failed to get versions of '%s': %v", name, err)
+	}
+
+	created, err := getSecretCreation(snap, name)
+	if err != nil {
+		return SecretDescriptor{}, xerrors.Errorf("failed to get creation of '%s': %v", name, err)
+	}
+
+	return SecretDescriptor{
+		Name:     name,
+		Smc:      smcKey,
+		Value:    value,
+		Owner:    string(owner),
+		Policy:   policy,
+		Window:   window,
+		Versions: len(versions),
+		Created:  created,
+	}, nil
+}
+
+// page returns at most limit keys starting at offset.
+func page(keys [][]byte, offset, limit uint64) [][]byte {
+	if offset >= uint64(len(keys)) {
+		return nil
+	}
+
+	end := uint64(len(keys))
+	if limit < end-offset {
+		end = offset + limit
+	}
+
+	return keys[offset:end]
+}
@@ -0,0 +1,162 @@
+package calypso
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestQuery(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+	setHeight(t, snap, 3)
+
+	smcs, err := ListSmc(snap)
+	require.NoError(t, err)
+	require.Empty(t, smcs)
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, otherSmcKey,
+		RosterArg, makeRoster(t, "node:12345", "node:12346"),
+		SmcProofArg, makeSmcProof(t, otherSmcKey, makeRoster(t, "node:12345", "node:12346"))))
+	require.NoError(t, err)
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		RosterArg, makeRoster(t, "node:12347"),
+		SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12347"))))
+	require.NoError(t, err)
+
+	smcs, err = ListSmc(snap)
+	require.NoError(t, err)
+	require.Equal(t, []SmcRecord{
+		{Key: []byte(testSmcKey), Roster: Roster{
+			{Address: "node:12347", PublicKey: []byte("pk:node:12347")},
+		}, Nonce: 1},
+		{Key: []byte(otherSmcKey), Roster: Roster{
+			{Address: "node:12345", PublicKey: []byte("pk:node:12345")},
+			{Address: "node:12346", PublicKey: []byte("pk:node:12346"), ShareIndex: 1},
+		}, Nonce: 1},
+	}, smcs)
+
+	smcPage, total, err := ListSmcPage(snap, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), total)
+	require.Equal(t, smcs[1:], smcPage)
+
+	smcPage, _, err = ListSmcPage(snap, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, smcs[:1], smcPage)
+
+	smcPage, _, err = ListSmcPage(snap, 5, 1)
+	require.NoError(t, err)
+	require.Empty(t, smcPage)
+
+	_, err = GetSmc(snap, []byte("smc3"))
+	require.EqualError(t, err, "'smc3' was not found among the SMCs")
+
+	err = cmd.createSecret(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		SecretNameArg, "b",
+		SecretArg, makeSecret(t, testSmcKey, "b", "value_b"),
+		PolicyReadersArg, "pk1",
+		NotAfterArg, "10"))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		SecretNameArg, "a",
+		SecretArg, makeSecret(t, testSmcKey, "a", "value_a")))
+	require.NoError(t, err)
+
+	err = cmd.updateSecret(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		SecretNameArg, "a",
+		SecretArg, makeSecret(t, testSmcKey, "a", "value_a2")))
+	require.NoError(t, err)
+
+	secrets, err := ListSecrets(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, []SecretDescriptor{
+		{
+			Name:     []byte("a"),
+			Smc:      []byte(testSmcKey),
+			Value:    []byte(makeSecret(t, testSmcKey, "a", "value_a2")),
+			Owner:    "PK",
+			Versions: 1,
+			Created:  &Creation{Height: 3},
+		},
+		{
+			Name:    []byte("b"),
+			Smc:     []byte(testSmcKey),
+			Value:   []byte(makeSecret(t, testSmcKey, "b", "value_b")),
+			Owner:   "PK",
+			Policy:  &Policy{Readers: [][]byte{[]byte("pk1")}},
+			Window:  &Window{Unit: WindowHeight, NotAfter: 10},
+			Created: &Creation{Height: 3},
+		},
+	}, secrets)
+
+	page, total, err := ListSecretsPage(snap, []byte(testSmcKey), 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), total)
+	require.Equal(t, secrets[1:], page)
+
+	page, total, err = ListSecretsPage(snap, nil, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), total)
+	require.Equal(t, secrets[:1], page)
+
+	page, _, err = ListSecretsPage(snap, nil, 2, 10)
+	require.NoError(t, err)
+	require.Empty(t, page)
+
+	_, _, err = ListSecretsPage(snap, []byte("smc3"), 0, 10)
+	require.EqualError(t, err, "SMC not found: smc3")
+
+	require.False(t, secrets[0].IsExpired(11))
+	require.False(t, secrets[1].IsExpired(10))
+	require.True(t, secrets[1].IsExpired(11))
+
+	secrets, err = ListSecrets(snap, []byte(otherSmcKey))
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+
+	_, err = ListSecrets(snap, []byte("smc3"))
+	require.EqualError(t, err, "SMC not found: smc3")
+
+	secret, err := GetSecret(snap, []byte(testSmcKey), []byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, []byte(makeSecret(t, testSmcKey, "b", "value_b")), secret.Value)
+
+	_, err = GetSecret(snap, []byte(otherSmcKey), []byte("b"))
+	require.EqualError(t, err, "'b' was not found among the secrets of the smc ("+otherSmcKey+")")
+
+	err = cmd.revealSecret(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey,
+		SecretNameArg, "a",
+		PubKeyArg, "pk2"))
+	require.NoError(t, err)
+
+	logs, err := ListAuditLogs(snap, []byte(testSmcKey), []byte("a"))
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, []byte("pk2"), logs[0].Reader)
+
+	_, err = ListAuditLogs(snap, []byte(otherSmcKey), []byte("a"))
+	require.EqualError(t, err, "'a' was not found among the secrets of the smc ("+otherSmcKey+")")
+
+	bad := fake.NewBadSnapshot()
+
+	_, err = ListSmc(bad)
+	require.EqualError(t, err, fake.Err("failed to get SMC list"))
+
+	_, err = ListSecrets(bad, []byte(testSmcKey))
+	require.EqualError(t, err, fake.Err("failed to get SMC '"+testSmcKey+"'"))
+}
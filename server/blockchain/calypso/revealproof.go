@@ -0,0 +1,199 @@
+package calypso
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"go.dedis.ch/dela/crypto"
+	"golang.org/x/xerrors"
+)
+
+// revealProofDomain separates the reveal proofs from any other message signed
+// by the nodes of the chain.
+const revealProofDomain = "calypso:reveal_proof"
+
+// RevealProofValidity is how long a reveal proof is accepted after it was
+// signed, so that a proof can't be replayed after the access has changed.
+const RevealProofValidity = 5 * time.Minute
+
+// RevealShare is the signature of a node of the chain over the access record
+// of an access token, as stored by REVEAL_SECRET.
+type RevealShare struct {
+	// Token is the access token.
+	Token []byte `json:"token"`
+
+	// Access is the access record of the token.
+	Access SecretAccess `json:"access"`
+
+	// Timestamp is the time, in seconds since the Unix epoch, the record was
+	// attested at.
+	Timestamp int64 `json:"timestamp"`
+
+	// PublicKey is the BLS public key of the node.
+	PublicKey []byte `json:"public_key"`
+
+	// Signature is the BLS signature of the node over the message returned by
+	// RevealProofMessage.
+	Signature []byte `json:"signature"`
+}
+
+// RevealProof proves to a SMC that a REVEAL_SECRET transaction was committed
+// for a secret and a reader. It is the access record of the reveal signed by a
+// threshold of the nodes of the chain.
+type RevealProof struct {
+	// Token is the access token of the reveal.
+	Token []byte `json:"token"`
+
+	// Access is the access record of the token.
+	Access SecretAccess `json:"access"`
+
+	// Timestamp is the time, in seconds since the Unix epoch, the record was
+	// attested at.
+	Timestamp int64 `json:"timestamp"`
+
+	// Signature is the collective signature of the nodes of the chain over the
+	// message returned by RevealProofMessage.
+	Signature RosterSignature `json:"signature"`
+}
+
+// AccessToken returns the access token recorded by REVEAL_SECRET when the
+// secret of the SMC is revealed to the reader.
+func AccessToken(smcKey []byte, secret []byte, reader []byte) []byte {
+	return computeAccessToken(smcKey, secret, reader)
+}
+
+// RevealProofMessage returns the message signed by the nodes of the chain to
+// attest the access record of an access token at the given time.
+func RevealProofMessage(token []byte, access SecretAccess, timestamp int64) ([]byte, error) {
+	buf, err := json.Marshal(access)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode access: %v", err)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(revealProofDomain))
+
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(token)))
+	h.Write(size)
+	h.Write(token)
+
+	binary.BigEndian.PutUint64(size, uint64(timestamp))
+	h.Write(size)
+	h.Write(buf)
+
+	return h.Sum(nil), nil
+}
+
+// NewRevealShare returns the share of the proof of an access record signed by
+// the given node of the chain at the given time.
+func NewRevealShare(signer crypto.Signer, token []byte, access SecretAccess,
+	timestamp int64) (RevealShare, error) {
+
+	msg, err := RevealProofMessage(token, access, timestamp)
+	if err != nil {
+		return RevealShare{}, err
+	}
+
+	sig, err := signer.Sign(msg)
+	if err != nil {
+		return RevealShare{}, xerrors.Errorf("failed to sign: %v", err)
+	}
+
+	pk, err := signer.GetPublicKey().MarshalBinary()
+	if err != nil {
+		return RevealShare{}, xerrors.Errorf("failed to marshal public key: %v", err)
+	}
+
+	buf, err := sig.MarshalBinary()
+	if err != nil {
+		return RevealShare{}, xerrors.Errorf("failed to marshal signature: %v", err)
+	}
+
+	return RevealShare{
+		Token:     token,
+		Access:    access,
+		Timestamp: timestamp,
+		PublicKey: pk,
+		Signature: buf,
+	}, nil
+}
+
+// CombineRevealShares gathers the shares of the nodes of the chain into a
+// proof. The shares must attest the same access record at the same time.
+func CombineRevealShares(roster Roster, shares []RevealShare) (RevealProof, error) {
+	if len(shares) == 0 {
+		return RevealProof{}, xerrors.New("no share")
+	}
+
+	first, err := json.Marshal(shares[0].Access)
+	if err != nil {
+		return RevealProof{}, xerrors.Errorf("failed to encode access: %v", err)
+	}
+
+	proof := RevealProof{
+		Token:     shares[0].Token,
+		Access:    shares[0].Access,
+		Timestamp: shares[0].Timestamp,
+		Signature: NewRosterSignature(roster),
+	}
+
+	for _, share := range shares {
+		access, err := json.Marshal(share.Access)
+		if err != nil {
+			return RevealProof{}, xerrors.Errorf("failed to encode access: %v", err)
+		}
+
+		if !bytes.Equal(share.Token, proof.Token) || !bytes.Equal(access, first) ||
+			share.Timestamp != proof.Timestamp {
+			return RevealProof{}, xerrors.New("shares disagree on the access record")
+		}
+
+		index := roster.indexOf(share.PublicKey)
+		if index < 0 {
+			return RevealProof{}, xerrors.Errorf("share of unknown node '%x'",
+				share.PublicKey)
+		}
+
+		if proof.Signature.isSigner(index) {
+			continue
+		}
+
+		proof.Signature.SetSigner(index, share.Signature)
+	}
+
+	return proof, nil
+}
+
+// VerifyRevealProof verifies that the proof is signed by a threshold of the
+// nodes of the chain, that it attests a valid access for the token and that it
+// was signed less than RevealProofValidity before now.
+func VerifyRevealProof(roster Roster, proof RevealProof, token []byte, now time.Time) error {
+	if !bytes.Equal(proof.Token, token) {
+		return xerrors.New("proof is for another access token")
+	}
+
+	age := now.Sub(time.Unix(proof.Timestamp, 0))
+	if age > RevealProofValidity || age < -RevealProofValidity {
+		return xerrors.Errorf("proof signed at %d is expired", proof.Timestamp)
+	}
+
+	msg, err := RevealProofMessage(proof.Token, proof.Access, proof.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	err = proof.Signature.verify(roster, msg)
+	if err != nil {
+		return xerrors.Errorf("failed to verify signature: %v", err)
+	}
+
+	if proof.Access.Revoked != nil {
+		return xerrors.Errorf("access revoked: %s", proof.Access.Revoked.Reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package calypso
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/crypto/bls"
+)
+
+func TestRevealProof(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	signers := []bls.Signer{bls.NewSigner(), bls.NewSigner(), bls.NewSigner(), bls.NewSigner()}
+	roster := makeSignerRoster(t, signers)
+
+	token := AccessToken([]byte(testSmcKey), []byte("secret"), []byte("reader"))
+	access := SecretAccess{
+		Reader:    []byte("reader"),
+		FirstSeen: 2,
+		LastSeen:  3,
+		Reveals:   2,
+	}
+
+	shares := make([]RevealShare, len(signers))
+	for i, signer := range signers {
+		share, err := NewRevealShare(signer, token, access, now.Unix())
+		require.NoError(t, err)
+
+		shares[i] = share
+	}
+
+	// a duplicated share is only counted once
+	proof, err := CombineRevealShares(roster, append(shares[1:], shares[1]))
+	require.NoError(t, err)
+	require.Equal(t, token, proof.Token)
+	require.Equal(t, access, proof.Access)
+	require.Equal(t, []byte{0b1110}, proof.Signature.Mask)
+
+	err = VerifyRevealProof(roster, proof, token, now)
+	require.NoError(t, err)
+
+	err = VerifyRevealProof(roster, proof, []byte("token"), now)
+	require.EqualError(t, err, "proof is for another access token")
+
+	proof, err = CombineRevealShares(roster, shares[:2])
+	require.NoError(t, err)
+
+	err = VerifyRevealProof(roster, proof, token, now)
+	require.EqualError(t, err, "failed to verify signature: not enough signers (2 < 3)")
+
+	// the access record is part of the signed message
+	proof, err = CombineRevealShares(roster, shares)
+	require.NoError(t, err)
+
+	proof.Access.Reveals = 3
+
+	err = VerifyRevealProof(roster, proof, token, now)
+	require.ErrorContains(t, err, "failed to verify signature: invalid signature of node ")
+
+	// so is the time of the proof, which is refused once expired
+	proof, err = CombineRevealShares(roster, shares)
+	require.NoError(t, err)
+
+	err = VerifyRevealProof(roster, proof, token, now.Add(RevealProofValidity))
+	require.NoError(t, err)
+
+	err = VerifyRevealProof(roster, proof, token, now.Add(RevealProofValidity+time.Second))
+	require.EqualError(t, err, fmt.Sprintf("proof signed at %d is expired", now.Unix()))
+
+	err = VerifyRevealProof(roster, proof, token, now.Add(-RevealProofValidity-time.Second))
+	require.EqualError(t, err, fmt.Sprintf("proof signed at %d is expired", now.Unix()))
+
+	proof.Timestamp++
+
+	err = VerifyRevealProof(roster, proof, token, now)
+	require.ErrorContains(t, err, "failed to verify signature: invalid signature of node ")
+}
+
+func TestRevealProof_Revoked(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	signers := []bls.Signer{bls.NewSigner()}
+	roster := makeSignerRoster(t, signers)
+
+	access := SecretAccess{
+		Reader:  []byte("reader"),
+		Revoked: &Revocation{Reason: "left the organisation"},
+	}
+
+	share, err := NewRevealShare(signers[0], []byte("token"), access, now.Unix())
+	require.NoError(t, err)
+
+	proof, err := CombineRevealShares(roster, []RevealShare{share})
+	require.NoError(t, err)
+
+	err = VerifyRevealProof(roster, proof, []byte("token"), now)
+	require.EqualError(t, err, "access revoked: left the organisation")
+}
+
+func TestCombineRevealShares_Failures(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	signers := []bls.Signer{bls.NewSigner(), bls.NewSigner()}
+	roster := makeSignerRoster(t, signers)
+
+	_, err := CombineRevealShares(roster, nil)
+	require.EqualError(t, err, "no share")
+
+	share, err := NewRevealShare(signers[0], []byte("token"), SecretAccess{Reveals: 1}, now.Unix())
+	require.NoError(t, err)
+
+	other, err := NewRevealShare(signers[1], []byte("token"), SecretAccess{Reveals: 2}, now.Unix())
+	require.NoError(t, err)
+
+	_, err = CombineRevealShares(roster, []RevealShare{share, other})
+	require.EqualError(t, err, "shares disagree on the access record")
+
+	other, err = NewRevealShare(signers[1], []byte("other"), SecretAccess{Reveals: 1}, now.Unix())
+	require.NoError(t, err)
+
+	_, err = CombineRevealShares(roster, []RevealShare{share, other})
+	require.EqualError(t, err, "shares disagree on the access record")
+
+	other, err = NewRevealShare(signers[1], []byte("token"), SecretAccess{Reveals: 1},
+		now.Unix()+1)
+	require.NoError(t, err)
+
+	_, err = CombineRevealShares(roster, []RevealShare{share, other})
+	require.EqualError(t, err, "shares disagree on the access record")
+
+	unknown, err := NewRevealShare(bls.NewSigner(), []byte("token"), SecretAccess{Reveals: 1},
+		now.Unix())
+	require.NoError(t, err)
+
+	_, err = CombineRevealShares(roster, []RevealShare{share, unknown})
+	require.EqualError(t, err, fmt.Sprintf("share of unknown node '%x'", unknown.PublicKey))
+}
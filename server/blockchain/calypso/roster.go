@@ -0,0 +1,291 @@
+package calypso
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sort"
+
+	"go.dedis.ch/dela/crypto/bls"
+	"golang.org/x/xerrors"
+)
+
+// rosterUpdateDomain separates the roster update messages from any other
+// message signed by the members of a SMC.
+const rosterUpdateDomain = "calypso:roster_update"
+
+// RosterMember describes a node of a SMC.
+type RosterMember struct {
+	// Address is the host:port address of the node.
+	Address string `json:"address"`
+
+	// PublicKey is the BLS public key identifying the node on the network. It
+	// is what identifies a member, the address can change. The members sign
+	// the roster updates of the SMC with the associated private key.
+	PublicKey []byte `json:"public_key"`
+
+	// ShareIndex is the index of the DKG share held by the node.
+	ShareIndex uint32 `json:"share_index"`
+
+	// PublicShare is the optional public share xiG of the DKG share xi held by
+	// the node. The readers verify the reencryption shares of the node with it.
+	PublicShare []byte `json:"public_share,omitempty"`
+}
+
+// Roster is the list of the members of a SMC.
+type Roster []RosterMember
+
+// RosterSignature is the collective signature of the members of a roster, e.g.
+// the members of the current roster of a SMC authorizing a new roster. The
+// signatures are not aggregated: the public keys of the members come without a
+// proof of possession, so an aggregate could be forged with a rogue key.
+type RosterSignature struct {
+	// Mask has the bit i set when the i-th member of the roster is one of the
+	// signers.
+	Mask []byte `json:"mask"`
+
+	// Signatures are the BLS signatures of the members over the signed
+	// message, e.g. the one returned by RosterUpdateMessage, in the order of
+	// the roster. The signature of a member that did not sign is empty.
+	Signatures [][]byte `json:"signatures"`
+}
+
+// NewRosterSignature returns an empty signature for the given roster.
+func NewRosterSignature(roster Roster) RosterSignature {
+	return RosterSignature{
+		Mask:       make([]byte, (len(roster)+7)/8),
+		Signatures: make([][]byte, len(roster)),
+	}
+}
+
+// SetSigner sets the signature of the i-th member of the roster.
+func (s RosterSignature) SetSigner(i int, sig []byte) {
+	s.Mask[i/8] |= 1 << (i % 8)
+	s.Signatures[i] = sig
+}
+
+// isSigner returns true if the i-th member of the roster is a signer.
+func (s RosterSignature) isSigner(i int) bool {
+	return s.Mask[i/8]&(1<<(i%8)) != 0
+}
+
+// RosterUpdateMessage returns the message the members of the current roster
+// of a SMC must sign to replace it with the new roster. The nonce is the one
+// of the SMC in the contract, see GetSmcNonce.
+func RosterUpdateMessage(smcKey []byte, nonce uint64, newRoster Roster) ([]byte, error) {
+	roster, err := newRoster.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(rosterUpdateDomain))
+
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(smcKey)))
+	h.Write(size)
+	h.Write(smcKey)
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, nonce)
+	h.Write(counter)
+	h.Write(roster)
+
+	return h.Sum(nil), nil
+}
+
+// DecodeRoster decodes and validates a roster. Every member must have a valid
+// address and a public key, and the public keys and share indices must be
+// unique.
+func DecodeRoster(data []byte) (Roster, error) {
+	var roster Roster
+
+	err := json.Unmarshal(data, &roster)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode roster: %v", err)
+	}
+
+	if len(roster) == 0 {
+		return nil, xerrors.Errorf("empty roster")
+	}
+
+	keys := map[string]struct{}{}
+	indices := map[uint32]struct{}{}
+
+	for _, m := range roster {
+		_, _, err := net.SplitHostPort(m.Address)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid node '%s' in roster: %v", m.Address, err)
+		}
+
+		if len(m.PublicKey) == 0 {
+			return nil, xerrors.Errorf("node '%s' has no public key", m.Address)
+		}
+
+		if len(m.PublicShare) > 0 {
+			err = suite.Point().UnmarshalBinary(m.PublicShare)
+			if err != nil {
+				return nil, xerrors.Errorf("invalid public share of node '%s': %v",
+					m.Address, err)
+			}
+		}
+
+		_, found := keys[string(m.PublicKey)]
+		if found {
+			return nil, xerrors.Errorf("duplicate public key %x", m.PublicKey)
+		}
+
+		keys[string(m.PublicKey)] = struct{}{}
+
+		_, found = indices[m.ShareIndex]
+		if found {
+			return nil, xerrors.Errorf("duplicate share index %d", m.ShareIndex)
+		}
+
+		indices[m.ShareIndex] = struct{}{}
+	}
+
+	return roster, nil
+}
+
+// Encode returns the serialized roster.
+func (r Roster) Encode() ([]byte, error) {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode roster: %v", err)
+	}
+
+	return buf, nil
+}
+
+// keys returns the sorted hex-encoded public keys of the members.
+func (r Roster) keys() []string {
+	keys := make([]string, len(r))
+	for i, m := range r {
+		keys[i] = hex.EncodeToString(m.PublicKey)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// indexOf returns the index of the member with the given public key, or -1 if
+// there is none.
+func (r Roster) indexOf(publicKey []byte) int {
+	for i, m := range r {
+		if bytes.Equal(m.PublicKey, publicKey) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// validateRosterUpdate verifies that the new roster has sufficient overlap
+// with the old roster. The members are compared by public key so that a node
+// changing its address is still the same member. It returns an error if the
+// new roster is not valid.
+func validateRosterUpdate(oldRoster Roster, newRoster Roster) error {
+	oldKeys := oldRoster.keys()
+
+	// verify there's overlap between old roster and new roster
+	overlap := intersectSortedRosters(oldKeys, newRoster.keys())
+	thr := rosterThreshold(len(oldKeys))
+	if overlap < thr {
+		return xerrors.Errorf(
+			"new roster does not overlap enough with current roster (%d < %d)",
+			overlap, thr)
+	}
+
+	return nil
+}
+
+// verifyRosterSignature verifies that the message is signed by at least a
+// threshold of the members of the roster.
+func verifyRosterSignature(roster Roster, msg []byte, data []byte) error {
+
+	var sig RosterSignature
+
+	err := json.Unmarshal(data, &sig)
+	if err != nil {
+		return xerrors.Errorf("failed to decode signature: %v", err)
+	}
+
+	return sig.verify(roster, msg)
+}
+
+// verify verifies that enough members of the roster signed the message. The
+// signature of each member is verified on its own.
+func (s RosterSignature) verify(roster Roster, msg []byte) error {
+	if len(s.Mask) != (len(roster)+7)/8 {
+		return xerrors.Errorf("invalid mask length %d", len(s.Mask))
+	}
+
+	if len(s.Signatures) != len(roster) {
+		return xerrors.Errorf("invalid number of signatures %d", len(s.Signatures))
+	}
+
+	signers := 0
+
+	for i, m := range roster {
+		if !s.isSigner(i) {
+			continue
+		}
+
+		pk, err := bls.NewPublicKey(m.PublicKey)
+		if err != nil {
+			return xerrors.Errorf("invalid public key of node '%s': %v", m.Address, err)
+		}
+
+		err = pk.Verify(msg, bls.NewSignature(s.Signatures[i]))
+		if err != nil {
+			return xerrors.Errorf("invalid signature of node '%s': %v", m.Address, err)
+		}
+
+		signers++
+	}
+
+	thr := rosterThreshold(len(roster))
+	if signers < thr {
+		return xerrors.Errorf("not enough signers (%d < %d)", signers, thr)
+	}
+
+	return nil
+}
+
+// rosterThreshold returns the number of members of a roster of size n that
+// must approve its update.
+func rosterThreshold(n int) int {
+	return n - (n-1)/3
+}
+
+// intersectSortedRosters returns the # of elements in common between 2 rosters
+// Its behaviour is undefined if the rosters are not sorted.
+func intersectSortedRosters(oldRoster []string, newRoster []string) int {
+	overlap := 0
+
+	oldIdx := 0
+	newIdx := 0
+	for oldIdx < len(oldRoster) && newIdx < len(newRoster) {
+		o, n := oldRoster[oldIdx], newRoster[newIdx]
+
+		switch {
+		case o < n:
+			oldIdx++
+
+		case o > n:
+			newIdx++
+
+		case o == n:
+			oldIdx++
+			newIdx++
+			overlap++
+		}
+	}
+
+	return overlap
+}
@@ -0,0 +1,340 @@
+package calypso
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/core/store/prefixed"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestDecodeRoster(t *testing.T) {
+	roster, err := DecodeRoster([]byte(makeRoster(t, "node:12345", "other:54321")))
+	require.NoError(t, err)
+	require.Equal(t, Roster{
+		{Address: "node:12345", PublicKey: []byte("pk:node:12345")},
+		{Address: "other:54321", PublicKey: []byte("pk:other:54321"), ShareIndex: 1},
+	}, roster)
+
+	buf, err := roster.Encode()
+	require.NoError(t, err)
+	require.Equal(t, makeRoster(t, "node:12345", "other:54321"), string(buf))
+
+	share, err := hex.DecodeString(testSmcKey)
+	require.NoError(t, err)
+
+	roster[0].PublicShare = share
+
+	buf, err = roster.Encode()
+	require.NoError(t, err)
+
+	decoded, err := DecodeRoster(buf)
+	require.NoError(t, err)
+	require.Equal(t, roster, decoded)
+}
+
+func TestDecodeRoster_Failures(t *testing.T) {
+	tests := []struct {
+		name   string
+		roster string
+		err    string
+	}{
+		{"bad json", "node:12345", "failed to decode roster: "},
+		{"empty", "[]", "empty roster"},
+		{"bad address",
+			`[{"address":"abcd","public_key":"QQ=="}]`,
+			"invalid node 'abcd' in roster: "},
+		{"no key",
+			`[{"address":"node:12345"}]`,
+			"node 'node:12345' has no public key"},
+		{"duplicate key",
+			`[{"address":"node:12345","public_key":"QQ=="},` +
+				`{"address":"other:54321","public_key":"QQ==","share_index":1}]`,
+			"duplicate public key 41"},
+		{"duplicate index",
+			`[{"address":"node:12345","public_key":"QQ=="},` +
+				`{"address":"other:54321","public_key":"Qg=="}]`,
+			"duplicate share index 0"},
+		{"bad public share",
+			`[{"address":"node:12345","public_key":"QQ==","public_share":"QQ=="}]`,
+			"invalid public share of node 'node:12345': "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeRoster([]byte(tt.roster))
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestCommand_AdvertiseSmc_RosterUpdate(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	smcKey := testSmcKey
+
+	signers := make([]bls.Signer, 5)
+	for i := range signers {
+		signers[i] = bls.NewSigner()
+	}
+
+	oldRoster := makeSignerRoster(t, signers[:4])
+	newRoster := makeSignerRoster(t, signers[1:])
+
+	oldBuf, err := oldRoster.Encode()
+	require.NoError(t, err)
+
+	newBuf, err := newRoster.Encode()
+	require.NoError(t, err)
+
+	snap := fake.NewSnapshot()
+
+	// the first roster of a SMC doesn't need a signature
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(oldBuf),
+		SmcProofArg, makeSmcProof(t, smcKey, string(oldBuf))))
+	require.NoError(t, err)
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(newBuf)))
+	require.EqualError(t, err, "'calypso:smc_roster_signature' not found in tx arg")
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(newBuf),
+		RosterSignatureArg, "abcd"))
+	require.ErrorContains(t, err,
+		"roster signature verification failed: failed to decode signature: ")
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(newBuf),
+		RosterSignatureArg, `{"mask":"AAAA"}`))
+	require.EqualError(t, err,
+		"roster signature verification failed: invalid mask length 3")
+
+	sig := signRosterUpdate(t, smcKey, 1, oldRoster, newRoster, signers, 0, 1)
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(newBuf),
+		RosterSignatureArg, sig))
+	require.EqualError(t, err,
+		"roster signature verification failed: not enough signers (2 < 3)")
+
+	// signed by enough members, but for another roster
+	sig = signRosterUpdate(t, smcKey, 1, oldRoster, oldRoster, signers, 0, 1, 2)
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(newBuf),
+		RosterSignatureArg, sig))
+	require.ErrorContains(t, err,
+		"roster signature verification failed: invalid signature of node ")
+
+	// signed by enough members, but for another SMC
+	sig = signRosterUpdate(t, otherSmcKey, 1, oldRoster, newRoster, signers, 0, 1, 2)
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(newBuf),
+		RosterSignatureArg, sig))
+	require.ErrorContains(t, err,
+		"roster signature verification failed: invalid signature of node ")
+
+	// signed by enough members, but for another nonce
+	sig = signRosterUpdate(t, smcKey, 0, oldRoster, newRoster, signers, 0, 1, 2)
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(newBuf),
+		RosterSignatureArg, sig))
+	require.ErrorContains(t, err,
+		"roster signature verification failed: invalid signature of node ")
+
+	sig = signRosterUpdate(t, smcKey, 1, oldRoster, newRoster, signers, 0, 2, 3)
+	update := makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(newBuf),
+		RosterSignatureArg, sig)
+
+	err = cmd.advertiseSmc(snap, update)
+	require.NoError(t, err)
+
+	k := prefixed.NewPrefixedKey([]byte(PrefixSmcRosterKeys), []byte(smcKey))
+	res, err := snap.Get(k)
+	require.NoError(t, err)
+	require.Equal(t, newBuf, res)
+
+	// the old roster takes the SMC back, the previous update can't be
+	// replayed to remove it again
+	sig = signRosterUpdate(t, smcKey, 2, newRoster, oldRoster, signers[1:], 0, 1, 2)
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey, RosterArg, string(oldBuf),
+		RosterSignatureArg, sig))
+	require.NoError(t, err)
+
+	err = cmd.advertiseSmc(snap, update)
+	require.ErrorContains(t, err,
+		"roster signature verification failed: invalid signature of node ")
+
+	nonce, err := GetSmcNonce(snap, []byte(smcKey))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), nonce)
+}
+
+func TestCommand_AdvertiseSmc_Reshare(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	signers := []bls.Signer{bls.NewSigner(), bls.NewSigner()}
+
+	oldRoster := makeSignerRoster(t, signers)
+	oldBuf, err := oldRoster.Encode()
+	require.NoError(t, err)
+
+	// the DKG is reshared to a disjoint committee
+	newBuf := makeRoster(t, "other:12345", "other:12346")
+	newRoster, err := DecodeRoster([]byte(newBuf))
+	require.NoError(t, err)
+
+	snap := fake.NewSnapshot()
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, string(oldBuf),
+		SmcProofArg, makeSmcProof(t, testSmcKey, string(oldBuf))))
+	require.NoError(t, err)
+
+	sig := signRosterUpdate(t, testSmcKey, 1, oldRoster, newRoster, signers, 0, 1)
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, newBuf, RosterSignatureArg, sig))
+	require.EqualError(t, err, "roster validation failed: "+
+		"new roster does not overlap enough with current roster (0 < 2)")
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, newBuf, RosterSignatureArg, sig,
+		SmcProofArg, makeSmcProof(t, testSmcKey, string(oldBuf))))
+	require.ErrorContains(t, err, "proof of possession verification failed: invalid proof: ")
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, newBuf, RosterSignatureArg, sig,
+		SmcProofArg, makeSmcProofAt(t, testSmcKey, 1, newBuf)))
+	require.NoError(t, err)
+
+	smc, err := GetSmc(snap, []byte(testSmcKey))
+	require.NoError(t, err)
+	require.Equal(t, newRoster, smc.Roster)
+}
+
+func TestCommand_AdvertiseSmc_RosterUpdateBadKey(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+
+	err := cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProof(t, testSmcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, testSmcKey, RosterArg, makeRoster(t, "node:12345"), SmcProofArg, makeSmcProofAt(t, testSmcKey, 1, makeRoster(t, "node:12345")),
+		RosterSignatureArg, `{"mask":"AQ==","signatures":["AA=="]}`))
+	require.ErrorContains(t, err, "roster signature verification failed: "+
+		"invalid public key of node 'node:12345': ")
+}
+
+func TestRosterSignature_Verify_Individually(t *testing.T) {
+	signers := make([]bls.Signer, 4)
+	for i := range signers {
+		signers[i] = bls.NewSigner()
+	}
+
+	roster := makeSignerRoster(t, signers)
+	msg := []byte("message")
+
+	sign := func(signer bls.Signer) []byte {
+		sig, err := signer.Sign(msg)
+		require.NoError(t, err)
+
+		buf, err := sig.MarshalBinary()
+		require.NoError(t, err)
+
+		return buf
+	}
+
+	sig := NewRosterSignature(roster)
+	sig.SetSigner(1, sign(signers[1]))
+	sig.SetSigner(2, sign(signers[2]))
+	sig.SetSigner(3, sign(signers[3]))
+	require.NoError(t, sig.verify(roster, msg))
+
+	// a member can't sign in the name of the others, e.g. with an aggregate
+	// built from a rogue public key
+	rogue := NewRosterSignature(roster)
+	rogue.SetSigner(0, sign(signers[3]))
+	rogue.SetSigner(1, sign(signers[3]))
+	rogue.SetSigner(3, sign(signers[3]))
+	err := rogue.verify(roster, msg)
+	require.ErrorContains(t, err, "invalid signature of node 'node:12345': ")
+
+	rogue = NewRosterSignature(roster)
+	rogue.SetSigner(0, []byte{})
+	rogue.Signatures = rogue.Signatures[:3]
+	err = rogue.verify(roster, msg)
+	require.EqualError(t, err, "invalid number of signatures 3")
+}
+
+// makeSignerRoster returns a roster with a member for each signer.
+func makeSignerRoster(t *testing.T, signers []bls.Signer) Roster {
+	roster := make(Roster, len(signers))
+	for i, signer := range signers {
+		pk, err := signer.GetPublicKey().MarshalBinary()
+		require.NoError(t, err)
+
+		roster[i] = RosterMember{
+			Address:    fmt.Sprintf("node:%d", 12345+i),
+			PublicKey:  pk,
+			ShareIndex: uint32(i),
+		}
+	}
+
+	return roster
+}
+
+// signRosterUpdate returns the serialized signature of the roster update with
+// the nonce by the signers at the given indices of the old roster.
+func signRosterUpdate(t *testing.T, smcKey string, nonce uint64, oldRoster,
+	newRoster Roster, signers []bls.Signer, indices ...int) string {
+
+	msg, err := RosterUpdateMessage([]byte(smcKey), nonce, newRoster)
+	require.NoError(t, err)
+
+	return signRosterMessage(t, msg, oldRoster, signers, indices...)
+}
+
+// signRosterMessage returns the serialized signature of the message by the
+// signers at the given indices of the roster.
+func signRosterMessage(t *testing.T, msg []byte, roster Roster, signers []bls.Signer,
+	indices ...int) string {
+
+	rosterSig := NewRosterSignature(roster)
+
+	for _, index := range indices {
+		sig, err := signers[index].Sign(msg)
+		require.NoError(t, err)
+
+		buf, err := sig.MarshalBinary()
+		require.NoError(t, err)
+
+		rosterSig.SetSigner(index, buf)
+	}
+
+	buf, err := json.Marshal(rosterSig)
+	require.NoError(t, err)
+
+	return string(buf)
+}
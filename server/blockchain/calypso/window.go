@@ -0,0 +1,172 @@
+package calypso
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/store/prefixed"
+	"golang.org/x/xerrors"
+)
+
+// Units of the bounds of a reveal window.
+const (
+	// WindowHeight expresses the bounds in block indices.
+	WindowHeight = "height"
+
+	// WindowTimestamp expresses the bounds in seconds since the Unix epoch.
+	// It is refused since the blocks of the ordering service have no time.
+	WindowTimestamp = "timestamp"
+)
+
+// Window defines when a secret can be revealed. A zero bound is not enforced.
+type Window struct {
+	// Unit is either WindowHeight or WindowTimestamp.
+	Unit string `json:"unit"`
+
+	// NotBefore is the first block index or time the secret can be revealed at.
+	NotBefore uint64 `json:"not_before,omitempty"`
+
+	// NotAfter is the last block index or time the secret can be revealed at.
+	NotAfter uint64 `json:"not_after,omitempty"`
+}
+
+// current returns the current position in the unit of the window. The blocks
+// of the ordering service have no time, so only their index is known.
+func (w Window) current(index uint64) (uint64, error) {
+	if w.Unit == WindowTimestamp {
+		return 0, xerrors.Errorf("the ordering service provides no timestamp")
+	}
+
+	return index, nil
+}
+
+// check returns nil if the secret can be revealed in the block.
+func (w Window) check(index uint64) error {
+	now, err := w.current(index)
+	if err != nil {
+		return err
+	}
+
+	if w.NotBefore > 0 && now < w.NotBefore {
+		return xerrors.Errorf("reveal window opens at %s %d (current %d)",
+			w.Unit, w.NotBefore, now)
+	}
+
+	if w.NotAfter > 0 && now > w.NotAfter {
+		return xerrors.Errorf("reveal window closed at %s %d (current %d)",
+			w.Unit, w.NotAfter, now)
+	}
+
+	return nil
+}
+
+// isExpired returns true if the window is closed for good.
+func (w Window) isExpired(index uint64) bool {
+	now, err := w.current(index)
+	if err != nil {
+		return false
+	}
+
+	return w.NotAfter > 0 && now > w.NotAfter
+}
+
+// parseWindow reads the optional window arguments of the transaction. It
+// returns nil if the transaction has none.
+func parseWindow(step execution.Step) (*Window, error) {
+	notBefore := step.Current.GetArg(NotBeforeArg)
+	notAfter := step.Current.GetArg(NotAfterArg)
+
+	if len(notBefore) == 0 && len(notAfter) == 0 {
+		return nil, nil
+	}
+
+	window := &Window{Unit: WindowHeight}
+
+	unit := string(step.Current.GetArg(WindowUnitArg))
+	switch unit {
+	case "", WindowHeight:
+	case WindowTimestamp:
+		return nil, xerrors.Errorf("unsupported window unit: %s, the ordering "+
+			"service provides no timestamp", unit)
+	default:
+		return nil, xerrors.Errorf("unknown window unit: %s", unit)
+	}
+
+	var err error
+
+	if len(notBefore) > 0 {
+		window.NotBefore, err = strconv.ParseUint(string(notBefore), 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid '%s': %v", NotBeforeArg, err)
+		}
+	}
+
+	if len(notAfter) > 0 {
+		window.NotAfter, err = strconv.ParseUint(string(notAfter), 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid '%s': %v", NotAfterArg, err)
+		}
+	}
+
+	if window.NotAfter > 0 && window.NotAfter < window.NotBefore {
+		return nil, xerrors.Errorf("'%s' is before '%s'", NotAfterArg, NotBeforeArg)
+	}
+
+	return window, nil
+}
+
+//
+// Utility functions
+//
+
+func getSecretWindow(snap store.Readable, name []byte) (*Window, error) {
+	k := prefixed.NewPrefixedKey([]byte(PrefixWindowKeys), name)
+	buf, err := snap.Get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) == 0 {
+		return nil, nil
+	}
+
+	var window Window
+	err = json.Unmarshal(buf, &window)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode window: %v", err)
+	}
+
+	return &window, nil
+}
+
+func setSecretWindow(snap store.Snapshot, name []byte, window Window) error {
+	buf, err := json.Marshal(window)
+	if err != nil {
+		return xerrors.Errorf("failed to encode window: %v", err)
+	}
+
+	k := prefixed.NewPrefixedKey([]byte(PrefixWindowKeys), name)
+	return snap.Set(k, buf)
+}
+
+// checkSecretWindow returns nil if the secret has no window or if it can be
+// revealed in the block.
+func checkSecretWindow(snap store.Readable, name []byte, index uint64) error {
+	window, err := getSecretWindow(snap, name)
+	if err != nil {
+		return xerrors.Errorf("failed to get window of '%s': %v", name, err)
+	}
+
+	if window == nil {
+		return nil
+	}
+
+	err = window.check(index)
+	if err != nil {
+		return xerrors.Errorf("secret '%s' can't be revealed: %v", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package calypso
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/testing/fake"
+)
+
+func TestCommand_RevealWindow(t *testing.T) {
+	contract := NewContract(fakeAccess{})
+
+	buf := &bytes.Buffer{}
+	contract.printer = buf
+
+	cmd := calypsoCommand{
+		Contract: &contract,
+	}
+
+	snap := fake.NewSnapshot()
+	setHeight(t, snap, 10)
+
+	const (
+		smcKey = testSmcKey
+		name   = "my_secret"
+	)
+
+	err := cmd.advertiseSmc(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		RosterArg, makeRoster(t, "node:12345"),
+		SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345"))))
+	require.NoError(t, err)
+
+	err = cmd.createSecret(snap, makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name,
+		SecretArg, makeSecret(t, smcKey, name, "my_value"),
+		NotBeforeArg, "20",
+		NotAfterArg, "30"))
+	require.NoError(t, err)
+
+	window, err := getSecretWindow(snap, []byte(name))
+	require.NoError(t, err)
+	require.Equal(t, &Window{Unit: WindowHeight, NotBefore: 20, NotAfter: 30}, window)
+
+	reveal := makeStep(t,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name,
+		PubKeyArg, "my_pubkey")
+
+	err = cmd.revealSecret(snap, reveal)
+	require.EqualError(t, err, "secret 'my_secret' can't be revealed: "+
+		"reveal window opens at height 20 (current 10)")
+
+	setHeight(t, snap, 20)
+	err = cmd.revealSecret(snap, reveal)
+	require.NoError(t, err)
+
+	setHeight(t, snap, 30)
+	err = cmd.revealSecret(snap, reveal)
+	require.NoError(t, err)
+
+	err = cmd.listSecrets(snap, makeStep(t, SmcPublicKeyArg, smcKey))
+	require.NoError(t, err)
+	require.Equal(t, "my_secret="+makeSecret(t, testSmcKey, "my_secret", "my_value"), buf.String())
+
+	setHeight(t, snap, 31)
+	err = cmd.revealSecret(snap, reveal)
+	require.EqualError(t, err, "secret 'my_secret' can't be revealed: "+
+		"reveal window closed at height 30 (current 31)")
+
+	buf.Reset()
+	err = cmd.listSecrets(snap, makeStep(t, SmcPublicKeyArg, smcKey))
+	require.NoError(t, err)
+	require.Equal(t, "my_secret="+makeSecret(t, smcKey, name, "my_value")+" (expired)", buf.String())
+
+	// the window is removed with the secret
+	err = deleteSecret(snap, []byte(name))
+	require.NoError(t, err)
+
+	window, err = getSecretWindow(snap, []byte(name))
+	require.NoError(t, err)
+	require.Nil(t, window)
+}
+
+func TestContract_RevealWindow_Opens(t *testing.T) {
+	blocks := &fakeBlockInfo{index: 1}
+	contract := NewContract(fakeAccess{}, WithBlockInfo(blocks))
+
+	snap := fake.NewSnapshot()
+
+	const (
+		smcKey = testSmcKey
+		name   = "my_secret"
+	)
+
+	execute := func(cmd Command, args ...string) error {
+		args = append(args, CmdArg, string(cmd))
+		return contract.Execute(snap, makeStep(t, args...))
+	}
+
+	err := execute(CmdAdvertiseSmc,
+		SmcPublicKeyArg, smcKey,
+		RosterArg, makeRoster(t, "node:12345"),
+		SmcProofArg, makeSmcProof(t, smcKey, makeRoster(t, "node:12345")))
+	require.NoError(t, err)
+
+	// the secret is created in the block 2 and can be revealed from the block 5
+	blocks.index = 2
+
+	err = execute(CmdCreateSecret,
+		SmcPublicKeyArg, smcKey,
+		SecretNameArg, name,
+		SecretArg, makeSecret(t, smcKey, name, "my_value"),
+		NotBeforeArg, "5")
+	require.NoError(t, err)
+
+	reveal := func() error {
+		return execute(CmdRevealSecret,
+			SmcPublicKeyArg, smcKey,
+			SecretNameArg, name,
+			PubKeyArg, "my_pubkey")
+	}
+
+	// the transactions don't move the window, only the blocks do
+	blocks.index = 4
+
+	for i := 0; i < 3; i++ {
+		err = reveal()
+		require.EqualError(t, err, "failed to REVEAL_SECRET: secret 'my_secret' "+
+			"can't be revealed: reveal window opens at height 5 (current 4)")
+	}
+
+	blocks.index = 5
+
+	err = reveal()
+	require.NoError(t, err)
+
+	height, err := GetHeight(snap)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), height)
+}
+
+func TestWindow_Timestamp(t *testing.T) {
+	window := Window{Unit: WindowTimestamp, NotAfter: 1700000000}
+
+	err := window.check(1700000001)
+	require.EqualError(t, err, "the ordering service provides no timestamp")
+	require.False(t, window.isExpired(1700000001))
+}
+
+func Test_parseWindow(t *testing.T) {
+	window, err := parseWindow(makeStep(t))
+	require.NoError(t, err)
+	require.Nil(t, window)
+
+	window, err = parseWindow(makeStep(t, NotAfterArg, "5"))
+	require.NoError(t, err)
+	require.Equal(t, &Window{Unit: WindowHeight, NotAfter: 5}, window)
+
+	_, err = parseWindow(makeStep(t, NotBeforeArg, "5", WindowUnitArg, WindowTimestamp))
+	require.EqualError(t, err, "unsupported window unit: timestamp, the ordering "+
+		"service provides no timestamp")
+
+	_, err = parseWindow(makeStep(t, NotBeforeArg, "5", WindowUnitArg, "days"))
+	require.EqualError(t, err, "unknown window unit: days")
+
+	_, err = parseWindow(makeStep(t, NotBeforeArg, "a"))
+	require.EqualError(t, err, "invalid 'calypso:not_before': "+
+		"strconv.ParseUint: parsing \"a\": invalid syntax")
+
+	_, err = parseWindow(makeStep(t, NotAfterArg, "a"))
+	require.EqualError(t, err, "invalid 'calypso:not_after': "+
+		"strconv.ParseUint: parsing \"a\": invalid syntax")
+
+	_, err = parseWindow(makeStep(t, NotBeforeArg, "5", NotAfterArg, "4"))
+	require.EqualError(t, err, "'calypso:not_after' is before 'calypso:not_before'")
+}
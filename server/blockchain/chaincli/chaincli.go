@@ -16,7 +16,6 @@ import (
 	minogrpc "go.dedis.ch/dela/mino/minogrpc/controller"
 	proxy "go.dedis.ch/dela/mino/proxy/http/controller"
 	"go.dedis.ch/hbt/server/blockchain/web"
-	purbkv "go.dedis.ch/purb-db/store/kv/controller"
 )
 
 func main() {
@@ -39,9 +38,7 @@ func runWithCfg(args []string, cfg config) error {
 	builder := node.NewBuilderWithCfg(
 		cfg.Channel,
 		cfg.Writer,
-		purbkv.NewController(),
 		proxy.NewController(),
-		web.NewController(),
 		minogrpc.NewController(),
 		kv.NewController(),
 		cosipbft.NewController(),
@@ -49,6 +46,8 @@ func runWithCfg(args []string, cfg config) error {
 		pool.NewController(),
 		access.NewController(),
 		calypso.NewController(),
+		// the handlers follow the blocks of the ordering service
+		web.NewController(),
 	)
 
 	app := builder.Build()
@@ -1,21 +1,24 @@
 package web
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
 	"go.dedis.ch/dela"
 	"go.dedis.ch/dela/cli/node"
-	"go.dedis.ch/dela/core/execution"
-	"go.dedis.ch/dela/core/txn"
-	"go.dedis.ch/dela/core/txn/signed"
+	"go.dedis.ch/dela/core/ordering"
+	"go.dedis.ch/dela/crypto"
 	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/crypto/loader"
 	"go.dedis.ch/dela/mino/proxy"
 	"go.dedis.ch/hbt/server/blockchain/calypso"
-	purbkv "go.dedis.ch/purb-db/store/kv"
 
 	"golang.org/x/xerrors"
 )
@@ -36,13 +39,45 @@ func (a *RegisterAction) Execute(ctx node.Context) error {
 
 	router := mux.NewRouter()
 
-	s := &secretHandler{ctx}
+	s := &secretHandler{
+		ctx:       ctx,
+		txs:       newTxSubmitter(ctx),
+		nodeOwner: ctx.Flags.Bool(nodeOwnerFlag),
+	}
+
+	var srvc ordering.Service
+	err = ctx.Injector.Resolve(&srvc)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve ordering service: %v", err)
+	}
+
+	// the statuses of the transactions are known from the registration
+	s.txs.tracker.start(srvc)
+
+	if ctx.Flags.Path(chainRosterFlag) != "" {
+		s.chainRoster, err = loadChainRoster(ctx.Flags.Path(chainRosterFlag))
+		if err != nil {
+			return err
+		}
+	}
+
 	router.HandleFunc("/secret/smc", s.advertiseSmc).Methods("POST")
+	router.HandleFunc("/secret/smc", s.listSmc).Methods("GET")
+	router.HandleFunc("/secret/smc/migrate", s.migrateSecrets).Methods("POST")
+	router.HandleFunc("/secret/smc/nonce", s.getSmcNonce).Methods("GET")
 
 	router.HandleFunc("/secret", s.addSecret).Methods("POST")
+	router.HandleFunc("/secret/tx/{id}", s.getTx).Methods("GET")
+	router.HandleFunc("/secret/nonce", s.getNonce).Methods("GET")
 
-	router.HandleFunc("/secret/admin/list", s.listSecrets).Methods("GET")
-	router.HandleFunc("/secret/admin", s.getSecret).Methods("GET")
+	router.HandleFunc("/secret/list", s.listSecrets).Methods("GET")
+	router.HandleFunc("/secret/admin", s.revealSecret).Methods("POST")
+
+	router.HandleFunc("/secret/reader", s.listReaderAccess).Methods("GET")
+	router.HandleFunc("/secret/access", s.getAccess).Methods("GET")
+	router.HandleFunc("/secret/access/share", s.getRevealShare).Methods("GET")
+
+	router.HandleFunc("/secret/{name}/audit", s.getAuditLog).Methods("GET")
 
 	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
 	router.MethodNotAllowedHandler = http.HandlerFunc(notAllowedHandler)
@@ -54,10 +89,17 @@ func (a *RegisterAction) Execute(ctx node.Context) error {
 	return nil
 }
 
-type DocID []byte
-
 type secretHandler struct {
 	ctx node.Context
+	txs *txSubmitter
+
+	// chainRoster is the roster of the chain, used to gather the reveal
+	// proofs. The proofs are not gathered if it is empty.
+	chainRoster calypso.Roster
+
+	// nodeOwner allows the node to sign the transactions of the requests
+	// without a transaction of the client.
+	nodeOwner bool
 }
 
 // advertiseSmc advertises the SMC public key and its roster to the blockchain
@@ -69,163 +111,436 @@ func (s *secretHandler) advertiseSmc(w http.ResponseWriter, r *http.Request) {
 
 	smckey := r.FormValue("smckey")
 	roster := r.FormValue("roster")
+	signature := r.FormValue("signature")
+	proof := r.FormValue("proof")
+	predecessor := r.FormValue("predecessor")
 	dela.Logger.Info().Msgf("received SMC pubkey %v from SMC roster %v", smckey, roster)
 
-	// get the calypso contract
-	var c calypso.Contract
-	err = s.ctx.Injector.Resolve(&c)
+	s.execute(w, r, calypso.CmdAdvertiseSmc,
+		calypso.SmcPublicKeyArg, smckey, calypso.RosterArg, roster,
+		calypso.RosterSignatureArg, signature, calypso.SmcProofArg, proof,
+		calypso.PredecessorArg, predecessor)
+}
+
+// migrateSecrets binds the secrets of the predecessor of a SMC to the SMC. The
+// ciphertexts are moved as they are, unless the form carries their values
+// encrypted for the SMC, as a JSON object, and the signature of the members of
+// the predecessor over them.
+func (s *secretHandler) migrateSecrets(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(32 << 20)
 	if err != nil {
-		dela.Logger.Error().Err(err).Msg("failed to resolve calypso contract")
-		http.Error(w, fmt.Sprintf("failed to resolve calypso contract: %v", err),
-			http.StatusInternalServerError)
+		log.Fatal().Err(err)
+	}
+
+	smckey := r.FormValue("smckey")
+	secrets := r.FormValue("secrets")
+	signature := r.FormValue("signature")
+	dela.Logger.Info().Msgf("received secrets migration to SMC %v", smckey)
+
+	s.execute(w, r, calypso.CmdMigrateSecrets, calypso.SmcPublicKeyArg, smckey,
+		calypso.MigratedSecretsArg, secrets, calypso.RosterSignatureArg, signature)
+}
+
+// addSecret adds a new secret in the blockchain
+func (s *secretHandler) addSecret(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		log.Fatal().Err(err)
+	}
+
+	smckey := r.FormValue("smckey")
+	secret := r.FormValue("secret")
+	id := r.FormValue("id")
+	dela.Logger.Info().Msgf("received doc ID=%v with secret=%v", id, secret)
+
+	// optional policy restricting who can reveal the secret
+	readers := r.FormValue("readers")
+	darc := r.FormValue("darc")
+
+	// optional window during which the secret can be revealed
+	notBefore := r.FormValue("not_before")
+	notAfter := r.FormValue("not_after")
+	windowUnit := r.FormValue("window_unit")
+
+	// the secret is added to the blockchain with the document ID as the key
+	// and the encrypted key as the value
+	s.execute(w, r, calypso.CmdCreateSecret,
+		calypso.SmcPublicKeyArg, smckey,
+		calypso.SecretNameArg, id, calypso.SecretArg, secret,
+		calypso.PolicyReadersArg, readers, calypso.PolicyDarcArg, darc,
+		calypso.NotBeforeArg, notBefore, calypso.NotAfterArg, notAfter,
+		calypso.WindowUnitArg, windowUnit)
+}
+
+// secretPage is the response of the secret list endpoint
+type secretPage struct {
+	Total   uint64                     `json:"total"`
+	Offset  uint64                     `json:"offset"`
+	Secrets []calypso.SecretDescriptor `json:"secrets"`
+}
+
+// listSecrets lists the secrets of a SMC, or of all the SMCs if no SMC key is
+// given, e.g. GET /secret/list?smckey=<key>&offset=0&limit=20
+func (s *secretHandler) listSecrets(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to parse form")
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
 		return
 	}
 
-	var db purbkv.DB
-	err = s.ctx.Injector.Resolve(&db)
+	offset, limit, err := parsePage(r)
 	if err != nil {
-		dela.Logger.Error().Err(err).Msg("failed to resolve PURB database")
-		http.Error(w, fmt.Sprintf("failed to resolve database: %v", err),
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pubkey := r.Form.Get("pubkey")
+	smckey := r.Form.Get("smckey")
+	dela.Logger.Info().Msgf("received request from %v to list the secrets", pubkey)
+
+	snap, err := s.getStore()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to resolve store")
+		http.Error(w, fmt.Sprintf("failed to resolve store: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	err = db.Update(func(txn purbkv.WritableTx) error {
-		b, err := txn.GetBucketOrCreate([]byte("bucket:secret"))
-		if err != nil {
-			return err
-		}
+	page := secretPage{Offset: offset}
+
+	page.Secrets, page.Total, err = calypso.ListSecretsPage(snap, []byte(smckey),
+		offset, limit)
+
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to list secrets")
+		http.Error(w, fmt.Sprintf("failed to list secrets: %v", err),
+			http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-		err = c.Execute(b, makeStep(calypso.CmdArg, string(calypso.CmdAdvertiseSmc),
-			calypso.SmcPublicKeyArg, smckey, calypso.RosterArg, roster))
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode secrets")
+	}
+}
 
-		return err
-	})
+// smcPage is the response of the SMC list endpoint
+type smcPage struct {
+	Total  uint64              `json:"total"`
+	Offset uint64              `json:"offset"`
+	Smcs   []calypso.SmcRecord `json:"smcs"`
+}
+
+// listSmc lists the advertised SMCs, e.g. GET /secret/smc?offset=0&limit=20
+func (s *secretHandler) listSmc(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to parse form")
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
+		return
+	}
 
+	offset, limit, err := parsePage(r)
 	if err != nil {
-		dela.Logger.Error().Err(err).Msg("failed to advertise SMC to the blockchain")
-		http.Error(w, fmt.Sprintf("failed to advertise SMC to the blockchain: %v", err),
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := s.getStore()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to resolve store")
+		http.Error(w, fmt.Sprintf("failed to resolve store: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	page := smcPage{Offset: offset}
+
+	page.Smcs, page.Total, err = calypso.ListSmcPage(snap, offset, limit)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to list SMCs")
+		http.Error(w, fmt.Sprintf("failed to list SMCs: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	dela.Logger.Info().Msg("SMC advertised to the blockchain")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode SMCs")
+	}
 }
 
-// addSecret adds a new secret in the blockchain
-func (s *secretHandler) addSecret(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(32 << 20)
+// getSmcNonce returns the nonce to sign in the next advertisement of a SMC,
+// e.g. GET /secret/smc/nonce?smckey=<key>. It is known for the deleted SMCs.
+func (s *secretHandler) getSmcNonce(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		log.Fatal().Err(err)
+		dela.Logger.Error().Err(err).Msg("failed to parse form")
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
+		return
 	}
 
-	smckey := r.FormValue("smckey")
-	secret := r.FormValue("secret")
-	id := r.FormValue("id")
-	dela.Logger.Info().Msgf("received doc ID=%v with secret=%v", id, secret)
+	smckey := r.Form.Get("smckey")
+	if smckey == "" {
+		http.Error(w, "missing smckey", http.StatusBadRequest)
+		return
+	}
 
-	// get the calypso contract
-	var c calypso.Contract
-	err = s.ctx.Injector.Resolve(&c)
+	snap, err := s.getStore()
 	if err != nil {
-		dela.Logger.Error().Err(err).Msg("failed to resolve calypso contract")
-		http.Error(w, fmt.Sprintf("failed to resolve calypso contract: %v", err),
+		dela.Logger.Error().Err(err).Msg("failed to resolve store")
+		http.Error(w, fmt.Sprintf("failed to resolve store: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	var db purbkv.DB
-	err = s.ctx.Injector.Resolve(&db)
+	nonce, err := calypso.GetSmcNonce(snap, []byte(smckey))
 	if err != nil {
-		dela.Logger.Error().Err(err).Msg("failed to resolve database")
-		http.Error(w, fmt.Sprintf("failed to resolve PURB database: %v", err),
+		dela.Logger.Error().Err(err).Msg("failed to get nonce")
+		http.Error(w, fmt.Sprintf("failed to get nonce: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	// add the secret to the blockchain
-	// the secret is added to the blockchain with the document ID as the key
-	// and the encrypted key as the value
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	err = db.Update(func(txn purbkv.WritableTx) error {
-		b, err := txn.GetBucketOrCreate([]byte("bucket:secret"))
-		if err != nil {
-			return err
-		}
+	err = json.NewEncoder(w).Encode(struct {
+		Nonce uint64 `json:"nonce"`
+	}{Nonce: nonce})
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode nonce")
+	}
+}
+
+// readerAccessPage is the response of the reader access endpoint
+type readerAccessPage struct {
+	Total    uint64                 `json:"total"`
+	Offset   uint64                 `json:"offset"`
+	Accesses []calypso.ReaderAccess `json:"accesses"`
+}
+
+// listReaderAccess lists the secrets revealed to a reader, e.g.
+// GET /secret/reader?pubkey=<key>&timestamp=<seconds>&signature=<hex>&limit=20.
+// The signature is the one of calypso.ReaderAccessRequest by the private key
+// of the reader.
+func (s *secretHandler) listReaderAccess(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to parse form")
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	pubkey := r.Form.Get("pubkey")
+	if pubkey == "" {
+		http.Error(w, "missing pubkey", http.StatusBadRequest)
+		return
+	}
+
+	timestamp, sig, err := parseSignedRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := calypso.ReaderAccessRequest{
+		Reader:    []byte(pubkey),
+		Timestamp: timestamp,
+	}
 
-		err = c.Execute(b, makeStep(calypso.CmdArg, string(calypso.CmdCreateSecret),
-			calypso.SmcPublicKeyArg, smckey,
-			calypso.SecretNameArg, id, calypso.SecretArg, secret))
+	err = req.Verify(sig)
+	if err != nil {
+		dela.Logger.Warn().Err(err).Msgf("refused accesses of %s", pubkey)
+		http.Error(w, fmt.Sprintf("not signed by the reader: %v", err),
+			http.StatusForbidden)
+		return
+	}
+
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := s.getStore()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to resolve store")
+		http.Error(w, fmt.Sprintf("failed to resolve store: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	page := readerAccessPage{
+		Offset:   offset,
+		Accesses: []calypso.ReaderAccess{},
+	}
 
-		return err
-	})
+	page.Accesses, page.Total, err = calypso.ListReaderAccess(snap, []byte(pubkey),
+		offset, limit)
 
 	if err != nil {
-		dela.Logger.Error().Err(err).Msg("failed to add secret to the blockchain")
-		http.Error(w, fmt.Sprintf("failed to add secret to the blockchain: %v", err),
+		dela.Logger.Error().Err(err).Msg("failed to list reader access")
+		http.Error(w, fmt.Sprintf("failed to list reader access: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	dela.Logger.Info().Msgf("secret added to the blockchain: ID=%v secret=%v", id, secret)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode reader access")
+	}
 }
 
-// listSecrets lists all secrets in the blockchain
-func (s *secretHandler) listSecrets(w http.ResponseWriter, r *http.Request) {
-	// list all secrets from the blockchain
+// getAccess returns the access record of an access token, e.g.
+// GET /secret/access?token=<hex>
+func (s *secretHandler) getAccess(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
 		dela.Logger.Error().Err(err).Msg("failed to parse form")
 		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	token, err := hex.DecodeString(r.Form.Get("token"))
+	if err != nil || len(token) == 0 {
+		http.Error(w, "invalid access token", http.StatusBadRequest)
+		return
+	}
+
+	snap, err := s.getStore()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to resolve store")
+		http.Error(w, fmt.Sprintf("failed to resolve store: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	pubkey := r.Form.Get("pubkey")
-	dela.Logger.Info().Msgf("received request from %v to list the secrets", pubkey)
+	access, err := calypso.GetAccess(snap, token)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to get access")
+		http.Error(w, fmt.Sprintf("failed to get access: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	if access == nil {
+		http.Error(w, "unknown access token", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(access)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode access")
+	}
+}
 
-	// get the calypso contract
-	var c calypso.Contract
-	err = s.ctx.Injector.Resolve(&c)
+// getRevealShare returns the access record of an access token signed by the
+// node at the given time, e.g.
+// GET /secret/access/share?token=<hex>&timestamp=<seconds>. The time must be
+// close to the clock of the node. The shares of the nodes of the chain are
+// combined into the reveal proof required by the SMC.
+func (s *secretHandler) getRevealShare(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to parse form")
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	token, err := hex.DecodeString(r.Form.Get("token"))
+	if err != nil || len(token) == 0 {
+		http.Error(w, "invalid access token", http.StatusBadRequest)
+		return
+	}
+
+	timestamp, err := strconv.ParseInt(r.Form.Get("timestamp"), 10, 64)
 	if err != nil {
-		dela.Logger.Error().Err(err).Msg("failed to resolve calypso contract")
-		http.Error(w, fmt.Sprintf("failed to resolve calypso contract: %v", err),
+		http.Error(w, "invalid timestamp", http.StatusBadRequest)
+		return
+	}
+
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew > calypso.RevealProofValidity || skew < -calypso.RevealProofValidity {
+		http.Error(w, "timestamp too far from the clock of the node", http.StatusBadRequest)
+		return
+	}
+
+	snap, err := s.getStore()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to resolve store")
+		http.Error(w, fmt.Sprintf("failed to resolve store: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	var db purbkv.DB
-	err = s.ctx.Injector.Resolve(&db)
+	access, err := calypso.GetAccess(snap, token)
 	if err != nil {
-		dela.Logger.Error().Err(err).Msg("failed to resolve database")
-		http.Error(w, fmt.Sprintf("failed to resolve database: %v", err),
+		dela.Logger.Error().Err(err).Msg("failed to get access")
+		http.Error(w, fmt.Sprintf("failed to get access: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	err = db.View(func(txn purbkv.ReadableTx) error {
-		b := txn.GetBucket([]byte("bucket:secret"))
+	if access == nil {
+		http.Error(w, "unknown access token", http.StatusNotFound)
+		return
+	}
 
-		err = c.Execute(b, makeStep(calypso.CmdArg, string(calypso.CmdListSecrets)))
+	signer, err := loadSigner(s.ctx)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to load signer")
+		http.Error(w, fmt.Sprintf("failed to load signer: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
 
-		return err
-	})
+	share, err := calypso.NewRevealShare(signer, token, *access, timestamp)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to sign access")
+		http.Error(w, fmt.Sprintf("failed to sign access: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(share)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode reveal share")
+	}
 }
 
-// getSecret gets a secret from the blockchain
-func (s *secretHandler) getSecret(w http.ResponseWriter, r *http.Request) {
-	// Decode the request
-	var id DocID
-	err := json.NewDecoder(r.Body).Decode(&id)
+// loadSigner loads the private key of the node, which is the one of the node
+// in the roster of the chain.
+func loadSigner(ctx node.Context) (crypto.Signer, error) {
+	path := filepath.Join(ctx.Flags.Path(configFlag), privateKeyFile)
+
+	data, err := loader.NewFileLoader(path).Load()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return nil, xerrors.Errorf("failed to load private key: %v", err)
 	}
 
-	// get the secret from the blockchain
-	// TODO
+	signer, err := bls.NewSignerFromBytes(data)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal signer: %v", err)
+	}
 
+	return signer, nil
 }
 
 // -----------------------------------------------------------------------------
@@ -281,24 +596,30 @@ func notAllowedHandler(w http.ResponseWriter, r *http.Request) {
 
 // -----------------------------------------------------------------------------
 // Utility functions
-var nounce uint64
 
-func makeStep(args ...string) execution.Step {
-	return execution.Step{Current: makeTx(args...)}
-}
+// defaultPageLimit is the number of records returned when no limit is given
+const defaultPageLimit = 100
+
+// parseUint parses an optional query parameter
+func parseUint(value string, def uint64) (uint64, error) {
+	if value == "" {
+		return def, nil
+	}
 
-func makeTx(args ...string) txn.Transaction {
-	signer := bls.NewSigner()
+	return strconv.ParseUint(value, 10, 64)
+}
 
-	options := []signed.TransactionOption{}
-	for i := 0; i < len(args)-1; i += 2 {
-		options = append(options, signed.WithArg(args[i], []byte(args[i+1])))
+// parsePage returns the offset and the limit of a list request
+func parsePage(r *http.Request) (uint64, uint64, error) {
+	offset, err := parseUint(r.Form.Get("offset"), 0)
+	if err != nil {
+		return 0, 0, xerrors.Errorf("invalid offset: %v", err)
 	}
 
-	tx, err := signed.NewTransaction(nounce, signer.GetPublicKey(), options...)
+	limit, err := parseUint(r.Form.Get("limit"), defaultPageLimit)
 	if err != nil {
-		nounce++
+		return 0, 0, xerrors.Errorf("invalid limit: %v", err)
 	}
 
-	return tx
+	return offset, limit, nil
 }
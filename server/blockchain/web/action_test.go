@@ -0,0 +1,604 @@
+package web
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/dela/core/access"
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/txn"
+	"go.dedis.ch/dela/core/validation"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/mino/proxy"
+	sjson "go.dedis.ch/dela/serde/json"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"go.dedis.ch/hbt/server/smc"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/suites"
+)
+
+var suite = suites.MustFind("Ed25519")
+
+func TestRegisterAction_Execute(t *testing.T) {
+	action := RegisterAction{}
+
+	inj := node.NewInjector()
+
+	err := action.Execute(node.Context{Injector: inj, Flags: node.FlagSet{}})
+	require.ErrorContains(t, err, "failed to resolve proxy: ")
+
+	inj.Inject(&fakeProxy{})
+
+	err = action.Execute(node.Context{Injector: inj, Flags: node.FlagSet{}})
+	require.ErrorContains(t, err, "failed to resolve ordering service: ")
+
+	inj.Inject(newFakeOrdering())
+
+	err = action.Execute(node.Context{
+		Injector: inj,
+		Flags:    node.FlagSet{chainRosterFlag: filepath.Join(t.TempDir(), "roster.json")},
+	})
+	require.ErrorContains(t, err, "failed to read chain roster: ")
+
+	err = action.Execute(node.Context{Injector: inj, Flags: node.FlagSet{}})
+	require.NoError(t, err)
+}
+
+func TestSecretHandler_AddSecret(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 1, false, node.FlagSet{})
+
+	smcKey := chain.advertiseSmc(t, nodes[0])
+	value := makeSecret(t, smcKey, "doc", "my secret")
+
+	// the node doesn't own the secrets of its clients
+	resp := postForm(t, nodes[0].url+"/secret", map[string]string{
+		"smckey": smcKey, "id": "doc", "secret": value,
+	})
+	requireStatus(t, resp, http.StatusForbidden,
+		"CREATE_SECRET requires a transaction signed by the client\n")
+
+	tx := newClientTx(t, calypso.CmdCreateSecret, calypso.SmcPublicKeyArg, smcKey,
+		calypso.SecretNameArg, "doc", calypso.SecretArg, value)
+
+	res := chain.submit(t, nodes[0], "/secret", tx, http.StatusOK)
+	require.Equal(t, txAccepted, res.Status)
+	require.Equal(t, uint64(2), res.Index)
+
+	// the client owns the secret
+	secret, err := calypso.GetSecret(chain.srvc.snap, []byte(smcKey), []byte("doc"))
+	require.NoError(t, err)
+	require.Equal(t, []byte(value), secret.Value)
+	require.Equal(t, identityOf(t, tx), secret.Owner)
+
+	// the transaction is refused by the contract
+	tx = newClientTx(t, calypso.CmdCreateSecret, calypso.SmcPublicKeyArg, smcKey,
+		calypso.SecretNameArg, "doc", calypso.SecretArg, value)
+
+	res = chain.submit(t, nodes[0], "/secret", tx, http.StatusBadRequest)
+	require.Equal(t, txRejected, res.Status)
+	require.Contains(t, res.Message, "failed to CREATE_SECRET: ")
+
+	// a transaction of another command is refused by the handler
+	resp = postForm(t, nodes[0].url+"/secret", map[string]string{
+		"tx": makeClientTx(t, calypso.CmdDeleteSecret),
+	})
+	requireStatus(t, resp, http.StatusBadRequest,
+		"expected a transaction of command CREATE_SECRET\n")
+}
+
+func TestSecretHandler_AddSecret_NodeOwner(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 1, false, node.FlagSet{nodeOwnerFlag: true})
+
+	smcKey := chain.advertiseSmc(t, nodes[0])
+
+	resp := postForm(t, nodes[0].url+"/secret", map[string]string{
+		"smckey": smcKey, "id": "doc", "secret": makeSecret(t, smcKey, "doc", "my secret"),
+	})
+	res := decodeTxResult(t, resp, http.StatusOK)
+	require.Equal(t, txAccepted, res.Status)
+
+	// the node owns the secret
+	secret, err := calypso.GetSecret(chain.srvc.snap, []byte(smcKey), []byte("doc"))
+	require.NoError(t, err)
+
+	owner, err := nodes[0].signer.GetPublicKey().MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, string(owner), secret.Owner)
+}
+
+func TestSecretHandler_ListSecrets(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 1, false, node.FlagSet{nodeOwnerFlag: true})
+
+	var page secretPage
+
+	// no SMC was advertised yet
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/list"), http.StatusOK, &page)
+	require.Equal(t, uint64(0), page.Total)
+	require.Empty(t, page.Secrets)
+
+	first := chain.advertiseSmc(t, nodes[0])
+	second := chain.advertiseSmc(t, nodes[0])
+
+	owner, err := nodes[0].signer.GetPublicKey().MarshalText()
+	require.NoError(t, err)
+
+	secrets := map[string]string{"a": first, "b": first, "c": first, "d": second}
+
+	for name, smcKey := range secrets {
+		resp := postForm(t, nodes[0].url+"/secret", map[string]string{
+			"smckey": smcKey, "id": name, "secret": makeSecret(t, smcKey, name, name),
+		})
+		decodeTxResult(t, resp, http.StatusOK)
+	}
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/list"), http.StatusOK, &page)
+	require.Equal(t, secretPage{Total: 4, Offset: 0, Secrets: page.Secrets}, page)
+	require.Len(t, page.Secrets, 4)
+
+	for _, secret := range page.Secrets {
+		require.Equal(t, secrets[string(secret.Name)], string(secret.Smc))
+		require.Equal(t, string(owner), secret.Owner)
+	}
+
+	all := page.Secrets
+	page = secretPage{}
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/list?offset=1&limit=2"),
+		http.StatusOK, &page)
+	require.Equal(t, secretPage{Total: 4, Offset: 1, Secrets: all[1:3]}, page)
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/list?smckey="+first),
+		http.StatusOK, &page)
+	require.Equal(t, uint64(3), page.Total)
+
+	for _, secret := range page.Secrets {
+		require.Equal(t, first, string(secret.Smc))
+	}
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/list?smckey="+second+"&offset=1"),
+		http.StatusOK, &page)
+	require.Equal(t, uint64(1), page.Total)
+	require.Empty(t, page.Secrets)
+
+	requireStatus(t, httpGet(t, nodes[0].url+"/secret/list?smckey=aa"),
+		http.StatusNotFound, "failed to list secrets: SMC not found: aa\n")
+
+	resp := httpGet(t, nodes[0].url+"/secret/list?offset=-1")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "invalid offset: ")
+
+	resp = httpGet(t, nodes[0].url+"/secret/list?limit=x")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "invalid limit: ")
+}
+
+func TestSecretHandler_ListSmc(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 1, false, node.FlagSet{})
+
+	var page smcPage
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/smc"), http.StatusOK, &page)
+	require.Equal(t, smcPage{Smcs: []calypso.SmcRecord{}}, page)
+
+	keys := map[string]bool{
+		chain.advertiseSmc(t, nodes[0]): true,
+		chain.advertiseSmc(t, nodes[0]): true,
+		chain.advertiseSmc(t, nodes[0]): true,
+	}
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/smc"), http.StatusOK, &page)
+	require.Equal(t, uint64(3), page.Total)
+	require.Len(t, page.Smcs, 3)
+
+	for _, record := range page.Smcs {
+		require.True(t, keys[string(record.Key)])
+		require.Len(t, record.Roster, 1)
+		require.Equal(t, "127.0.0.1:2001", record.Roster[0].Address)
+	}
+
+	all := page.Smcs
+	page = smcPage{}
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/smc?offset=2&limit=5"),
+		http.StatusOK, &page)
+	require.Equal(t, smcPage{Total: 3, Offset: 2, Smcs: all[2:]}, page)
+
+	resp := httpGet(t, nodes[0].url+"/secret/smc?offset=x")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "invalid offset: ")
+}
+
+func TestSecretHandler_GetSmcNonce(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 1, false, node.FlagSet{})
+
+	var res struct {
+		Nonce uint64 `json:"nonce"`
+	}
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/smc/nonce?smckey=abcd"),
+		http.StatusOK, &res)
+	require.Equal(t, uint64(0), res.Nonce)
+
+	smcKey := chain.advertiseSmc(t, nodes[0])
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/smc/nonce?smckey="+smcKey),
+		http.StatusOK, &res)
+	require.Equal(t, uint64(1), res.Nonce)
+
+	requireStatus(t, httpGet(t, nodes[0].url+"/secret/smc/nonce"),
+		http.StatusBadRequest, "missing smckey\n")
+}
+
+func TestSecretHandler_GetRevealShare(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 2, true, node.FlagSet{})
+
+	smcKey := chain.advertiseSmc(t, nodes[0])
+	token := chain.reveal(t, nodes[0], smcKey, "reader")
+
+	now := time.Now().Unix()
+
+	var share calypso.RevealShare
+
+	decodeJSON(t, httpGet(t, fmt.Sprintf("%s/secret/access/share?token=%x&timestamp=%d",
+		nodes[1].url, token, now)), http.StatusOK, &share)
+
+	pk, err := nodes[1].signer.GetPublicKey().MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, pk, share.PublicKey)
+	require.Equal(t, token, share.Token)
+	require.Equal(t, now, share.Timestamp)
+
+	msg, err := calypso.RevealProofMessage(token, share.Access, now)
+	require.NoError(t, err)
+	require.NoError(t, nodes[1].signer.GetPublicKey().Verify(msg, bls.NewSignature(share.Signature)))
+
+	requireStatus(t, httpGet(t, nodes[1].url+"/secret/access/share?token=xyz&timestamp=0"),
+		http.StatusBadRequest, "invalid access token\n")
+
+	requireStatus(t, httpGet(t, fmt.Sprintf("%s/secret/access/share?token=%x",
+		nodes[1].url, token)), http.StatusBadRequest, "invalid timestamp\n")
+
+	requireStatus(t, httpGet(t, fmt.Sprintf("%s/secret/access/share?token=%x&timestamp=%d",
+		nodes[1].url, token, now-3600)), http.StatusBadRequest,
+		"timestamp too far from the clock of the node\n")
+
+	requireStatus(t, httpGet(t, fmt.Sprintf("%s/secret/access/share?token=aa&timestamp=%d",
+		nodes[1].url, now)), http.StatusNotFound, "unknown access token\n")
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// testChain is a chain whose transactions are executed by the calypso contract
+// as soon as they are added to the pool, each in its own block.
+type testChain struct {
+	srvc *fakeOrdering
+	pool *fakePool
+
+	// roster is the roster of the chain written for the nodes, if any.
+	roster calypso.Roster
+
+	index uint64
+}
+
+func newTestChain() *testChain {
+	chain := &testChain{
+		srvc: newFakeOrdering(),
+		pool: &fakePool{},
+	}
+
+	contract := calypso.NewContract(fakeAccess{})
+
+	chain.pool.onAdd = func(tx txn.Transaction) {
+		chain.index++
+
+		err := contract.Execute(chain.srvc.snap, execution.Step{Current: tx})
+		if err != nil {
+			chain.srvc.include(chain.index, tx, false, err.Error())
+		} else {
+			chain.srvc.include(chain.index, tx, true, "")
+		}
+	}
+
+	return chain
+}
+
+// testNode is a node of the test chain, with the handlers of its proxy served
+// by a test server.
+type testNode struct {
+	url    string
+	server *httptest.Server
+	signer bls.Signer
+
+	handler func(http.ResponseWriter, *http.Request)
+}
+
+// startNodes starts n nodes of the chain with the flags. The roster of the
+// chain is written for them if roster is true.
+func (c *testChain) startNodes(t *testing.T, n int, roster bool,
+	flags node.FlagSet) []*testNode {
+
+	nodes := make([]*testNode, n)
+	members := make(calypso.Roster, n)
+
+	for i := range nodes {
+		nd := &testNode{signer: bls.NewSigner()}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+			r *http.Request) {
+
+			nd.handler(w, r)
+		}))
+		t.Cleanup(server.Close)
+
+		nd.url = server.URL
+		nd.server = server
+
+		pk, err := nd.signer.GetPublicKey().MarshalBinary()
+		require.NoError(t, err)
+
+		members[i] = calypso.RosterMember{
+			Address:    strings.TrimPrefix(server.URL, "http://"),
+			PublicKey:  pk,
+			ShareIndex: uint32(i),
+		}
+
+		nodes[i] = nd
+	}
+
+	rosterPath := ""
+
+	if roster {
+		buf, err := members.Encode()
+		require.NoError(t, err)
+
+		rosterPath = filepath.Join(t.TempDir(), "roster.json")
+		require.NoError(t, os.WriteFile(rosterPath, buf, 0600))
+
+		c.roster = members
+	}
+
+	for _, nd := range nodes {
+		config := t.TempDir()
+
+		key, err := nd.signer.MarshalBinary()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(config, privateKeyFile), key, 0600))
+
+		p := &fakeProxy{}
+
+		inj := node.NewInjector()
+		inj.Inject(p)
+		inj.Inject(c.srvc)
+		inj.Inject(c.pool)
+		inj.Inject(fakeValidation{})
+
+		nodeFlags := node.FlagSet{configFlag: config, chainRosterFlag: rosterPath}
+		for k, v := range flags {
+			nodeFlags[k] = v
+		}
+
+		action := RegisterAction{}
+
+		err = action.Execute(node.Context{Injector: inj, Flags: nodeFlags})
+		require.NoError(t, err)
+
+		nd.handler = p.handler
+	}
+
+	return nodes
+}
+
+// advertiseSmc advertises a new SMC through the proxy of the node, and returns
+// its key.
+func (c *testChain) advertiseSmc(t *testing.T, nd *testNode) string {
+	secret := suite.Scalar().Pick(suite.RandomStream())
+
+	smcKey := hexPoint(t, suite.Point().Mul(secret, nil))
+
+	roster := calypso.Roster{{
+		Address:   "127.0.0.1:2001",
+		PublicKey: []byte("pk"),
+	}}
+
+	buf, err := roster.Encode()
+	require.NoError(t, err)
+
+	msg, err := calypso.SmcProofMessage([]byte(smcKey), 0, roster)
+	require.NoError(t, err)
+
+	proof, err := schnorr.Sign(suite, secret, msg)
+	require.NoError(t, err)
+
+	tx := newClientTx(t, calypso.CmdAdvertiseSmc, calypso.SmcPublicKeyArg, smcKey,
+		calypso.RosterArg, string(buf), calypso.SmcProofArg, hex.EncodeToString(proof))
+
+	res := c.submit(t, nd, "/secret/smc", tx, http.StatusOK)
+	require.Equal(t, txAccepted, res.Status, res.Message)
+
+	return smcKey
+}
+
+// reveal creates the secret "doc" of the SMC signed by a client, and reveals it
+// to the reader through the node. It returns the access token of the reveal.
+func (c *testChain) reveal(t *testing.T, nd *testNode, smcKey string, reader string) []byte {
+	value := makeSecret(t, smcKey, "doc", "my secret")
+
+	tx := newClientTx(t, calypso.CmdCreateSecret, calypso.SmcPublicKeyArg, smcKey,
+		calypso.SecretNameArg, "doc", calypso.SecretArg, value)
+
+	c.submit(t, nd, "/secret", tx, http.StatusOK)
+
+	var secret smc.Secret
+
+	decodeJSON(t, postForm(t, nd.url+"/secret/admin", map[string]string{
+		"id": "doc", "pubkey": reader,
+		"tx": makeClientTx(t, calypso.CmdRevealSecret, calypso.SmcPublicKeyArg, smcKey,
+			calypso.SecretNameArg, "doc", calypso.PubKeyArg, reader),
+	}), http.StatusOK, &secret)
+
+	return calypso.AccessToken([]byte(smcKey), []byte(value), []byte(reader))
+}
+
+// submit posts the transaction of the client to the path of the node, and
+// returns its result after checking the status of the response.
+func (c *testChain) submit(t *testing.T, nd *testNode, path string,
+	tx txn.Transaction, status int, values ...string) txResult {
+
+	data, err := tx.Serialize(sjson.NewContext())
+	require.NoError(t, err)
+
+	form := map[string]string{"tx": string(data)}
+	for i := 0; i < len(values)-1; i += 2 {
+		form[values[i]] = values[i+1]
+	}
+
+	return decodeTxResult(t, postForm(t, nd.url+path, form), status)
+}
+
+// postForm posts the values as a multipart form.
+func postForm(t *testing.T, url string, values map[string]string) *http.Response {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	for k, v := range values {
+		require.NoError(t, w.WriteField(k, v))
+	}
+
+	require.NoError(t, w.Close())
+
+	resp, err := http.Post(url, w.FormDataContentType(), &body)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+// httpGet sends a GET request to the URL.
+func httpGet(t *testing.T, url string) *http.Response {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+// requireStatus checks the status and the body of the response.
+func requireStatus(t *testing.T, resp *http.Response, status int, body string) {
+	buf := readBody(t, resp)
+
+	require.Equal(t, status, resp.StatusCode, buf)
+	require.Equal(t, body, buf)
+}
+
+// decodeJSON checks the status of the response, and decodes its JSON body.
+func decodeJSON(t *testing.T, resp *http.Response, status int, v interface{}) {
+	buf, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Equal(t, status, resp.StatusCode, string(buf))
+	require.NoError(t, json.Unmarshal(buf, v))
+}
+
+// decodeTxResult checks the status of the response, and returns the status of
+// the transaction.
+func decodeTxResult(t *testing.T, resp *http.Response, status int) txResult {
+	var res txResult
+	decodeJSON(t, resp, status, &res)
+
+	return res
+}
+
+// identityOf returns the text of the identity of the transaction.
+func identityOf(t *testing.T, tx txn.Transaction) string {
+	ident, err := tx.GetIdentity().MarshalText()
+	require.NoError(t, err)
+
+	return string(ident)
+}
+
+// makeSecret returns the value of a secret encrypted for the SMC.
+func makeSecret(t *testing.T, smcKey string, name string, msg string) string {
+	buf, err := calypso.EncryptSecret([]byte(smcKey), []byte(name), []byte(msg))
+	require.NoError(t, err)
+
+	return string(buf)
+}
+
+func hexPoint(t *testing.T, p kyber.Point) string {
+	buf, err := p.MarshalBinary()
+	require.NoError(t, err)
+
+	return hex.EncodeToString(buf)
+}
+
+// fakeProxy keeps the handler registered by the action.
+//
+// - implements proxy.Proxy
+type fakeProxy struct {
+	proxy.Proxy
+	sync.Mutex
+
+	handler func(http.ResponseWriter, *http.Request)
+}
+
+// RegisterHandler implements proxy.Proxy.
+func (p *fakeProxy) RegisterHandler(path string, h func(http.ResponseWriter, *http.Request)) {
+	p.Lock()
+	p.handler = h
+	p.Unlock()
+}
+
+// fakeAccess grants every command to every identity.
+//
+// - implements access.Service
+type fakeAccess struct {
+	access.Service
+}
+
+// Match implements access.Service.
+func (fakeAccess) Match(store.Readable, access.Credential, ...access.Identity) error {
+	return nil
+}
+
+// Grant implements access.Service.
+func (fakeAccess) Grant(store.Snapshot, access.Credential, ...access.Identity) error {
+	return nil
+}
+
+// fakeValidation returns the nonce 0 for every identity, the transactions of
+// the test chain are not validated.
+//
+// - implements validation.Service
+type fakeValidation struct {
+	validation.Service
+}
+
+// GetNonce implements validation.Service.
+func (fakeValidation) GetNonce(store.Readable, access.Identity) (uint64, error) {
+	return 0, nil
+}
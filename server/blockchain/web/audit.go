@@ -0,0 +1,176 @@
+package web
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.dedis.ch/dela"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"golang.org/x/xerrors"
+)
+
+// auditWindow is how far the timestamp of an audit log request, or of any other
+// signed request, can be from the clock of the node.
+const auditWindow = 5 * time.Minute
+
+// auditColumns are the columns of the audit log exported as CSV.
+var auditColumns = []string{"version", "event", "height", "identity", "reader", "access_token", "tx_id", "reveal", "purpose", "reason"}
+
+// getAuditLog returns the audit log of a secret to its owner, e.g.
+// GET /secret/<name>/audit?timestamp=<seconds>&signature=<hex>. The signature
+// is the one of calypso.AuditLogRequest by the identity that created the
+// secret. The log is in JSON, or in CSV if the "format" form value is csv.
+func (s *secretHandler) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to parse form")
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	format := r.Form.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, fmt.Sprintf("unsupported format '%s'", format), http.StatusBadRequest)
+		return
+	}
+
+	req, sig, err := parseAuditLogRequest(r, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := s.getStore()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to resolve store")
+		http.Error(w, fmt.Sprintf("failed to resolve store: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := findSecret(snap, r.Form.Get("smckey"), name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to find secret: %v", err), http.StatusNotFound)
+		return
+	}
+
+	err = req.Verify(secret.Owner, sig)
+	if err != nil {
+		dela.Logger.Warn().Err(err).Msgf("refused audit log of %s", name)
+		http.Error(w, fmt.Sprintf("not the owner of the secret: %v", err),
+			http.StatusForbidden)
+		return
+	}
+
+	logs, err := calypso.ListAuditLogs(snap, secret.Smc, []byte(name))
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to list audit logs")
+		http.Error(w, fmt.Sprintf("failed to list audit logs: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=%q", name+"-audit.csv"))
+
+		err = writeAuditCSV(w, logs)
+		if err != nil {
+			dela.Logger.Error().Err(err).Msg("failed to write audit logs")
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(logs)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode audit logs")
+	}
+}
+
+// parseAuditLogRequest returns the signed request of an audit log, after
+// checking that it is recent.
+func parseAuditLogRequest(r *http.Request,
+	name string) (calypso.AuditLogRequest, []byte, error) {
+
+	timestamp, sig, err := parseSignedRequest(r)
+	if err != nil {
+		return calypso.AuditLogRequest{}, nil, err
+	}
+
+	req := calypso.AuditLogRequest{
+		Name:      []byte(name),
+		Timestamp: timestamp,
+	}
+
+	return req, sig, nil
+}
+
+// parseSignedRequest returns the timestamp and the signature of a signed
+// request, after checking that it is recent.
+func parseSignedRequest(r *http.Request) (int64, []byte, error) {
+	timestamp, err := strconv.ParseInt(r.Form.Get("timestamp"), 10, 64)
+	if err != nil {
+		return 0, nil, xerrors.Errorf("invalid timestamp: %v", err)
+	}
+
+	now := time.Now()
+	ts := time.Unix(timestamp, 0)
+
+	if ts.Before(now.Add(-auditWindow)) || ts.After(now.Add(auditWindow)) {
+		return 0, nil,
+			xerrors.Errorf("stale request: timestamp %d is out of the window", timestamp)
+	}
+
+	sig, err := hex.DecodeString(r.Form.Get("signature"))
+	if err != nil || len(sig) == 0 {
+		return 0, nil, xerrors.New("invalid signature")
+	}
+
+	return timestamp, sig, nil
+}
+
+// writeAuditCSV writes the audit entries as CSV, with a header line. The access
+// token and the transaction ID are hex-encoded.
+func writeAuditCSV(w http.ResponseWriter, logs []calypso.AuditEntry) error {
+	out := csv.NewWriter(w)
+
+	err := out.Write(auditColumns)
+	if err != nil {
+		return xerrors.Errorf("failed to write header: %v", err)
+	}
+
+	for _, entry := range logs {
+		err = out.Write([]string{
+			strconv.FormatUint(uint64(entry.Version), 10),
+			entry.Event,
+			strconv.FormatUint(entry.Height, 10),
+			entry.Identity,
+			string(entry.Reader),
+			hex.EncodeToString(entry.AccessToken),
+			hex.EncodeToString(entry.TxID),
+			strconv.FormatUint(entry.Reveal, 10),
+			entry.Purpose,
+			entry.Reason,
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to write entry: %v", err)
+		}
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
@@ -0,0 +1,379 @@
+package web
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/txn"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"go.dedis.ch/hbt/server/registry/registry"
+	"go.dedis.ch/hbt/server/smc"
+	"golang.org/x/xerrors"
+)
+
+// shareTimeout is how long the proxy waits for the reveal share of another
+// node of the chain.
+var shareTimeout = 5 * time.Second
+
+// revealSecret reveals a secret to a reader, e.g. POST /secret/admin with the
+// form values pubkey=<hex> and id=<name>. It commits the REVEAL_SECRET
+// transaction for the reader and returns the ciphertext of the secret, with
+// the reveal proof required by the SMC if the roster of the chain is known.
+//
+// The reveal is authorized by the reader: the request carries either the
+// transaction signed by the client in the "tx" form value, or the "nonce" and
+// the hex-encoded "signature" of the calypso.RevealRequest by the reader key,
+// in which case the node signs the transaction.
+func (s *secretHandler) revealSecret(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil && err != http.ErrNotMultipart {
+		dela.Logger.Error().Err(err).Msg("failed to parse form")
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	pubkey := r.Form.Get("pubkey")
+	id := r.Form.Get("id")
+
+	if pubkey == "" || id == "" {
+		http.Error(w, "missing pubkey or id", http.StatusBadRequest)
+		return
+	}
+
+	_, timeout, err := parseWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dela.Logger.Info().Msgf("received request from %v to reveal secret %v", pubkey, id)
+
+	snap, err := s.getStore()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to resolve store")
+		http.Error(w, fmt.Sprintf("failed to resolve store: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := findSecret(snap, r.Form.Get("smckey"), id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to find secret: %v", err), http.StatusNotFound)
+		return
+	}
+
+	tx, status, err := s.makeRevealTx(r, secret, pubkey)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to create reveal transaction")
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	res, status, err := s.txs.submit(tx, true, timeout)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to submit reveal transaction")
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	switch res.Status {
+	case txPending:
+		// the client can poll the transaction and retry
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+
+		err = json.NewEncoder(w).Encode(res)
+		if err != nil {
+			dela.Logger.Error().Err(err).Msg("failed to encode transaction status")
+		}
+
+		return
+	case txRejected:
+		http.Error(w, fmt.Sprintf("reveal refused: %s", res.Message), http.StatusForbidden)
+		return
+	}
+
+	response := smc.Secret{
+		Data: string(secret.Value),
+		ID:   registry.RegistrationID{ID: []byte(id)},
+	}
+
+	if len(s.chainRoster) > 0 {
+		token := calypso.AccessToken(secret.Smc, secret.Value, []byte(pubkey))
+
+		proof, err := s.makeRevealProof(token)
+		if err != nil {
+			dela.Logger.Error().Err(err).Msg("failed to make reveal proof")
+			http.Error(w, fmt.Sprintf("failed to make reveal proof: %v", err),
+				http.StatusServiceUnavailable)
+			return
+		}
+
+		response.Proof, err = json.Marshal(proof)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to encode reveal proof: %v", err),
+				http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode secret")
+	}
+}
+
+// makeRevealTx returns the transaction revealing the secret to the reader. It
+// is the transaction of the client if any, which must be the one of the
+// request. Otherwise the request must be signed by the reader, and the
+// transaction is signed by the node with the nonce of the request, so that it
+// can't be replayed.
+func (s *secretHandler) makeRevealTx(r *http.Request, secret *calypso.SecretDescriptor,
+	pubkey string) (txn.Transaction, int, error) {
+
+	args := []string{
+		calypso.SmcPublicKeyArg, string(secret.Smc),
+		calypso.SecretNameArg, string(secret.Name),
+		calypso.PubKeyArg, pubkey,
+	}
+
+	if r.FormValue("tx") != "" {
+		tx, status, err := s.makeTx(r.FormValue("tx"), calypso.CmdRevealSecret)
+		if err != nil {
+			return nil, status, err
+		}
+
+		for i := 0; i < len(args)-1; i += 2 {
+			if string(tx.GetArg(args[i])) != args[i+1] {
+				return nil, http.StatusBadRequest,
+					xerrors.Errorf("the transaction doesn't match the request: '%s' "+
+						"is '%s'", args[i], tx.GetArg(args[i]))
+			}
+		}
+
+		return tx, http.StatusOK, nil
+	}
+
+	if r.FormValue("signature") == "" {
+		return nil, http.StatusForbidden,
+			xerrors.New("the reveal requires the signature of the reader")
+	}
+
+	nonce, err := strconv.ParseUint(r.FormValue("nonce"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, xerrors.Errorf("invalid nonce: %v", err)
+	}
+
+	sig, err := hex.DecodeString(r.FormValue("signature"))
+	if err != nil {
+		return nil, http.StatusBadRequest, xerrors.New("invalid signature")
+	}
+
+	req := calypso.RevealRequest{
+		Token: calypso.AccessToken(secret.Smc, secret.Value, []byte(pubkey)),
+		Nonce: nonce,
+	}
+
+	err = req.Verify([]byte(pubkey), sig)
+	if err != nil {
+		return nil, http.StatusForbidden,
+			xerrors.Errorf("not signed by the reader: %v", err)
+	}
+
+	args = append(args, calypso.RevealNonceArg, strconv.FormatUint(nonce, 10))
+
+	tx, err := s.txs.make(append([]string{calypso.CmdArg,
+		string(calypso.CmdRevealSecret)}, args...)...)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return tx, http.StatusOK, nil
+}
+
+// findSecret returns the secret of the SMC, or of any SMC if the key is empty.
+func findSecret(snap store.Readable, smckey string, name string) (*calypso.SecretDescriptor, error) {
+	if smckey != "" {
+		return calypso.GetSecret(snap, []byte(smckey), []byte(name))
+	}
+
+	smcs, err := calypso.ListSmc(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range smcs {
+		secret, err := calypso.GetSecret(snap, record.Key, []byte(name))
+		if err == nil {
+			return secret, nil
+		}
+	}
+
+	return nil, xerrors.Errorf("secret '%s' not found", name)
+}
+
+// makeRevealProof signs the access record of the token with the key of the
+// node, gathers the shares of the other nodes of the chain and combines them.
+// The shares that don't attest the same record are ignored.
+func (s *secretHandler) makeRevealProof(token []byte) (calypso.RevealProof, error) {
+	snap, err := s.getStore()
+	if err != nil {
+		return calypso.RevealProof{}, err
+	}
+
+	access, err := calypso.GetAccess(snap, token)
+	if err != nil {
+		return calypso.RevealProof{}, xerrors.Errorf("failed to get access: %v", err)
+	}
+
+	if access == nil {
+		return calypso.RevealProof{}, xerrors.New("unknown access token")
+	}
+
+	signer, err := loadSigner(s.ctx)
+	if err != nil {
+		return calypso.RevealProof{}, err
+	}
+
+	// the nodes attest the record at the same time, which bounds the validity
+	// of the proof
+	timestamp := time.Now().Unix()
+
+	own, err := calypso.NewRevealShare(signer, token, *access, timestamp)
+	if err != nil {
+		return calypso.RevealProof{}, err
+	}
+
+	msg, err := calypso.RevealProofMessage(token, *access, timestamp)
+	if err != nil {
+		return calypso.RevealProof{}, err
+	}
+
+	shares := []calypso.RevealShare{own}
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for _, member := range s.chainRoster {
+		if bytes.Equal(member.PublicKey, own.PublicKey) {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(member calypso.RosterMember) {
+			defer wg.Done()
+
+			share, err := fetchRevealShare(member, token, timestamp, msg)
+			if err != nil {
+				dela.Logger.Warn().Err(err).Msgf("no reveal share from %s", member.Address)
+				return
+			}
+
+			lock.Lock()
+			shares = append(shares, share)
+			lock.Unlock()
+		}(member)
+	}
+
+	wg.Wait()
+
+	proof, err := calypso.CombineRevealShares(s.chainRoster, shares)
+	if err != nil {
+		return calypso.RevealProof{}, err
+	}
+
+	// fails if less than a threshold of the nodes answered
+	err = calypso.VerifyRevealProof(s.chainRoster, proof, token, time.Now())
+	if err != nil {
+		return calypso.RevealProof{}, err
+	}
+
+	return proof, nil
+}
+
+// fetchRevealShare returns the share of the node for the token, after checking
+// that it signs the expected message.
+func fetchRevealShare(member calypso.RosterMember, token []byte, timestamp int64,
+	msg []byte) (calypso.RevealShare, error) {
+
+	client := http.Client{Timeout: shareTimeout}
+
+	resp, err := client.Get(fmt.Sprintf("http://%s/secret/access/share?token=%s&timestamp=%d",
+		member.Address, hex.EncodeToString(token), timestamp))
+	if err != nil {
+		return calypso.RevealShare{}, xerrors.Errorf("failed to reach node: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return calypso.RevealShare{}, xerrors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var share calypso.RevealShare
+
+	err = json.NewDecoder(resp.Body).Decode(&share)
+	if err != nil {
+		return calypso.RevealShare{}, xerrors.Errorf("failed to decode share: %v", err)
+	}
+
+	if !bytes.Equal(share.PublicKey, member.PublicKey) {
+		return calypso.RevealShare{}, xerrors.New("share of another node")
+	}
+
+	shareMsg, err := calypso.RevealProofMessage(share.Token, share.Access, share.Timestamp)
+	if err != nil {
+		return calypso.RevealShare{}, err
+	}
+
+	if !bytes.Equal(shareMsg, msg) {
+		return calypso.RevealShare{}, xerrors.New("share of another access record")
+	}
+
+	pk, err := bls.NewPublicKey(share.PublicKey)
+	if err != nil {
+		return calypso.RevealShare{}, xerrors.Errorf("invalid public key: %v", err)
+	}
+
+	err = pk.Verify(msg, bls.NewSignature(share.Signature))
+	if err != nil {
+		return calypso.RevealShare{}, xerrors.Errorf("invalid signature: %v", err)
+	}
+
+	return share, nil
+}
+
+// loadChainRoster reads the roster of the chain from a JSON file. The
+// addresses of the members are the ones of their proxy.
+func loadChainRoster(path string) (calypso.Roster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read chain roster: %v", err)
+	}
+
+	var roster calypso.Roster
+
+	err = json.Unmarshal(data, &roster)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode chain roster: %v", err)
+	}
+
+	if len(roster) == 0 {
+		return nil, xerrors.New("empty chain roster")
+	}
+
+	return roster, nil
+}
@@ -0,0 +1,189 @@
+package web
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"go.dedis.ch/hbt/server/smc"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestSecretHandler_RevealSecret(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 4, true, node.FlagSet{})
+
+	smcKey := chain.advertiseSmc(t, nodes[0])
+	value := makeSecret(t, smcKey, "doc", "my secret")
+
+	tx := newClientTx(t, calypso.CmdCreateSecret, calypso.SmcPublicKeyArg, smcKey,
+		calypso.SecretNameArg, "doc", calypso.SecretArg, value)
+
+	chain.submit(t, nodes[0], "/secret", tx, http.StatusOK)
+
+	// a node of the chain is down, the others are a threshold
+	nodes[3].server.Close()
+
+	privK, reader := makeReader(t)
+	token := calypso.AccessToken([]byte(smcKey), []byte(value), []byte(reader))
+
+	var secret smc.Secret
+
+	decodeJSON(t, postForm(t, nodes[1].url+"/secret/admin",
+		signReveal(t, privK, reader, token, 0)), http.StatusOK, &secret)
+
+	require.Equal(t, value, secret.Data)
+	require.Equal(t, []byte("doc"), secret.ID.ID)
+
+	var proof calypso.RevealProof
+	require.NoError(t, json.Unmarshal(secret.Proof, &proof))
+
+	roster := chain.roster
+
+	require.NoError(t, calypso.VerifyRevealProof(roster, proof, token, time.Now()))
+	require.Equal(t, []byte(reader), proof.Access.Reader)
+
+	// the proof is for the reader only
+	other := calypso.AccessToken([]byte(smcKey), []byte(value), []byte("other"))
+	require.EqualError(t, calypso.VerifyRevealProof(roster, proof, other, time.Now()),
+		"proof is for another access token")
+
+	// the SMC of the secret can be given
+	form := signReveal(t, privK, reader, token, 1)
+	form["smckey"] = smcKey
+
+	decodeJSON(t, postForm(t, nodes[1].url+"/secret/admin", form), http.StatusOK, &secret)
+
+	// a request of the reader can't be replayed
+	resp := postForm(t, nodes[1].url+"/secret/admin", signReveal(t, privK, reader, token, 1))
+	body := readBody(t, resp)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Contains(t, body, "reveal refused: ")
+	require.Contains(t, body, "invalid reveal nonce 1, expected 2")
+
+	// less than a threshold of the nodes attest the reveal
+	nodes[2].server.Close()
+
+	resp = postForm(t, nodes[1].url+"/secret/admin", signReveal(t, privK, reader, token, 2))
+	body = readBody(t, resp)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Contains(t, body, "failed to make reveal proof: ")
+}
+
+func TestSecretHandler_RevealSecret_Refused(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 1, false, node.FlagSet{})
+
+	smcKey := chain.advertiseSmc(t, nodes[0])
+	value := makeSecret(t, smcKey, "doc", "x")
+
+	alicePrivK, alice := makeReader(t)
+	bobPrivK, bob := makeReader(t)
+
+	tx := newClientTx(t, calypso.CmdCreateSecret, calypso.SmcPublicKeyArg, smcKey,
+		calypso.SecretNameArg, "doc", calypso.SecretArg, value,
+		calypso.PolicyReadersArg, alice)
+
+	chain.submit(t, nodes[0], "/secret", tx, http.StatusOK)
+
+	aliceToken := calypso.AccessToken([]byte(smcKey), []byte(value), []byte(alice))
+	bobToken := calypso.AccessToken([]byte(smcKey), []byte(value), []byte(bob))
+
+	// the proof is only gathered if the roster of the chain is known
+	var secret smc.Secret
+
+	decodeJSON(t, postForm(t, nodes[0].url+"/secret/admin",
+		signReveal(t, alicePrivK, alice, aliceToken, 0)), http.StatusOK, &secret)
+	require.Empty(t, secret.Proof)
+
+	resp := postForm(t, nodes[0].url+"/secret/admin",
+		signReveal(t, bobPrivK, bob, bobToken, 0))
+	body := readBody(t, resp)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Contains(t, body, "reveal refused: ")
+	require.Contains(t, body, "is not allowed by the policy")
+
+	// the node doesn't reveal a secret without the consent of the reader
+	requireStatus(t, postForm(t, nodes[0].url+"/secret/admin",
+		map[string]string{"id": "doc", "pubkey": alice}),
+		http.StatusForbidden, "the reveal requires the signature of the reader\n")
+
+	form := signReveal(t, bobPrivK, alice, aliceToken, 1)
+
+	resp = postForm(t, nodes[0].url+"/secret/admin", form)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "not signed by the reader: invalid signature")
+
+	form["nonce"] = "x"
+
+	resp = postForm(t, nodes[0].url+"/secret/admin", form)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "invalid nonce: ")
+
+	form = signReveal(t, alicePrivK, alice, aliceToken, 1)
+	form["signature"] = "xyz"
+
+	requireStatus(t, postForm(t, nodes[0].url+"/secret/admin", form),
+		http.StatusBadRequest, "invalid signature\n")
+
+	// the transaction of a client must be the one of the request
+	requireStatus(t, postForm(t, nodes[0].url+"/secret/admin", map[string]string{
+		"id": "doc", "pubkey": alice,
+		"tx": makeClientTx(t, calypso.CmdRevealSecret, calypso.SmcPublicKeyArg, smcKey,
+			calypso.SecretNameArg, "doc", calypso.PubKeyArg, bob),
+	}), http.StatusBadRequest, "the transaction doesn't match the request: "+
+		"'calypso:pub_key' is '"+bob+"'\n")
+
+	// the state is only changed by a POST
+	resp = httpGet(t, nodes[0].url+"/secret/admin?id=doc&pubkey="+alice)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	requireStatus(t, postForm(t, nodes[0].url+"/secret/admin", map[string]string{"id": "doc"}),
+		http.StatusBadRequest, "missing pubkey or id\n")
+
+	requireStatus(t, postForm(t, nodes[0].url+"/secret/admin", map[string]string{"pubkey": bob}),
+		http.StatusBadRequest, "missing pubkey or id\n")
+
+	requireStatus(t, postForm(t, nodes[0].url+"/secret/admin",
+		map[string]string{"id": "nope", "pubkey": bob}),
+		http.StatusNotFound, "failed to find secret: secret 'nope' not found\n")
+}
+
+// makeReader returns the private key of a new reader and its hex-encoded
+// public key.
+func makeReader(t *testing.T) (kyber.Scalar, string) {
+	privK := suite.Scalar().Pick(suite.RandomStream())
+
+	return privK, hexPoint(t, suite.Point().Mul(privK, nil))
+}
+
+// signReveal returns the form of the reveal of "doc" to the reader, signed by
+// the private key with the nonce.
+func signReveal(t *testing.T, privK kyber.Scalar, reader string, token []byte,
+	nonce uint64) map[string]string {
+
+	sig, err := calypso.RevealRequest{Token: token, Nonce: nonce}.Sign(privK)
+	require.NoError(t, err)
+
+	return map[string]string{
+		"id":        "doc",
+		"pubkey":    reader,
+		"nonce":     strconv.FormatUint(nonce, 10),
+		"signature": hex.EncodeToString(sig),
+	}
+}
+
+// readBody returns the body of the response.
+func readBody(t *testing.T, resp *http.Response) string {
+	buf, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return string(buf)
+}
@@ -0,0 +1,207 @@
+package web
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+
+	"go.dedis.ch/dela/core/ordering"
+)
+
+// maxTrackedTxs is the number of transactions whose status is remembered by
+// the proxy. The oldest ones are forgotten first.
+const maxTrackedTxs = 10000
+
+const (
+	// txPending is the status of a transaction added to the pool and not yet
+	// included in a block.
+	txPending = "pending"
+
+	// txAccepted is the status of a transaction included in a block and
+	// executed successfully.
+	txAccepted = "accepted"
+
+	// txRejected is the status of a transaction included in a block and
+	// refused by the execution.
+	txRejected = "rejected"
+)
+
+// txResult is the status of a transaction, as returned by the proxy.
+type txResult struct {
+	// TxID is the hex-encoded ID of the transaction.
+	TxID string `json:"txid"`
+
+	// Status is pending, accepted or rejected.
+	Status string `json:"status"`
+
+	// Index is the index of the block containing the transaction, if it is not
+	// pending.
+	Index uint64 `json:"index"`
+
+	// Message is the reason of the refusal of the transaction.
+	Message string `json:"message,omitempty"`
+}
+
+// txTracker follows the transactions of the blocks, and remembers the status
+// of the latest ones. The transactions submitted by the proxy are pending until
+// their block is seen.
+type txTracker struct {
+	sync.Mutex
+
+	results map[string]txResult
+
+	// order is the IDs of the results from the oldest to the newest.
+	order []string
+
+	// waiters are notified when their pending transaction is included.
+	waiters map[string][]chan txResult
+
+	// onResult is called for each transaction included in a block.
+	onResult func(txResult)
+
+	started bool
+}
+
+// newTxTracker returns a new tracker. It doesn't follow the blocks until it is
+// started, which is done when the handlers are registered.
+func newTxTracker(onResult func(txResult)) *txTracker {
+	return &txTracker{
+		results:  make(map[string]txResult),
+		waiters:  make(map[string][]chan txResult),
+		onResult: onResult,
+	}
+}
+
+// start follows the blocks of the ordering service, unless it is already
+// started.
+func (t *txTracker) start(srvc ordering.Service) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.started {
+		return
+	}
+
+	t.started = true
+
+	events := srvc.Watch(context.Background())
+
+	go func() {
+		for event := range events {
+			for _, res := range event.Transactions {
+				accepted, msg := res.GetStatus()
+
+				result := txResult{
+					TxID:    hex.EncodeToString(res.GetTransaction().GetID()),
+					Status:  txAccepted,
+					Index:   event.Index,
+					Message: msg,
+				}
+
+				if !accepted {
+					result.Status = txRejected
+				} else {
+					result.Message = ""
+				}
+
+				t.set(result)
+
+				if t.onResult != nil {
+					t.onResult(result)
+				}
+			}
+		}
+	}()
+}
+
+// pending tracks a transaction that is about to be added to the pool, and
+// returns a channel that receives its result when it is included.
+func (t *txTracker) pending(txID string) <-chan txResult {
+	t.Lock()
+	defer t.Unlock()
+
+	ch := make(chan txResult, 1)
+	t.waiters[txID] = append(t.waiters[txID], ch)
+
+	t.store(txResult{TxID: txID, Status: txPending})
+
+	return ch
+}
+
+// stopWaiting removes a channel returned by pending, once the caller stops
+// waiting for the transaction. The transaction is still tracked.
+func (t *txTracker) stopWaiting(txID string, ch <-chan txResult) {
+	t.Lock()
+	defer t.Unlock()
+
+	waiters := t.waiters[txID]
+
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+
+	if len(waiters) == 0 {
+		delete(t.waiters, txID)
+	} else {
+		t.waiters[txID] = waiters
+	}
+}
+
+// forget stops tracking a transaction that never made it to the pool.
+func (t *txTracker) forget(txID string) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.results, txID)
+	delete(t.waiters, txID)
+
+	for i, id := range t.order {
+		if id == txID {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// get returns the status of the transaction if it is known.
+func (t *txTracker) get(txID string) (txResult, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	res, found := t.results[txID]
+
+	return res, found
+}
+
+// set updates the status of a transaction and notifies its waiters.
+func (t *txTracker) set(res txResult) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.store(res)
+
+	for _, ch := range t.waiters[res.TxID] {
+		ch <- res
+	}
+
+	delete(t.waiters, res.TxID)
+}
+
+// store remembers the result, and forgets the oldest ones above the limit.
+// The lock must be held.
+func (t *txTracker) store(res txResult) {
+	_, found := t.results[res.TxID]
+	if !found {
+		t.order = append(t.order, res.TxID)
+	}
+
+	t.results[res.TxID] = res
+
+	for len(t.order) > maxTrackedTxs {
+		delete(t.results, t.order[0])
+		t.order = t.order[1:]
+	}
+}
@@ -0,0 +1,220 @@
+package web
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/dela/core/ordering"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/txn"
+	"go.dedis.ch/dela/core/txn/pool"
+	"go.dedis.ch/dela/core/validation"
+	"go.dedis.ch/dela/core/validation/simple"
+	"go.dedis.ch/dela/testing/fake"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"golang.org/x/xerrors"
+)
+
+func TestTxTracker(t *testing.T) {
+	srvc := newFakeOrdering()
+
+	results := make(chan txResult, 2)
+
+	tracker := newTxTracker(func(res txResult) {
+		results <- res
+	})
+
+	tracker.start(srvc)
+	tracker.start(srvc)
+
+	accepted := newClientTx(t, calypso.CmdCreateSecret)
+	rejected := newClientTx(t, calypso.CmdCreateSecret)
+
+	acceptedID := hex.EncodeToString(accepted.GetID())
+	rejectedID := hex.EncodeToString(rejected.GetID())
+
+	included := tracker.pending(acceptedID)
+
+	res, found := tracker.get(acceptedID)
+	require.True(t, found)
+	require.Equal(t, txResult{TxID: acceptedID, Status: txPending}, res)
+
+	srvc.include(3, accepted, true, "")
+	srvc.include(4, rejected, false, "nonce is invalid")
+
+	require.Equal(t, txResult{TxID: acceptedID, Status: txAccepted, Index: 3}, <-included)
+
+	expected := txResult{TxID: rejectedID, Status: txRejected, Index: 4,
+		Message: "nonce is invalid"}
+
+	require.Equal(t, txResult{TxID: acceptedID, Status: txAccepted, Index: 3}, <-results)
+	require.Equal(t, expected, <-results)
+
+	res, found = tracker.get(rejectedID)
+	require.True(t, found)
+	require.Equal(t, expected, res)
+
+	tracker.Lock()
+	require.Empty(t, tracker.waiters)
+	tracker.Unlock()
+}
+
+func TestTxTracker_StopWaiting(t *testing.T) {
+	tracker := newTxTracker(nil)
+
+	first := tracker.pending("aa")
+	second := tracker.pending("aa")
+
+	tracker.stopWaiting("aa", first)
+	require.Len(t, tracker.waiters["aa"], 1)
+
+	tracker.stopWaiting("aa", second)
+	require.Empty(t, tracker.waiters)
+
+	// the transaction is still tracked
+	res, found := tracker.get("aa")
+	require.True(t, found)
+	require.Equal(t, txPending, res.Status)
+
+	tracker.forget("aa")
+
+	_, found = tracker.get("aa")
+	require.False(t, found)
+}
+
+func TestTxSubmitter_Submit(t *testing.T) {
+	srvc := newFakeOrdering()
+	p := &fakePool{}
+
+	inj := node.NewInjector()
+	inj.Inject(p)
+
+	s := newTxSubmitter(node.Context{Injector: inj})
+	s.tracker.start(srvc)
+
+	tx := newClientTx(t, calypso.CmdCreateSecret)
+	txID := hex.EncodeToString(tx.GetID())
+
+	// the waiter is removed once the handler stops waiting
+	res, status, err := s.submit(tx, false, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, status)
+	require.Equal(t, txResult{TxID: txID, Status: txPending}, res)
+	require.Empty(t, s.tracker.waiters)
+
+	res, status, err = s.submit(tx, true, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, status)
+	require.Equal(t, txPending, res.Status)
+	require.Empty(t, s.tracker.waiters)
+
+	// the handler gets the result of the block
+	p.onAdd = func(tx txn.Transaction) {
+		go srvc.include(5, tx, true, "")
+	}
+
+	res, status, err = s.submit(tx, true, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, txResult{TxID: txID, Status: txAccepted, Index: 5}, res)
+
+	// a transaction refused by the pool is forgotten
+	p.err = xerrors.New("oops")
+
+	tx = newClientTx(t, calypso.CmdCreateSecret)
+
+	_, status, err = s.submit(tx, true, time.Second)
+	require.EqualError(t, err, "failed to add transaction: oops")
+	require.Equal(t, http.StatusBadRequest, status)
+
+	_, found := s.tracker.get(hex.EncodeToString(tx.GetID()))
+	require.False(t, found)
+	require.Empty(t, s.tracker.waiters)
+
+	_, status, err = newTxSubmitter(node.Context{Injector: node.NewInjector()}).
+		submit(tx, true, time.Second)
+	require.ErrorContains(t, err, "failed to resolve pool: ")
+	require.Equal(t, http.StatusInternalServerError, status)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// fakeOrdering is an ordering service whose blocks are created by the tests.
+// Its store is a single snapshot.
+//
+// - implements ordering.Service
+type fakeOrdering struct {
+	ordering.Service
+	sync.Mutex
+
+	snap     store.Snapshot
+	watchers []chan ordering.Event
+}
+
+func newFakeOrdering() *fakeOrdering {
+	return &fakeOrdering{snap: fake.NewSnapshot()}
+}
+
+// Watch implements ordering.Service.
+func (o *fakeOrdering) Watch(ctx context.Context) <-chan ordering.Event {
+	o.Lock()
+	defer o.Unlock()
+
+	ch := make(chan ordering.Event, 100)
+	o.watchers = append(o.watchers, ch)
+
+	return ch
+}
+
+// GetStore implements ordering.Service.
+func (o *fakeOrdering) GetStore() store.Readable {
+	return o.snap
+}
+
+// include creates the block at the index with the transaction.
+func (o *fakeOrdering) include(index uint64, tx txn.Transaction, accepted bool,
+	reason string) {
+
+	o.Lock()
+	defer o.Unlock()
+
+	for _, ch := range o.watchers {
+		ch <- ordering.Event{
+			Index: index,
+			Transactions: []validation.TransactionResult{
+				simple.NewTransactionResult(tx, accepted, reason),
+			},
+		}
+	}
+}
+
+// fakePool is a pool that calls onAdd for each transaction, unless it fails
+// with err.
+//
+// - implements pool.Pool
+type fakePool struct {
+	pool.Pool
+
+	err   error
+	onAdd func(txn.Transaction)
+}
+
+// Add implements pool.Pool.
+func (p *fakePool) Add(tx txn.Transaction) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	if p.onAdd != nil {
+		p.onAdd(tx)
+	}
+
+	return nil
+}
@@ -0,0 +1,407 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/dela/core/access"
+	"go.dedis.ch/dela/core/execution/native"
+	"go.dedis.ch/dela/core/ordering"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/txn"
+	"go.dedis.ch/dela/core/txn/pool"
+	"go.dedis.ch/dela/core/txn/signed"
+	"go.dedis.ch/dela/core/validation"
+	"go.dedis.ch/dela/crypto/bls"
+	sjson "go.dedis.ch/dela/serde/json"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"golang.org/x/xerrors"
+
+	// the transactions of the clients are in the JSON format of dela
+	_ "go.dedis.ch/dela/core/txn/signed/json"
+)
+
+// inclusionTimeout is how long a handler waits by default for its transaction
+// to be included in a block.
+var inclusionTimeout = 30 * time.Second
+
+// maxInclusionTimeout is the longest a client can ask a handler to wait.
+const maxInclusionTimeout = 5 * time.Minute
+
+// txSubmitter creates the transactions of the handlers, signed by the node,
+// and submits them to the pool. The manager is shared by the handlers so that
+// the nonces of the pending transactions are not reused.
+type txSubmitter struct {
+	sync.Mutex
+
+	ctx node.Context
+
+	// manager is created on the first transaction, and reset when its nonce
+	// might be out of sync with the chain.
+	manager txn.Manager
+
+	tracker *txTracker
+}
+
+// newTxSubmitter returns a new submitter for the node.
+func newTxSubmitter(ctx node.Context) *txSubmitter {
+	s := &txSubmitter{ctx: ctx}
+
+	s.tracker = newTxTracker(func(res txResult) {
+		// the nonce of a refused transaction is consumed, unless it was
+		// refused because of the nonce itself
+		if res.Status == txRejected && strings.HasPrefix(res.Message, "nonce is invalid") {
+			s.reset()
+		}
+	})
+
+	return s
+}
+
+// make returns a new transaction of the calypso contract signed by the node.
+func (s *txSubmitter) make(args ...string) (txn.Transaction, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.manager == nil {
+		manager, err := s.newManager()
+		if err != nil {
+			return nil, err
+		}
+
+		s.manager = manager
+	}
+
+	txArgs := []txn.Arg{
+		{Key: native.ContractArg, Value: []byte(calypso.ContractName)},
+	}
+
+	for i := 0; i < len(args)-1; i += 2 {
+		txArgs = append(txArgs, txn.Arg{Key: args[i], Value: []byte(args[i+1])})
+	}
+
+	tx, err := s.manager.Make(txArgs...)
+	if err != nil {
+		s.manager = nil
+		return nil, xerrors.Errorf("failed to create transaction: %v", err)
+	}
+
+	return tx, nil
+}
+
+// reset drops the manager, so that the next transaction fetches the nonce of
+// the node from the chain.
+func (s *txSubmitter) reset() {
+	s.Lock()
+	s.manager = nil
+	s.Unlock()
+}
+
+// newManager returns a transaction manager for the private key of the node,
+// synchronized with the chain.
+func (s *txSubmitter) newManager() (txn.Manager, error) {
+	var srvc ordering.Service
+	err := s.ctx.Injector.Resolve(&srvc)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to resolve ordering service: %v", err)
+	}
+
+	var vs validation.Service
+	err = s.ctx.Injector.Resolve(&vs)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to resolve validation service: %v", err)
+	}
+
+	signer, err := loadSigner(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := signed.NewManager(signer, client{srvc: srvc, mgr: vs})
+
+	err = manager.Sync()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sync manager: %v", err)
+	}
+
+	return manager, nil
+}
+
+// submit adds the transaction to the pool and, if wait is true, waits at most
+// the timeout for the block that contains it. The transaction is still pending
+// if it is not included in time. It returns the HTTP status of the failure if
+// any.
+func (s *txSubmitter) submit(tx txn.Transaction, wait bool,
+	timeout time.Duration) (txResult, int, error) {
+
+	txID := hex.EncodeToString(tx.GetID())
+
+	var p pool.Pool
+	err := s.ctx.Injector.Resolve(&p)
+	if err != nil {
+		return txResult{}, http.StatusInternalServerError,
+			xerrors.Errorf("failed to resolve pool: %v", err)
+	}
+
+	// the tracker follows the blocks, so that the block of the transaction
+	// can't be missed once it is pending
+	included := s.tracker.pending(txID)
+
+	err = p.Add(tx)
+	if err != nil {
+		s.tracker.forget(txID)
+		s.reset()
+
+		return txResult{}, http.StatusBadRequest,
+			xerrors.Errorf("failed to add transaction: %v", err)
+	}
+
+	pending := txResult{TxID: txID, Status: txPending}
+
+	if !wait {
+		s.tracker.stopWaiting(txID, included)
+		return pending, http.StatusAccepted, nil
+	}
+
+	select {
+	case res := <-included:
+		return res, http.StatusOK, nil
+	case <-time.After(timeout):
+		s.tracker.stopWaiting(txID, included)
+		return pending, http.StatusAccepted, nil
+	}
+}
+
+// getTx returns the status of a transaction submitted through the proxy, or
+// included in a block since the proxy started, e.g. GET /secret/tx/<hex>.
+func (s *secretHandler) getTx(w http.ResponseWriter, r *http.Request) {
+	txID := mux.Vars(r)["id"]
+
+	_, err := hex.DecodeString(txID)
+	if err != nil {
+		http.Error(w, "invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	res, found := s.txs.tracker.get(strings.ToLower(txID))
+	if !found {
+		http.Error(w, "unknown transaction", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode transaction status")
+	}
+}
+
+// execute submits a transaction of the calypso command and writes its status.
+// The transaction is the one of the "tx" form value if any, signed by the
+// client, otherwise it is created from the arguments and signed by the node if
+// the node allows it.
+//
+// The handler waits for the inclusion of the transaction unless the "wait"
+// form value is false. The "timeout" form value is the number of seconds to
+// wait, after which the transaction is returned as pending.
+func (s *secretHandler) execute(w http.ResponseWriter, r *http.Request,
+	cmd calypso.Command, args ...string) {
+
+	wait, timeout, err := parseWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, status, err := s.makeTx(r.FormValue("tx"), cmd, args...)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msgf("failed to create %s transaction", cmd)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	res, status, err := s.txs.submit(tx, wait, timeout)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msgf("failed to submit %s transaction", cmd)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if res.Status == txRejected {
+		dela.Logger.Warn().Msgf("%s transaction %s refused: %s", cmd, res.TxID, res.Message)
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode transaction status")
+	}
+}
+
+// parseWait returns the wait options of a write request.
+func parseWait(r *http.Request) (bool, time.Duration, error) {
+	wait := true
+
+	if r.FormValue("wait") != "" {
+		var err error
+
+		wait, err = strconv.ParseBool(r.FormValue("wait"))
+		if err != nil {
+			return false, 0, xerrors.Errorf("invalid wait: %v", err)
+		}
+	}
+
+	seconds, err := parseUint(r.FormValue("timeout"), 0)
+	if err != nil {
+		return false, 0, xerrors.Errorf("invalid timeout: %v", err)
+	}
+
+	timeout := inclusionTimeout
+	if seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	if timeout > maxInclusionTimeout {
+		timeout = maxInclusionTimeout
+	}
+
+	return wait, timeout, nil
+}
+
+// makeTx returns the transaction of the client if any, after checking that it
+// is a transaction of the calypso command. Otherwise it returns a transaction
+// of the node, which is refused unless the operator of the node allows it,
+// since any client of the proxy would then act with the identity of the node.
+func (s *secretHandler) makeTx(data string, cmd calypso.Command,
+	args ...string) (txn.Transaction, int, error) {
+
+	if data == "" {
+		if !s.nodeOwner {
+			return nil, http.StatusForbidden,
+				xerrors.Errorf("%s requires a transaction signed by the client", cmd)
+		}
+
+		tx, err := s.txs.make(append([]string{calypso.CmdArg, string(cmd)}, args...)...)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		return tx, http.StatusOK, nil
+	}
+
+	tx, err := signed.NewTransactionFactory().TransactionOf(sjson.NewContext(), []byte(data))
+	if err != nil {
+		return nil, http.StatusBadRequest, xerrors.Errorf("invalid transaction: %v", err)
+	}
+
+	if string(tx.GetArg(native.ContractArg)) != calypso.ContractName ||
+		string(tx.GetArg(calypso.CmdArg)) != string(cmd) {
+
+		return nil, http.StatusBadRequest,
+			xerrors.Errorf("expected a transaction of command %s", cmd)
+	}
+
+	return tx, http.StatusOK, nil
+}
+
+// getNonce returns the nonce of the next transaction of a client, e.g.
+// GET /secret/nonce?identity=<base64 BLS public key>, so that the client can
+// sign its transactions.
+func (s *secretHandler) getNonce(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to parse form")
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(r.Form.Get("identity"))
+	if err != nil || len(buf) == 0 {
+		http.Error(w, "missing or invalid identity", http.StatusBadRequest)
+		return
+	}
+
+	ident, err := bls.NewPublicKey(buf)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid identity: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var srvc ordering.Service
+	err = s.ctx.Injector.Resolve(&srvc)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to resolve ordering service: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	var vs validation.Service
+	err = s.ctx.Injector.Resolve(&vs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to resolve validation service: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := client{srvc: srvc, mgr: vs}.GetNonce(ident)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to get nonce")
+		http.Error(w, fmt.Sprintf("failed to get nonce: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(struct {
+		Nonce uint64 `json:"nonce"`
+	}{Nonce: nonce})
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to encode nonce")
+	}
+}
+
+// getStore returns the store of the blockchain, as updated by the last block.
+func (s *secretHandler) getStore() (store.Readable, error) {
+	var srvc ordering.Service
+	err := s.ctx.Injector.Resolve(&srvc)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to resolve ordering service: %v", err)
+	}
+
+	return srvc.GetStore(), nil
+}
+
+// client reads the nonce of an identity from the store of the ordering
+// service.
+//
+// - implements signed.Client
+type client struct {
+	srvc ordering.Service
+	mgr  validation.Service
+}
+
+// GetNonce implements signed.Client.
+func (c client) GetNonce(ident access.Identity) (uint64, error) {
+	nonce, err := c.mgr.GetNonce(c.srvc.GetStore(), ident)
+	if err != nil {
+		return 0, err
+	}
+
+	return nonce, nil
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/dela/core/execution/native"
+	"go.dedis.ch/dela/core/txn"
+	"go.dedis.ch/dela/core/txn/signed"
+	"go.dedis.ch/dela/crypto/bls"
+	sjson "go.dedis.ch/dela/serde/json"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+)
+
+func TestSecretHandler_MakeTx_Client(t *testing.T) {
+	s := &secretHandler{}
+
+	// the node doesn't sign the transactions of the clients
+	for _, cmd := range []calypso.Command{
+		calypso.CmdAdvertiseSmc, calypso.CmdDeleteSmc, calypso.CmdMigrateSecrets,
+		calypso.CmdCreateSecret, calypso.CmdUpdateSecret, calypso.CmdDeleteSecret,
+		calypso.CmdUpdatePolicy, calypso.CmdRevokeAccess, calypso.CmdRevealSecret,
+	} {
+		_, status, err := s.makeTx("", cmd)
+		require.EqualError(t, err, string(cmd)+" requires a transaction signed by the client")
+		require.Equal(t, http.StatusForbidden, status)
+	}
+
+	// they are accepted when signed by the client
+	data := makeClientTx(t, calypso.CmdCreateSecret)
+
+	tx, status, err := s.makeTx(data, calypso.CmdCreateSecret)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, []byte(calypso.CmdCreateSecret), tx.GetArg(calypso.CmdArg))
+
+	_, status, err = s.makeTx(data, calypso.CmdDeleteSecret)
+	require.EqualError(t, err, "expected a transaction of command DELETE_SECRET")
+	require.Equal(t, http.StatusBadRequest, status)
+
+	_, status, err = s.makeTx("{}", calypso.CmdCreateSecret)
+	require.ErrorContains(t, err, "invalid transaction: ")
+	require.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestSecretHandler_GetTx(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 1, false, node.FlagSet{nodeOwnerFlag: true})
+
+	smcKey := chain.advertiseSmc(t, nodes[0])
+
+	// the transactions stay in the pool until the test includes them
+	var pending txn.Transaction
+
+	chain.pool.onAdd = func(tx txn.Transaction) {
+		pending = tx
+	}
+
+	form := map[string]string{
+		"smckey": smcKey, "id": "doc", "secret": makeSecret(t, smcKey, "doc", "my secret"),
+	}
+
+	form["wait"] = "maybe"
+
+	resp := postForm(t, nodes[0].url+"/secret", form)
+	requireStatus(t, resp, http.StatusBadRequest,
+		"invalid wait: strconv.ParseBool: parsing \"maybe\": invalid syntax\n")
+
+	form["wait"] = "false"
+
+	res := decodeTxResult(t, postForm(t, nodes[0].url+"/secret", form), http.StatusAccepted)
+	require.Equal(t, txPending, res.Status)
+	require.Equal(t, hex.EncodeToString(pending.GetID()), res.TxID)
+
+	// the handler gives up after the timeout, and the transaction is pending
+	delete(form, "wait")
+	form["timeout"] = "1"
+
+	res = decodeTxResult(t, postForm(t, nodes[0].url+"/secret", form), http.StatusAccepted)
+	require.Equal(t, txPending, res.Status)
+
+	var status txResult
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/tx/"+res.TxID), http.StatusOK, &status)
+	require.Equal(t, txResult{TxID: res.TxID, Status: txPending}, status)
+
+	chain.srvc.include(3, pending, true, "")
+
+	// the ID is not case sensitive
+	url := nodes[0].url + "/secret/tx/" + strings.ToUpper(res.TxID)
+
+	require.Eventually(t, func() bool {
+		decodeJSON(t, httpGet(t, url), http.StatusOK, &status)
+		return status.Status != txPending
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, txResult{TxID: res.TxID, Status: txAccepted, Index: 3}, status)
+
+	requireStatus(t, httpGet(t, nodes[0].url+"/secret/tx/xyz"), http.StatusBadRequest,
+		"invalid transaction ID\n")
+
+	requireStatus(t, httpGet(t, nodes[0].url+"/secret/tx/aa"), http.StatusNotFound,
+		"unknown transaction\n")
+}
+
+func TestSecretHandler_GetNonce(t *testing.T) {
+	chain := newTestChain()
+	nodes := chain.startNodes(t, 1, false, node.FlagSet{})
+
+	pk, err := bls.NewSigner().GetPublicKey().MarshalBinary()
+	require.NoError(t, err)
+
+	var res struct {
+		Nonce uint64 `json:"nonce"`
+	}
+
+	decodeJSON(t, httpGet(t, nodes[0].url+"/secret/nonce?identity="+
+		url.QueryEscape(base64.StdEncoding.EncodeToString(pk))), http.StatusOK, &res)
+	require.Equal(t, uint64(0), res.Nonce)
+
+	requireStatus(t, httpGet(t, nodes[0].url+"/secret/nonce"),
+		http.StatusBadRequest, "missing or invalid identity\n")
+
+	resp := httpGet(t, nodes[0].url+"/secret/nonce?identity=YWJjZA%3D%3D")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "invalid identity: ")
+}
+
+// makeClientTx returns the JSON transaction of the calypso command with the
+// arguments, signed by a new client.
+func makeClientTx(t *testing.T, cmd calypso.Command, args ...string) string {
+	data, err := newClientTx(t, cmd, args...).Serialize(sjson.NewContext())
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+// newClientTx returns a transaction of the calypso command with the arguments,
+// signed by a new client.
+func newClientTx(t *testing.T, cmd calypso.Command, args ...string) txn.Transaction {
+	signer := bls.NewSigner()
+
+	opts := []signed.TransactionOption{
+		signed.WithArg(native.ContractArg, []byte(calypso.ContractName)),
+		signed.WithArg(calypso.CmdArg, []byte(cmd)),
+	}
+
+	for i := 0; i < len(args)-1; i += 2 {
+		opts = append(opts, signed.WithArg(args[i], []byte(args[i+1])))
+	}
+
+	tx, err := signed.NewTransaction(0, signer.GetPublicKey(), opts...)
+	require.NoError(t, err)
+
+	require.NoError(t, tx.Sign(signer))
+
+	return tx
+}
@@ -17,6 +17,23 @@ var proxyFac func(string) proxy.Proxy = http.NewHTTP
 
 const defaultProxyAddr = "127.0.0.1:3003"
 
+// configFlag is the flag name of the config folder of the node. It contains
+// the private key of the node used to sign the reveal shares and the
+// transactions of the proxy.
+const configFlag = "config"
+
+// chainRosterFlag is the flag name of the path to the JSON roster of the
+// chain, with the proxy addresses of the nodes and their BLS public keys.
+const chainRosterFlag = "chainroster"
+
+// nodeOwnerFlag is the flag name allowing the proxy to sign the transactions
+// of the requests without a transaction of the client with the key of the node.
+const nodeOwnerFlag = "nodeowner"
+
+// privateKeyFile is the file of the private key of the node in the config
+// folder, as created by the ordering service.
+const privateKeyFile = "private.key"
+
 // NewController returns a new controller initializer
 func NewController() node.Initializer {
 	return controller{}
@@ -36,6 +53,21 @@ func (m controller) SetCommands(builder node.Builder) {
 			Required: false,
 			Value:    defaultProxyAddr,
 		},
+		cli.StringFlag{
+			Name: chainRosterFlag,
+			Usage: "path to the JSON roster of the chain, with the proxy address " +
+				"and the public key of each node. If set, the reveals are returned " +
+				"with a proof signed by the nodes",
+			Required: false,
+		},
+		cli.BoolFlag{
+			Name: nodeOwnerFlag,
+			Usage: "let the proxy sign the transactions with the key of the node " +
+				"when the request has no transaction of the client. Anyone " +
+				"reaching the proxy then acts as the node, e.g. as the owner of " +
+				"the secrets added through it",
+			Required: false,
+		},
 	)
 }
 
@@ -70,8 +102,12 @@ func (m controller) OnStart(ctx cli.Flags, inj node.Injector) error {
 	register := RegisterAction{}
 	err := register.Execute(node.Context{
 		Injector: inj,
-		Flags:    node.FlagSet{},
-		Out:      os.Stdout,
+		Flags: node.FlagSet{
+			configFlag:      ctx.Path(configFlag),
+			chainRosterFlag: ctx.Path(chainRosterFlag),
+			nodeOwnerFlag:   ctx.Bool(nodeOwnerFlag),
+		},
+		Out: os.Stdout,
 	})
 
 	if err != nil {
@@ -19,6 +19,7 @@ N=4                   # number of nodes
 P=10000               # base port number
 PROXY=40000           # base proxy port number
 KEYFILE=/tmp/priv.key # private key file
+CHAINROSTER=/tmp/chain-roster.json # roster of the chain, required by the SMC
 
 echo -e "${GREEN}[PARSE parameters]${NC}"
 while getopts n:p:s:t:w: flag
@@ -60,15 +61,30 @@ do
     p=$((P + i))
     proxy=$((PROXY + i))
     echo -e "${GREEN}creating node #${i} on port ${p}${NC}"
-    # session s, window 0, panes 1 to N
+    # session s, window 0, panes 1 to N. The demo client doesn't sign its
+    # transactions, the nodes own the secrets it adds.
     tmux send-keys -t ${S}:${W}.${i} "LLVL=${L} LOGF=./${W}${i}.log chaincli --config /tmp/${W}${i} \
     start --listen tcp://127.0.0.1:${p} --proxyaddr localhost:${proxy} --public grpc://localhost:${p} \
-    --routing tree --noTLS" C-m
+    --routing tree --noTLS --nodeowner" C-m
     sleep 1
     i=$((i + 1));
 done
 
 
+echo -e "${GREEN}[ROSTER]${NC} save the roster of the chain in ${CHAINROSTER}"
+i=1;
+R=""
+while [ ${i} -le ${N} ]
+do
+    proxy=$((PROXY + i))
+    pk=$(crypto bls signer read --path /tmp/${W}${i}/private.key --format BASE64_PUBKEY)
+    R="${R}{\"address\":\"localhost:${proxy}\",\"public_key\":\"${pk}\",\"share_index\":$((i - 1))}"
+    if [ ${i} -lt ${N} ]; then R="${R},"; fi
+    i=$((i + 1));
+done
+echo "[${R}]" > ${CHAINROSTER}
+
+
 echo -e "${GREEN}[CONNECT]${NC} ${N} nodes and exchange certificates"
 i=2;
 p=$((P + 1))
@@ -115,4 +131,14 @@ tmux send-keys -t "${MASTERPANE}" "chaincli --config /tmp/${W}1 pool add \
     --args access:identity --args $(crypto bls signer read --path ${KEYFILE} --format BASE64_PUBKEY) \
     --args access:command --args GRANT" C-m
 
+echo -e "${GREEN}[GRANT]${NC} grant the calypso commands of the proxies to the nodes"
+i=1;
+while [ ${i} -le ${N} ]
+do
+    tmux send-keys -t "${MASTERPANE}" "chaincli --config /tmp/${W}1 calypso grant \
+    --key ${KEYFILE} --role admin --role publisher \
+    --identity $(crypto bls signer read --path /tmp/${W}${i}/private.key --format BASE64_PUBKEY)" C-m
+    i=$((i + 1));
+done
+
 tmux select-pane -t "${MASTERPANE}"
@@ -17,6 +17,7 @@ W=smc                 # window name
 N=4                   # number of nodes
 P=11000               # base port number
 PROXY=41000           # base proxy port number
+CHAINROSTER=/tmp/chain-roster.json # roster of the chain, see start_chain.sh
 
 echo -e "${GREEN}[PARSE parameters]${NC}"
 while getopts n:p:s:t:w: flag
@@ -57,7 +58,7 @@ do
     # session s, window 0, panes 1 to N
     tmux send-keys -t ${S}:${W}.${i} "LLVL=${L} LOGF=./${W}${i}.log smccli --config /tmp/${W}${i} \
     start --listen tcp://127.0.0.1:${p} --proxyaddr localhost:${proxy} --public grpc://localhost:${p} \
-    --routing tree --noTLS" C-m
+    --routing tree --noTLS --chainroster ${CHAINROSTER}" C-m
     sleep 0.5
     i=$((i + 1));
 done
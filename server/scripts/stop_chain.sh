@@ -10,3 +10,6 @@ rm -rf /tmp/blockchain*
 
 # remove blockchain pk
 rm -f /tmp/priv.key
+
+# remove the roster of the chain
+rm -f /tmp/chain-roster.json
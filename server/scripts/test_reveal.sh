@@ -27,4 +27,4 @@ echo -e "XhatEnc: \t${XHATENC}\n"
 
 echo -e "DKG key: \t$1\n"
 
-smccli smc reveal --xhatenc ${XHATENC} --encrypted ${CIPHER} --dkgpub $1 --privk ${PRIVK}
+smccli smc reveal --xhatenc ${XHATENC} --encrypted ${CIPHER} --dkgpub $1 --privk ${PRIVK} --legacy
@@ -0,0 +1,85 @@
+package smc
+
+import (
+	"net/url"
+)
+
+// ReencryptBatchRequest is the request of a reader to reencrypt many secrets
+// to its public key at once.
+type ReencryptBatchRequest struct {
+	// PubK is the hex-encoded public key of the reader.
+	PubK string `json:"pubk"`
+
+	// Items are the secrets to reencrypt.
+	Items []ReencryptBatchItem `json:"items"`
+}
+
+// ReencryptBatchItem is a secret of a batch. It has the same fields as a
+// single reencryption request, and is signed by the reader the same way.
+type ReencryptBatchItem struct {
+	// Name is the name of the secret.
+	Name string `json:"name"`
+
+	// Encrypted is the ciphertext of the secret.
+	Encrypted string `json:"encrypted"`
+
+	// Proof is the JSON reveal proof of the secret, if the SMC requires it.
+	Proof string `json:"proof,omitempty"`
+
+	// Target, Timestamp, Nonce and Signature are the ones of the signed
+	// request, see ReencryptRequest.
+	Target    string `json:"target"`
+	Timestamp string `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+// ReencryptBatchResult is the result of an item of a batch, in the order of
+// the request.
+type ReencryptBatchResult struct {
+	// Status is the HTTP status the item would have had as a single request.
+	Status int `json:"status"`
+
+	// Response is the response of the item if it succeeded.
+	Response *ReencryptResponse `json:"response,omitempty"`
+
+	// Error is the reason of the failure of the item.
+	Error string `json:"error,omitempty"`
+}
+
+// NewReencryptBatchItem returns the item of a batch for the signed request.
+func NewReencryptBatchItem(req ReencryptRequest, sig []byte, encrypted string,
+	proof string) ReencryptBatchItem {
+
+	values := req.Values(sig)
+
+	return ReencryptBatchItem{
+		Name:      values.Get("name"),
+		Encrypted: encrypted,
+		Proof:     proof,
+		Target:    values.Get("target"),
+		Timestamp: values.Get("timestamp"),
+		Nonce:     values.Get("nonce"),
+		Signature: values.Get("signature"),
+	}
+}
+
+// Values returns the form values of the item as a single request of the
+// reader with the given public key.
+func (i ReencryptBatchItem) Values(pubK string) url.Values {
+	values := url.Values{
+		"pubk":      {pubK},
+		"name":      {i.Name},
+		"encrypted": {i.Encrypted},
+		"target":    {i.Target},
+		"timestamp": {i.Timestamp},
+		"nonce":     {i.Nonce},
+		"signature": {i.Signature},
+	}
+
+	if i.Proof != "" {
+		values.Set("proof", i.Proof)
+	}
+
+	return values
+}
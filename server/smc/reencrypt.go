@@ -0,0 +1,184 @@
+package smc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/suites"
+	"golang.org/x/xerrors"
+)
+
+// suite is the Kyber suite of the SMC and reader keys.
+var suite = suites.MustFind("Ed25519")
+
+// reencryptDomain separates the reencryption requests from any other message
+// signed by a reader.
+const reencryptDomain = "smc:reencrypt"
+
+// nonceSize is the size in bytes of the nonce of a reencryption request.
+const nonceSize = 16
+
+// ReencryptRequest is the request of a reader to reencrypt a secret to its
+// public key. It is signed by the reader to prove that it holds the private
+// key, and carries the node it is sent to, a timestamp and a nonce so that it
+// can't be replayed.
+type ReencryptRequest struct {
+	// Name is the name of the secret.
+	Name []byte
+
+	// Target is the address of the node the request is sent to, as returned
+	// by GET /smc/address. The nonces are only remembered by that node.
+	Target []byte
+
+	// K is the ephemeral key of the ciphertext of the secret.
+	K kyber.Point
+
+	// PubK is the public key of the reader.
+	PubK kyber.Point
+
+	// Timestamp is the creation time of the request, in seconds since epoch.
+	Timestamp int64
+
+	// Nonce is a random value unique to the request.
+	Nonce []byte
+}
+
+// NewReencryptRequest returns a new request to the target node created now,
+// with a random nonce.
+func NewReencryptRequest(name []byte, target []byte, K kyber.Point,
+	pubK kyber.Point) (ReencryptRequest, error) {
+
+	nonce := make([]byte, nonceSize)
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return ReencryptRequest{}, xerrors.Errorf("failed to generate nonce: %v", err)
+	}
+
+	return ReencryptRequest{
+		Name:      name,
+		Target:    target,
+		K:         K,
+		PubK:      pubK,
+		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
+	}, nil
+}
+
+// Message returns the message signed by the reader.
+func (r ReencryptRequest) Message() ([]byte, error) {
+	h := sha256.New()
+	h.Write([]byte(reencryptDomain))
+
+	for _, buf := range [][]byte{r.Name, r.Target, r.Nonce} {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(buf)))
+		h.Write(size)
+		h.Write(buf)
+	}
+
+	for _, p := range []kyber.Point{r.K, r.PubK} {
+		_, err := p.MarshalTo(h)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to hash point: %v", err)
+		}
+	}
+
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(r.Timestamp))
+	h.Write(ts)
+
+	return h.Sum(nil), nil
+}
+
+// Sign returns the Schnorr signature of the request by the private key of the
+// reader.
+func (r ReencryptRequest) Sign(privK kyber.Scalar) ([]byte, error) {
+	msg, err := r.Message()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := schnorr.Sign(suite, privK, msg)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign: %v", err)
+	}
+
+	return sig, nil
+}
+
+// Verify verifies the signature of the request by the reader.
+func (r ReencryptRequest) Verify(sig []byte) error {
+	msg, err := r.Message()
+	if err != nil {
+		return err
+	}
+
+	err = schnorr.Verify(suite, r.PubK, msg, sig)
+	if err != nil {
+		return xerrors.Errorf("invalid signature: %v", err)
+	}
+
+	return nil
+}
+
+// Values returns the form values of the signed request, to be added to the
+// values of the reencryption.
+func (r ReencryptRequest) Values(sig []byte) url.Values {
+	return url.Values{
+		"name":      {string(r.Name)},
+		"target":    {string(r.Target)},
+		"timestamp": {strconv.FormatInt(r.Timestamp, 10)},
+		"nonce":     {hex.EncodeToString(r.Nonce)},
+		"signature": {hex.EncodeToString(sig)},
+	}
+}
+
+// DecodeReencryptRequest decodes the request from the form values, and returns
+// it with its signature.
+func DecodeReencryptRequest(form url.Values, K kyber.Point,
+	pubK kyber.Point) (ReencryptRequest, []byte, error) {
+
+	name := form.Get("name")
+	if name == "" {
+		return ReencryptRequest{}, nil, xerrors.New("missing name")
+	}
+
+	target := form.Get("target")
+	if target == "" {
+		return ReencryptRequest{}, nil, xerrors.New("missing target")
+	}
+
+	timestamp, err := strconv.ParseInt(form.Get("timestamp"), 10, 64)
+	if err != nil {
+		return ReencryptRequest{}, nil, xerrors.Errorf("invalid timestamp: %v", err)
+	}
+
+	nonce, err := hex.DecodeString(form.Get("nonce"))
+	if err != nil || len(nonce) != nonceSize {
+		return ReencryptRequest{}, nil, xerrors.New("invalid nonce")
+	}
+
+	sig, err := hex.DecodeString(form.Get("signature"))
+	if err != nil || len(sig) == 0 {
+		return ReencryptRequest{}, nil, xerrors.New("invalid signature")
+	}
+
+	req := ReencryptRequest{
+		Name:      []byte(name),
+		Target:    []byte(target),
+		K:         K,
+		PubK:      pubK,
+		Timestamp: timestamp,
+		Nonce:     nonce,
+	}
+
+	return req, sig, nil
+}
@@ -0,0 +1,172 @@
+package smc
+
+import (
+	"crypto/sha256"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	"golang.org/x/xerrors"
+)
+
+// ReencryptResponse is the response of the SMC to a reencryption request.
+type ReencryptResponse struct {
+	// XhatEnc is the hex-encoded reencrypted key, as combined by the SMC.
+	XhatEnc string `json:"xhatenc"`
+
+	// Shares are the reencryption shares of the nodes, if the SMC supports
+	// them. The reader can verify them and combine the valid ones instead of
+	// trusting XhatEnc.
+	Shares []ReencryptShare `json:"shares,omitempty"`
+}
+
+// ReencryptShare is the reencryption share Ui = xi(K + PubK) of the node
+// holding the DKG share xi, with a DLEQ proof that Ui and the public share
+// Xi = xiG have the same discrete logarithm.
+type ReencryptShare struct {
+	// Index is the index of the DKG share of the node.
+	Index int `json:"index"`
+
+	// Ui is the reencryption share.
+	Ui []byte `json:"ui"`
+
+	// Ei is the challenge of the proof.
+	Ei []byte `json:"ei"`
+
+	// Fi is the response of the proof.
+	Fi []byte `json:"fi"`
+}
+
+// NewReencryptShare returns the serialized share of a node.
+func NewReencryptShare(index int, Ui kyber.Point, Ei kyber.Scalar,
+	Fi kyber.Scalar) (ReencryptShare, error) {
+
+	var err error
+
+	s := ReencryptShare{Index: index}
+
+	s.Ui, err = Ui.MarshalBinary()
+	if err != nil {
+		return s, xerrors.Errorf("failed to marshal Ui: %v", err)
+	}
+
+	s.Ei, err = Ei.MarshalBinary()
+	if err != nil {
+		return s, xerrors.Errorf("failed to marshal Ei: %v", err)
+	}
+
+	s.Fi, err = Fi.MarshalBinary()
+	if err != nil {
+		return s, xerrors.Errorf("failed to marshal Fi: %v", err)
+	}
+
+	return s, nil
+}
+
+// Verify verifies the proof of the share against the public share Xi of the
+// node, and returns the reencryption share. The proof is the one of the
+// Pedersen DKG of dela: Ei = H(Ui, FiA - EiUi, FiG - EiXi) where A = K + PubK.
+func (s ReencryptShare) Verify(K kyber.Point, pubK kyber.Point,
+	publicShare kyber.Point) (*share.PubShare, error) {
+
+	Ui := suite.Point()
+
+	err := Ui.UnmarshalBinary(s.Ui)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid Ui: %v", err)
+	}
+
+	Ei := suite.Scalar()
+
+	err = Ei.UnmarshalBinary(s.Ei)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid Ei: %v", err)
+	}
+
+	Fi := suite.Scalar()
+
+	err = Fi.UnmarshalBinary(s.Fi)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid Fi: %v", err)
+	}
+
+	A := suite.Point().Add(K, pubK)
+
+	uiHat := suite.Point().Sub(suite.Point().Mul(Fi, A), suite.Point().Mul(Ei, Ui))
+	hiHat := suite.Point().Sub(suite.Point().Mul(Fi, nil), suite.Point().Mul(Ei, publicShare))
+
+	h := sha256.New()
+
+	for _, p := range []kyber.Point{Ui, uiHat, hiHat} {
+		_, err = p.MarshalTo(h)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to hash point: %v", err)
+		}
+	}
+
+	if !suite.Scalar().SetBytes(h.Sum(nil)).Equal(Ei) {
+		return nil, xerrors.New("invalid proof")
+	}
+
+	return &share.PubShare{I: s.Index, V: Ui}, nil
+}
+
+// RecoverXhatEnc verifies the shares against the public shares of the nodes,
+// indexed by share index, and combines the valid ones into the reencrypted
+// key. The public key of the SMC is used to check that enough shares are
+// valid. It returns the indices of the invalid shares so that the nodes can be
+// excluded.
+func RecoverXhatEnc(smcKey kyber.Point, K kyber.Point, pubK kyber.Point,
+	publicShares map[int]kyber.Point, shares []ReencryptShare) (kyber.Point, []int, error) {
+
+	var invalid []int
+
+	uis := make([]*share.PubShare, 0, len(shares))
+	xis := make([]*share.PubShare, 0, len(shares))
+	seen := make(map[int]struct{})
+
+	for _, s := range shares {
+		Xi, found := publicShares[s.Index]
+		if !found {
+			invalid = append(invalid, s.Index)
+			continue
+		}
+
+		_, found = seen[s.Index]
+		if found {
+			continue
+		}
+
+		Ui, err := s.Verify(K, pubK, Xi)
+		if err != nil {
+			invalid = append(invalid, s.Index)
+			continue
+		}
+
+		seen[s.Index] = struct{}{}
+
+		uis = append(uis, Ui)
+		xis = append(xis, &share.PubShare{I: s.Index, V: Xi})
+	}
+
+	if len(uis) == 0 {
+		return nil, invalid, xerrors.New("no valid share")
+	}
+
+	// the public shares of the valid shares interpolate to the key of the SMC
+	// only if there are at least threshold of them
+	X, err := share.RecoverCommit(suite, xis, len(xis), len(publicShares))
+	if err != nil {
+		return nil, invalid, xerrors.Errorf("failed to recover public key: %v", err)
+	}
+
+	if !X.Equal(smcKey) {
+		return nil, invalid, xerrors.Errorf("not enough valid shares (%d)", len(uis))
+	}
+
+	XhatEnc, err := share.RecoverCommit(suite, uis, len(uis), len(publicShares))
+	if err != nil {
+		return nil, invalid, xerrors.Errorf("failed to recover XhatEnc: %v", err)
+	}
+
+	return XhatEnc, invalid, nil
+}
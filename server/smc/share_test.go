@@ -0,0 +1,191 @@
+package smc
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+)
+
+func TestReencryptShare_Verify(t *testing.T) {
+	committee := newTestCommittee(3, 2)
+	K, pubK := randomPoint(), randomPoint()
+
+	s := committee.share(t, 0, K, pubK, proofTamper{})
+
+	Ui, err := s.Verify(K, pubK, committee.publicShares[0])
+	require.NoError(t, err)
+	require.Equal(t, 0, Ui.I)
+	require.True(t, committee.ui(0, K, pubK).Equal(Ui.V))
+
+	// the share is for another request
+	_, err = s.Verify(randomPoint(), pubK, committee.publicShares[0])
+	require.EqualError(t, err, "invalid proof")
+
+	// the share is verified against the public share of another node
+	_, err = s.Verify(K, pubK, committee.publicShares[1])
+	require.EqualError(t, err, "invalid proof")
+
+	// the reencryption share is replaced after the proof
+	tampered := s
+	tampered.Ui, err = randomPoint().MarshalBinary()
+	require.NoError(t, err)
+
+	_, err = tampered.Verify(K, pubK, committee.publicShares[0])
+	require.EqualError(t, err, "invalid proof")
+
+	// the commitments of the proof don't match its response
+	s = committee.share(t, 0, K, pubK, proofTamper{uiHat: randomPoint()})
+
+	_, err = s.Verify(K, pubK, committee.publicShares[0])
+	require.EqualError(t, err, "invalid proof")
+
+	s = committee.share(t, 0, K, pubK, proofTamper{hiHat: randomPoint()})
+
+	_, err = s.Verify(K, pubK, committee.publicShares[0])
+	require.EqualError(t, err, "invalid proof")
+
+	s.Ui = []byte("xyz")
+
+	_, err = s.Verify(K, pubK, committee.publicShares[0])
+	require.ErrorContains(t, err, "invalid Ui: ")
+}
+
+func TestRecoverXhatEnc(t *testing.T) {
+	committee := newTestCommittee(4, 3)
+	K, pubK := randomPoint(), randomPoint()
+
+	expected := suite.Point().Mul(committee.x, suite.Point().Add(K, pubK))
+
+	shares := []ReencryptShare{
+		committee.share(t, 0, K, pubK, proofTamper{}),
+		committee.share(t, 1, K, pubK, proofTamper{hiHat: randomPoint()}),
+		committee.share(t, 2, K, pubK, proofTamper{}),
+		committee.share(t, 3, K, pubK, proofTamper{}),
+	}
+
+	XhatEnc, invalid, err := RecoverXhatEnc(committee.X, K, pubK, committee.publicShares,
+		shares)
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, invalid)
+	require.True(t, expected.Equal(XhatEnc))
+
+	// less than a threshold of the shares are valid
+	_, invalid, err = RecoverXhatEnc(committee.X, K, pubK, committee.publicShares,
+		shares[:3])
+	require.EqualError(t, err, "not enough valid shares (2)")
+	require.Equal(t, []int{1}, invalid)
+
+	// a share repeated doesn't count twice
+	_, _, err = RecoverXhatEnc(committee.X, K, pubK, committee.publicShares,
+		[]ReencryptShare{shares[0], shares[0], shares[2]})
+	require.EqualError(t, err, "not enough valid shares (2)")
+
+	// the public shares don't interpolate to the key of the SMC
+	other := newTestCommittee(4, 3)
+
+	_, _, err = RecoverXhatEnc(other.X, K, pubK, committee.publicShares, shares)
+	require.EqualError(t, err, "not enough valid shares (3)")
+
+	publicShares := map[int]kyber.Point{}
+	for i, Xi := range committee.publicShares {
+		publicShares[i] = Xi
+	}
+
+	publicShares[3] = other.publicShares[3]
+
+	_, invalid, err = RecoverXhatEnc(committee.X, K, pubK, publicShares, shares)
+	require.EqualError(t, err, "not enough valid shares (2)")
+	require.Equal(t, []int{1, 3}, invalid)
+
+	// a share of an unknown node is invalid
+	delete(publicShares, 3)
+
+	_, invalid, err = RecoverXhatEnc(committee.X, K, pubK, publicShares, shares[3:])
+	require.EqualError(t, err, "no valid share")
+	require.Equal(t, []int{3}, invalid)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// testCommittee holds the DKG shares of a committee, dealt from the private
+// key x of the SMC.
+type testCommittee struct {
+	x kyber.Scalar
+	X kyber.Point
+
+	priShares    []*share.PriShare
+	publicShares map[int]kyber.Point
+}
+
+func newTestCommittee(n int, threshold int) testCommittee {
+	poly := share.NewPriPoly(suite, threshold, nil, suite.RandomStream())
+
+	c := testCommittee{
+		x:            poly.Secret(),
+		X:            suite.Point().Mul(poly.Secret(), nil),
+		priShares:    poly.Shares(n),
+		publicShares: make(map[int]kyber.Point),
+	}
+
+	for _, s := range c.priShares {
+		c.publicShares[s.I] = suite.Point().Mul(s.V, nil)
+	}
+
+	return c
+}
+
+// ui returns the reencryption share of the node i.
+func (c testCommittee) ui(i int, K kyber.Point, pubK kyber.Point) kyber.Point {
+	return suite.Point().Mul(c.priShares[i].V, suite.Point().Add(K, pubK))
+}
+
+// proofTamper are the points added to the commitments of a proof, so that they
+// don't match its response.
+type proofTamper struct {
+	uiHat kyber.Point
+	hiHat kyber.Point
+}
+
+// share returns the reencryption share of the node i with its DLEQ proof, as
+// computed by the DKG actor.
+func (c testCommittee) share(t *testing.T, i int, K kyber.Point, pubK kyber.Point,
+	tamper proofTamper) ReencryptShare {
+
+	xi := c.priShares[i].V
+	Ui := c.ui(i, K, pubK)
+
+	si := suite.Scalar().Pick(suite.RandomStream())
+
+	uiHat := suite.Point().Mul(si, suite.Point().Add(K, pubK))
+	if tamper.uiHat != nil {
+		uiHat.Add(uiHat, tamper.uiHat)
+	}
+
+	hiHat := suite.Point().Mul(si, nil)
+	if tamper.hiHat != nil {
+		hiHat.Add(hiHat, tamper.hiHat)
+	}
+
+	h := sha256.New()
+
+	for _, p := range []kyber.Point{Ui, uiHat, hiHat} {
+		_, err := p.MarshalTo(h)
+		require.NoError(t, err)
+	}
+
+	Ei := suite.Scalar().SetBytes(h.Sum(nil))
+	Fi := suite.Scalar().Add(si, suite.Scalar().Mul(Ei, xi))
+
+	s, err := NewReencryptShare(c.priShares[i].I, Ui, Ei, Fi)
+	require.NoError(t, err)
+
+	return s
+}
+
+func randomPoint() kyber.Point {
+	return suite.Point().Pick(suite.RandomStream())
+}
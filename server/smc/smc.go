@@ -1,9 +1,17 @@
 package smc
 
-import "go.dedis.ch/hbt/server/registry/registry"
+import (
+	"encoding/json"
+
+	"go.dedis.ch/hbt/server/registry/registry"
+)
 
 // SmcSecret contains the secret for the SMC
 type Secret struct {
 	Data string                  `json:"secret"`
 	ID   registry.RegistrationID `json:"id"`
+
+	// Proof is the JSON reveal proof of the secret for the reader, if the
+	// blockchain gathers it. See calypso.RevealProof.
+	Proof json.RawMessage `json:"proof,omitempty"`
 }
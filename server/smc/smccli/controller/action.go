@@ -2,13 +2,19 @@ package controller
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"go.dedis.ch/dela"
 	"go.dedis.ch/dela/cli/node"
 	"go.dedis.ch/dela/dkg"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"go.dedis.ch/hbt/server/smc"
 	"go.dedis.ch/kyber/v3/util/key"
 
 	"go.dedis.ch/kyber/v3"
@@ -21,6 +27,10 @@ var suite = suites.MustFind("Ed25519")
 
 const separator = ":"
 const malformedEncoded = "malformed encoded: %s"
+
+// errUnversioned is the error of a legacy K:C message used without the legacy
+// flag.
+const errUnversioned = "unversioned ciphertext, use --legacy to migrate it"
 const keyFileName = "key.pair"
 
 // createKeyPairAction is an action to create a key pair
@@ -65,11 +75,7 @@ func (c createKeyPairAction) Execute(_ node.Context) error {
 type revealAction struct{}
 
 func (r revealAction) Execute(ctx node.Context) error {
-	xhatString := ctx.Flags.String("xhatenc")
-	xhatenc, err := decodePublicKey(xhatString)
-	if err != nil {
-		return xerrors.Errorf("failed to reveal: %v", err)
-	}
+	var err error
 
 	dkgpubString := ctx.Flags.String("dkgpub")
 	var dkgpubk kyber.Point
@@ -98,12 +104,27 @@ func (r revealAction) Execute(ctx node.Context) error {
 	}
 
 	encrypted := ctx.Flags.String("encrypted")
-	_, cs, err := decodeEncrypted(encrypted)
+	legacy := ctx.Flags.Bool("legacy")
+
+	k, err := decodeEncryptedKey(encrypted, legacy)
 	if err != nil {
 		return xerrors.Errorf("failed to decode encrypted str: %v", err)
 	}
 
-	msg, err := reveal(xhatenc, dkgpubk, privateKey, cs)
+	var xhatenc kyber.Point
+
+	xhatString := ctx.Flags.String("xhatenc")
+	if xhatString != "" {
+		xhatenc, err = decodePublicKey(xhatString)
+	} else {
+		xhatenc, err = requestReencryption(ctx, dkgpubk, k, privateKey, encrypted)
+	}
+
+	if err != nil {
+		return xerrors.Errorf("failed to reveal: %v", err)
+	}
+
+	msg, err := reveal(xhatenc, dkgpubk, privateKey, encrypted, legacy)
 	if err != nil {
 		fmt.Printf("couldn't reveal message. %v", err)
 		return err
@@ -113,6 +134,177 @@ func (r revealAction) Execute(ctx node.Context) error {
 	return nil
 }
 
+// readerSigAction is an action to sign the request of a reader to list the
+// secrets revealed to it on the blockchain proxy. It prints the form values of
+// the request.
+//
+// - implements node.ActionTemplate
+type readerSigAction struct{}
+
+func (a readerSigAction) Execute(ctx node.Context) error {
+	privK, err := decodePrivateKey(ctx.Flags.String("privk"))
+	if err != nil {
+		return xerrors.Errorf("failed to decode private key str: %v", err)
+	}
+
+	pubK, err := suite.Point().Mul(privK, nil).MarshalBinary()
+	if err != nil {
+		return xerrors.Errorf("failed to marshal public key: %v", err)
+	}
+
+	req := calypso.ReaderAccessRequest{
+		Reader:    []byte(hex.EncodeToString(pubK)),
+		Timestamp: time.Now().Unix(),
+	}
+
+	sig, err := req.Sign(privK)
+	if err != nil {
+		return xerrors.Errorf("failed to sign request: %v", err)
+	}
+
+	fmt.Fprintf(ctx.Out, "pubkey=%s&timestamp=%d&signature=%x\n", req.Reader,
+		req.Timestamp, sig)
+
+	return nil
+}
+
+// requestReencryption requests the reencryption of the secret to the key of
+// the reader from the SMC. The request is signed by the reader. If the roster
+// of the SMC is given, the reencryption shares of the nodes are verified
+// against their public shares and the valid ones are combined.
+func requestReencryption(ctx node.Context, dkgpubk kyber.Point, k kyber.Point,
+	privateKey kyber.Scalar, encrypted string) (kyber.Point, error) {
+
+	pubk := suite.Point().Mul(privateKey, nil)
+
+	pubkbuff, err := pubk.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal public key: %v", err)
+	}
+
+	smcAddr := ctx.Flags.String("smcaddr")
+
+	// the request is only valid for the node it is sent to
+	target, err := getNodeAddress(smcAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := smc.NewReencryptRequest([]byte(ctx.Flags.String("name")), target, k, pubk)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create request: %v", err)
+	}
+
+	sig, err := req.Sign(privateKey)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign request: %v", err)
+	}
+
+	values := req.Values(sig)
+	values.Set("pubk", hex.EncodeToString(pubkbuff))
+	values.Set("encrypted", encrypted)
+
+	proof := ctx.Flags.String("proof")
+	if proof != "" {
+		values.Set("proof", proof)
+	}
+
+	resp, err := http.PostForm(smcAddr+"/smc/reencrypt", values)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to reach the SMC: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, xerrors.Errorf("unexpected status %s: %s", resp.Status, msg)
+	}
+
+	var response smc.ReencryptResponse
+
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode response: %v", err)
+	}
+
+	rosterString := ctx.Flags.String("roster")
+	if rosterString == "" {
+		return decodePublicKey(response.XhatEnc)
+	}
+
+	roster, err := calypso.DecodeRoster([]byte(rosterString))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode roster: %v", err)
+	}
+
+	if len(response.Shares) == 0 {
+		return nil, xerrors.New("the SMC returned no reencryption share")
+	}
+
+	return verifyReencryption(roster, dkgpubk, k, pubk, response.Shares)
+}
+
+// getNodeAddress returns the address of the node of the SMC behind the proxy.
+func getNodeAddress(smcAddr string) ([]byte, error) {
+	resp, err := http.Get(smcAddr + "/smc/address")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to reach the SMC: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read address: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("unexpected status %s: %s", resp.Status, body)
+	}
+
+	return body, nil
+}
+
+// verifyReencryption combines the valid reencryption shares, and reports the
+// nodes of the roster with an invalid share.
+func verifyReencryption(roster calypso.Roster, dkgpubk kyber.Point, k kyber.Point,
+	pubk kyber.Point, shares []smc.ReencryptShare) (kyber.Point, error) {
+
+	publicShares := make(map[int]kyber.Point)
+	addrs := make(map[int]string)
+
+	for _, m := range roster {
+		if len(m.PublicShare) == 0 {
+			continue
+		}
+
+		Xi := suite.Point()
+
+		err := Xi.UnmarshalBinary(m.PublicShare)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid public share of node '%s': %v",
+				m.Address, err)
+		}
+
+		publicShares[int(m.ShareIndex)] = Xi
+		addrs[int(m.ShareIndex)] = m.Address
+	}
+
+	xhatenc, invalid, err := smc.RecoverXhatEnc(dkgpubk, k, pubk, publicShares, shares)
+
+	for _, index := range invalid {
+		dela.Logger.Warn().Msgf("excluded the invalid share %d of node '%s'",
+			index, addrs[index])
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to verify reencryption: %v", err)
+	}
+
+	return xhatenc, nil
+}
+
 // -----------------------------------------------------------------------------
 // helper functions
 func decodePrivateKey(str string) (kyber.Scalar, error) {
@@ -145,6 +337,28 @@ func decodePublicKey(str string) (kyber.Point, error) {
 	return pk, nil
 }
 
+// decodeEncryptedKey returns the ephemeral key K of the encrypted message. The
+// legacy K:C messages of the DKG actor are only accepted if legacy is true.
+func decodeEncryptedKey(str string, legacy bool) (kyber.Point, error) {
+	// secrets stored on the blockchain are verifiable ciphertexts
+	if strings.HasPrefix(str, "{") {
+		ctext, err := calypso.DecodeCiphertext([]byte(str))
+		if err != nil {
+			return nil, err
+		}
+
+		return ctext.Key()
+	}
+
+	if !legacy {
+		return nil, xerrors.New(errUnversioned)
+	}
+
+	k, _, err := decodeEncrypted(str)
+
+	return k, err
+}
+
 func decodeEncrypted(str string) (kyber.Point, []kyber.Point, error) {
 	parts := strings.Split(str, separator)
 	if len(parts) < 2 {
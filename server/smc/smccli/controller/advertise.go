@@ -0,0 +1,420 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/dela/core/access"
+	"go.dedis.ch/dela/core/execution/native"
+	"go.dedis.ch/dela/core/ordering/cosipbft/authority"
+	"go.dedis.ch/dela/core/txn"
+	"go.dedis.ch/dela/core/txn/signed"
+	"go.dedis.ch/dela/crypto"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/crypto/ed25519"
+	"go.dedis.ch/dela/crypto/loader"
+	"go.dedis.ch/dela/dkg"
+	"go.dedis.ch/dela/mino"
+	sjson "go.dedis.ch/dela/serde/json"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"golang.org/x/xerrors"
+
+	// the transactions are sent in the JSON format of dela
+	_ "go.dedis.ch/dela/core/txn/signed/json"
+)
+
+// thresholdSigner is implemented by the DKG actors able to produce a Schnorr
+// signature with the distributed private key, each node contributing with its
+// share. The private key is never reconstructed.
+type thresholdSigner interface {
+	Sign(msg []byte) ([]byte, error)
+}
+
+// advertiseAction is an action to advertise the SMC on the blockchain with a
+// proof of possession of its DKG private key. A SMC succeeding another one
+// also provides the signature of the predecessor's members.
+//
+// - implements node.ActionTemplate
+type advertiseAction struct{}
+
+func (a advertiseAction) Execute(ctx node.Context) error {
+	var actor dkg.Actor
+	err := ctx.Injector.Resolve(&actor)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve DKG actor: %v", err)
+	}
+
+	pubKey, err := actor.GetPublicKey()
+	if err != nil {
+		return xerrors.Errorf("failed retrieving DKG public key: %v", err)
+	}
+
+	buf, err := pubKey.MarshalBinary()
+	if err != nil {
+		return xerrors.Errorf("failed to marshal DKG public key: %v", err)
+	}
+
+	smcKey := hex.EncodeToString(buf)
+
+	roster, err := calypso.DecodeRoster([]byte(ctx.Flags.String("roster")))
+	if err != nil {
+		return xerrors.Errorf("invalid roster: %v", err)
+	}
+
+	chainAddr := ctx.Flags.String("chainaddr")
+
+	nonce, err := getSmcNonce(chainAddr, smcKey)
+	if err != nil {
+		return xerrors.Errorf("failed to get nonce: %v", err)
+	}
+
+	proof, err := proveSmcKey(actor, smcKey, nonce, roster)
+	if err != nil {
+		return xerrors.Errorf("failed to create proof: %v", err)
+	}
+
+	encodedRoster, err := roster.Encode()
+	if err != nil {
+		return xerrors.Errorf("failed to encode roster: %v", err)
+	}
+
+	// a successor SMC also carries the signature of its predecessor
+	err = submitCommand(chainAddr, "/secret/smc", ctx.Flags.String("key"),
+		calypso.CmdAdvertiseSmc,
+		calypso.SmcPublicKeyArg, smcKey,
+		calypso.RosterArg, string(encodedRoster),
+		calypso.SmcProofArg, hex.EncodeToString(proof),
+		calypso.PredecessorArg, ctx.Flags.String("predecessor"),
+		calypso.RosterSignatureArg, ctx.Flags.String("signature"))
+	if err != nil {
+		return xerrors.Errorf("failed to advertise SMC: %v", err)
+	}
+
+	fmt.Fprintf(ctx.Out, "SMC %s advertised", smcKey)
+
+	return nil
+}
+
+// proveSmcKey returns the Schnorr proof of possession of the DKG private key
+// for the roster, produced collectively by the SMC nodes.
+func proveSmcKey(actor dkg.Actor, smcKey string, nonce uint64,
+	roster calypso.Roster) ([]byte, error) {
+
+	signer, ok := actor.(thresholdSigner)
+	if !ok {
+		return nil, xerrors.Errorf("DKG actor %T doesn't support threshold signing", actor)
+	}
+
+	msg, err := calypso.SmcProofMessage([]byte(smcKey), nonce, roster)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create message: %v", err)
+	}
+
+	sig, err := signer.Sign(msg)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to sign: %v", err)
+	}
+
+	pubKey, err := decodePublicKey(smcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the blockchain would refuse an invalid proof, fail early instead
+	err = schnorr.Verify(suite, pubKey, msg, sig)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid signature: %v", err)
+	}
+
+	return sig, nil
+}
+
+// getSmcNonce returns the nonce of the SMC in the contract, to sign in its
+// next advertisement.
+func getSmcNonce(chainAddr string, smcKey string) (uint64, error) {
+	resp, err := http.Get(chainAddr + "/secret/smc/nonce?" +
+		url.Values{"smckey": {smcKey}}.Encode())
+	if err != nil {
+		return 0, xerrors.Errorf("failed to reach blockchain: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return 0, xerrors.Errorf("unexpected status %s: %s", resp.Status, msg)
+	}
+
+	var res struct {
+		Nonce uint64 `json:"nonce"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to decode nonce: %v", err)
+	}
+
+	return res.Nonce, nil
+}
+
+// migrateAction is an action to bind the secrets of the SMC to its successor.
+// The ciphertexts are moved as they are, so the successor must hold the DKG key
+// of the SMC, reshared to its committee.
+//
+// - implements node.ActionTemplate
+type migrateAction struct{}
+
+func (a migrateAction) Execute(ctx node.Context) error {
+	successor := ctx.Flags.String("successor")
+	if successor == "" {
+		return xerrors.New("the key of the successor is required")
+	}
+
+	err := submitCommand(ctx.Flags.String("chainaddr"), "/secret/smc/migrate",
+		ctx.Flags.String("key"), calypso.CmdMigrateSecrets,
+		calypso.SmcPublicKeyArg, successor)
+	if err != nil {
+		return xerrors.Errorf("failed to migrate secrets: %v", err)
+	}
+
+	fmt.Fprintf(ctx.Out, "secrets migrated to SMC %s", successor)
+
+	return nil
+}
+
+// reshareAction is an action to reshare the DKG private key of the node's
+// committee to a new committee. It is only available to the operator of a
+// node of the current committee.
+//
+// - implements node.ActionTemplate
+type reshareAction struct{}
+
+func (a reshareAction) Execute(ctx node.Context) error {
+	var actor dkg.Actor
+	err := ctx.Injector.Resolve(&actor)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve DKG actor: %v", err)
+	}
+
+	var m mino.Mino
+	err = ctx.Injector.Resolve(&m)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve mino: %v", err)
+	}
+
+	threshold := ctx.Flags.Int("threshold")
+	if threshold <= 0 {
+		return xerrors.Errorf("invalid threshold %d", threshold)
+	}
+
+	co, err := decodeAuthorities(m, ctx.Flags.StringSlice("authority"))
+	if err != nil {
+		return xerrors.Errorf("failed to decode authorities: %v", err)
+	}
+
+	if co.Len() < threshold {
+		return xerrors.Errorf("threshold %d is above the %d new members",
+			threshold, co.Len())
+	}
+
+	err = actor.Reshare(co, threshold)
+	if err != nil {
+		return xerrors.Errorf("failed to reshare: %v", err)
+	}
+
+	fmt.Fprintf(ctx.Out, "DKG key reshared to %d members", co.Len())
+
+	return nil
+}
+
+// decodeAuthorities decodes the authorities of the new committee, in the
+// "<ADDR>:<PK>" format of the dkg command, each token encoded in base64.
+func decodeAuthorities(m mino.Mino, authorities []string) (crypto.CollectiveAuthority, error) {
+	if len(authorities) == 0 {
+		return nil, xerrors.New("no authority")
+	}
+
+	addrs := make([]mino.Address, len(authorities))
+	pubkeys := make([]crypto.PublicKey, len(authorities))
+
+	for i, auth := range authorities {
+		parts := strings.Split(auth, separator)
+		if len(parts) != 2 {
+			return nil, xerrors.Errorf(malformedEncoded, auth)
+		}
+
+		addrBuf, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, xerrors.Errorf("failed to decode address: %v", err)
+		}
+
+		pkBuf, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, xerrors.Errorf("failed to decode public key: %v", err)
+		}
+
+		pk := suite.Point()
+
+		err = pk.UnmarshalBinary(pkBuf)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to unmarshal public key: %v", err)
+		}
+
+		addrs[i] = m.GetAddressFactory().FromText(addrBuf)
+		pubkeys[i] = ed25519.NewPublicKeyFromPoint(pk)
+	}
+
+	return authority.New(addrs, pubkeys), nil
+}
+
+// formFields are the names of the form values of the proxy for the arguments
+// of the transactions.
+var formFields = map[string]string{
+	calypso.SmcPublicKeyArg:    "smckey",
+	calypso.RosterArg:          "roster",
+	calypso.SmcProofArg:        "proof",
+	calypso.PredecessorArg:     "predecessor",
+	calypso.RosterSignatureArg: "signature",
+}
+
+// submitCommand sends the command of the calypso contract to the path of the
+// proxy. The transaction is signed by the BLS private key at keyPath,
+// which must be granted the command. Without a key, the arguments are sent as
+// a form and the transaction is signed by the node of the proxy, if its
+// operator allows it.
+func submitCommand(chainAddr, path, keyPath string, cmd calypso.Command,
+	args ...string) error {
+
+	if keyPath == "" {
+		values := make(map[string]string, len(args)/2)
+		for i := 0; i < len(args)-1; i += 2 {
+			values[formFields[args[i]]] = args[i+1]
+		}
+
+		return postForm(chainAddr+path, values)
+	}
+
+	data, err := loader.NewFileLoader(keyPath).Load()
+	if err != nil {
+		return xerrors.Errorf("failed to load key: %v", err)
+	}
+
+	signer, err := bls.NewSignerFromBytes(data)
+	if err != nil {
+		return xerrors.Errorf("failed to unmarshal signer: %v", err)
+	}
+
+	manager := signed.NewManager(signer, nonceClient{chainAddr: chainAddr})
+
+	err = manager.Sync()
+	if err != nil {
+		return xerrors.Errorf("failed to sync manager: %v", err)
+	}
+
+	txArgs := []txn.Arg{
+		{Key: native.ContractArg, Value: []byte(calypso.ContractName)},
+		{Key: calypso.CmdArg, Value: []byte(cmd)},
+	}
+
+	for i := 0; i < len(args)-1; i += 2 {
+		txArgs = append(txArgs, txn.Arg{Key: args[i], Value: []byte(args[i+1])})
+	}
+
+	tx, err := manager.Make(txArgs...)
+	if err != nil {
+		return xerrors.Errorf("failed to create transaction: %v", err)
+	}
+
+	buf, err := tx.Serialize(sjson.NewContext())
+	if err != nil {
+		return xerrors.Errorf("failed to serialize transaction: %v", err)
+	}
+
+	return postForm(chainAddr+path, map[string]string{"tx": string(buf)})
+}
+
+// nonceClient reads the nonce of an identity from the proxy of the chain.
+//
+// - implements signed.Client
+type nonceClient struct {
+	chainAddr string
+}
+
+// GetNonce implements signed.Client.
+func (c nonceClient) GetNonce(ident access.Identity) (uint64, error) {
+	pk, ok := ident.(bls.PublicKey)
+	if !ok {
+		return 0, xerrors.Errorf("unsupported identity %T", ident)
+	}
+
+	buf, err := pk.MarshalBinary()
+	if err != nil {
+		return 0, xerrors.Errorf("failed to marshal identity: %v", err)
+	}
+
+	resp, err := http.Get(c.chainAddr + "/secret/nonce?" +
+		url.Values{"identity": {base64.StdEncoding.EncodeToString(buf)}}.Encode())
+	if err != nil {
+		return 0, xerrors.Errorf("failed to reach blockchain: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return 0, xerrors.Errorf("unexpected status %s: %s", resp.Status, msg)
+	}
+
+	var res struct {
+		Nonce uint64 `json:"nonce"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to decode nonce: %v", err)
+	}
+
+	return res.Nonce, nil
+}
+
+// postForm sends the form to the address as multipart data.
+func postForm(addr string, values map[string]string) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for name, value := range values {
+		err := writer.WriteField(name, value)
+		if err != nil {
+			return xerrors.Errorf("failed to write '%s': %v", name, err)
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		return xerrors.Errorf("failed to close form: %v", err)
+	}
+
+	resp, err := http.Post(addr, writer.FormDataContentType(), body)
+	if err != nil {
+		return xerrors.Errorf("failed to reach blockchain: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return xerrors.Errorf("unexpected status %s: %s", resp.Status, msg)
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/dela/core/access"
+	"go.dedis.ch/dela/core/execution"
+	"go.dedis.ch/dela/core/ordering/cosipbft/authority"
+	"go.dedis.ch/dela/core/store"
+	"go.dedis.ch/dela/core/txn/signed"
+	"go.dedis.ch/dela/crypto"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/crypto/ed25519"
+	"go.dedis.ch/dela/dkg"
+	"go.dedis.ch/dela/mino"
+	"go.dedis.ch/dela/mino/minoch"
+	sjson "go.dedis.ch/dela/serde/json"
+	"go.dedis.ch/dela/testing/fake"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	smcdkg "go.dedis.ch/hbt/server/smc/smccli/dkg"
+)
+
+func TestAdvertiseAction_Execute(t *testing.T) {
+	actors, roster := makeCommittee(t, 4, 3)
+
+	chain := newFakeChain(t)
+
+	buf, err := roster.Encode()
+	require.NoError(t, err)
+
+	inj := node.NewInjector()
+	inj.Inject(actors[1])
+
+	out := &bytes.Buffer{}
+
+	err = advertiseAction{}.Execute(node.Context{
+		Injector: inj,
+		Out:      out,
+		Flags: node.FlagSet{
+			"roster":    string(buf),
+			"chainaddr": chain.url,
+			"key":       chain.keyPath,
+		},
+	})
+	require.NoError(t, err)
+
+	pubKey, err := actors[0].GetPublicKey()
+	require.NoError(t, err)
+
+	smcKey, err := pubKey.MarshalBinary()
+	require.NoError(t, err)
+
+	require.Equal(t, fmt.Sprintf("SMC %x advertised", smcKey), out.String())
+
+	// the contract accepted the proof of the committee
+	nonce, err := calypso.GetSmcNonce(chain.snap, []byte(hex.EncodeToString(smcKey)))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), nonce)
+}
+
+func TestProveSmcKey_NoThresholdSigner(t *testing.T) {
+	_, err := proveSmcKey(fakeActor{}, "", 0, nil)
+	require.EqualError(t, err,
+		"DKG actor controller.fakeActor doesn't support threshold signing")
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// makeCommittee returns the actors of a DKG set up with n nodes, and the roster
+// of the SMC.
+func makeCommittee(t *testing.T, n int, threshold int) ([]dkg.Actor, calypso.Roster) {
+	manager := minoch.NewManager()
+
+	actors := make([]dkg.Actor, n)
+	addrs := make([]mino.Address, n)
+	pubkeys := make([]crypto.PublicKey, n)
+	roster := make(calypso.Roster, n)
+
+	for i := range actors {
+		m := minoch.MustCreate(manager, fmt.Sprintf("node%d", i))
+
+		d, pubkey := smcdkg.NewDKG(m)
+
+		actor, err := d.Listen()
+		require.NoError(t, err)
+
+		pk, err := pubkey.MarshalBinary()
+		require.NoError(t, err)
+
+		actors[i] = actor
+		addrs[i] = m.GetAddress()
+		pubkeys[i] = ed25519.NewPublicKeyFromPoint(pubkey)
+		roster[i] = calypso.RosterMember{
+			Address:    fmt.Sprintf("127.0.0.1:%d", 2001+i),
+			PublicKey:  pk,
+			ShareIndex: uint32(i),
+		}
+	}
+
+	_, err := actors[0].Setup(authority.New(addrs, pubkeys), threshold)
+	require.NoError(t, err)
+
+	return actors, roster
+}
+
+// fakeChain is the proxy of a chain whose transactions are executed by the
+// calypso contract as soon as they are received.
+type fakeChain struct {
+	sync.Mutex
+
+	url     string
+	keyPath string
+	snap    store.Snapshot
+}
+
+// newFakeChain returns a chain served by a test server, and writes the key of
+// a client to sign its transactions.
+func newFakeChain(t *testing.T) *fakeChain {
+	chain := &fakeChain{
+		keyPath: filepath.Join(t.TempDir(), "private.key"),
+		snap:    fake.NewSnapshot(),
+	}
+
+	key, err := bls.NewSigner().MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(chain.keyPath, key, 0600))
+
+	contract := calypso.NewContract(fakeAccess{})
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/secret/nonce", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]uint64{"nonce": 0})
+	})
+
+	mux.HandleFunc("/secret/smc/nonce", func(w http.ResponseWriter, r *http.Request) {
+		chain.Lock()
+		defer chain.Unlock()
+
+		nonce, err := calypso.GetSmcNonce(chain.snap, []byte(r.FormValue("smckey")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]uint64{"nonce": nonce})
+	})
+
+	mux.HandleFunc("/secret/smc", func(w http.ResponseWriter, r *http.Request) {
+		chain.Lock()
+		defer chain.Unlock()
+
+		tx, err := signed.NewTransactionFactory().TransactionOf(sjson.NewContext(),
+			[]byte(r.FormValue("tx")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = contract.Execute(chain.snap, execution.Step{Current: tx})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	chain.url = server.URL
+
+	return chain
+}
+
+// fakeAccess grants every command to every identity.
+//
+// - implements access.Service
+type fakeAccess struct {
+	access.Service
+}
+
+// Match implements access.Service.
+func (fakeAccess) Match(store.Readable, access.Credential, ...access.Identity) error {
+	return nil
+}
+
+// fakeActor is a DKG actor that can't sign.
+//
+// - implements dkg.Actor
+type fakeActor struct {
+	dkg.Actor
+}
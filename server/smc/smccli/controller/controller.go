@@ -26,8 +26,31 @@ func (s smcctl) SetCommands(builder node.Builder) {
 	sub.SetDescription("reveal a reencrypted message")
 	sub.SetFlags(
 		cli.StringFlag{
-			Name:  "xhatenc",
-			Usage: "the reencrypted key as <hex(xhatenc)>",
+			Name: "xhatenc",
+			Usage: "the reencrypted key as <hex(xhatenc)>. If not set, it is " +
+				"requested from the SMC with a request signed by the private key",
+			Required: false,
+		},
+		cli.StringFlag{
+			Name:     "smcaddr",
+			Usage:    "the proxy address of a node of the SMC, e.g. http://127.0.0.1:3002",
+			Required: false,
+		},
+		cli.StringFlag{
+			Name:     "name",
+			Usage:    "the name of the secret to reencrypt",
+			Required: false,
+		},
+		cli.StringFlag{
+			Name:     "proof",
+			Usage:    "the JSON reveal proof of the secret, if the SMC requires it",
+			Required: false,
+		},
+		cli.StringFlag{
+			Name: "roster",
+			Usage: "the roster of the SMC as a JSON list of members with their " +
+				"public shares. If set, the reencryption shares are verified",
+			Required: false,
 		},
 		cli.StringFlag{
 			Name:     "dkgpub",
@@ -35,8 +58,15 @@ func (s smcctl) SetCommands(builder node.Builder) {
 			Required: false,
 		},
 		cli.StringFlag{
-			Name:  "encrypted",
-			Usage: "the encrypted string, as <hex(K)>:<hex(C1):<hex(C2):...>",
+			Name: "encrypted",
+			Usage: "the JSON ciphertext of the secret, or the encrypted string as " +
+				"<hex(K)>:<hex(C1):<hex(C2):...> with --legacy",
+		},
+		cli.BoolFlag{
+			Name: "legacy",
+			Usage: "accept the unversioned encrypted string of 'dkg encrypt', " +
+				"only to migrate it to a ciphertext",
+			Required: false,
 		},
 		cli.StringFlag{
 			Name:  "privk",
@@ -44,6 +74,86 @@ func (s smcctl) SetCommands(builder node.Builder) {
 		},
 	)
 	sub.SetAction(builder.MakeAction(revealAction{}))
+
+	sub = cmd.SetSubCommand("readersig")
+	sub.SetDescription("sign the request of a reader to list the secrets " +
+		"revealed to it")
+	sub.SetFlags(
+		cli.StringFlag{
+			Name:  "privk",
+			Usage: "the private key of the reader as <hex(privk)>",
+		},
+	)
+	sub.SetAction(builder.MakeAction(readerSigAction{}))
+
+	sub = cmd.SetSubCommand("advertise")
+	sub.SetDescription("advertise the SMC on the blockchain with a proof of " +
+		"possession of its DKG private key")
+	sub.SetFlags(
+		cli.StringFlag{
+			Name:  "roster",
+			Usage: "the roster of the SMC as a JSON list of members",
+		},
+		cli.StringFlag{
+			Name:  "chainaddr",
+			Usage: "the address of the blockchain proxy, e.g. http://127.0.0.1:3003",
+		},
+		cli.StringFlag{
+			Name:     "predecessor",
+			Usage:    "the hex-encoded public key of the SMC succeeded by this one",
+			Required: false,
+		},
+		cli.StringFlag{
+			Name: "signature",
+			Usage: "the signature of the members of the predecessor over the " +
+				"successor message, as JSON",
+			Required: false,
+		},
+		cli.StringFlag{
+			Name: "key",
+			Usage: "path to the BLS private key signing the transaction, granted " +
+				"the command. Without it, the transaction is signed by the node " +
+				"of the proxy if its operator allows it",
+			Required: false,
+		},
+	)
+	sub.SetAction(builder.MakeAction(advertiseAction{}))
+
+	sub = cmd.SetSubCommand("reshare")
+	sub.SetDescription("reshare the DKG private key of the node's committee to a " +
+		"new committee")
+	sub.SetFlags(
+		cli.StringSliceFlag{
+			Name:  "authority",
+			Usage: "<ADDR>:<PK> string of a new member, where each token is encoded in base64",
+		},
+		cli.IntFlag{
+			Name:  "threshold",
+			Usage: "the threshold of the new committee",
+		},
+	)
+	sub.SetAction(builder.MakeAction(reshareAction{}))
+
+	sub = cmd.SetSubCommand("migrate")
+	sub.SetDescription("bind the secrets of the SMC to its successor")
+	sub.SetFlags(
+		cli.StringFlag{
+			Name:  "chainaddr",
+			Usage: "the address of the blockchain proxy, e.g. http://127.0.0.1:3003",
+		},
+		cli.StringFlag{
+			Name:  "successor",
+			Usage: "the hex-encoded key of the successor SMC",
+		},
+		cli.StringFlag{
+			Name: "key",
+			Usage: "path to the BLS private key signing the transaction, granted " +
+				"the command. Without it, the transaction is signed by the node " +
+				"of the proxy if its operator allows it",
+			Required: false,
+		},
+	)
+	sub.SetAction(builder.MakeAction(migrateAction{}))
 }
 
 // OnStart implements node.Initializer. It creates and registers a pedersen DKG.
@@ -1,18 +1,42 @@
 package controller
 
 import (
+	"strings"
+
 	"go.dedis.ch/dela"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
 	"go.dedis.ch/kyber/v3"
 	"golang.org/x/xerrors"
 )
 
-// reveal decrypts a reencrypted message.
+// reveal decrypts a reencrypted message. The message is either a ciphertext
+// stored on the blockchain, or points encrypted by the DKG actor if legacy is
+// true.
 func reveal(
 	XhatEnc kyber.Point,
 	dkgPk kyber.Point,
 	userPrivateKey kyber.Scalar,
-	Cs []kyber.Point,
+	encrypted string,
+	legacy bool,
 ) ([]byte, error) {
+	if strings.HasPrefix(encrypted, "{") {
+		ctext, err := calypso.DecodeCiphertext([]byte(encrypted))
+		if err != nil {
+			return nil, err
+		}
+
+		return ctext.Reveal(XhatEnc, dkgPk, userPrivateKey)
+	}
+
+	if !legacy {
+		return nil, xerrors.New(errUnversioned)
+	}
+
+	_, Cs, err := decodeEncrypted(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
 	dela.Logger.Info().Msgf("XhatEnc:%v", XhatEnc)
 	dela.Logger.Info().Msgf("dkgPk:%v", dkgPk)
 	dela.Logger.Info().Msgf("Cs:%v", Cs)
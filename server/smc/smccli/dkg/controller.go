@@ -0,0 +1,69 @@
+package dkg
+
+import (
+	"go.dedis.ch/dela/cli"
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/dela/dkg/pedersen"
+	"go.dedis.ch/dela/dkg/pedersen/controller"
+	"go.dedis.ch/dela/mino"
+	"golang.org/x/xerrors"
+)
+
+// NewController returns the initializer of the DKG. It has the commands of the
+// minimal initializer of dela, but injects the DKG of this package.
+func NewController() node.Initializer {
+	return dkgctl{Initializer: controller.NewMinimal()}
+}
+
+// dkgctl implements node.Initializer
+type dkgctl struct {
+	node.Initializer
+}
+
+// OnStart implements node.Initializer. The minimal initializer of dela creates
+// the Pedersen DKG from the mino of the node, and keeps its public key for the
+// authority written by "dkg listen". It is given the wrapped mino, and the DKG
+// it injects is replaced by the one of this package.
+func (c dkgctl) OnStart(flags cli.Flags, inj node.Injector) error {
+	var m mino.Mino
+	err := inj.Resolve(&m)
+	if err != nil {
+		return xerrors.Errorf("failed to resolve mino: %v", err)
+	}
+
+	return c.Initializer.OnStart(flags, dkgInjector{
+		Injector: inj,
+		mino:     newDkgMino(m),
+	})
+}
+
+// dkgInjector resolves the mino to the wrapped one, and wraps the injected
+// Pedersen DKG.
+//
+// - implements node.Injector
+type dkgInjector struct {
+	node.Injector
+
+	mino *dkgMino
+}
+
+// Resolve implements node.Injector.
+func (i dkgInjector) Resolve(el interface{}) error {
+	m, ok := el.(*mino.Mino)
+	if ok {
+		*m = i.mino
+		return nil
+	}
+
+	return i.Injector.Resolve(el)
+}
+
+// Inject implements node.Injector.
+func (i dkgInjector) Inject(v interface{}) {
+	p, ok := v.(*pedersen.Pedersen)
+	if ok {
+		v = &DKG{pedersen: p, mino: i.mino}
+	}
+
+	i.Injector.Inject(v)
+}
@@ -0,0 +1,141 @@
+package dkg
+
+import (
+	"context"
+	"sync"
+
+	"go.dedis.ch/dela/dkg/pedersen/types"
+	"go.dedis.ch/dela/mino"
+	"go.dedis.ch/dela/serde"
+	"go.dedis.ch/kyber/v3"
+	"golang.org/x/xerrors"
+)
+
+// rpcName is the name of the RPC created by the Pedersen DKG of dela.
+const rpcName = "dkg"
+
+// dkgMino wraps the mino of the node to capture the RPC of the Pedersen DKG,
+// and the committee announced by the start messages received by its handler.
+//
+// - implements mino.Mino
+type dkgMino struct {
+	mino.Mino
+	sync.Mutex
+
+	rpc       mino.RPC
+	players   []mino.Address
+	threshold int
+}
+
+func newDkgMino(m mino.Mino) *dkgMino {
+	return &dkgMino{Mino: m}
+}
+
+// CreateRPC implements mino.Mino. The handler of the DKG RPC is wrapped to
+// follow the committee and to sign, and the RPC is kept to stream the
+// reencryption and signing requests.
+func (m *dkgMino) CreateRPC(name string, h mino.Handler, f serde.Factory) (mino.RPC, error) {
+	if name != rpcName {
+		return m.Mino.CreateRPC(name, h, f)
+	}
+
+	rpc, err := m.Mino.CreateRPC(name, dkgHandler{Handler: h, mino: m}, signFactory{Factory: f})
+	if err != nil {
+		return nil, err
+	}
+
+	m.Lock()
+	m.rpc = rpc
+	m.Unlock()
+
+	return rpc, nil
+}
+
+// getCommittee returns the RPC of the DKG, and the members of the committee
+// with its threshold.
+func (m *dkgMino) getCommittee() (mino.RPC, []mino.Address, int, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.rpc == nil {
+		return nil, nil, 0, xerrors.New("the DKG is not listening")
+	}
+
+	if len(m.players) == 0 {
+		return nil, nil, 0, xerrors.New("the DKG has no committee")
+	}
+
+	return m.rpc, m.players, m.threshold, nil
+}
+
+// update sets the committee announced by a start message. Other messages are
+// ignored.
+func (m *dkgMino) update(msg serde.Message) {
+	m.Lock()
+	defer m.Unlock()
+
+	switch start := msg.(type) {
+	case types.Start:
+		m.players = start.GetAddresses()
+		m.threshold = start.GetThreshold()
+	case types.StartResharing:
+		m.players = start.GetAddrsNew()
+		m.threshold = start.GetTNew()
+	}
+}
+
+// dkgHandler is the handler of the DKG RPC. The messages are processed by the
+// handler of dela once seen by the mino, except the signing requests that are
+// answered with the private share of the node.
+//
+// - implements mino.Handler
+type dkgHandler struct {
+	mino.Handler
+
+	mino *dkgMino
+}
+
+// Stream implements mino.Handler.
+func (h dkgHandler) Stream(out mino.Sender, in mino.Receiver) error {
+	return h.Handler.Stream(out, &dkgReceiver{
+		Receiver: in,
+		out:      out,
+		handler:  h.Handler,
+		mino:     h.mino,
+	})
+}
+
+// dkgReceiver passes the messages received by the handler to the mino, and
+// answers the signing requests of the stream. The nonce of the signature
+// of the stream is kept until it is used.
+//
+// - implements mino.Receiver
+type dkgReceiver struct {
+	mino.Receiver
+
+	out     mino.Sender
+	handler mino.Handler
+	mino    *dkgMino
+	nonce   kyber.Scalar
+}
+
+// Recv implements mino.Receiver.
+func (r *dkgReceiver) Recv(ctx context.Context) (mino.Address, serde.Message, error) {
+	for {
+		from, msg, err := r.Receiver.Recv(ctx)
+		if err != nil {
+			return from, msg, err
+		}
+
+		switch req := msg.(type) {
+		case signNonceRequest:
+			r.commitNonce(from)
+		case signRequest:
+			r.sign(from, req)
+		default:
+			r.mino.update(msg)
+
+			return from, msg, nil
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Package dkg implements a Pedersen DKG on top of the one of dela, whose actor
+// also returns the reencryption shares of the nodes with their DLEQ proofs,
+// reencrypts many keys at once, and signs with the distributed key.
+package dkg
+
+import (
+	"context"
+	"time"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/dkg"
+	"go.dedis.ch/dela/dkg/pedersen"
+	"go.dedis.ch/dela/dkg/pedersen/types"
+	"go.dedis.ch/dela/mino"
+	"go.dedis.ch/hbt/server/smc"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/suites"
+	"golang.org/x/xerrors"
+)
+
+// suite is the Kyber suite of the DKG.
+var suite = suites.MustFind("Ed25519")
+
+// reencryptTimeout is the time given to the committee to reply to a
+// reencryption request.
+var reencryptTimeout = time.Minute
+
+// DKG is the Pedersen DKG of dela with an extended actor.
+//
+// - implements dkg.DKG
+type DKG struct {
+	pedersen *pedersen.Pedersen
+	mino     *dkgMino
+}
+
+// NewDKG returns a new DKG for the mino, and the public key of the node in the
+// DKG setup.
+func NewDKG(m mino.Mino) (*DKG, kyber.Point) {
+	wrapped := newDkgMino(m)
+
+	p, pubkey := pedersen.NewPedersen(wrapped)
+
+	return &DKG{pedersen: p, mino: wrapped}, pubkey
+}
+
+// Listen implements dkg.DKG. It creates the RPC of the DKG.
+func (d *DKG) Listen() (dkg.Actor, error) {
+	actor, err := d.pedersen.Listen()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to listen: %v", err)
+	}
+
+	return &Actor{Actor: actor, mino: d.mino}, nil
+}
+
+// Actor is the actor of the Pedersen DKG of dela, which also returns the
+// reencryption shares of the nodes, reencrypts batches and signs.
+//
+// - implements dkg.Actor
+type Actor struct {
+	dkg.Actor
+
+	mino *dkgMino
+}
+
+// ReencryptShares returns the reencryption share Ui = xi(K + pubk) of each
+// node of the committee, with the DLEQ proof computed by the node. The shares
+// are not verified, since the public shares of the nodes are not known by the
+// actor. It waits for every node, but returns the shares received within the
+// timeout if there are at least threshold of them.
+func (a *Actor) ReencryptShares(K kyber.Point, pubk kyber.Point) ([]smc.ReencryptShare, error) {
+	replies, _, _, err := a.reencrypt([]kyber.Point{K}, pubk, true)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to reencrypt: %v", err)
+	}
+
+	shares := make([]smc.ReencryptShare, len(replies[0]))
+
+	for i, reply := range replies[0] {
+		shares[i], err = smc.NewReencryptShare(reply.Ui.I, reply.Ui.V, reply.Ei, reply.Fi)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid share %d: %v", reply.Ui.I, err)
+		}
+	}
+
+	return shares, nil
+}
+
+// ReencryptBatch reencrypts the keys for the same reader in a single
+// round-trip across the committee, and returns the XhatEnc of each key in the
+// same order. Like the actor of dela, the shares are combined without being
+// verified.
+func (a *Actor) ReencryptBatch(Ks []kyber.Point, pubk kyber.Point) ([]kyber.Point, error) {
+	if len(Ks) == 0 {
+		return nil, nil
+	}
+
+	replies, n, threshold, err := a.reencrypt(Ks, pubk, false)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to reencrypt: %v", err)
+	}
+
+	XhatEncs := make([]kyber.Point, len(Ks))
+
+	for i := range Ks {
+		Uis := make([]*share.PubShare, len(replies[i]))
+		for j, reply := range replies[i] {
+			Uis[j] = reply.Ui
+		}
+
+		XhatEncs[i], err = share.RecoverCommit(suite, Uis, threshold, n)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to recover XhatEnc %d: %v", i, err)
+		}
+	}
+
+	return XhatEncs, nil
+}
+
+// reencrypt streams a reencryption request for each key to the committee, and
+// returns the replies for each key with the size and the threshold of the
+// committee. A node
+// processes the messages of a stream one after the other, so that its replies
+// are in the order of the requests. It returns once each node replied to each
+// key, or once each key has a threshold of replies if all is false. It fails
+// if a key has less than threshold replies when the timeout expires.
+func (a *Actor) reencrypt(Ks []kyber.Point, pubk kyber.Point,
+	all bool) ([][]types.ReencryptReply, int, int, error) {
+
+	_, err := a.GetPublicKey()
+	if err != nil {
+		return nil, 0, 0, xerrors.Errorf("failed to get public key: %v", err)
+	}
+
+	rpc, players, threshold, err := a.mino.getCommittee()
+	if err != nil {
+		return nil, 0, 0, xerrors.Errorf("failed to get committee: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reencryptTimeout)
+	defer cancel()
+
+	sender, receiver, err := rpc.Stream(ctx, mino.NewAddresses(players...))
+	if err != nil {
+		return nil, 0, 0, xerrors.Errorf("failed to create stream: %v", err)
+	}
+
+	for _, K := range Ks {
+		err = <-sender.Send(types.NewReencryptRequest(K, pubk), players...)
+		if err != nil {
+			return nil, 0, 0, xerrors.Errorf("failed to send reencrypt request: %v", err)
+		}
+	}
+
+	replies := make([][]types.ReencryptReply, len(Ks))
+
+	// the number of replies of each node, and the number of keys with a
+	// threshold of replies
+	received := make(map[string]int)
+	done := 0
+
+	for i := 0; i < len(players)*len(Ks); i++ {
+		if !all && done == len(Ks) {
+			break
+		}
+
+		from, msg, err := receiver.Recv(ctx)
+		if err != nil {
+			dela.Logger.Warn().Err(err).Msgf("got %d of %d reencryption replies",
+				i, len(players)*len(Ks))
+			break
+		}
+
+		reply, ok := msg.(types.ReencryptReply)
+		if !ok {
+			return nil, 0, 0, xerrors.Errorf("unexpected reply from '%s': %T", from, msg)
+		}
+
+		index := received[from.String()]
+		if index >= len(Ks) {
+			return nil, 0, 0, xerrors.Errorf("unexpected reply from '%s'", from)
+		}
+
+		received[from.String()]++
+
+		if reply.Ui == nil {
+			dela.Logger.Warn().Msgf("empty reencryption reply from %s", from)
+			continue
+		}
+
+		replies[index] = append(replies[index], reply)
+
+		if len(replies[index]) == threshold {
+			done++
+		}
+	}
+
+	for i := range replies {
+		if len(replies[i]) < threshold {
+			return nil, 0, 0, xerrors.Errorf("not enough replies for key %d (%d < %d)",
+				i, len(replies[i]), threshold)
+		}
+	}
+
+	return replies, len(players), threshold, nil
+}
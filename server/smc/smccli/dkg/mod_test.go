@@ -0,0 +1,276 @@
+package dkg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/core/ordering/cosipbft/authority"
+	"go.dedis.ch/dela/crypto"
+	"go.dedis.ch/dela/crypto/ed25519"
+	"go.dedis.ch/dela/dkg/pedersen"
+	"go.dedis.ch/dela/dkg/pedersen/types"
+	"go.dedis.ch/dela/mino"
+	"go.dedis.ch/dela/mino/minoch"
+	"go.dedis.ch/dela/serde"
+	"go.dedis.ch/dela/serde/json"
+	"go.dedis.ch/hbt/server/smc"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+)
+
+func TestActor_ReencryptShares(t *testing.T) {
+	actors, smcKey := makeCommittee(t, 4, 3)
+
+	publicShares := getPublicShares(t, actors[1])
+
+	k := suite.Scalar().Pick(suite.RandomStream())
+	K := suite.Point().Mul(k, nil)
+
+	privk := suite.Scalar().Pick(suite.RandomStream())
+	pubk := suite.Point().Mul(privk, nil)
+
+	shares, err := actors[2].ReencryptShares(K, pubk)
+	require.NoError(t, err)
+	require.Len(t, shares, 4)
+
+	for _, s := range shares {
+		_, err = s.Verify(K, pubk, publicShares[s.Index])
+		require.NoError(t, err)
+	}
+
+	XhatEnc, invalid, err := smc.RecoverXhatEnc(smcKey, K, pubk, publicShares, shares)
+	require.NoError(t, err)
+	require.Empty(t, invalid)
+
+	expected, err := actors[0].Reencrypt(K, pubk)
+	require.NoError(t, err)
+	require.True(t, expected.Equal(XhatEnc))
+
+	// the reader removes its key to get the key of the secret kX
+	Xhat := suite.Point().Sub(XhatEnc, suite.Point().Mul(privk, smcKey))
+	require.True(t, suite.Point().Mul(k, smcKey).Equal(Xhat))
+
+	// a share doesn't verify against the public share of another node, or
+	// for another key
+	_, err = shares[0].Verify(K, pubk, publicShares[shares[1].Index])
+	require.EqualError(t, err, "invalid proof")
+
+	_, err = shares[0].Verify(suite.Point().Neg(K), pubk, publicShares[shares[0].Index])
+	require.EqualError(t, err, "invalid proof")
+
+	// the invalid share is excluded, and the others are enough
+	shares[0].Ui = shares[1].Ui
+
+	XhatEnc, invalid, err = smc.RecoverXhatEnc(smcKey, K, pubk, publicShares, shares)
+	require.NoError(t, err)
+	require.Equal(t, []int{shares[0].Index}, invalid)
+	require.True(t, expected.Equal(XhatEnc))
+}
+
+func TestActor_ReencryptShares_NoSetup(t *testing.T) {
+	manager := minoch.NewManager()
+
+	d, _ := NewDKG(minoch.MustCreate(manager, "node0"))
+
+	actor, err := d.Listen()
+	require.NoError(t, err)
+
+	_, err = actor.(*Actor).ReencryptShares(suite.Point().Base(), suite.Point().Base())
+	require.ErrorContains(t, err, "failed to reencrypt: failed to get public key: ")
+}
+
+func TestActor_ReencryptBatch(t *testing.T) {
+	actors, _ := makeCommittee(t, 4, 3)
+
+	pubk := suite.Point().Pick(suite.RandomStream())
+
+	Ks := make([]kyber.Point, 5)
+	for i := range Ks {
+		Ks[i] = suite.Point().Pick(suite.RandomStream())
+	}
+
+	XhatEncs, err := actors[3].ReencryptBatch(Ks, pubk)
+	require.NoError(t, err)
+	require.Len(t, XhatEncs, len(Ks))
+
+	// each key is combined from the replies to its own request
+	for i, K := range Ks {
+		expected, err := actors[0].Reencrypt(K, pubk)
+		require.NoError(t, err)
+		require.True(t, expected.Equal(XhatEncs[i]))
+	}
+
+	XhatEncs, err = actors[3].ReencryptBatch(nil, pubk)
+	require.NoError(t, err)
+	require.Nil(t, XhatEncs)
+}
+
+func TestActor_ReencryptBatch_NoSetup(t *testing.T) {
+	manager := minoch.NewManager()
+
+	d, _ := NewDKG(minoch.MustCreate(manager, "node0"))
+
+	actor, err := d.Listen()
+	require.NoError(t, err)
+
+	_, err = actor.(*Actor).ReencryptBatch([]kyber.Point{suite.Point()}, suite.Point())
+	require.ErrorContains(t, err, "failed to reencrypt: failed to get public key: ")
+}
+
+func TestActor_Sign(t *testing.T) {
+	actors, smcKey := makeCommittee(t, 4, 3)
+
+	msg := []byte("message")
+
+	sig, err := actors[1].Sign(msg)
+	require.NoError(t, err)
+	require.NoError(t, schnorr.Verify(suite, smcKey, msg, sig))
+
+	// a new nonce is used for each signature
+	other, err := actors[2].Sign(msg)
+	require.NoError(t, err)
+	require.NoError(t, schnorr.Verify(suite, smcKey, msg, other))
+	require.NotEqual(t, sig, other)
+
+	err = schnorr.Verify(suite, smcKey, []byte("other message"), sig)
+	require.Error(t, err)
+}
+
+func TestActor_Sign_NoSetup(t *testing.T) {
+	manager := minoch.NewManager()
+
+	d, _ := NewDKG(minoch.MustCreate(manager, "node0"))
+
+	actor, err := d.Listen()
+	require.NoError(t, err)
+
+	_, err = actor.(*Actor).Sign([]byte("message"))
+	require.ErrorContains(t, err, "failed to get public key: ")
+}
+
+func TestPrivateShare(t *testing.T) {
+	h := pedersen.NewHandler(suite.Scalar().Pick(suite.RandomStream()),
+		minoch.MustCreate(minoch.NewManager(), "node0").GetAddress())
+
+	_, err := privateShare(h)
+	require.EqualError(t, err, "the DKG is not set up")
+
+	_, err = privateShare(fakeHandler{})
+	require.EqualError(t, err, "unsupported handler dkg.fakeHandler")
+}
+
+func TestSignFactory_Deserialize(t *testing.T) {
+	ctx := json.NewContext()
+	factory := signFactory{Factory: types.NewMessageFactory(minoch.AddressFactory{})}
+
+	msgs := []serde.Message{
+		signNonceRequest{},
+		signNonceReply{index: 2, R: suite.Point().Pick(suite.RandomStream())},
+		signRequest{c: suite.Scalar().Pick(suite.RandomStream())},
+		signReply{index: 3, s: suite.Scalar().Pick(suite.RandomStream())},
+	}
+
+	for _, msg := range msgs {
+		data, err := msg.Serialize(ctx)
+		require.NoError(t, err)
+
+		res, err := factory.Deserialize(ctx, data)
+		require.NoError(t, err)
+		require.IsType(t, msg, res)
+
+		buf, err := res.Serialize(ctx)
+		require.NoError(t, err)
+		require.Equal(t, data, buf)
+	}
+
+	// the messages of dela are deserialized by its factory
+	data, err := types.NewDecryptReply(1, suite.Point().Base()).Serialize(ctx)
+	require.NoError(t, err)
+
+	res, err := factory.Deserialize(ctx, data)
+	require.NoError(t, err)
+	require.IsType(t, types.DecryptReply{}, res)
+
+	_, err = factory.Deserialize(ctx, []byte(`{"SignReply":{"Value":"AA=="}}`))
+	require.ErrorContains(t, err, "failed to unmarshal signature: ")
+}
+
+func TestDkgMino_GetCommittee(t *testing.T) {
+	manager := minoch.NewManager()
+
+	m := newDkgMino(minoch.MustCreate(manager, "node0"))
+
+	_, _, _, err := m.getCommittee()
+	require.EqualError(t, err, "the DKG is not listening")
+
+	d, _ := NewDKG(m)
+
+	_, err = d.Listen()
+	require.NoError(t, err)
+
+	_, _, _, err = m.getCommittee()
+	require.EqualError(t, err, "the DKG has no committee")
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// makeCommittee returns the actors of a DKG set up with n nodes, and the DKG
+// public key.
+func makeCommittee(t *testing.T, n int, threshold int) ([]*Actor, kyber.Point) {
+	manager := minoch.NewManager()
+
+	actors := make([]*Actor, n)
+	addrs := make([]mino.Address, n)
+	pubkeys := make([]crypto.PublicKey, n)
+
+	for i := range actors {
+		m := minoch.MustCreate(manager, fmt.Sprintf("node%d", i))
+
+		d, pubkey := NewDKG(m)
+
+		actor, err := d.Listen()
+		require.NoError(t, err)
+
+		actors[i] = actor.(*Actor)
+		addrs[i] = m.GetAddress()
+		pubkeys[i] = ed25519.NewPublicKeyFromPoint(pubkey)
+	}
+
+	pubkey, err := actors[0].Setup(authority.New(addrs, pubkeys), threshold)
+	require.NoError(t, err)
+
+	return actors, pubkey
+}
+
+// getPublicShares returns the public shares of the nodes, indexed by share
+// index. They are the reencryption shares of K = G for pubk = 0.
+func getPublicShares(t *testing.T, actor *Actor) map[int]kyber.Point {
+	base := suite.Point().Base()
+	null := suite.Point().Null()
+
+	shares, err := actor.ReencryptShares(base, null)
+	require.NoError(t, err)
+
+	publicShares := make(map[int]kyber.Point)
+
+	for _, s := range shares {
+		Xi := suite.Point()
+		require.NoError(t, Xi.UnmarshalBinary(s.Ui))
+
+		_, err = s.Verify(base, null, Xi)
+		require.NoError(t, err)
+
+		publicShares[s.Index] = Xi
+	}
+
+	return publicShares
+}
+
+// fakeHandler is a handler that isn't the one of the Pedersen DKG of dela.
+//
+// - implements mino.Handler
+type fakeHandler struct {
+	mino.UnsupportedHandler
+}
@@ -0,0 +1,393 @@
+package dkg
+
+import (
+	"context"
+	"crypto/sha512"
+	"reflect"
+	"sync"
+	"time"
+	"unsafe"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/dkg/pedersen"
+	"go.dedis.ch/dela/mino"
+	"go.dedis.ch/dela/serde"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"golang.org/x/xerrors"
+)
+
+// signTimeout is the time given to the committee to sign a message.
+var signTimeout = time.Minute
+
+// Sign returns the Schnorr signature of the message with the private key of
+// the DKG, as verified by schnorr.Verify with its public key. The private key
+// is never reconstructed: the first threshold nodes of the committee to commit
+// to a nonce ri each sign with their share xi, and the signature is combined
+// from their replies si = ri + c*xi by Lagrange interpolation.
+func (a *Actor) Sign(msg []byte) ([]byte, error) {
+	pubKey, err := a.GetPublicKey()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get public key: %v", err)
+	}
+
+	rpc, players, threshold, err := a.mino.getCommittee()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get committee: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+
+	sender, receiver, err := rpc.Stream(ctx, mino.NewAddresses(players...))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create stream: %v", err)
+	}
+
+	err = <-sender.Send(signNonceRequest{}, players...)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to send nonce request: %v", err)
+	}
+
+	// the share index of each signer, and the commitments to their nonces
+	signers := make(map[string]int)
+	addrs := make([]mino.Address, 0, threshold)
+	commits := make([]*share.PubShare, 0, threshold)
+
+	for len(commits) < threshold {
+		from, msg, err := receiver.Recv(ctx)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to receive nonces (%d < %d): %v",
+				len(commits), threshold, err)
+		}
+
+		reply, ok := msg.(signNonceReply)
+		if !ok {
+			return nil, xerrors.Errorf("unexpected reply from '%s': %T", from, msg)
+		}
+
+		_, found := signers[from.String()]
+		if found {
+			return nil, xerrors.Errorf("unexpected reply from '%s'", from)
+		}
+
+		signers[from.String()] = reply.index
+		addrs = append(addrs, from)
+		commits = append(commits, &share.PubShare{I: reply.index, V: reply.R})
+	}
+
+	R, err := share.RecoverCommit(suite, commits, threshold, len(players))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to recover commitment: %v", err)
+	}
+
+	c, err := challenge(R, pubKey, msg)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to compute challenge: %v", err)
+	}
+
+	err = <-sender.Send(signRequest{c: c}, addrs...)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to send sign request: %v", err)
+	}
+
+	partials := make([]*share.PriShare, 0, threshold)
+
+	for len(partials) < threshold {
+		from, msg, err := receiver.Recv(ctx)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to receive signatures (%d < %d): %v",
+				len(partials), threshold, err)
+		}
+
+		// the nonces of the other nodes are not used
+		_, ok := msg.(signNonceReply)
+		if ok {
+			continue
+		}
+
+		reply, ok := msg.(signReply)
+		if !ok {
+			return nil, xerrors.Errorf("unexpected reply from '%s': %T", from, msg)
+		}
+
+		index, found := signers[from.String()]
+		if !found || index != reply.index {
+			return nil, xerrors.Errorf("unexpected reply from '%s'", from)
+		}
+
+		delete(signers, from.String())
+
+		partials = append(partials, &share.PriShare{I: reply.index, V: reply.s})
+	}
+
+	s, err := share.RecoverSecret(suite, partials, threshold, len(players))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to recover signature: %v", err)
+	}
+
+	sig, err := R.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal commitment: %v", err)
+	}
+
+	buf, err := s.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal signature: %v", err)
+	}
+
+	sig = append(sig, buf...)
+
+	// the replies are not verified one by one, an invalid one makes the
+	// signature invalid
+	err = schnorr.Verify(suite, pubKey, msg, sig)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid signature: %v", err)
+	}
+
+	return sig, nil
+}
+
+// challenge returns the challenge of the Schnorr signature of the message, as
+// computed by schnorr.Verify.
+func challenge(R kyber.Point, pubKey kyber.Point, msg []byte) (kyber.Scalar, error) {
+	h := sha512.New()
+
+	_, err := R.MarshalTo(h)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = pubKey.MarshalTo(h)
+	if err != nil {
+		return nil, err
+	}
+
+	h.Write(msg)
+
+	return suite.Scalar().SetBytes(h.Sum(nil)), nil
+}
+
+// commitNonce picks the nonce ri of the signature of the stream, and replies
+// with its commitment ri*G.
+func (r *dkgReceiver) commitNonce(from mino.Address) {
+	priShare, err := privateShare(r.handler)
+	if err != nil {
+		dela.Logger.Warn().Err(err).Msgf("failed to commit to a nonce for %s", from)
+		return
+	}
+
+	r.nonce = suite.Scalar().Pick(suite.RandomStream())
+
+	reply := signNonceReply{index: priShare.I, R: suite.Point().Mul(r.nonce, nil)}
+
+	err = <-r.out.Send(reply, from)
+	if err != nil {
+		dela.Logger.Warn().Err(err).Msgf("failed to send nonce to %s", from)
+	}
+}
+
+// sign replies with si = ri + c*xi. The nonce is forgotten, so that it is
+// never used for two challenges, which would reveal the share.
+func (r *dkgReceiver) sign(from mino.Address, req signRequest) {
+	nonce := r.nonce
+	r.nonce = nil
+
+	if nonce == nil {
+		dela.Logger.Warn().Msgf("sign request of %s without a nonce", from)
+		return
+	}
+
+	priShare, err := privateShare(r.handler)
+	if err != nil {
+		dela.Logger.Warn().Err(err).Msgf("failed to sign for %s", from)
+		return
+	}
+
+	s := suite.Scalar().Mul(req.c, priShare.V)
+	s.Add(s, nonce)
+
+	err = <-r.out.Send(signReply{index: priShare.I, s: s}, from)
+	if err != nil {
+		dela.Logger.Warn().Err(err).Msgf("failed to send signature to %s", from)
+	}
+}
+
+// privateShare returns the private share of the node, as kept by the handler
+// of the Pedersen DKG of dela. It is not exported by dela v0.1.0, so it is
+// read from the instance of the handler, under its lock.
+func privateShare(h mino.Handler) (*share.PriShare, error) {
+	handler, ok := h.(*pedersen.Handler)
+	if !ok {
+		return nil, xerrors.Errorf("unsupported handler %T", h)
+	}
+
+	instance := reflect.ValueOf(handler).Elem().FieldByName("dkgInstance")
+	if instance.Kind() != reflect.Interface || instance.IsNil() {
+		return nil, xerrors.New("unsupported DKG handler")
+	}
+
+	instance = instance.Elem()
+	if instance.Kind() != reflect.Ptr || instance.Elem().Kind() != reflect.Struct {
+		return nil, xerrors.New("unsupported DKG instance")
+	}
+
+	instance = instance.Elem()
+
+	lock := instance.FieldByName("Mutex")
+	field := instance.FieldByName("privShare")
+
+	if !lock.IsValid() || lock.Type() != reflect.TypeOf(sync.Mutex{}) ||
+		!field.IsValid() || field.Type() != reflect.TypeOf(&share.PriShare{}) {
+
+		return nil, xerrors.New("unsupported DKG instance")
+	}
+
+	mu := (*sync.Mutex)(unsafe.Pointer(lock.UnsafeAddr()))
+
+	mu.Lock()
+	priShare := *(**share.PriShare)(unsafe.Pointer(field.UnsafeAddr()))
+	mu.Unlock()
+
+	if priShare == nil {
+		return nil, xerrors.New("the DKG is not set up")
+	}
+
+	return priShare, nil
+}
+
+// signNonceRequest asks a node for the commitment to a new nonce.
+//
+// - implements serde.Message
+type signNonceRequest struct{}
+
+// Serialize implements serde.Message.
+func (req signNonceRequest) Serialize(ctx serde.Context) ([]byte, error) {
+	return ctx.Marshal(signMessageJSON{SignNonceRequest: &struct{}{}})
+}
+
+// signNonceReply is the commitment R = ri*G of a node to its nonce.
+//
+// - implements serde.Message
+type signNonceReply struct {
+	index int
+	R     kyber.Point
+}
+
+// Serialize implements serde.Message.
+func (reply signNonceReply) Serialize(ctx serde.Context) ([]byte, error) {
+	R, err := reply.R.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal commitment: %v", err)
+	}
+
+	return ctx.Marshal(signMessageJSON{
+		SignNonceReply: &signShareJSON{Index: reply.index, Value: R},
+	})
+}
+
+// signRequest asks a node to sign the challenge c with its nonce.
+//
+// - implements serde.Message
+type signRequest struct {
+	c kyber.Scalar
+}
+
+// Serialize implements serde.Message.
+func (req signRequest) Serialize(ctx serde.Context) ([]byte, error) {
+	c, err := req.c.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal challenge: %v", err)
+	}
+
+	return ctx.Marshal(signMessageJSON{SignRequest: &signShareJSON{Value: c}})
+}
+
+// signReply is the share s = ri + c*xi of the signature of a node.
+//
+// - implements serde.Message
+type signReply struct {
+	index int
+	s     kyber.Scalar
+}
+
+// Serialize implements serde.Message.
+func (reply signReply) Serialize(ctx serde.Context) ([]byte, error) {
+	s, err := reply.s.MarshalBinary()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal signature: %v", err)
+	}
+
+	return ctx.Marshal(signMessageJSON{
+		SignReply: &signShareJSON{Index: reply.index, Value: s},
+	})
+}
+
+// signMessageJSON is the JSON message of the signing requests and replies.
+// Its fields are distinct from the ones of the messages of dela.
+type signMessageJSON struct {
+	SignNonceRequest *struct{}      `json:",omitempty"`
+	SignNonceReply   *signShareJSON `json:",omitempty"`
+	SignRequest      *signShareJSON `json:",omitempty"`
+	SignReply        *signShareJSON `json:",omitempty"`
+}
+
+// signShareJSON is the JSON value of a signing message, with the share index
+// of the node for the replies.
+type signShareJSON struct {
+	Index int
+	Value []byte
+}
+
+// signFactory deserializes the signing messages, and the messages of dela
+// with its factory.
+//
+// - implements serde.Factory
+type signFactory struct {
+	serde.Factory
+}
+
+// Deserialize implements serde.Factory.
+func (f signFactory) Deserialize(ctx serde.Context, data []byte) (serde.Message, error) {
+	var m signMessageJSON
+
+	err := ctx.Unmarshal(data, &m)
+	if err != nil {
+		return f.Factory.Deserialize(ctx, data)
+	}
+
+	switch {
+	case m.SignNonceRequest != nil:
+		return signNonceRequest{}, nil
+	case m.SignNonceReply != nil:
+		R := suite.Point()
+
+		err = R.UnmarshalBinary(m.SignNonceReply.Value)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to unmarshal commitment: %v", err)
+		}
+
+		return signNonceReply{index: m.SignNonceReply.Index, R: R}, nil
+	case m.SignRequest != nil:
+		c := suite.Scalar()
+
+		err = c.UnmarshalBinary(m.SignRequest.Value)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to unmarshal challenge: %v", err)
+		}
+
+		return signRequest{c: c}, nil
+	case m.SignReply != nil:
+		s := suite.Scalar()
+
+		err = s.UnmarshalBinary(m.SignReply.Value)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to unmarshal signature: %v", err)
+		}
+
+		return signReply{index: m.SignReply.Index, s: s}, nil
+	}
+
+	return f.Factory.Deserialize(ctx, data)
+}
@@ -6,10 +6,10 @@ import (
 	"os"
 
 	"go.dedis.ch/dela/cli/node"
-	dkg "go.dedis.ch/dela/dkg/pedersen/controller"
 	minogrpc "go.dedis.ch/dela/mino/minogrpc/controller"
 	proxy "go.dedis.ch/dela/mino/proxy/http/controller"
 	smc "go.dedis.ch/hbt/server/smc/smccli/controller"
+	"go.dedis.ch/hbt/server/smc/smccli/dkg"
 	"go.dedis.ch/hbt/server/smc/smccli/web"
 	kv "go.dedis.ch/purb-db/store/kv/controller"
 )
@@ -38,7 +38,7 @@ func runWithCfg(args []string, cfg config) error {
 		proxy.NewController(),
 		web.NewController(),
 		minogrpc.NewController(),
-		dkg.NewMinimal(),
+		dkg.NewController(),
 		smc.NewSmcController(),
 	)
 
@@ -1,18 +1,25 @@
 package web
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog/log"
 	"go.dedis.ch/dela"
 	"go.dedis.ch/dela/cli/node"
 	"go.dedis.ch/dela/dkg"
+	"go.dedis.ch/dela/mino"
 	"go.dedis.ch/dela/mino/proxy"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"go.dedis.ch/hbt/server/smc"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/suites"
 
@@ -44,9 +51,30 @@ func (a *RegisterAction) Execute(ctx node.Context) error {
 	pk := &pubKeyHandler{ctx}
 	router.HandleFunc("/smc/pubkey", pk.ServeHTTP).Methods("GET")
 
-	re := &reencryptHandler{ctx}
+	addr := &addressHandler{ctx}
+	router.HandleFunc("/smc/address", addr.ServeHTTP).Methods("GET")
+
+	re := &reencryptHandler{
+		ctx:       ctx,
+		chainAddr: ctx.Flags.String(chainAddrFlag),
+		replay:    newReplayGuard(),
+	}
+
+	// the secrets are only reencrypted for the reveals committed on the chain
+	if ctx.Flags.Path(chainRosterFlag) == "" {
+		return xerrors.New("the roster of the chain is required to check the reveal proofs")
+	}
+
+	re.chainRoster, err = loadChainRoster(ctx.Flags.Path(chainRosterFlag))
+	if err != nil {
+		return err
+	}
+
 	router.HandleFunc("/smc/reencrypt", re.ServeHTTP).Methods("POST")
 
+	batch := &batchHandler{re: re}
+	router.HandleFunc("/smc/reencrypt/batch", batch.ServeHTTP).Methods("POST")
+
 	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
 	router.MethodNotAllowedHandler = http.HandlerFunc(notAllowedHandler)
 
@@ -92,8 +120,45 @@ func (h *pubKeyHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+// addressHandler returns the address of the node, which the readers sign in
+// their reencryption requests.
+type addressHandler struct {
+	ctx node.Context
+}
+
+func (h *addressHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	addr, err := nodeAddress(h.ctx.Injector)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(addr)
+	if err != nil {
+		dela.Logger.Error().Err(err).Msg("failed to write address")
+	}
+}
+
+// shareReencrypter is implemented by the DKG actors that return the
+// reencryption shares of the nodes with their DLEQ proofs. The actor of dela
+// only returns the combined XhatEnc.
+type shareReencrypter interface {
+	ReencryptShares(K kyber.Point, pubk kyber.Point) ([]smc.ReencryptShare, error)
+}
+
 type reencryptHandler struct {
 	ctx node.Context
+
+	// chainAddr is the address of the blockchain proxy used to check the
+	// access tokens. The tokens are not checked if it is empty.
+	chainAddr string
+
+	// chainRoster is the roster of the nodes of the chain signing the reveal
+	// proofs.
+	chainRoster calypso.Roster
+
+	// replay refuses the stale and replayed requests.
+	replay *replayGuard
 }
 
 func (h *reencryptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -108,35 +173,29 @@ func (h *reencryptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	err = r.ParseForm()
 	if err != nil {
 		log.Err(err).Msg("failed to parse form")
-		http.Error(w, "failed to parse form", http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("failed to parse form: %v", err), http.StatusBadRequest)
 		return
 	}
 
 	// XHATENC=$(smccli --config /tmp/smc1 dkg reencrypt --encrypted ${CIPHER} --pubk ${PUBK})
 
-	// retrieve the public key
-	pubkString := r.FormValue("pubk")
-	pubk, err := decodePublicKey(pubkString)
+	item, status, err := h.check(a, r.Form)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode public key str: %v", err),
-			http.StatusInternalServerError)
+		http.Error(w, err.Error(), status)
 		return
 	}
 
-	// retrieve the encrypted cypher
-	encrypted := r.FormValue("encrypted")
-	k, _, err := decodeEncrypted(encrypted)
+	// re-encrypt the message
+	hatenc, err := a.Reencrypt(item.k, item.pubk)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode encrypted str: %v", err),
+		http.Error(w, fmt.Sprintf("failed to re-encrypt: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	// re-encrypt the message
-	hatenc, err := a.Reencrypt(k, pubk)
+	response, err := makeReencryptResponse(a, item, hatenc)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to re-encrypt: %v", err),
-			http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -144,71 +203,279 @@ func (h *reencryptHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	encoder := json.NewEncoder(w)
-	err = encoder.Encode(hatenc)
+	err = encoder.Encode(response)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to encode response: %v", err),
 			http.StatusInternalServerError)
 		return
 	}
 
-	dela.Logger.Debug().Msgf("Re-encrypted message: %v", hatenc)
+	dela.Logger.Debug().Msgf("Re-encrypted message of '%s': %v", item.name, hatenc)
 }
 
-// -----------------------------------------------------------------------------
-// Helper functions
-func decodePublicKey(str string) (kyber.Point, error) {
-	pkbuff, err := hex.DecodeString(str)
+// reencryptItem is a reencryption request that passed the checks.
+type reencryptItem struct {
+	name []byte
+	k    kyber.Point
+	pubk kyber.Point
+}
+
+// check decodes the reencryption request from the form values and verifies
+// that it is allowed. It returns an error with the HTTP status to reply
+// otherwise.
+func (h *reencryptHandler) check(a dkg.Actor, form url.Values) (reencryptItem, int, error) {
+	// retrieve the public key
+	pubkString := form.Get("pubk")
+	pubk, err := decodePublicKey(pubkString)
 	if err != nil {
-		return nil, xerrors.Errorf(malformedEncoded, str)
+		return reencryptItem{}, http.StatusBadRequest,
+			xerrors.Errorf("failed to decode public key str: %v", err)
 	}
 
-	pk := suite.Point()
-	err = pk.UnmarshalBinary(pkbuff)
+	// retrieve the encrypted cypher
+	encrypted := form.Get("encrypted")
+	k, err := decodeEncryptedKey(encrypted)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to unmarshal pk: %v", err)
+		return reencryptItem{}, http.StatusBadRequest,
+			xerrors.Errorf("failed to decode encrypted str: %v", err)
 	}
 
-	return pk, nil
-}
+	// check that the caller holds the private key of the reader
+	req, sig, err := smc.DecodeReencryptRequest(form, k, pubk)
+	if err != nil {
+		return reencryptItem{}, http.StatusBadRequest,
+			xerrors.Errorf("invalid request: %v", err)
+	}
 
-func decodeEncrypted(str string) (kyber.Point, []kyber.Point, error) {
-	parts := strings.Split(str, separator)
-	if len(parts) < 2 {
-		return nil, nil, xerrors.Errorf(malformedEncoded, str)
+	err = req.Verify(sig)
+	if err != nil {
+		return reencryptItem{}, http.StatusUnauthorized,
+			xerrors.Errorf("access refused: %v", err)
 	}
 
-	// Decode K
-	kbuff, err := hex.DecodeString(parts[0])
+	// the nonces are only known by this node, so a request signed for another
+	// node of the committee would be replayable here
+	addr, err := nodeAddress(h.ctx.Injector)
 	if err != nil {
-		return nil, nil, xerrors.Errorf("failed to decode k point: %v", err)
+		return reencryptItem{}, http.StatusInternalServerError, err
 	}
 
-	k := suite.Point()
-	err = k.UnmarshalBinary(kbuff)
+	if !bytes.Equal(req.Target, addr) {
+		return reencryptItem{}, http.StatusForbidden,
+			xerrors.Errorf("access refused: request for node '%s'", req.Target)
+	}
+
+	// the access token is derived from the secret and the reader of the
+	// request, so that the token of another reveal can't be used
+	token, status, err := accessToken(a, encrypted, pubkString)
 	if err != nil {
-		return nil, nil, xerrors.Errorf("failed to unmarshal k point: %v", err)
+		return reencryptItem{}, status, err
 	}
 
-	// Decode Cs
-	cs := make([]kyber.Point, 0, len(parts)-1)
-	for _, p := range parts[1:] {
-		cbuff, err := hex.DecodeString(p)
+	// check that the reveal of the secret to that key was committed
+	status, err = h.checkRevealProof(form.Get("proof"), token)
+	if err != nil {
+		return reencryptItem{}, status, xerrors.Errorf("access refused: %v", err)
+	}
+
+	// check the access token of the reveal on the blockchain
+	if h.chainAddr != "" {
+		status, err := checkAccessToken(h.chainAddr, hex.EncodeToString(token))
 		if err != nil {
-			return nil, nil, xerrors.Errorf("failed to decode c point: %v", err)
+			return reencryptItem{}, status, xerrors.Errorf("access refused: %v", err)
 		}
+	}
+
+	// the nonce is only remembered once the request is verified
+	status, err = h.replay.check(req)
+	if err != nil {
+		return reencryptItem{}, status, xerrors.Errorf("access refused: %v", err)
+	}
+
+	return reencryptItem{name: req.Name, k: k, pubk: pubk}, http.StatusOK, nil
+}
+
+// makeReencryptResponse returns the response for the reencrypted key of the
+// item, with the shares of the nodes if the actor supports them.
+func makeReencryptResponse(a dkg.Actor, item reencryptItem,
+	hatenc kyber.Point) (smc.ReencryptResponse, error) {
+
+	hatencbuff, err := hatenc.MarshalBinary()
+	if err != nil {
+		return smc.ReencryptResponse{},
+			xerrors.Errorf("failed to marshal re-encrypted message: %v", err)
+	}
 
-		c := suite.Point()
-		err = c.UnmarshalBinary(cbuff)
+	response := smc.ReencryptResponse{
+		XhatEnc: hex.EncodeToString(hatencbuff),
+	}
+
+	// the shares let the reader verify the nodes instead of trusting XhatEnc
+	sr, ok := a.(shareReencrypter)
+	if ok {
+		response.Shares, err = sr.ReencryptShares(item.k, item.pubk)
 		if err != nil {
-			return nil, nil, xerrors.Errorf("failed to unmarshal c point: %v", err)
+			return smc.ReencryptResponse{},
+				xerrors.Errorf("failed to get re-encryption shares: %v", err)
 		}
+	}
 
-		cs = append(cs, c)
+	return response, nil
+}
+
+// -----------------------------------------------------------------------------
+// Helper functions
+
+// nodeAddress returns the text form of the address of the node.
+func nodeAddress(inj node.Injector) ([]byte, error) {
+	var m mino.Mino
+	err := inj.Resolve(&m)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to resolve mino: %v", err)
+	}
+
+	addr, err := m.GetAddress().MarshalText()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal address: %v", err)
 	}
 
-	dela.Logger.Debug().Msgf("Decoded K: %v and Cs: %v", k, cs)
+	return addr, nil
+}
+
+// checkAccessToken asks the blockchain proxy for the access record of the
+// token and returns an error with the HTTP status to reply if the token is
+// unknown or revoked.
+func checkAccessToken(chainAddr string, token string) (int, error) {
+	if token == "" {
+		return http.StatusBadRequest, xerrors.New("missing access token")
+	}
+
+	resp, err := http.Get(chainAddr + "/secret/access?token=" + url.QueryEscape(token))
+	if err != nil {
+		return http.StatusBadGateway, xerrors.Errorf("failed to reach blockchain: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return http.StatusForbidden, xerrors.Errorf("unknown access token")
+	default:
+		return http.StatusBadGateway, xerrors.Errorf("unexpected blockchain status: %s",
+			resp.Status)
+	}
+
+	var access calypso.SecretAccess
+	err = json.NewDecoder(resp.Body).Decode(&access)
+	if err != nil {
+		return http.StatusBadGateway, xerrors.Errorf("failed to decode access: %v", err)
+	}
+
+	if access.Revoked != nil {
+		return http.StatusForbidden, xerrors.Errorf("access token revoked: %s",
+			access.Revoked.Reason)
+	}
+
+	return http.StatusOK, nil
+}
+
+// accessToken returns the access token of the reveal of the secret to the
+// reader. It is computed from the key of the SMC so that the token of another
+// secret or another reader is refused.
+func accessToken(a dkg.Actor, encrypted string, reader string) ([]byte, int, error) {
+	pk, err := a.GetPublicKey()
+	if err != nil {
+		return nil, http.StatusServiceUnavailable,
+			xerrors.Errorf("failed retrieving public key: %v", err)
+	}
+
+	pkbuff, err := pk.MarshalBinary()
+	if err != nil {
+		return nil, http.StatusInternalServerError,
+			xerrors.Errorf("failed to marshal public key: %v", err)
+	}
+
+	smcKey := hex.EncodeToString(pkbuff)
+
+	return calypso.AccessToken([]byte(smcKey), []byte(encrypted), []byte(reader)),
+		http.StatusOK, nil
+}
+
+// checkRevealProof verifies the reveal proof of the access token against the
+// roster of the chain.
+func (h *reencryptHandler) checkRevealProof(proofString string, token []byte) (int, error) {
+	if proofString == "" {
+		return http.StatusBadRequest, xerrors.New("missing reveal proof")
+	}
+
+	var proof calypso.RevealProof
+
+	err := json.Unmarshal([]byte(proofString), &proof)
+	if err != nil {
+		return http.StatusBadRequest,
+			xerrors.Errorf("failed to decode reveal proof: %v", err)
+	}
+
+	err = calypso.VerifyRevealProof(h.chainRoster, proof, token, time.Now())
+	if err != nil {
+		return http.StatusForbidden, xerrors.Errorf("invalid reveal proof: %v", err)
+	}
+
+	return http.StatusOK, nil
+}
+
+// loadChainRoster reads the roster of the chain from a JSON file.
+func loadChainRoster(path string) (calypso.Roster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read chain roster: %v", err)
+	}
+
+	var roster calypso.Roster
+
+	err = json.Unmarshal(data, &roster)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode chain roster: %v", err)
+	}
+
+	if len(roster) == 0 {
+		return nil, xerrors.New("empty chain roster")
+	}
+
+	return roster, nil
+}
+
+func decodePublicKey(str string) (kyber.Point, error) {
+	pkbuff, err := hex.DecodeString(str)
+	if err != nil {
+		return nil, xerrors.Errorf(malformedEncoded, str)
+	}
+
+	pk := suite.Point()
+	err = pk.UnmarshalBinary(pkbuff)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to unmarshal pk: %v", err)
+	}
+
+	return pk, nil
+}
+
+// decodeEncryptedKey returns the ephemeral key K of the encrypted message.
+// Only K is reencrypted, the rest of the message stays with the reader. The
+// message must be a versioned ciphertext, the legacy K:C messages of the DKG
+// actor are refused.
+func decodeEncryptedKey(str string) (kyber.Point, error) {
+	if !strings.HasPrefix(str, "{") {
+		return nil, xerrors.New("unversioned ciphertext")
+	}
+
+	ctext, err := calypso.DecodeCiphertext([]byte(str))
+	if err != nil {
+		return nil, err
+	}
 
-	return k, cs, nil
+	return ctext.Key()
 }
 
 // -----------------------------------------------------------------------------
@@ -0,0 +1,467 @@
+package web
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/dela/cli/node"
+	"go.dedis.ch/dela/core/ordering/cosipbft/authority"
+	"go.dedis.ch/dela/crypto"
+	"go.dedis.ch/dela/crypto/bls"
+	"go.dedis.ch/dela/crypto/ed25519"
+	"go.dedis.ch/dela/dkg"
+	"go.dedis.ch/dela/mino"
+	"go.dedis.ch/dela/mino/minoch"
+	"go.dedis.ch/dela/mino/proxy"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"go.dedis.ch/hbt/server/smc"
+	smcdkg "go.dedis.ch/hbt/server/smc/smccli/dkg"
+	"go.dedis.ch/kyber/v3"
+)
+
+func TestRegisterAction_Execute(t *testing.T) {
+	action := RegisterAction{}
+
+	inj := node.NewInjector()
+
+	err := action.Execute(node.Context{Injector: inj, Flags: node.FlagSet{}})
+	require.ErrorContains(t, err, "failed to resolve proxy: ")
+
+	inj.Inject(&fakeProxy{})
+
+	err = action.Execute(node.Context{Injector: inj, Flags: node.FlagSet{}})
+	require.EqualError(t, err, "the roster of the chain is required to check the reveal proofs")
+
+	err = action.Execute(node.Context{
+		Injector: inj,
+		Flags:    node.FlagSet{chainRosterFlag: filepath.Join(t.TempDir(), "roster.json")},
+	})
+	require.ErrorContains(t, err, "failed to read chain roster: ")
+}
+
+func TestReencryptHandler_ServeHTTP(t *testing.T) {
+	committee := newTestCommittee(t, 4, 3)
+	nd := committee.startNode(t, 1, "")
+
+	reader := newTestReader()
+	secret := committee.newSecret(t)
+
+	form := committee.makeRequest(t, 1, reader, secret, reader)
+
+	var res smc.ReencryptResponse
+
+	decodeJSON(t, postForm(t, nd, form), http.StatusCreated, &res)
+
+	// the reader doesn't trust XhatEnc, it combines the verified shares
+	XhatEnc, invalid, err := smc.RecoverXhatEnc(committee.pubkey, secret.K, reader.pubk,
+		committee.getPublicShares(t), res.Shares)
+	require.NoError(t, err)
+	require.Empty(t, invalid)
+	require.Equal(t, res.XhatEnc, hexPoint(t, XhatEnc))
+
+	// the reader removes its key to decrypt the secret
+	msg, err := secret.ctext.Reveal(XhatEnc, committee.pubkey, reader.privk)
+	require.NoError(t, err)
+	require.Equal(t, secret.msg, msg)
+
+	requireStatus(t, postForm(t, nd, form), http.StatusForbidden,
+		"access refused: replayed request\n")
+
+	// the request is signed for another node of the committee
+	form = committee.makeRequest(t, 2, reader, secret, reader)
+
+	addr, err := committee.minos[2].GetAddress().MarshalText()
+	require.NoError(t, err)
+
+	requireStatus(t, postForm(t, nd, form), http.StatusForbidden,
+		fmt.Sprintf("access refused: request for node '%s'\n", addr))
+
+	// the request is not signed by the reader
+	form = committee.makeRequest(t, 1, reader, secret, newTestReader())
+
+	resp := postForm(t, nd, form)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "access refused: invalid signature: ")
+
+	// the secret is revealed to another reader
+	form = committee.makeRequest(t, 1, reader, secret, reader)
+	form.Set("proof", committee.makeProof(t, secret, newTestReader()))
+
+	requireStatus(t, postForm(t, nd, form), http.StatusForbidden,
+		"access refused: invalid reveal proof: proof is for another access token\n")
+
+	form = committee.makeRequest(t, 1, reader, secret, reader)
+	form.Del("proof")
+
+	requireStatus(t, postForm(t, nd, form), http.StatusBadRequest,
+		"access refused: missing reveal proof\n")
+}
+
+func TestReencryptHandler_ServeHTTP_BadRequest(t *testing.T) {
+	committee := newTestCommittee(t, 3, 2)
+	nd := committee.startNode(t, 0, "")
+
+	reader := newTestReader()
+	secret := committee.newSecret(t)
+
+	form := committee.makeRequest(t, 0, reader, secret, reader)
+	form.Set("pubk", "xyz")
+
+	resp := postForm(t, nd, form)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "failed to decode public key str: ")
+
+	// the legacy K:C messages are refused
+	form = committee.makeRequest(t, 0, reader, secret, reader)
+	form.Set("encrypted", hexPoint(t, secret.K)+separator+hexPoint(t, suite.Point().Pick(
+		suite.RandomStream())))
+
+	requireStatus(t, postForm(t, nd, form), http.StatusBadRequest,
+		"failed to decode encrypted str: unversioned ciphertext\n")
+
+	form = committee.makeRequest(t, 0, reader, secret, reader)
+	form.Set("encrypted", "{")
+
+	resp = postForm(t, nd, form)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "failed to decode encrypted str: ")
+
+	form = committee.makeRequest(t, 0, reader, secret, reader)
+	form.Set("proof", "{")
+
+	resp = postForm(t, nd, form)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "access refused: failed to decode reveal proof: ")
+}
+
+func TestReencryptHandler_ServeHTTP_DelaActor(t *testing.T) {
+	committee := newTestCommittee(t, 3, 2)
+
+	// the actor of dela doesn't return the shares
+	committee.actors[0] = delaActor{Actor: committee.actors[0]}
+
+	nd := committee.startNode(t, 0, "")
+
+	reader := newTestReader()
+	secret := committee.newSecret(t)
+
+	var res smc.ReencryptResponse
+
+	decodeJSON(t, postForm(t, nd, committee.makeRequest(t, 0, reader, secret, reader)),
+		http.StatusCreated, &res)
+
+	expected, err := committee.actors[1].Reencrypt(secret.K, reader.pubk)
+	require.NoError(t, err)
+	require.Equal(t, hexPoint(t, expected), res.XhatEnc)
+	require.Empty(t, res.Shares)
+}
+
+func TestReencryptHandler_ServeHTTP_AccessToken(t *testing.T) {
+	committee := newTestCommittee(t, 3, 2)
+
+	reader := newTestReader()
+	secret := committee.newSecret(t)
+
+	// the blockchain proxy knows the access token of the reveal, until it is
+	// revoked
+	access := calypso.SecretAccess{Reader: []byte(hexPoint(t, reader.pubk))}
+
+	chain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := committee.token(secret, reader)
+
+		if r.URL.Query().Get("token") != hex.EncodeToString(token) {
+			http.Error(w, "unknown access token", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(access)
+	}))
+	defer chain.Close()
+
+	nd := committee.startNode(t, 0, chain.URL)
+
+	var res smc.ReencryptResponse
+
+	decodeJSON(t, postForm(t, nd, committee.makeRequest(t, 0, reader, secret, reader)),
+		http.StatusCreated, &res)
+
+	access.Revoked = &calypso.Revocation{Reason: "leaked"}
+
+	requireStatus(t, postForm(t, nd, committee.makeRequest(t, 0, reader, secret, reader)),
+		http.StatusForbidden, "access refused: access token revoked: leaked\n")
+
+	// the proof is valid, but the token is unknown to the blockchain
+	other := committee.newSecret(t)
+
+	requireStatus(t, postForm(t, nd, committee.makeRequest(t, 0, reader, other, reader)),
+		http.StatusForbidden, "access refused: unknown access token\n")
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// testCommittee is a DKG committee set up over minoch, with the chain that
+// signs the reveal proofs.
+type testCommittee struct {
+	actors []dkg.Actor
+	minos  []mino.Mino
+	pubkey kyber.Point
+
+	// chain is the single node of the chain signing the reveal proofs.
+	chain       bls.Signer
+	chainRoster calypso.Roster
+}
+
+// newTestCommittee returns a committee of n nodes set up with the threshold.
+func newTestCommittee(t *testing.T, n int, threshold int) *testCommittee {
+	manager := minoch.NewManager()
+
+	c := &testCommittee{
+		actors: make([]dkg.Actor, n),
+		minos:  make([]mino.Mino, n),
+		chain:  bls.NewSigner(),
+	}
+
+	addrs := make([]mino.Address, n)
+	pubkeys := make([]crypto.PublicKey, n)
+
+	for i := range c.actors {
+		m := minoch.MustCreate(manager, fmt.Sprintf("node%d", i))
+
+		d, pubkey := smcdkg.NewDKG(m)
+
+		actor, err := d.Listen()
+		require.NoError(t, err)
+
+		c.actors[i] = actor
+		c.minos[i] = m
+		addrs[i] = m.GetAddress()
+		pubkeys[i] = ed25519.NewPublicKeyFromPoint(pubkey)
+	}
+
+	var err error
+
+	c.pubkey, err = c.actors[0].Setup(authority.New(addrs, pubkeys), threshold)
+	require.NoError(t, err)
+
+	pk, err := c.chain.GetPublicKey().MarshalBinary()
+	require.NoError(t, err)
+
+	c.chainRoster = calypso.Roster{{Address: "127.0.0.1:3003", PublicKey: pk}}
+
+	return c
+}
+
+// startNode registers the handlers of the node i on a test server, and returns
+// its URL.
+func (c *testCommittee) startNode(t *testing.T, i int, chainAddr string) string {
+	buf, err := c.chainRoster.Encode()
+	require.NoError(t, err)
+
+	rosterPath := filepath.Join(t.TempDir(), "roster.json")
+	require.NoError(t, os.WriteFile(rosterPath, buf, 0600))
+
+	p := &fakeProxy{}
+
+	inj := node.NewInjector()
+	inj.Inject(p)
+	inj.Inject(c.actors[i])
+	inj.Inject(c.minos[i])
+
+	action := RegisterAction{}
+
+	err = action.Execute(node.Context{
+		Injector: inj,
+		Flags:    node.FlagSet{chainAddrFlag: chainAddr, chainRosterFlag: rosterPath},
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(p.handler))
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+// testSecret is a secret encrypted for the committee.
+type testSecret struct {
+	msg       []byte
+	ctext     calypso.Ciphertext
+	K         kyber.Point
+	encrypted string
+}
+
+// newSecret returns a new random secret encrypted for the committee.
+func (c *testCommittee) newSecret(t *testing.T) testSecret {
+	msg := make([]byte, 32)
+	suite.RandomStream().XORKeyStream(msg, msg)
+
+	buf, err := calypso.EncryptSecret([]byte(hexPoint(t, c.pubkey)), []byte("doc"), msg)
+	require.NoError(t, err)
+
+	ctext, err := calypso.DecodeCiphertext(buf)
+	require.NoError(t, err)
+
+	K, err := ctext.Key()
+	require.NoError(t, err)
+
+	return testSecret{msg: msg, ctext: ctext, K: K, encrypted: string(buf)}
+}
+
+// token returns the access token of the reveal of the secret to the reader.
+func (c *testCommittee) token(secret testSecret, reader testReader) []byte {
+	smcKey, _ := c.pubkey.MarshalBinary()
+	pubk, _ := reader.pubk.MarshalBinary()
+
+	return calypso.AccessToken([]byte(hex.EncodeToString(smcKey)),
+		[]byte(secret.encrypted), []byte(hex.EncodeToString(pubk)))
+}
+
+// makeProof returns the JSON reveal proof of the secret to the reader, signed
+// by the chain.
+func (c *testCommittee) makeProof(t *testing.T, secret testSecret, reader testReader) string {
+	token := c.token(secret, reader)
+
+	access := calypso.SecretAccess{
+		Reader:    []byte(hexPoint(t, reader.pubk)),
+		FirstSeen: 3,
+		LastSeen:  3,
+		Reveals:   1,
+	}
+
+	share, err := calypso.NewRevealShare(c.chain, token, access, time.Now().Unix())
+	require.NoError(t, err)
+
+	proof, err := calypso.CombineRevealShares(c.chainRoster, []calypso.RevealShare{share})
+	require.NoError(t, err)
+
+	buf, err := json.Marshal(proof)
+	require.NoError(t, err)
+
+	return string(buf)
+}
+
+// makeRequest returns the form values of the reencryption of the secret for
+// the reader to the node i, signed by the signer.
+func (c *testCommittee) makeRequest(t *testing.T, i int, reader testReader,
+	secret testSecret, signer testReader) url.Values {
+
+	addr, err := c.minos[i].GetAddress().MarshalText()
+	require.NoError(t, err)
+
+	req, err := smc.NewReencryptRequest([]byte("doc"), addr, secret.K, reader.pubk)
+	require.NoError(t, err)
+
+	sig, err := req.Sign(signer.privk)
+	require.NoError(t, err)
+
+	form := req.Values(sig)
+	form.Set("pubk", hexPoint(t, reader.pubk))
+	form.Set("encrypted", secret.encrypted)
+	form.Set("proof", c.makeProof(t, secret, reader))
+
+	return form
+}
+
+// getPublicShares returns the public shares of the nodes, indexed by share
+// index. They are the reencryption shares of K = G for pubk = 0.
+func (c *testCommittee) getPublicShares(t *testing.T) map[int]kyber.Point {
+	shares, err := c.actors[0].(*smcdkg.Actor).ReencryptShares(suite.Point().Base(),
+		suite.Point().Null())
+	require.NoError(t, err)
+
+	publicShares := make(map[int]kyber.Point)
+
+	for _, s := range shares {
+		Xi := suite.Point()
+		require.NoError(t, Xi.UnmarshalBinary(s.Ui))
+
+		publicShares[s.Index] = Xi
+	}
+
+	return publicShares
+}
+
+// testReader is the key pair of a reader.
+type testReader struct {
+	privk kyber.Scalar
+	pubk  kyber.Point
+}
+
+func newTestReader() testReader {
+	privk := suite.Scalar().Pick(suite.RandomStream())
+
+	return testReader{privk: privk, pubk: suite.Point().Mul(privk, nil)}
+}
+
+// postForm posts the form values to the reencryption endpoint of the node.
+func postForm(t *testing.T, nodeURL string, form url.Values) *http.Response {
+	resp, err := http.PostForm(nodeURL+"/smc/reencrypt", form)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+// readBody returns the body of the response.
+func readBody(t *testing.T, resp *http.Response) string {
+	buf, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return string(buf)
+}
+
+// requireStatus checks the status and the body of the response.
+func requireStatus(t *testing.T, resp *http.Response, status int, body string) {
+	buf := readBody(t, resp)
+
+	require.Equal(t, status, resp.StatusCode, buf)
+	require.Equal(t, body, buf)
+}
+
+// decodeJSON checks the status of the response, and decodes its JSON body.
+func decodeJSON(t *testing.T, resp *http.Response, status int, v interface{}) {
+	buf := readBody(t, resp)
+
+	require.Equal(t, status, resp.StatusCode, buf)
+	require.NoError(t, json.Unmarshal([]byte(buf), v))
+}
+
+func hexPoint(t *testing.T, p kyber.Point) string {
+	buf, err := p.MarshalBinary()
+	require.NoError(t, err)
+
+	return hex.EncodeToString(buf)
+}
+
+// delaActor hides the shares and the batches of the actor, like the actor of
+// dela.
+//
+// - implements dkg.Actor
+type delaActor struct {
+	dkg.Actor
+}
+
+// fakeProxy keeps the handler registered by the action.
+//
+// - implements proxy.Proxy
+type fakeProxy struct {
+	proxy.Proxy
+
+	handler func(http.ResponseWriter, *http.Request)
+}
+
+// RegisterHandler implements proxy.Proxy.
+func (p *fakeProxy) RegisterHandler(path string, h func(http.ResponseWriter, *http.Request)) {
+	p.handler = h
+}
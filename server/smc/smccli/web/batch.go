@@ -0,0 +1,193 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.dedis.ch/dela"
+	"go.dedis.ch/dela/dkg"
+	"go.dedis.ch/hbt/server/smc"
+	"go.dedis.ch/kyber/v3"
+	"golang.org/x/xerrors"
+)
+
+// maxBatchSize is the maximum number of items of a batch.
+const maxBatchSize = 256
+
+// batchConcurrency is the maximum number of items of a batch processed at the
+// same time.
+const batchConcurrency = 8
+
+// batchReencrypter is implemented by the DKG actors that reencrypt many
+// ciphertexts in a single round-trip across the committee. The items are
+// reencrypted one by one otherwise.
+type batchReencrypter interface {
+	ReencryptBatch(Ks []kyber.Point, pubk kyber.Point) ([]kyber.Point, error)
+}
+
+// batchHandler serves POST /smc/reencrypt/batch. The items are checked as
+// single reencryption requests, and the result of each item is returned in
+// the order of the request.
+type batchHandler struct {
+	re *reencryptHandler
+}
+
+func (h *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var a dkg.Actor
+	err := h.re.ctx.Injector.Resolve(&a)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to resolve DKG actor: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	var req smc.ReencryptBatchRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode batch: %v", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Items) == 0 {
+		http.Error(w, "empty batch", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Items) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("too many items (%d > %d)", len(req.Items), maxBatchSize),
+			http.StatusBadRequest)
+		return
+	}
+
+	results := make([]smc.ReencryptBatchResult, len(req.Items))
+	items := make([]reencryptItem, len(req.Items))
+
+	forEach(len(req.Items), func(i int) {
+		item, status, err := h.re.check(a, req.Items[i].Values(req.PubK))
+		if err != nil {
+			results[i] = smc.ReencryptBatchResult{Status: status, Error: err.Error()}
+			return
+		}
+
+		items[i] = item
+		results[i].Status = http.StatusCreated
+	})
+
+	hatencs, errs := reencryptBatch(a, items, results)
+
+	forEach(len(items), func(i int) {
+		if results[i].Status != http.StatusCreated {
+			return
+		}
+
+		if errs[i] != nil {
+			results[i] = smc.ReencryptBatchResult{
+				Status: http.StatusInternalServerError,
+				Error:  fmt.Sprintf("failed to re-encrypt: %v", errs[i]),
+			}
+			return
+		}
+
+		response, err := makeReencryptResponse(a, items[i], hatencs[i])
+		if err != nil {
+			results[i] = smc.ReencryptBatchResult{
+				Status: http.StatusInternalServerError,
+				Error:  err.Error(),
+			}
+			return
+		}
+
+		results[i].Response = &response
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(results)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	dela.Logger.Debug().Msgf("Re-encrypted a batch of %d messages", len(items))
+}
+
+// reencryptBatch reencrypts the items that passed the checks, in a single
+// round-trip if the actor supports it. It returns the reencrypted key or the
+// error of each item.
+func reencryptBatch(a dkg.Actor, items []reencryptItem,
+	results []smc.ReencryptBatchResult) ([]kyber.Point, []error) {
+
+	hatencs := make([]kyber.Point, len(items))
+	errs := make([]error, len(items))
+
+	br, ok := a.(batchReencrypter)
+	if !ok {
+		forEach(len(items), func(i int) {
+			if results[i].Status == http.StatusCreated {
+				hatencs[i], errs[i] = a.Reencrypt(items[i].k, items[i].pubk)
+			}
+		})
+
+		return hatencs, errs
+	}
+
+	var indices []int
+	var Ks []kyber.Point
+
+	for i, item := range items {
+		if results[i].Status == http.StatusCreated {
+			indices = append(indices, i)
+			Ks = append(Ks, item.k)
+		}
+	}
+
+	if len(Ks) == 0 {
+		return hatencs, errs
+	}
+
+	// every item of a batch is for the same reader
+	pubk := items[indices[0]].pubk
+
+	res, err := br.ReencryptBatch(Ks, pubk)
+	if err == nil && len(res) != len(Ks) {
+		err = xerrors.Errorf("got %d results for %d items", len(res), len(Ks))
+	}
+
+	for j, i := range indices {
+		if err != nil {
+			errs[i] = err
+		} else {
+			hatencs[i] = res[j]
+		}
+	}
+
+	return hatencs, errs
+}
+
+// forEach calls fn for each index in [0, n), with at most batchConcurrency
+// calls at the same time.
+func forEach(n int, fn func(i int)) {
+	sem := make(chan struct{}, batchConcurrency)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/hbt/server/smc"
+)
+
+func TestBatchHandler_ServeHTTP(t *testing.T) {
+	committee := newTestCommittee(t, 4, 3)
+	nd := committee.startNode(t, 0, "")
+
+	reader := newTestReader()
+	secrets := []testSecret{committee.newSecret(t), committee.newSecret(t), committee.newSecret(t)}
+
+	req := committee.makeBatch(t, 0, reader, secrets)
+
+	// the reveal of the second secret is for another reader
+	req.Items[1].Proof = committee.makeProof(t, secrets[1], newTestReader())
+
+	var results []smc.ReencryptBatchResult
+
+	decodeJSON(t, postBatch(t, nd, req), http.StatusOK, &results)
+	require.Len(t, results, 3)
+
+	require.Equal(t, smc.ReencryptBatchResult{
+		Status: http.StatusForbidden,
+		Error:  "access refused: invalid reveal proof: proof is for another access token",
+	}, results[1])
+
+	publicShares := committee.getPublicShares(t)
+
+	for _, i := range []int{0, 2} {
+		require.Equal(t, http.StatusCreated, results[i].Status, results[i].Error)
+
+		// each item is reencrypted with its own key, and has its shares
+		XhatEnc, invalid, err := smc.RecoverXhatEnc(committee.pubkey, secrets[i].K,
+			reader.pubk, publicShares, results[i].Response.Shares)
+		require.NoError(t, err)
+		require.Empty(t, invalid)
+		require.Equal(t, hexPoint(t, XhatEnc), results[i].Response.XhatEnc)
+	}
+
+	// the items are not replayed
+	results = nil
+
+	decodeJSON(t, postBatch(t, nd, req), http.StatusOK, &results)
+
+	for _, res := range results {
+		require.Equal(t, http.StatusForbidden, res.Status)
+		require.Nil(t, res.Response)
+	}
+
+	require.Equal(t, "access refused: replayed request", results[0].Error)
+}
+
+func TestBatchHandler_ServeHTTP_DelaActor(t *testing.T) {
+	committee := newTestCommittee(t, 3, 2)
+
+	// the items are reencrypted one by one with the actor of dela
+	committee.actors[0] = delaActor{Actor: committee.actors[0]}
+
+	nd := committee.startNode(t, 0, "")
+
+	reader := newTestReader()
+	secrets := []testSecret{committee.newSecret(t), committee.newSecret(t)}
+
+	var results []smc.ReencryptBatchResult
+
+	decodeJSON(t, postBatch(t, nd, committee.makeBatch(t, 0, reader, secrets)),
+		http.StatusOK, &results)
+	require.Len(t, results, 2)
+
+	for i, res := range results {
+		require.Equal(t, http.StatusCreated, res.Status, res.Error)
+		require.Empty(t, res.Response.Shares)
+
+		expected, err := committee.actors[1].Reencrypt(secrets[i].K, reader.pubk)
+		require.NoError(t, err)
+		require.Equal(t, hexPoint(t, expected), res.Response.XhatEnc)
+	}
+}
+
+func TestBatchHandler_ServeHTTP_BadRequest(t *testing.T) {
+	committee := newTestCommittee(t, 3, 2)
+	nd := committee.startNode(t, 0, "")
+
+	requireStatus(t, postBatch(t, nd, smc.ReencryptBatchRequest{}), http.StatusBadRequest,
+		"empty batch\n")
+
+	req := smc.ReencryptBatchRequest{Items: make([]smc.ReencryptBatchItem, maxBatchSize+1)}
+
+	requireStatus(t, postBatch(t, nd, req), http.StatusBadRequest,
+		fmt.Sprintf("too many items (%d > %d)\n", maxBatchSize+1, maxBatchSize))
+
+	resp, err := http.Post(nd+"/smc/reencrypt/batch", "application/json",
+		strings.NewReader("[]"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, readBody(t, resp), "failed to decode batch: ")
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// makeBatch returns the batch of the reencryptions of the secrets for the
+// reader to the node i.
+func (c *testCommittee) makeBatch(t *testing.T, i int, reader testReader,
+	secrets []testSecret) smc.ReencryptBatchRequest {
+
+	req := smc.ReencryptBatchRequest{PubK: hexPoint(t, reader.pubk)}
+
+	for _, secret := range secrets {
+		form := c.makeRequest(t, i, reader, secret, reader)
+
+		req.Items = append(req.Items, smc.ReencryptBatchItem{
+			Name:      form.Get("name"),
+			Encrypted: form.Get("encrypted"),
+			Proof:     form.Get("proof"),
+			Target:    form.Get("target"),
+			Timestamp: form.Get("timestamp"),
+			Nonce:     form.Get("nonce"),
+			Signature: form.Get("signature"),
+		})
+	}
+
+	return req
+}
+
+// postBatch posts the batch to the node.
+func postBatch(t *testing.T, nodeURL string, req smc.ReencryptBatchRequest) *http.Response {
+	buf, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	resp, err := http.Post(nodeURL+"/smc/reencrypt/batch", "application/json",
+		bytes.NewReader(buf))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
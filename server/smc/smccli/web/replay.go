@@ -0,0 +1,110 @@
+package web
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"go.dedis.ch/hbt/server/smc"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// requestWindow is how far the timestamp of a reencryption request can be
+	// from the clock of the node.
+	requestWindow = 5 * time.Minute
+
+	// bucketSpan is the range of timestamps of the requests whose nonces are
+	// stored in the same bucket.
+	bucketSpan = 30 * time.Second
+
+	// maxNonces is the number of nonces remembered at most, new requests are
+	// refused until the oldest expire.
+	maxNonces = 100000
+)
+
+// replayGuard refuses the reencryption requests that are stale or that were
+// already served. The nonces are remembered as long as their request is in
+// the window, older requests are refused because of their timestamp.
+//
+// The nonces are bucketed by the timestamp of their request so that a whole
+// bucket is dropped when it leaves the window.
+type replayGuard struct {
+	sync.Mutex
+
+	window time.Duration
+	span   time.Duration
+	limit  int
+	now    func() time.Time
+
+	// buckets maps the start of a range of timestamps to the nonces of the
+	// served requests in that range.
+	buckets map[int64]map[string]struct{}
+	size    int
+}
+
+// newReplayGuard returns a new guard with the default window.
+func newReplayGuard() *replayGuard {
+	return &replayGuard{
+		window:  requestWindow,
+		span:    bucketSpan,
+		limit:   maxNonces,
+		now:     time.Now,
+		buckets: make(map[int64]map[string]struct{}),
+	}
+}
+
+// check returns an error with the HTTP status to reply if the request is
+// stale or replayed, otherwise it remembers its nonce. It must be called once
+// the request is verified, so that only the served requests use the memory
+// of the guard.
+func (g *replayGuard) check(req smc.ReencryptRequest) (int, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	now := g.now()
+
+	ts := time.Unix(req.Timestamp, 0)
+	if ts.Before(now.Add(-g.window)) || ts.After(now.Add(g.window)) {
+		return http.StatusForbidden,
+			xerrors.Errorf("stale request: timestamp %d is out of the window",
+				req.Timestamp)
+	}
+
+	g.expire(now)
+
+	start := ts.Truncate(g.span).Unix()
+	nonce := string(req.Nonce)
+
+	// a replayed request has the same timestamp, so it is in the same bucket
+	_, found := g.buckets[start][nonce]
+	if found {
+		return http.StatusForbidden, xerrors.New("replayed request")
+	}
+
+	if g.size >= g.limit {
+		return http.StatusTooManyRequests, xerrors.New("too many pending requests")
+	}
+
+	bucket := g.buckets[start]
+	if bucket == nil {
+		bucket = make(map[string]struct{})
+		g.buckets[start] = bucket
+	}
+
+	bucket[nonce] = struct{}{}
+	g.size++
+
+	return http.StatusOK, nil
+}
+
+// expire drops the buckets whose requests are all out of the window.
+func (g *replayGuard) expire(now time.Time) {
+	for start, bucket := range g.buckets {
+		end := time.Unix(start, 0).Add(g.span)
+		if !end.After(now.Add(-g.window)) {
+			g.size -= len(bucket)
+			delete(g.buckets, start)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/hbt/server/smc"
+)
+
+func TestReplayGuard_Check(t *testing.T) {
+	now := time.Unix(1000000, 0)
+
+	g := newReplayGuard()
+	g.limit = 3
+	g.now = func() time.Time { return now }
+
+	request := func(ts time.Time, nonce string) smc.ReencryptRequest {
+		return smc.ReencryptRequest{Timestamp: ts.Unix(), Nonce: []byte(nonce)}
+	}
+
+	status, err := g.check(request(now, "a"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status)
+
+	status, err = g.check(request(now, "a"))
+	require.EqualError(t, err, "replayed request")
+	require.Equal(t, http.StatusForbidden, status)
+
+	_, err = g.check(request(now.Add(-time.Minute), "b"))
+	require.NoError(t, err)
+
+	_, err = g.check(request(now.Add(-4*time.Minute), "c"))
+	require.NoError(t, err)
+	require.Len(t, g.buckets, 3)
+
+	// the guard is full
+	status, err = g.check(request(now, "d"))
+	require.EqualError(t, err, "too many pending requests")
+	require.Equal(t, http.StatusTooManyRequests, status)
+
+	status, err = g.check(request(now.Add(-6*time.Minute), "d"))
+	require.EqualError(t, err, "stale request: timestamp 999640 is out of the window")
+	require.Equal(t, http.StatusForbidden, status)
+
+	// the bucket of the oldest request leaves the window
+	now = now.Add(2 * time.Minute)
+
+	_, err = g.check(request(now, "d"))
+	require.NoError(t, err)
+	require.Len(t, g.buckets, 3)
+	require.Equal(t, 3, g.size)
+
+}
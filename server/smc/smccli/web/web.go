@@ -17,6 +17,14 @@ var proxyFac func(string) proxy.Proxy = http.NewHTTP
 
 const defaultProxyAddr = "127.0.0.1:3002"
 
+// chainAddrFlag is the flag name containing the address of the blockchain
+// proxy used to check the access tokens.
+const chainAddrFlag = "chainaddr"
+
+// chainRosterFlag is the flag name containing the path to the JSON roster of
+// the nodes of the chain signing the reveal proofs.
+const chainRosterFlag = "chainroster"
+
 // NewController returns a new controller initializer
 func NewController() node.Initializer {
 	return controller{}
@@ -36,6 +44,18 @@ func (m controller) SetCommands(builder node.Builder) {
 			Required: false,
 			Value:    defaultProxyAddr,
 		},
+		cli.StringFlag{
+			Name: chainAddrFlag,
+			Usage: "the address of the blockchain proxy, e.g. http://127.0.0.1:3003. " +
+				"If set, the access tokens are checked before re-encrypting",
+			Required: false,
+		},
+		cli.StringFlag{
+			Name: chainRosterFlag,
+			Usage: "the path to the JSON roster of the nodes of the chain. A reveal " +
+				"proof signed by the nodes is required before re-encrypting",
+			Required: true,
+		},
 	)
 }
 
@@ -70,8 +90,11 @@ func (m controller) OnStart(ctx cli.Flags, inj node.Injector) error {
 	register := RegisterAction{}
 	err := register.Execute(node.Context{
 		Injector: inj,
-		Flags:    node.FlagSet{},
-		Out:      os.Stdout,
+		Flags: node.FlagSet{
+			chainAddrFlag:   ctx.String(chainAddrFlag),
+			chainRosterFlag: ctx.String(chainRosterFlag),
+		},
+		Out: os.Stdout,
 	})
 
 	if err != nil {
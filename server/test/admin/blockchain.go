@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/rs/zerolog/log"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
 	"go.dedis.ch/hbt/server/registry/registry"
 	"go.dedis.ch/hbt/server/smc"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/suites"
+	"golang.org/x/xerrors"
 )
 
 const blockchainServer = "http://localhost:40001"
@@ -18,63 +22,132 @@ const blockchainServer = "http://localhost:40001"
 // suite is the Kyber suite for Pedersen.
 var suite = suites.MustFind("Ed25519")
 
-// BlockchainGetDocs polls the blockchain to get the list of encrypted documents
-// adminPubkey is the public key of the admin and is used for audit purpose
+// secretPage is a page of the secrets listed by the blockchain.
+type secretPage struct {
+	Total   uint64 `json:"total"`
+	Secrets []struct {
+		Name  []byte `json:"name"`
+		Smc   []byte `json:"smc"`
+		Value []byte `json:"value"`
+	} `json:"secrets"`
+}
+
+// BlockchainGetDocIDs polls the blockchain to get the list of encrypted
+// documents. adminPubkey is the public key of the admin and is used for audit
+// purpose.
 func BlockchainGetDocIDs(adminPubkey kyber.Point) []registry.RegistrationID {
 	encoded, err := adminPubkey.MarshalBinary()
 	if err != nil {
 		log.Fatal().Msgf("error: %v", err)
 	}
 
-	resp, err := http.Get(blockchainServer + "/secret/admin/list?pubkey=" + hex.EncodeToString(encoded))
+	items := []registry.RegistrationID{}
+
+	for {
+		query := url.Values{
+			"pubkey": {hex.EncodeToString(encoded)},
+			"offset": {strconv.Itoa(len(items))},
+		}
+
+		page, err := getSecretPage(query)
+		if err != nil {
+			log.Error().Msgf("Failed to fetch items: %v", err)
+			return nil
+		}
+
+		for _, secret := range page.Secrets {
+			items = append(items, registry.RegistrationID{ID: secret.Name})
+		}
+
+		if len(page.Secrets) == 0 || uint64(len(items)) >= page.Total {
+			break
+		}
+	}
+
+	// Printing the list of IDs
+	log.Info().Msg("List of IDs:")
+	for i, item := range items {
+		log.Info().Msgf("ID[%v] = %v", i, item.ID)
+	}
+
+	return items
+}
+
+// getSecretPage returns a page of the secrets listed by the blockchain.
+func getSecretPage(query url.Values) (secretPage, error) {
+	resp, err := http.Get(blockchainServer + "/secret/list?" + query.Encode())
 	if err != nil {
-		log.Fatal().Msgf("error: %v", err)
+		return secretPage{}, err
 	}
 
 	defer resp.Body.Close()
 
-	// Reading the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Error().Msgf("Error reading response body: %v", err)
-		return nil
+		return secretPage{}, xerrors.Errorf("failed to read response body: %v", err)
 	}
 
-	var items []registry.RegistrationID
-	// Checking if the request was successful (status code 200)
-	if resp.StatusCode == http.StatusOK {
-		// Parsing JSON data
-		if err := json.Unmarshal(body, &items); err != nil {
-			log.Error().Msgf("Error parsing JSON: %v", err)
-			return nil
-		}
+	if resp.StatusCode != http.StatusOK {
+		return secretPage{}, xerrors.Errorf("unexpected status %s: %s", resp.Status, body)
+	}
 
-		// Printing the list of IDs
-		log.Info().Msg("List of IDs:")
-		for i, item := range items {
-			log.Info().Msgf("ID[%v] = %v", i, item.ID)
-		}
-	} else {
-		log.Error().Msgf("Failed to fetch items. Status code:%v", resp.StatusCode)
+	var page secretPage
+
+	err = json.Unmarshal(body, &page)
+	if err != nil {
+		return secretPage{}, xerrors.Errorf("failed to parse JSON: %v", err)
 	}
 
-	return items
+	return page, nil
 }
 
-// BlockchainGetDocument polls the blockchain to get the encrypted document
-func BlockchainGetSecret(id registry.RegistrationID, pk kyber.Point) (smc.Secret, []byte) {
+// BlockchainGetSecret reveals the encrypted document to the admin. The reveal
+// is signed by the admin and committed on the blockchain, and its proof is
+// returned for the SMC.
+func BlockchainGetSecret(id registry.RegistrationID, pk kyber.Point,
+	sk kyber.Scalar) (smc.Secret, []byte) {
+
 	encodedPk, err := pk.MarshalBinary()
 	if err != nil {
 		log.Fatal().Msgf("error: %v", err)
 	}
 
-	resp, err := http.Get(blockchainServer + "/secret/admin?pubkey=" + string(encodedPk) + "&id=" + string(id.ID))
+	reader := hex.EncodeToString(encodedPk)
+
+	token, err := getAccessToken(id, reader)
+	if err != nil {
+		log.Fatal().Msgf("error: %v", err)
+	}
+
+	nonce, err := getRevealNonce(token)
+	if err != nil {
+		log.Fatal().Msgf("error: %v", err)
+	}
+
+	sig, err := calypso.RevealRequest{Token: token, Nonce: nonce}.Sign(sk)
+	if err != nil {
+		log.Fatal().Msgf("error: %v", err)
+	}
+
+	form := url.Values{
+		"pubkey":    {reader},
+		"id":        {string(id.ID)},
+		"nonce":     {strconv.FormatUint(nonce, 10)},
+		"signature": {hex.EncodeToString(sig)},
+	}
+
+	resp, err := http.PostForm(blockchainServer+"/secret/admin", form)
 	if err != nil {
 		log.Fatal().Msgf("error: %v", err)
 	}
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		log.Fatal().Msgf("failed to reveal secret: %s: %s", resp.Status, msg)
+	}
+
 	// Decode the response
 	var secret smc.Secret
 	err = json.NewDecoder(resp.Body).Decode(&secret)
@@ -82,5 +155,60 @@ func BlockchainGetSecret(id registry.RegistrationID, pk kyber.Point) (smc.Secret
 		log.Error().Msgf("error decoding response: %v", err)
 	}
 
-	return secret, nil
+	return secret, secret.Proof
+}
+
+// getAccessToken returns the access token of the reveal of the document to the
+// reader, computed from the secret listed by the blockchain.
+func getAccessToken(id registry.RegistrationID, reader string) ([]byte, error) {
+	offset := 0
+
+	for {
+		page, err := getSecretPage(url.Values{"offset": {strconv.Itoa(offset)}})
+		if err != nil {
+			return nil, xerrors.Errorf("failed to list secrets: %v", err)
+		}
+
+		for _, secret := range page.Secrets {
+			if string(secret.Name) == string(id.ID) {
+				return calypso.AccessToken(secret.Smc, secret.Value, []byte(reader)), nil
+			}
+		}
+
+		offset += len(page.Secrets)
+
+		if len(page.Secrets) == 0 || uint64(offset) >= page.Total {
+			return nil, xerrors.Errorf("secret '%s' not found", id.ID)
+		}
+	}
+}
+
+// getRevealNonce returns the number of reveals recorded for the access token,
+// which the reader signs in its next reveal.
+func getRevealNonce(token []byte) (uint64, error) {
+	resp, err := http.Get(blockchainServer + "/secret/access?" +
+		url.Values{"token": {hex.EncodeToString(token)}}.Encode())
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return 0, xerrors.Errorf("unexpected status %s: %s", resp.Status, msg)
+	}
+
+	var access calypso.SecretAccess
+
+	err = json.NewDecoder(resp.Body).Decode(&access)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to decode access: %v", err)
+	}
+
+	return access.Reveals, nil
 }
@@ -1,27 +1,59 @@
 package admin
 
 import (
-	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net/http"
-	"strings"
 
 	"github.com/rs/zerolog/log"
-	"go.dedis.ch/dela"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
+	"go.dedis.ch/hbt/server/smc"
 	"go.dedis.ch/kyber/v3"
-	"go.dedis.ch/kyber/v3/suites"
-	"golang.org/x/xerrors"
 )
 
 const smcServer = "localhost:3002"
 
 // SmcReencryptSecret re-encrypts the secret with the new public key
 // and returns a xhatenc value that can be used to reveal the secret
-// first argument is supposed to be the proof
-func SmcReencryptSecret(_ []byte, pk kyber.Point, secret string) (kyber.Point, error) {
-	resp, err := http.Post(smcServer+"/reencrypt", "application/json",
-		bytes.NewBuffer([]byte(`{"pubk": "`+encodePublickey(pk)+`", "encrypted": "`+secret+`"}`)))
+// first argument is the JSON reveal proof required by the SMC, if any
+// the request is signed with the private key of the admin
+func SmcReencryptSecret(
+	proof []byte,
+	name []byte,
+	pk kyber.Point,
+	sk kyber.Scalar,
+	secret string,
+) (kyber.Point, error) {
+	k, err := decodeEncryptedKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := getSmcAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := smc.NewReencryptRequest(name, target, k, pk)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := req.Sign(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	form := req.Values(sig)
+	form.Set("pubk", encodePublickey(pk))
+	form.Set("encrypted", secret)
+
+	if len(proof) > 0 {
+		form.Set("proof", string(proof))
+	}
+
+	resp, err := http.PostForm(smcServer+"/smc/reencrypt", form)
 	if err != nil {
 		log.Error().Msgf("error: %v", err)
 		return nil, err
@@ -29,15 +61,16 @@ func SmcReencryptSecret(_ []byte, pk kyber.Point, secret string) (kyber.Point, e
 
 	defer resp.Body.Close()
 
-	// Decode the response
-	var xhatenc string
-	err = json.NewDecoder(resp.Body).Decode(&xhatenc)
+	// Decode the response, the shares are not verified as the test does not
+	// know the public shares of the nodes
+	var response smc.ReencryptResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
 		log.Error().Msgf("error decoding response: %v", err)
 		return nil, err
 	}
 
-	xhatencbuff, err := decodeReencrypted(xhatenc)
+	xhatencbuff, err := decodeReencrypted(response.XhatEnc)
 	if err != nil {
 		log.Error().Msgf("error decoding response: %v", err)
 		return nil, err
@@ -46,6 +79,20 @@ func SmcReencryptSecret(_ []byte, pk kyber.Point, secret string) (kyber.Point, e
 	return xhatencbuff, nil
 }
 
+// getSmcAddress returns the address of the SMC node, which is part of the
+// signed request
+func getSmcAddress() ([]byte, error) {
+	resp, err := http.Get(smcServer + "/smc/address")
+	if err != nil {
+		log.Error().Msgf("error: %v", err)
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
 func encodePublickey(pk kyber.Point) string {
 	pkbuff, err := pk.MarshalBinary()
 	if err != nil {
@@ -93,85 +140,28 @@ func SmcGetKey() kyber.Point {
 	return data
 }
 
-// SmcReveal decrypts a reencrypted message.
+// SmcReveal decrypts a reencrypted message. The secrets stored on the
+// blockchain are versioned ciphertexts.
 func SmcReveal(
 	XhatEnc kyber.Point,
 	dkgPk kyber.Point,
 	userPrivateKey kyber.Scalar,
 	secret string,
 ) ([]byte, error) {
-	_, Cs, err := decodeEncrypted(secret)
+	ctext, err := calypso.DecodeCiphertext([]byte(secret))
 	if err != nil {
-		log.Fatal().Msgf("error: %v", err)
-	}
-
-	log.Info().Msgf("XhatEnc:%v", XhatEnc)
-	log.Info().Msgf("dkgPk:%v", dkgPk)
-	log.Info().Msgf("Cs:%v", Cs)
-
-	suite := suites.MustFind("Ed25519")
-
-	xcInv := suite.Scalar().Neg(userPrivateKey)
-	XhatDec := suite.Point().Mul(xcInv, dkgPk)
-	Xhat := suite.Point().Add(XhatEnc, XhatDec)
-	XhatInv := suite.Point().Neg(Xhat)
-
-	msg := make([]byte, 0, 128*len(Cs))
-
-	// Decrypt Cs to keyPointHat
-	for _, C := range Cs {
-		keyPointHat := suite.Point().Add(C, XhatInv)
-		keyPart, err := keyPointHat.Data()
-		if err != nil {
-			e := xerrors.Errorf("Error while decrypting Cs: %v", err)
-			dela.Logger.Error().Err(e).Msg("Failed revealing message")
-			return nil, e
-		}
-		msg = append(msg, keyPart...)
+		return nil, err
 	}
 
-	return msg, nil
+	return ctext.Reveal(XhatEnc, dkgPk, userPrivateKey)
 }
 
-// straight from pedersen/controller/action
-func decodeEncrypted(str string) (kyber.Point, []kyber.Point, error) {
-	const separator = ":"
-	parts := strings.Split(str, separator)
-	if len(parts) < 2 {
-		return nil, nil, xerrors.Errorf("malformed encoded: %s", str)
-	}
-
-	// Decode K
-	kbuff, err := hex.DecodeString(parts[0])
-	if err != nil {
-		return nil, nil, xerrors.Errorf("failed to decode k point: %v", err)
-	}
-
-	k := suite.Point()
-
-	err = k.UnmarshalBinary(kbuff)
+// decodeEncryptedKey returns the ephemeral key K of the encrypted secret.
+func decodeEncryptedKey(str string) (kyber.Point, error) {
+	ctext, err := calypso.DecodeCiphertext([]byte(str))
 	if err != nil {
-		return nil, nil, xerrors.Errorf("failed to unmarshal k point: %v", err)
-	}
-
-	// Decode Cs
-	cs := make([]kyber.Point, 0, len(parts)-1)
-
-	for _, p := range parts[1:] {
-		cbuff, err := hex.DecodeString(p)
-		if err != nil {
-			return nil, nil, xerrors.Errorf("failed to decode c point: %v", err)
-		}
-
-		c := suite.Point()
-
-		err = c.UnmarshalBinary(cbuff)
-		if err != nil {
-			return nil, nil, xerrors.Errorf("failed to unmarshal c point: %v", err)
-		}
-
-		cs = append(cs, c)
+		return nil, err
 	}
 
-	return k, cs, nil
+	return ctext.Key()
 }
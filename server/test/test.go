@@ -52,10 +52,10 @@ func main() {
 	docIDs := admin.BlockchainGetDocIDs(pk)
 
 	for _, id := range docIDs {
-		secret, proof := admin.BlockchainGetSecret(id, pk)
+		secret, proof := admin.BlockchainGetSecret(id, pk, sk)
 		log.Info().Msgf("secret: %v", secret)
 
-		xhatenc, err := admin.SmcReencryptSecret(proof, pk, secret.Data)
+		xhatenc, err := admin.SmcReencryptSecret(proof, id.ID, pk, sk, secret.Data)
 		if err != nil {
 			log.Fatal().Msgf("error: %v", err)
 		}
@@ -65,7 +65,7 @@ func main() {
 			log.Fatal().Msg("SMC key mismatch")
 		}
 
-		// secret.Data = K:Cs in a string format
+		// secret.Data is the JSON ciphertext of the secret
 		symKey2, err := admin.SmcReveal(xhatenc, smcKey, sk, secret.Data)
 		if err != nil {
 			log.Fatal().Msgf("error: %v", err)
@@ -3,16 +3,16 @@ package user
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"io"
 	"mime/multipart"
 	"net/http"
 
 	"github.com/rs/zerolog/log"
-	"go.dedis.ch/dela"
+	"go.dedis.ch/hbt/server/blockchain/calypso"
 	"go.dedis.ch/hbt/server/registry/registry"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/suites"
-	"golang.org/x/xerrors"
 )
 
 const blockchainServer = "http://localhost:40001"
@@ -25,8 +25,15 @@ func BlockchainEncryptAndAddSecret(
 	secret []byte,
 	id registry.RegistrationID,
 ) string {
-	// Encrypt the secret
-	encryptedSecret, err := encryptToKCs(key, secret)
+	keybuff, err := key.MarshalBinary()
+	if err != nil {
+		log.Fatal().Msgf("error: %v", err)
+	}
+
+	smcKey := hex.EncodeToString(keybuff)
+
+	// Encrypt the secret, the proof binds it to the SMC key and the ID
+	encryptedSecret, err := calypso.EncryptSecret([]byte(smcKey), id.ID, secret)
 	if err != nil {
 		log.Fatal().Msgf("error: %v", err)
 	}
@@ -34,7 +41,16 @@ func BlockchainEncryptAndAddSecret(
 	var body bytes.Buffer
 	w := multipart.NewWriter(&body)
 
-	fw, err := w.CreateFormField("secret")
+	fw, err := w.CreateFormField("smckey")
+	if err != nil {
+		log.Fatal().Msgf("error: %v", err)
+	}
+	_, err = io.Copy(fw, bytes.NewReader([]byte(smcKey)))
+	if err != nil {
+		log.Fatal().Msgf("error: %v", err)
+	}
+
+	fw, err = w.CreateFormField("secret")
 	if err != nil {
 		log.Fatal().Msgf("error: %v", err)
 	}
@@ -69,59 +85,26 @@ func BlockchainEncryptAndAddSecret(
 
 	defer resp.Body.Close()
 
-	return encryptedSecret
-}
-
-func encryptToKCs(key kyber.Point, msg []byte) (string, error) {
-	// ElGamal-encrypt the point to produce ciphertext (K,C).
-	r := suite.Scalar().Pick(suite.RandomStream())
+	// the proxy waits for the block of the transaction
+	var status txStatus
 
-	K := suite.Point().Mul(r, nil)
-	dela.Logger.Debug().Msgf("K: %v", K.String())
-
-	C := suite.Point().Mul(r, key)
-	dela.Logger.Debug().Msgf("C: %v", C)
-
-	// S: ephemeral DH shared secret
-	S := suite.Point().Mul(r, key)
-	dela.Logger.Debug().Msgf("S: %v", S.String())
-
-	Cs := make([]kyber.Point, 0, 16)
-	for len(msg) > 0 {
-		kp := suite.Point().Embed(msg, suite.RandomStream())
-		dela.Logger.Debug().Msgf("kp: %v", kp.String())
-
-		// message blinded with secret
-		c := suite.Point().Add(C, kp)
-		dela.Logger.Debug().Msgf("c: %v", c)
-
-		Cs = append(Cs, c)
-		dela.Logger.Debug().Msgf("Cs: %v", Cs)
-
-		msg = msg[min(len(msg), kp.EmbedLen()):]
-	}
-
-	return encodeEncrypted(K, Cs)
-}
-
-// from pedersen/controller/action
-const separator = ":"
-
-func encodeEncrypted(k kyber.Point, cs []kyber.Point) (string, error) {
-	kbuff, err := k.MarshalBinary()
+	err = json.NewDecoder(resp.Body).Decode(&status)
 	if err != nil {
-		return "", xerrors.Errorf("failed to marshal k: %v", err)
+		log.Fatal().Msgf("unexpected response %s: %v", resp.Status, err)
 	}
 
-	encoded := hex.EncodeToString(kbuff)
-
-	for _, c := range cs {
-		cbuff, err := c.MarshalBinary()
-		if err != nil {
-			return "", xerrors.Errorf("failed to marshal c: %v", err)
-		}
-		encoded += separator + hex.EncodeToString(cbuff)
+	if status.Status != "accepted" {
+		log.Fatal().Msgf("secret not stored: transaction %s is %s: %s",
+			status.TxID, status.Status, status.Message)
 	}
 
-	return encoded, nil
+	return string(encryptedSecret)
+}
+
+// txStatus is the status of a transaction returned by the blockchain proxy.
+type txStatus struct {
+	TxID    string `json:"txid"`
+	Status  string `json:"status"`
+	Index   uint64 `json:"index"`
+	Message string `json:"message"`
 }